@@ -0,0 +1,82 @@
+package transx
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// RsyncArg is an rsync argument of a transfer with the origin of its setting, so that an unexpected
+// argument can be traced back to the option or the rule that added it.
+type RsyncArg struct {
+	Arg    string
+	Origin string // Option field that requested it (e.g., "RsyncOptions.Archive"), or the rule that added it
+	Auto   bool   // Whether transx added it by a rule (auto-detection or a default) rather than an option
+}
+
+// rsyncArgList collects rsync arguments with their origins, in command line order.
+type rsyncArgList []RsyncArg
+
+// option appends arguments requested by the option field.
+func (l *rsyncArgList) option(field string, args ...string) {
+	for _, arg := range args {
+		*l = append(*l, RsyncArg{Arg: arg, Origin: field})
+	}
+}
+
+// auto appends arguments added by the rule.
+func (l *rsyncArgList) auto(rule string, args ...string) {
+	for _, arg := range args {
+		*l = append(*l, RsyncArg{Arg: arg, Origin: rule, Auto: true})
+	}
+}
+
+// values returns the arguments of the list.
+func (l rsyncArgList) values() []string {
+	values := make([]string, len(l))
+	for i, arg := range l {
+		values[i] = arg.Arg
+	}
+	return values
+}
+
+// effectiveRsyncArgs returns the option arguments of the rsync transfer of the task with their origins,
+// as printed with Verbose and recorded in MigrationReport.EffectiveOptions. The arguments specific to
+// a leg or mode (e.g., the relay staging manifest exclude or an rsync batch file) are not included.
+func effectiveRsyncArgs(task DataMigrationModel) []RsyncArg {
+	_, args := buildRsyncArgList(task)
+	if task.wantsProgress() {
+		args.auto(progressRule(task), "--info=progress2")
+	}
+	return args
+}
+
+// progressRule returns the rule adding --info=progress2 to the transfer of the task.
+func progressRule(task DataMigrationModel) string {
+	if task.RsyncOptions.OnProgress != nil {
+		return "RsyncOptions.OnProgress"
+	}
+	if task.RsyncOptions.onProgress != nil {
+		return "progress consumer attached"
+	}
+	return "RsyncOptions.StallTimeout: output to watch"
+}
+
+// printEffectiveRsyncArgs writes the arguments as a table of one argument (with the value of -e) per
+// line with its origin, indented by indent.
+func printEffectiveRsyncArgs(w io.Writer, args []RsyncArg, indent string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i := 0; i < len(args); i++ {
+		arg := args[i].Arg
+		if arg == "-e" && i+1 < len(args) && args[i+1].Origin == args[i].Origin {
+			i++
+			arg += " " + args[i].Arg
+		}
+		kind := "option"
+		if args[i].Auto {
+			kind = "auto"
+		}
+		fmt.Fprintf(tw, "%s%s\t%s\t%s\n", indent, arg, kind, args[i].Origin)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,145 @@
+package transx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit results (see AuditRecord.Result).
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditRecord is the audit entry of a command executed by transx: a backup, pre-transfer, restore,
+// or probe command run with executeCommand, or a command of the transfer (rsync, tar, and the relay
+// source cleanup).
+type AuditRecord struct {
+	Time     time.Time // When the command finished
+	Actor    string    // DataMigrationModel.Actor, or the local OS user if it is not set
+	Hosts    []string  // Remote hosts the command ran against (empty for a local command)
+	Command  string    // Command line, redacted like OperationError.Redacted, with secrets (e.g., "password=...") redacted
+	Result   string    // AuditSuccess or AuditFailure
+	ExitCode int       // Exit code of the command, or -1 if it did not exit normally (0 on success)
+	Error    string    // Error message if the command failed
+}
+
+// AuditLogger receives an AuditRecord for each command executed by transx (see WorkflowOption.AuditLogger).
+// It is separate from the operational output on stdout, so it can be directed to a tamper-evident sink.
+// An error fails the audited operation, so that no command runs unaudited past a broken sink.
+type AuditLogger interface {
+	Audit(record AuditRecord) error
+}
+
+// AuditLoggerFunc adapts a function to the AuditLogger interface.
+type AuditLoggerFunc func(record AuditRecord) error
+
+// Audit calls f(record).
+func (f AuditLoggerFunc) Audit(record AuditRecord) error {
+	return f(record)
+}
+
+// jsonAuditLogger writes each record as a line of JSON.
+type jsonAuditLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONAuditLogger returns an AuditLogger that writes each record to w as a line of JSON.
+// Writes are serialized, so w may be shared by the concurrent tasks of a batch.
+func NewJSONAuditLogger(w io.Writer) AuditLogger {
+	return &jsonAuditLogger{w: w}
+}
+
+func (l *jsonAuditLogger) Audit(record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(data, '\n'))
+	return err
+}
+
+// auditTrail records the commands of a task with its AuditLogger. It is nil-safe.
+type auditTrail struct {
+	logger    AuditLogger
+	actor     string
+	endpoints []EndpointDetails // Endpoints of the task, whose hosts, usernames, and paths are redacted
+	secrets   []string          // Resolved secret values of the command being run (see SecretsProvider)
+}
+
+// attachAuditTrail sets up the audit trail of the task's commands if WorkflowOptions.AuditLogger is set
+// and the task does not have one yet.
+func (task *DataMigrationModel) attachAuditTrail() {
+	if task.WorkflowOptions.AuditLogger == nil || task.RsyncOptions.audit != nil {
+		return
+	}
+	actor := strings.TrimSpace(task.Actor)
+	if actor == "" {
+		if u, err := user.Current(); err == nil {
+			actor = u.Username
+		}
+	}
+	task.RsyncOptions.audit = &auditTrail{
+		logger:    task.WorkflowOptions.AuditLogger,
+		actor:     actor,
+		endpoints: task.endpoints(),
+	}
+}
+
+// record writes the audit record of a command run against the endpoints that finished with err,
+// and returns err, joined with the error of the AuditLogger if it failed.
+func (a *auditTrail) record(command string, err error, endpoints ...EndpointDetails) error {
+	if a == nil {
+		return err
+	}
+	r := newRedactor(a.endpoints)
+	record := AuditRecord{
+		Time:    time.Now(),
+		Actor:   a.actor,
+		Hosts:   remoteHosts(endpoints...),
+		Command: redactSecrets(r.redact(hideSecrets(command, a.secrets))),
+		Result:  AuditSuccess,
+	}
+	if err != nil {
+		record.Result = AuditFailure
+		record.ExitCode = exitCode(err)
+		record.Error = redactSecrets(r.redact(hideSecrets(err.Error(), a.secrets)))
+	}
+	if auditErr := a.logger.Audit(record); auditErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to write the audit record of '%s': %w", record.Command, auditErr))
+	}
+	return err
+}
+
+// withSecrets returns a copy of the trail that also redacts the resolved secret values.
+func (a *auditTrail) withSecrets(secrets []string) *auditTrail {
+	if a == nil || len(secrets) == 0 {
+		return a
+	}
+	trail := *a
+	trail.secrets = secrets
+	return &trail
+}
+
+// remoteHosts returns the hosts of the remote endpoints (the hosts of container endpoints).
+func remoteHosts(endpoints ...EndpointDetails) []string {
+	var hosts []string
+	for _, e := range endpoints {
+		if e.isContainer() {
+			e = e.hostEndpoint()
+		}
+		if e.isRemote() && strings.TrimSpace(e.HostIP) != "" {
+			hosts = append(hosts, e.HostIP)
+		}
+	}
+	return hosts
+}
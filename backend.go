@@ -0,0 +1,211 @@
+package transx
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransferBackend moves the data of a task in place of rsync (see DataMigrationModel.Backend), e.g.,
+// an accelerated transfer tool. The workflow around the transfer (validation, preflight checks,
+// backup and restore commands, hooks, reports) is kept. Steps that run rsync themselves, such as
+// verification, the delta preview, and the free-space check of a relay staging directory, still
+// run rsync; disable them for endpoints without it.
+type TransferBackend interface {
+	// Capabilities returns what the backend can transfer; Validate refuses other tasks before
+	// the backend's own Validate is called.
+	Capabilities() BackendCapabilities
+
+	// Validate checks that the backend can honor the task, e.g., rejecting rsync options it ignores.
+	Validate(task DataMigrationModel) error
+
+	// Estimate returns what the transfer would write, for the free-space preflight check.
+	Estimate(task DataMigrationModel) (*TransferEstimate, error)
+
+	// Transfer moves the data of a validated task. A nil result is reported as an empty one, and a
+	// zero Duration is replaced by the time Transfer took.
+	Transfer(ctx context.Context, task DataMigrationModel, callbacks TransferCallbacks) (*TransferResult, error)
+}
+
+// BackendCapabilities declares the tasks a TransferBackend can transfer.
+type BackendCapabilities struct {
+	// Topologies are the topologies the backend transfers. Between two remote endpoints, a backend
+	// declaring RemoteToRemotePush but not RemoteToRemoteRelay makes the task's Topology the push one.
+	Topologies []Topology
+	Containers bool // Whether the backend transfers to and from container endpoints
+}
+
+// TransferEstimate is what a transfer would write, as estimated by TransferBackend.Estimate.
+type TransferEstimate struct {
+	Bytes       int64 // Bytes written (an upper bound for updated files; -1 if unknown)
+	Entries     int64 // Entries (files, directories, links) created (-1 if unknown)
+	LargestFile int64 // Size of the largest file written (-1 if unknown)
+}
+
+// TransferCallbacks are the callbacks of the task that a TransferBackend reports to.
+type TransferCallbacks struct {
+	OnProgress ProgressFunc // Called with each progress snapshot (nil if nobody listens; see RsyncOption.OnProgress)
+	OnFile     FileFunc     // Called with each entry transferred (nil if nobody listens; see RsyncOption.OnFile)
+}
+
+// transferBackends holds the registered backends by name.
+var transferBackends = struct {
+	sync.RWMutex
+	byName map[string]TransferBackend
+}{byName: map[string]TransferBackend{BackendRsync: rsyncBackend{}}}
+
+// RegisterBackend makes a TransferBackend available under name for DataMigrationModel.Backend.
+// The built-in names ("rsync", "tar", and "sftp") are reserved, and a name can be registered once.
+func RegisterBackend(name string, backend TransferBackend) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("backend name must not be empty")
+	}
+	if backend == nil {
+		return fmt.Errorf("backend '%s' must not be nil", name)
+	}
+	if name == BackendTar || name == BackendSFTP {
+		return fmt.Errorf("backend name '%s' is reserved", name)
+	}
+	transferBackends.Lock()
+	defer transferBackends.Unlock()
+	if _, ok := transferBackends.byName[name]; ok {
+		return fmt.Errorf("backend '%s' is already registered", name)
+	}
+	transferBackends.byName[name] = backend
+	return nil
+}
+
+// Backends returns the names of the registered backends, sorted.
+func Backends() []string {
+	transferBackends.RLock()
+	defer transferBackends.RUnlock()
+	names := make([]string, 0, len(transferBackends.byName))
+	for name := range transferBackends.byName {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// backendName returns the name of the task's backend, rsync if Backend is empty.
+func (task *DataMigrationModel) backendName() string {
+	if strings.TrimSpace(task.Backend) == "" {
+		return BackendRsync
+	}
+	return task.Backend
+}
+
+// transferBackend returns the task's backend, or false if its name is not registered.
+func (task *DataMigrationModel) transferBackend() (TransferBackend, bool) {
+	transferBackends.RLock()
+	defer transferBackends.RUnlock()
+	backend, ok := transferBackends.byName[task.backendName()]
+	return backend, ok
+}
+
+// usesCustomBackend reports whether the task is transferred by a backend other than rsync.
+func (task *DataMigrationModel) usesCustomBackend() bool {
+	return task.backendName() != BackendRsync
+}
+
+// validateBackend checks that the task's backend is registered, declares the topology of the task
+// (and container support if needed), and accepts the task.
+func (task *DataMigrationModel) validateBackend() error {
+	backend, ok := task.transferBackend()
+	if !ok {
+		return fmt.Errorf("unknown backend '%s' (registered: %s)", task.Backend, strings.Join(Backends(), ", "))
+	}
+	if !task.usesCustomBackend() {
+		return nil
+	}
+	if len(task.RsyncOptions.FallbackBackends) > 0 {
+		return fmt.Errorf("FallbackBackends apply to rsync only; the %s backend does not fall back", task.Backend)
+	}
+	capabilities := backend.Capabilities()
+	if topology := task.Topology(); !slices.Contains(capabilities.Topologies, topology) {
+		return fmt.Errorf("the %s backend does not support the %s topology", task.Backend, topology)
+	}
+	if !capabilities.Containers && (task.Source.isContainer() || task.Destination.isContainer()) {
+		return fmt.Errorf("the %s backend does not support container endpoints", task.Backend)
+	}
+	if err := backend.Validate(*task); err != nil {
+		return fmt.Errorf("the %s backend cannot transfer the task: %w", task.Backend, err)
+	}
+	return nil
+}
+
+// EstimateTransfer validates the task and returns what its transfer would write, as estimated by
+// its backend (an rsync dry-run for rsync).
+func EstimateTransfer(task DataMigrationModel) (*TransferEstimate, error) {
+	if err := Validate(task); err != nil {
+		return nil, fmt.Errorf("rsync task validation failed: %w", err)
+	}
+	backend, _ := task.transferBackend()
+	return backend.Estimate(task)
+}
+
+// runCustomBackend transfers a validated task with its backend other than rsync.
+func runCustomBackend(ctx context.Context, task DataMigrationModel) (*TransferResult, error) {
+	backend, _ := task.transferBackend()
+	fmt.Printf("Transferring with the %s backend from '%s' to '%s'...\n", task.Backend, task.Source.displayPath(), task.Destination.displayPath())
+	start := time.Now()
+	result, err := backend.Transfer(ctx, task, TransferCallbacks{OnProgress: task.RsyncOptions.progressFunc(), OnFile: task.RsyncOptions.OnFile})
+	if err != nil {
+		return result, fmt.Errorf("%s transfer failed: %w", task.Backend, err)
+	}
+	if result == nil {
+		result = &TransferResult{}
+	}
+	if result.Duration == 0 {
+		result.Duration = time.Since(start)
+	}
+	return result, nil
+}
+
+// rsyncBackend is the built-in TransferBackend of BackendRsync.
+type rsyncBackend struct{}
+
+func (rsyncBackend) Capabilities() BackendCapabilities {
+	return BackendCapabilities{
+		Topologies: []Topology{LocalToLocal, LocalToRemote, RemoteToLocal, RemoteToRemoteRelay},
+		Containers: true,
+	}
+}
+
+// Validate accepts any task; rsync's checks are part of Validate.
+func (rsyncBackend) Validate(task DataMigrationModel) error {
+	return nil
+}
+
+// Estimate sums the files an rsync dry-run would send and counts the entries it would create.
+func (rsyncBackend) Estimate(task DataMigrationModel) (*TransferEstimate, error) {
+	scan, err := scanDryRun(task)
+	if err != nil {
+		return nil, err
+	}
+	estimate := &TransferEstimate{}
+	for _, entry := range scan.Entries {
+		if entry.isDeletion() {
+			continue
+		}
+		if entry.isFileTransfer() {
+			estimate.Bytes += entry.Size // Sent files are written in full (an upper bound for updates)
+			estimate.LargestFile = max(estimate.LargestFile, entry.Size)
+		}
+		if strings.Contains(entry.Itemize, "+++++") {
+			estimate.Entries++ // Newly created entry
+		}
+	}
+	return estimate, nil
+}
+
+func (rsyncBackend) Transfer(ctx context.Context, task DataMigrationModel, callbacks TransferCallbacks) (*TransferResult, error) {
+	task.RsyncOptions.OnProgress = callbacks.OnProgress
+	task.RsyncOptions.onProgress = nil
+	task.RsyncOptions.OnFile = callbacks.OnFile
+	result, _, err := transferWithBackends(ctx, task)
+	return result, err
+}
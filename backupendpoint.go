@@ -0,0 +1,120 @@
+package transx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// backupEndpoint returns the endpoint Source.BackupCmd runs on: BackupEndpoint if set, otherwise the source.
+func (task *DataMigrationModel) backupEndpoint() EndpointDetails {
+	if task.BackupEndpoint != nil {
+		return *task.BackupEndpoint
+	}
+	return task.Source
+}
+
+// endpoints returns the endpoints the task runs commands on: the source, the destination, and
+// BackupEndpoint if set.
+func (task *DataMigrationModel) endpoints() []EndpointDetails {
+	endpoints := []EndpointDetails{task.Source, task.Destination}
+	if task.BackupEndpoint != nil {
+		endpoints = append(endpoints, *task.BackupEndpoint)
+	}
+	return endpoints
+}
+
+// sameEndpoint reports whether two endpoints run their commands as the same user on the same host
+// (and in the same container).
+func sameEndpoint(a, b EndpointDetails) bool {
+	return sameHost(a, b) && strings.TrimSpace(a.Username) == strings.TrimSpace(b.Username) &&
+		strings.TrimSpace(a.ContainerName) == strings.TrimSpace(b.ContainerName)
+}
+
+// commandLocation returns where commands run on the endpoint in a human-readable form
+// (e.g., "user@host", "container db on user@host", or "local").
+func (e *EndpointDetails) commandLocation() string {
+	location := "local"
+	if e.isRemote() {
+		location = strings.TrimSuffix(e.rsyncPathFor(""), ":")
+	}
+	if e.isContainer() {
+		location = fmt.Sprintf("container %s on %s", e.ContainerName, location)
+	}
+	return location
+}
+
+// validateBackupEndpoint checks that a BackupEndpoint leaves a single data flow: Source.BackupCmd
+// runs on it, the transfer reads from the source, and neither endpoint is the same as the other or
+// the destination.
+func (task *DataMigrationModel) validateBackupEndpoint() error {
+	if task.BackupEndpoint == nil {
+		return nil
+	}
+	e := task.BackupEndpoint
+	if strings.TrimSpace(task.Source.BackupCmd) == "" {
+		return fmt.Errorf("BackupEndpoint requires Source.BackupCmd, the command run on it")
+	}
+	var commands []string
+	for _, c := range []struct{ name, value string }{
+		{"BackupCmd", e.BackupCmd}, {"RestoreCmd", e.RestoreCmd}, {"PreTransferCmd", e.PreTransferCmd}, {"HealthCmd", e.HealthCmd},
+	} {
+		if strings.TrimSpace(c.value) != "" {
+			commands = append(commands, c.name)
+		}
+	}
+	if len(commands) > 0 {
+		return fmt.Errorf("BackupEndpoint runs Source.BackupCmd only; move %s of BackupEndpoint to the source or destination", strings.Join(commands, ", "))
+	}
+	if strings.TrimSpace(e.DataPath) == "" {
+		return fmt.Errorf("BackupEndpoint DataPath must be provided (where the backup writes)")
+	}
+	if len(e.AdditionalDataPaths) > 0 {
+		return fmt.Errorf("BackupEndpoint does not take AdditionalDataPaths; the transfer reads the source paths")
+	}
+	if e.isRemote() && e.SSHPort != 0 && (e.SSHPort < 1 || e.SSHPort > 65535) {
+		return fmt.Errorf("backup endpoint SSH port %d is out of valid range (1-65535)", e.SSHPort)
+	}
+	if err := e.validateContainer(); err != nil {
+		return fmt.Errorf("invalid backup endpoint container: %w", err)
+	}
+	if sameEndpoint(*e, task.Source) {
+		return fmt.Errorf("BackupEndpoint is the source endpoint (%s); leave it unset to run the backup on the source", e.commandLocation())
+	}
+	if sameEndpoint(*e, task.Destination) {
+		return fmt.Errorf("BackupEndpoint is the destination endpoint (%s); the backup must reach the destination through the transfer from the source", e.commandLocation())
+	}
+	return nil
+}
+
+// roles returns the resolved roles of the endpoints in the workflow, one line per step
+// (e.g., "backup: runs on user@db (BackupEndpoint), writing to /mnt/backups").
+func (task *DataMigrationModel) roles() []string {
+	var roles []string
+	reads := strings.Join(task.Source.rsyncSourcePaths(), ", ")
+	if task.Source.isURL() {
+		roles = append(roles, "fetch: downloads "+task.Source.URL+" into a local staging file")
+		reads = "the staged artifact"
+	}
+	if strings.TrimSpace(task.Source.BackupCmd) != "" {
+		backup := task.backupEndpoint()
+		role := "backup: runs on " + backup.commandLocation() + " (source)"
+		if task.BackupEndpoint != nil {
+			role = fmt.Sprintf("backup: runs on %s (BackupEndpoint), writing to %s", backup.commandLocation(), backup.DataPath)
+		}
+		roles = append(roles, role)
+	}
+	if strings.TrimSpace(task.Destination.PreTransferCmd) != "" {
+		roles = append(roles, "pre-transfer: runs on "+task.Destination.commandLocation()+" (destination)")
+	}
+	via := task.Topology().String()
+	if task.usesCustomBackend() {
+		via += ", " + task.Backend + " backend"
+	} else if task.RsyncOptions.RelayStreaming && task.Topology() == RemoteToRemoteRelay {
+		via += ", streamed with tar"
+	}
+	roles = append(roles, fmt.Sprintf("transfer: reads %s, writes %s (%s)", reads, task.Destination.displayPath(), via))
+	if strings.TrimSpace(task.Destination.RestoreCmd) != "" {
+		roles = append(roles, "restore: runs on "+task.Destination.commandLocation()+" (destination)")
+	}
+	return roles
+}
@@ -0,0 +1,189 @@
+package transx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// BatchReport summarizes a MigrateBatch run. It is JSON-serializable for machine consumption;
+// PrintBatchSummary formats it for humans (e.g., for a notification email).
+type BatchReport struct {
+	StartTime        time.Time
+	EndTime          time.Time
+	Total            int                  // Number of tasks in the batch
+	Succeeded        int                  // Number of tasks that completed successfully
+	Failed           int                  // Number of tasks that failed
+	BytesTransferred int64                // Sum of the bytes transferred by all tasks
+	Tasks            []*MigrationReport   // Report of each task, in batch order
+	Failures         []BatchFailure       // Failed tasks with their reasons
+	FanOut           []FanOutVerification // Consistency of the replicas of each fan-out source, with BatchOption.FanOutVerify
+}
+
+// BatchFailure identifies a failed task of a batch.
+type BatchFailure struct {
+	Index       int    // Index of the task in the batch
+	Source      string // Display form of the source endpoint
+	Destination string // Display form of the destination endpoint
+	Stage       Stage  // Stage that failed ("" if the task failed before any stage ran)
+	Error       string
+}
+
+// BatchOption defines options of a MigrateBatch run.
+type BatchOption struct {
+	// ProbeCacheTTL is how long the result of an environment probe (rsync version, LocalRunAs sudo check,
+	// host resolution) is reused by later tasks of the batch (0 uses 5 minutes).
+	// Probes of a host are repeated when a task uses different SSH settings (key, remote shell, etc.)
+	// for it. A task opts out with WorkflowOption.BypassProbeCache.
+	ProbeCacheTTL time.Duration
+
+	// FanOutVerify verifies, after the tasks ran, that the destinations of each source transferred to
+	// more than one destination hold identical replicas (see FanOutVerifyOption).
+	FanOutVerify FanOutVerifyOption
+}
+
+// MigrateBatch runs MigrateData for each task in order, continuing after failures, and returns
+// the aggregated report. The error is non-nil if any task failed.
+func MigrateBatch(tasks []DataMigrationModel) (*BatchReport, error) {
+	return MigrateBatchWithOptions(tasks, BatchOption{})
+}
+
+// MigrateBatchWithOptions is like MigrateBatch with the given batch options.
+func MigrateBatchWithOptions(tasks []DataMigrationModel, opts BatchOption) (*BatchReport, error) {
+	batch := &BatchReport{StartTime: time.Now(), Total: len(tasks)}
+	probes := newProbeCache(opts.ProbeCacheTTL)
+
+	for i, task := range tasks {
+		task.RsyncOptions.probes = probes
+		fmt.Printf("Batch: running task %d/%d (%s -> %s)...\n", i+1, len(tasks), task.Source.displayPath(), task.Destination.displayPath())
+		report, err := MigrateDataWithReport(task)
+		batch.Tasks = append(batch.Tasks, report)
+		if report.Transfer != nil {
+			batch.BytesTransferred += report.Transfer.BytesTransferred
+		}
+		if err == nil {
+			batch.Succeeded++
+			continue
+		}
+
+		batch.Failed++
+		failure := BatchFailure{Index: i, Source: report.Source, Destination: report.Destination, Error: err.Error()}
+		for _, stage := range report.Stages {
+			if !stage.Success {
+				failure.Stage = stage.Stage
+			}
+		}
+		batch.Failures = append(batch.Failures, failure)
+	}
+
+	var errs []error
+	if batch.Failed > 0 {
+		errs = append(errs, fmt.Errorf("%d of %d batch task(s) failed", batch.Failed, batch.Total))
+	}
+	if opts.FanOutVerify.Enabled {
+		if err := verifyFanOuts(batch, tasks, opts.FanOutVerify); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	batch.EndTime = time.Now()
+	return batch, errors.Join(errs...)
+}
+
+// verifyFanOuts verifies the replicas of each fan-out source of the batch and records the outcomes.
+// It returns an error counting the replicas that differ from their source and, separately, those
+// that could not be verified.
+func verifyFanOuts(batch *BatchReport, tasks []DataMigrationModel, opts FanOutVerifyOption) error {
+	mismatches, unverified := 0, 0
+	for _, group := range fanOutGroups(tasks) {
+		fmt.Printf("Batch: verifying the %d replicas of %s...\n", len(group), tasks[group[0]].Source.displayPath())
+		verification := verifyFanOut(context.Background(), opts, tasks, batch.Tasks, group)
+		for _, replica := range verification.Replicas {
+			switch replica.Status {
+			case ReplicaMismatch:
+				mismatches++
+			case ReplicaUnreachable:
+				unverified++
+			case ReplicaSkipped:
+				if verification.Error != "" {
+					unverified++
+				}
+			}
+		}
+		batch.FanOut = append(batch.FanOut, verification)
+	}
+
+	var errs []error
+	if mismatches > 0 {
+		errs = append(errs, fmt.Errorf("fan-out verification: %d replica(s) differ from their source", mismatches))
+	}
+	if unverified > 0 {
+		errs = append(errs, fmt.Errorf("fan-out verification: %d replica(s) could not be verified", unverified))
+	}
+	return errors.Join(errs...)
+}
+
+// PrintBatchSummary writes a human-readable summary of the batch report to w: counts, totals,
+// one line per task, and the failures with their reasons.
+func PrintBatchSummary(w io.Writer, report BatchReport) {
+	fmt.Fprintln(w, "=== Batch Migration Summary ===")
+	fmt.Fprintf(w, "Tasks:       %d succeeded, %d failed, %d total\n", report.Succeeded, report.Failed, report.Total)
+	fmt.Fprintf(w, "Bytes:       %d transferred\n", report.BytesTransferred)
+	if !report.EndTime.IsZero() {
+		fmt.Fprintf(w, "Total time:  %s\n", report.EndTime.Sub(report.StartTime).Round(time.Millisecond))
+	}
+
+	if len(report.Tasks) > 0 {
+		fmt.Fprintln(w, "Tasks:")
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for i, task := range report.Tasks {
+			status := "ok"
+			if !task.Success {
+				status = "failed"
+			}
+			fmt.Fprintf(tw, "  #%d\t%s -> %s\t%s\t%s\n", i, task.Source, task.Destination,
+				task.EndTime.Sub(task.StartTime).Round(time.Millisecond), status)
+		}
+		tw.Flush()
+	}
+
+	for _, verification := range report.FanOut {
+		if verification.Error != "" {
+			reason, _, _ := strings.Cut(verification.Error, "\n")
+			fmt.Fprintf(w, "Fan-out:     %s could not be listed: %s\n", verification.Source, reason)
+		} else {
+			fmt.Fprintf(w, "Fan-out:     %s (%d file(s), digest %.12s)\n", verification.Source, verification.Files, verification.Digest)
+		}
+		for _, replica := range verification.Replicas {
+			switch replica.Status {
+			case ReplicaConsistent:
+				fmt.Fprintf(w, "  #%d %s: %s\n", replica.Index, replica.Destination, replica.Status)
+			case ReplicaMismatch:
+				fmt.Fprintf(w, "  #%d %s: %s (%d file(s), digest %.12s)\n", replica.Index, replica.Destination, replica.Status, replica.Files, replica.Digest)
+			default:
+				reason, _, _ := strings.Cut(replica.Error, "\n") // The command output follows the first line
+				fmt.Fprintf(w, "  #%d %s: %s (%s)\n", replica.Index, replica.Destination, replica.Status, reason)
+			}
+			for _, difference := range replica.Differences {
+				fmt.Fprintf(w, "    %s\n", difference)
+			}
+			if replica.Truncated > 0 {
+				fmt.Fprintf(w, "    ... and %d more\n", replica.Truncated)
+			}
+		}
+	}
+
+	if len(report.Failures) > 0 {
+		fmt.Fprintln(w, "Failures:")
+		for _, failure := range report.Failures {
+			stage := failure.Stage
+			if stage == "" {
+				stage = "setup"
+			}
+			fmt.Fprintf(w, "  #%d %s -> %s (%s): %s\n", failure.Index, failure.Source, failure.Destination, stage, failure.Error)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package transx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackendBigFile is the backend of the parallel byte-range transfer of a single file
+// (see RsyncOption.BigFileParallelStreams).
+const BackendBigFile = "bigfile"
+
+const (
+	bigFilePartSuffix    = ".transx-part-" // Suffix of the part-files on the destination, followed by the range index
+	bigFilePartialSuffix = ".transx-partial"
+)
+
+// validateBigFile checks that the big-file mode can be applied to the task.
+func (task *DataMigrationModel) validateBigFile() error {
+	streams := task.RsyncOptions.BigFileParallelStreams
+	if streams < 0 {
+		return fmt.Errorf("BigFileParallelStreams must not be negative")
+	}
+	if streams < 2 {
+		return nil
+	}
+	if task.Source.isContainer() || task.Destination.isContainer() {
+		return fmt.Errorf("BigFileParallelStreams is not supported with container endpoints")
+	}
+	if len(task.Source.AdditionalDataPaths) > 0 {
+		return fmt.Errorf("BigFileParallelStreams cannot be combined with multiple source paths")
+	}
+	if len(task.RsyncOptions.MtimeSplit.Boundaries) > 0 {
+		return fmt.Errorf("BigFileParallelStreams cannot be combined with MtimeSplit")
+	}
+	if task.RsyncOptions.RemoveSourceFiles {
+		return fmt.Errorf("BigFileParallelStreams cannot be combined with RemoveSourceFiles")
+	}
+	return nil
+}
+
+// bigFileRange is a byte range of the source file, transferred into its own part-file.
+type bigFileRange struct {
+	index  int
+	offset int64
+	length int64
+}
+
+// splitBigFile splits a file of the given size into at most streams ranges of nearly equal length.
+func splitBigFile(size int64, streams int) []bigFileRange {
+	length := (size + int64(streams) - 1) / int64(streams)
+	var ranges []bigFileRange
+	for offset := int64(0); offset < size; offset += length {
+		ranges = append(ranges, bigFileRange{index: len(ranges), offset: offset, length: min(length, size-offset)})
+	}
+	return ranges
+}
+
+// bigFileSize returns the size of the source DataPath if it is a regular file, or ok=false if it is
+// anything else (e.g., a directory), in which case the task is transferred by rsync as usual.
+func bigFileSize(ctx context.Context, task DataMigrationModel) (size int64, ok bool, err error) {
+	source := task.Source.DataPath
+	if strings.HasSuffix(source, "/") {
+		return 0, false, nil
+	}
+	quoted := shellQuotePath(source)
+	output, err := executeCommandContext(ctx, fmt.Sprintf("if [ -f %s ]; then wc -c < %s; fi", quoted, quoted), task.Source, task.RsyncOptions)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to inspect the source '%s': %w\nOutput:\n%s", task.Source.displayPath(), err, string(output))
+	}
+	text := strings.TrimSpace(string(output))
+	if text == "" {
+		return 0, false, nil
+	}
+	size, err = strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to parse the size of the source '%s': %q", task.Source.displayPath(), text)
+	}
+	return size, true, nil
+}
+
+// bigFileDestination returns the path of the file on the destination, following rsync: the
+// destination DataPath itself, or the source file name within it if it is an existing directory
+// or ends with a slash.
+func bigFileDestination(ctx context.Context, task DataMigrationModel) (string, error) {
+	destination := task.Destination.DataPath
+	name := path.Base(task.Source.DataPath)
+	if strings.HasSuffix(destination, "/") {
+		return destination + name, nil
+	}
+	output, err := executeCommandContext(ctx, fmt.Sprintf("if [ -d %s ]; then echo dir; fi", shellQuotePath(destination)), task.Destination, task.RsyncOptions)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect the destination '%s': %w\nOutput:\n%s", task.Destination.displayPath(), err, string(output))
+	}
+	if strings.TrimSpace(string(output)) == "dir" {
+		return path.Join(destination, name), nil
+	}
+	return destination, nil
+}
+
+// transferBigFile transfers a source that is a single regular file as BigFileParallelStreams byte
+// ranges streamed concurrently into part-files on the destination, which are then concatenated and
+// verified against the source by checksum (RsyncOption.ChecksumAlgorithm) before the file is moved
+// into place. It returns handled=false without transferring anything if the source is not a non-empty
+// regular file, so that rsync transfers it instead.
+func transferBigFile(ctx context.Context, task DataMigrationModel) (result *TransferResult, handled bool, err error) {
+	startTime := time.Now()
+	size, ok, err := bigFileSize(ctx, task)
+	if err != nil || !ok || size == 0 {
+		return nil, err != nil, err
+	}
+	final, err := bigFileDestination(ctx, task)
+	if err != nil {
+		return nil, true, err
+	}
+
+	ranges := splitBigFile(size, task.RsyncOptions.BigFileParallelStreams)
+	parts := make([]string, len(ranges))
+	quotedParts := make([]string, len(ranges))
+	for i := range ranges {
+		parts[i] = final + bigFilePartSuffix + strconv.Itoa(i)
+		quotedParts[i] = shellQuotePath(parts[i])
+	}
+	partial := final + bigFilePartialSuffix
+
+	// The part-files and the partial file are removed whatever the outcome
+	removeCmd := "rm -f " + strings.Join(quotedParts, " ") + " " + shellQuotePath(partial)
+	defer task.RsyncOptions.cleanups.track(fmt.Sprintf("big-file parts of %s on the destination", final), func() error {
+		output, err := executeCommandContext(context.Background(), removeCmd, task.Destination, task.RsyncOptions)
+		if err != nil {
+			return fmt.Errorf("%w\nOutput:\n%s", err, string(output))
+		}
+		return nil
+	})()
+
+	fmt.Printf("Big-file transfer: streaming %d bytes from '%s' to '%s' in %d range(s)...\n",
+		size, task.Source.displayPath(), final, len(ranges))
+	mkdirCmd := mkdirCommand(path.Dir(final), task.RsyncOptions.CreateDestDirMode)
+	if output, err := executeCommandContext(ctx, mkdirCmd, task.Destination, task.RsyncOptions); err != nil {
+		return nil, true, fmt.Errorf("failed to create the destination directory: %w\nOutput:\n%s", err, string(output))
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+		sent int64
+	)
+	for _, r := range ranges {
+		wg.Add(1)
+		go func(r bigFileRange) {
+			defer wg.Done()
+			n, err := transferBigFileRange(ctx, task, r, parts[r.index])
+			mu.Lock()
+			defer mu.Unlock()
+			sent += n
+			if err != nil {
+				errs = append(errs, fmt.Errorf("range %d: %w", r.index, err))
+			}
+		}(r)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, true, err
+	}
+
+	// Reassemble the ranges and verify the result before it replaces the destination file
+	assembleCmd := fmt.Sprintf("cat %s > %s && rm -f %s", strings.Join(quotedParts, " "), shellQuotePath(partial), strings.Join(quotedParts, " "))
+	if output, err := executeCommandContext(ctx, assembleCmd, task.Destination, task.RsyncOptions); err != nil {
+		return nil, true, fmt.Errorf("failed to reassemble '%s': %w\nOutput:\n%s", final, err, string(output))
+	}
+	if err := verifyBigFile(ctx, task, partial); err != nil {
+		return nil, true, err
+	}
+	moveCmd := fmt.Sprintf("mv -f %s %s", shellQuotePath(partial), shellQuotePath(final))
+	if output, err := executeCommandContext(ctx, moveCmd, task.Destination, task.RsyncOptions); err != nil {
+		return nil, true, fmt.Errorf("failed to move '%s' into place: %w\nOutput:\n%s", final, err, string(output))
+	}
+
+	return &TransferResult{
+		TotalFileCount:   1,
+		FilesTransferred: 1,
+		TotalFileSize:    size,
+		BytesTransferred: size,
+		BytesSent:        sent,
+		Duration:         time.Since(startTime),
+	}, true, nil
+}
+
+// transferBigFileRange streams a byte range of the source file into a part-file on the destination,
+// retried with RsyncOption.Retry, and returns the bytes streamed by the last attempt.
+func transferBigFileRange(ctx context.Context, task DataMigrationModel, r bigFileRange, part string) (int64, error) {
+	readCmd := fmt.Sprintf("tail -c +%d %s | head -c %d", r.offset+1, shellQuotePath(task.Source.DataPath), r.length)
+	writeCmd := "umask 077 && cat > " + shellQuotePath(part) // Private until the file is reassembled
+
+	var sent int64
+	err := task.RsyncOptions.retry(ctx, fmt.Sprintf("Big-file range %d", r.index), func() error {
+		if err := throttle(ctx, task.RsyncOptions, task.Source, task.Destination); err != nil {
+			return err
+		}
+		sender := endpointShellCommand(ctx, task.Source, task.RsyncOptions, readCmd)
+		receiver := endpointShellCommand(ctx, task.Destination, task.RsyncOptions, writeCmd)
+		stream, err := sender.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		counter := &countingReader{r: stream}
+		receiver.Stdin = counter
+		var senderErrOutput, receiverOutput bytes.Buffer
+		sender.Stderr = &senderErrOutput
+		receiver.Stdout = &receiverOutput
+		receiver.Stderr = &receiverOutput
+
+		start := time.Now()
+		if err := sender.Start(); err != nil {
+			return fmt.Errorf("failed to read the range on the source: %w", err)
+		}
+		receiveErr := receiver.Run()
+		stream.Close() // A sender still writing after the receiver exited gets SIGPIPE instead of blocking
+		sendErr := sender.Wait()
+		task.RsyncOptions.usage.record(sender, start)
+		task.RsyncOptions.usage.record(receiver, start)
+		sent = counter.n
+		err = task.RsyncOptions.audit.record(sender.String()+" | "+receiver.String(), errors.Join(sendErr, receiveErr), task.Source, task.Destination)
+		if err == nil && counter.n != r.length {
+			err = fmt.Errorf("streamed %d bytes instead of %d (did the source change?)", counter.n, r.length)
+		}
+		if err != nil {
+			output := append(senderErrOutput.Bytes(), receiverOutput.Bytes()...)
+			return newOperationError(task, StageTransfer,
+				fmt.Sprintf("big-file range %d transfer failed from '%s'", r.index, task.Source.displayPath()),
+				[]string{readCmd + " | " + writeCmd}, output, err)
+		}
+		return nil
+	})
+	return sent, err
+}
+
+// verifyBigFile compares the checksum of the reassembled file on the destination with the source file.
+func verifyBigFile(ctx context.Context, task DataMigrationModel, partial string) error {
+	algorithm := task.RsyncOptions.ChecksumAlgorithm.orDefault()
+	sourceHasher, err := detectHasher(ctx, task.Source, task.RsyncOptions, algorithm)
+	if err != nil {
+		return err
+	}
+	destinationHasher, err := detectHasher(ctx, task.Destination, task.RsyncOptions, algorithm)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Big-file transfer: verifying the reassembled file by %s...\n", algorithm)
+	name := path.Base(task.Source.DataPath)
+	sourceSums, err := sourceHasher.checksums(ctx, task.RsyncOptions, path.Dir(task.Source.DataPath), []string{name})
+	if err != nil {
+		return fmt.Errorf("failed to checksum the source file: %w", err)
+	}
+	partialName := path.Base(partial)
+	destinationSums, err := destinationHasher.checksums(ctx, task.RsyncOptions, path.Dir(partial), []string{partialName})
+	if err != nil {
+		return fmt.Errorf("failed to checksum the reassembled file: %w", err)
+	}
+	sourceSum, ok := sourceSums[name]
+	if !ok {
+		return fmt.Errorf("failed to checksum the source file '%s'", task.Source.displayPath())
+	}
+	if sourceSum != destinationSums[partialName] {
+		return fmt.Errorf("checksum mismatch of the reassembled file (source %s, destination %s)", sourceSum, destinationSums[partialName])
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package transx
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// InsufficientSpaceError is returned by the free-space preflight check when a transfer target
+// does not have enough free bytes for the data the transfer would write.
+type InsufficientSpaceError struct {
+	Path      string // Display form of the checked location
+	Required  int64  // Estimated bytes the transfer writes
+	Available int64  // Free bytes available to unprivileged users
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("insufficient free space at '%s': the transfer needs about %d bytes, but only %d are available", e.Path, e.Required, e.Available)
+}
+
+// InsufficientInodesError is returned by the free-space preflight check when a transfer target
+// has enough bytes but not enough free inodes for the entries the transfer would create
+// (typically with millions of small files).
+type InsufficientInodesError struct {
+	Path      string // Display form of the checked location
+	Required  int64  // Number of entries (files, directories, links) the transfer creates
+	Available int64  // Free inodes
+}
+
+func (e *InsufficientInodesError) Error() string {
+	return fmt.Sprintf("insufficient free inodes at '%s': the transfer creates %d entries, but only %d inodes are free", e.Path, e.Required, e.Available)
+}
+
+// FreeSpaceCheck records the capacity of one transfer target measured by the free-space check.
+type FreeSpaceCheck struct {
+	Label           string // "destination", "staging" (the local relay staging directory), or "temp-dir" (RsyncOption.TempDir)
+	Path            string // Display form of the checked location
+	RequiredBytes   int64  // -1 if the transfer backend does not estimate it
+	AvailableBytes  int64
+	RequiredInodes  int64 // -1 if the transfer backend does not estimate it
+	AvailableInodes int64 // -1 if the filesystem does not report inodes (e.g., allocated dynamically)
+}
+
+// checkFreeSpace estimates the bytes and inodes the transfer needs with its backend (an rsync
+// dry-run for rsync) and compares them with the free capacity of the destination (and, in relay
+// mode with rsync and without RelayStreaming, of the local staging directory, which receives
+// everything first). With RsyncOption.TempDir, its filesystem
+// must also hold the largest file sent.
+func checkFreeSpace(task DataMigrationModel, report *PreflightReport) error {
+	if task.Source.isContainer() || task.Destination.isContainer() {
+		return fmt.Errorf("free-space check is not supported with container endpoints")
+	}
+
+	backend, ok := task.transferBackend()
+	if !ok {
+		return fmt.Errorf("unknown backend '%s'", task.Backend)
+	}
+	estimate, err := backend.Estimate(task)
+	if err != nil {
+		return fmt.Errorf("failed to estimate the size of the transfer: %w", err)
+	}
+	requiredBytes, requiredInodes, largestFile := estimate.Bytes, estimate.Entries, estimate.LargestFile
+
+	type target struct {
+		label          string
+		endpoint       EndpointDetails
+		requiredBytes  int64
+		requiredInodes int64
+	}
+	targets := []target{{"destination", task.Destination, requiredBytes, requiredInodes}}
+	if task.Topology() == RemoteToRemoteRelay && !task.usesCustomBackend() && !task.RsyncOptions.RelayStreaming {
+		stagingDir := task.RsyncOptions.StagingDir
+		if strings.TrimSpace(stagingDir) == "" {
+			stagingDir = os.TempDir()
+		}
+		targets = append(targets, target{"staging", EndpointDetails{DataPath: stagingDir}, requiredBytes, requiredInodes})
+	}
+	if tempDir := task.RsyncOptions.TempDir; tempDir != "" && largestFile > 0 {
+		// The receiver writes one file at a time into the temp dir before moving it into place
+		if !path.IsAbs(tempDir) {
+			tempDir = path.Join(task.Destination.DataPath, tempDir)
+		}
+		endpoint := task.Destination
+		endpoint.DataPath = tempDir
+		targets = append(targets, target{"temp-dir", endpoint, largestFile, 1})
+	}
+
+	for _, target := range targets {
+		requiredBytes, requiredInodes := target.requiredBytes, target.requiredInodes
+		availableBytes, availableInodes, err := measureFreeSpace(target.endpoint, task.RsyncOptions)
+		if err != nil {
+			return fmt.Errorf("failed to measure free space of %s '%s': %w", target.label, target.endpoint.displayPath(), err)
+		}
+		report.FreeSpace = append(report.FreeSpace, FreeSpaceCheck{
+			Label:           target.label,
+			Path:            target.endpoint.displayPath(),
+			RequiredBytes:   requiredBytes,
+			AvailableBytes:  availableBytes,
+			RequiredInodes:  requiredInodes,
+			AvailableInodes: availableInodes,
+		})
+
+		if requiredBytes > availableBytes {
+			return &InsufficientSpaceError{Path: target.endpoint.displayPath(), Required: requiredBytes, Available: availableBytes}
+		}
+		if availableInodes >= 0 && requiredInodes > availableInodes {
+			return &InsufficientInodesError{Path: target.endpoint.displayPath(), Required: requiredInodes, Available: availableInodes}
+		}
+	}
+	return nil
+}
+
+// measureFreeSpace runs POSIX "df -P" and "df -Pi" on the endpoint for its DataPath (or the nearest
+// existing parent, since the transfer may create the path) and returns the free bytes and inodes.
+// The free inodes are -1 if the filesystem reports no inode total.
+func measureFreeSpace(endpoint EndpointDetails, sshConfig RsyncOption) (bytes, inodes int64, err error) {
+	dfCmd := fmt.Sprintf(`p=%s; while [ ! -e "$p" ]; do p=$(dirname "$p"); done; df -Pk "$p" | tail -n 1; df -Pi "$p" | tail -n 1`,
+		shellQuotePath(endpoint.DataPath))
+	output, err := executeCommand(dfCmd, endpoint, sshConfig)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w\nOutput:\n%s", err, string(output))
+	}
+
+	// The last two lines are the df rows; anything before them is an SSH banner or warning
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) < 2 {
+		return 0, 0, fmt.Errorf("unexpected df output: %q", string(output))
+	}
+	blockRow := strings.Fields(lines[len(lines)-2])
+	inodeRow := strings.Fields(lines[len(lines)-1])
+	if len(blockRow) < 4 || len(inodeRow) < 4 {
+		return 0, 0, fmt.Errorf("unexpected df output: %q", string(output))
+	}
+
+	// Columns: Filesystem, total, used, available, capacity, mount point
+	availableKB, err := strconv.ParseInt(blockRow[3], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected available size in df output: %q", blockRow[3])
+	}
+	totalInodes, err := strconv.ParseInt(inodeRow[1], 10, 64)
+	if err != nil || totalInodes == 0 {
+		return availableKB * 1024, -1, nil // e.g., btrfs reports "-" or 0 inodes
+	}
+	freeInodes, err := strconv.ParseInt(inodeRow[3], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected free inode count in df output: %q", inodeRow[3])
+	}
+	return availableKB * 1024, freeInodes, nil
+}
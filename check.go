@@ -0,0 +1,146 @@
+package transx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// CheckSeverity is the severity of a CheckConfig finding.
+type CheckSeverity string
+
+const (
+	CheckError   CheckSeverity = "error"   // The configuration cannot run
+	CheckWarning CheckSeverity = "warning" // The configuration runs, but is likely a mistake
+	CheckInfo    CheckSeverity = "info"    // Informational (e.g., a check that could not be applied)
+)
+
+// CheckFinding is a finding of CheckConfig.
+type CheckFinding struct {
+	Severity CheckSeverity
+	Check    string // Check that produced the finding ("schema", "validate", "lint", "secrets", "restore", or "plan")
+	Message  string
+}
+
+// String returns the finding as "severity: [check] message".
+func (f CheckFinding) String() string {
+	return fmt.Sprintf("%s: [%s] %s", f.Severity, f.Check, f.Message)
+}
+
+// CheckReport is the outcome of CheckConfig.
+type CheckReport struct {
+	Topology Topology
+	Roles    []string // Resolved roles of the endpoints, one line per step (e.g., "backup: runs on user@host (source)")
+	Findings []CheckFinding
+	Commands [][]string // rsync command lines the transfer would run, if they could be built
+}
+
+// HasErrors reports whether any finding has the error severity.
+func (r *CheckReport) HasErrors() bool {
+	for _, f := range r.Findings {
+		if f.Severity == CheckError {
+			return true
+		}
+	}
+	return false
+}
+
+// add records a finding.
+func (r *CheckReport) add(severity CheckSeverity, check, message string) {
+	r.Findings = append(r.Findings, CheckFinding{Severity: severity, Check: check, Message: message})
+}
+
+// CheckConfig runs every check that needs no host on the task, e.g., to gate configuration changes
+// in CI: the schema validation of its JSON form, Validate, Lint, the plaintext-secret check, the
+// restore inputs excluded from the transfer (the static part of WorkflowOption.RestorePreview), and
+// the construction of the rsync command lines of the transfer. It contacts no host and starts no process.
+// Problems of the configuration are reported as findings; the error is only set if the checks
+// themselves could not run.
+func CheckConfig(dmm DataMigrationModel) (*CheckReport, error) {
+	jsonData, err := json.Marshal(dmm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the configuration: %w", err)
+	}
+	var document any
+	if err := json.Unmarshal(jsonData, &document); err != nil {
+		return nil, fmt.Errorf("failed to decode the configuration: %w", err)
+	}
+	report := &CheckReport{}
+	checkDocument(report, document)
+	checkModel(report, dmm)
+	return report, nil
+}
+
+// CheckConfigFile is like CheckConfig for a configuration file as read by LoadConfig: the schema is
+// validated against the document itself, so unknown properties and type mismatches are found.
+func CheckConfigFile(path string) (*CheckReport, error) {
+	jsonData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	report := &CheckReport{}
+	var document any
+	if err := json.Unmarshal(jsonData, &document); err != nil {
+		report.add(CheckError, "schema", fmt.Sprintf("invalid JSON: %v", err))
+		return report, nil
+	}
+	checkDocument(report, document)
+
+	var dmm DataMigrationModel
+	if err := json.Unmarshal(jsonData, &dmm); err != nil {
+		report.add(CheckError, "schema", fmt.Sprintf("failed to decode the configuration: %v", err))
+		return report, nil
+	}
+	if err := expandHomeDir(&dmm.Source.SSHPrivateKeyPath); err != nil {
+		report.add(CheckError, "validate", err.Error())
+	}
+	if err := expandHomeDir(&dmm.Destination.SSHPrivateKeyPath); err != nil {
+		report.add(CheckError, "validate", err.Error())
+	}
+	checkModel(report, dmm)
+	return report, nil
+}
+
+// checkDocument records the schema violations of the JSON document.
+func checkDocument(report *CheckReport, document any) {
+	for _, violation := range validateAgainstSchema(document) {
+		report.add(CheckError, "schema", violation)
+	}
+}
+
+// checkModel records the findings of the checks of the decoded task.
+func checkModel(report *CheckReport, dmm DataMigrationModel) {
+	report.Topology = dmm.Topology()
+	report.Roles = dmm.roles()
+	validateErr := Validate(dmm)
+	if validateErr != nil {
+		report.add(CheckError, "validate", validateErr.Error())
+	}
+	for _, warning := range Lint(dmm) {
+		report.add(CheckWarning, "lint", warning)
+	}
+	if found := dmm.plaintextSecrets(); len(found) > 0 {
+		report.add(CheckWarning, "secrets", fmt.Sprintf("%s contain(s) plaintext secrets; use secret references (secret://<name>) with a SecretsProvider instead",
+			strings.Join(found, ", ")))
+	}
+	for _, p := range restoreInputPaths(dmm) {
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, path.Clean(dmm.Destination.DataPath)), "/")
+		if pattern := excludingPattern(dmm.RsyncOptions, rel); pattern != "" {
+			report.add(CheckWarning, "restore", fmt.Sprintf("restore input %s is excluded from the transfer by '%s'", p, pattern))
+		}
+	}
+	if validateErr != nil {
+		return // The command lines of an invalid task are meaningless
+	}
+
+	commands, err := BuildRsyncCommands(dmm)
+	if err != nil {
+		report.add(CheckInfo, "plan", fmt.Sprintf("command lines not built: %v", err))
+		return
+	}
+	for _, command := range commands {
+		report.Commands = append(report.Commands, append([]string{command.Path}, command.Args...))
+	}
+}
@@ -0,0 +1,264 @@
+package transx
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ChecksumAlgorithm selects the hash used to compare files by the verification features.
+type ChecksumAlgorithm string
+
+const (
+	ChecksumSHA256 ChecksumAlgorithm = "sha256" // SHA-256 (default of the sampled verification)
+	ChecksumSHA1   ChecksumAlgorithm = "sha1"   // SHA-1
+	ChecksumMD5    ChecksumAlgorithm = "md5"    // MD5
+	ChecksumXXH64  ChecksumAlgorithm = "xxh64"  // XXH64 (non-cryptographic, fast)
+)
+
+// checksumTools lists, per algorithm, the hashing commands tried in order on an endpoint.
+// Each prints "<hex digest> <name>" lines, with one or two spaces or " *" as the separator.
+var checksumTools = map[ChecksumAlgorithm][]string{
+	ChecksumSHA256: {"sha256sum", "shasum -a 256", "openssl dgst -sha256 -r"},
+	ChecksumSHA1:   {"sha1sum", "shasum -a 1", "openssl dgst -sha1 -r"},
+	ChecksumMD5:    {"md5sum", "openssl dgst -md5 -r"},
+	ChecksumXXH64:  {"xxh64sum", "xxhsum -H1"},
+}
+
+// checksumHexLengths is the length of the hex digest of each algorithm.
+var checksumHexLengths = map[ChecksumAlgorithm]int{
+	ChecksumSHA256: 64,
+	ChecksumSHA1:   40,
+	ChecksumMD5:    32,
+	ChecksumXXH64:  16,
+}
+
+// orDefault returns the algorithm, or SHA-256 if it is not set.
+func (a ChecksumAlgorithm) orDefault() ChecksumAlgorithm {
+	if a == "" {
+		return ChecksumSHA256
+	}
+	return a
+}
+
+// validate checks that the algorithm is known.
+func (a ChecksumAlgorithm) validate() error {
+	if _, ok := checksumTools[a.orDefault()]; !ok {
+		return fmt.Errorf("unknown checksum algorithm '%s' (use '%s', '%s', '%s', or '%s')",
+			a, ChecksumSHA256, ChecksumSHA1, ChecksumMD5, ChecksumXXH64)
+	}
+	return nil
+}
+
+// newNativeHash returns the Go implementation of the algorithm, or nil if there is none.
+func newNativeHash(a ChecksumAlgorithm) hash.Hash {
+	switch a {
+	case ChecksumSHA256:
+		return sha256.New()
+	case ChecksumSHA1:
+		return sha1.New()
+	case ChecksumMD5:
+		return md5.New()
+	}
+	return nil
+}
+
+// endpointHasher computes checksums of files on one endpoint with the hashing command detected there,
+// or natively in Go for a local endpoint without one.
+type endpointHasher struct {
+	endpoint  EndpointDetails
+	algorithm ChecksumAlgorithm
+	command   string // Hashing command; empty for the native fallback
+}
+
+// detectHasher finds the first available hashing command for the algorithm on the endpoint.
+// A local endpoint without any falls back to the Go implementation, if the algorithm has one.
+func detectHasher(ctx context.Context, endpoint EndpointDetails, sshConfig RsyncOption, algorithm ChecksumAlgorithm) (*endpointHasher, error) {
+	algorithm = algorithm.orDefault()
+	tools := checksumTools[algorithm]
+	quoted := make([]string, len(tools))
+	for i, tool := range tools {
+		quoted[i] = shellQuote(tool)
+	}
+	detectCmd := fmt.Sprintf(`for t in %s; do set -- $t; if command -v "$1" >/dev/null 2>&1; then echo "$t"; exit 0; fi; done; true`,
+		strings.Join(quoted, " "))
+	output, err := executeCommandContext(ctx, detectCmd, endpoint, sshConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect a %s hashing command on '%s': %w\nOutput:\n%s", algorithm, endpoint.displayPath(), err, string(output))
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		for _, tool := range tools {
+			if strings.TrimSpace(line) == tool {
+				return &endpointHasher{endpoint: endpoint, algorithm: algorithm, command: tool}, nil
+			}
+		}
+	}
+
+	if !endpoint.isRemote() && !endpoint.isContainer() && newNativeHash(algorithm) != nil {
+		return &endpointHasher{endpoint: endpoint, algorithm: algorithm}, nil
+	}
+	return nil, fmt.Errorf("no %s hashing command found on '%s' (tried %s)", algorithm, endpoint.displayPath(), strings.Join(tools, ", "))
+}
+
+// checksums returns the checksum of each named file below root by name. Missing or unreadable
+// files are absent from the result.
+func (h *endpointHasher) checksums(ctx context.Context, sshConfig RsyncOption, root string, names []string) (map[string]string, error) {
+	sums := make(map[string]string, len(names))
+	if h.command == "" {
+		for _, name := range names {
+			if sum, err := nativeChecksum(h.algorithm, path.Join(root, name)); err == nil {
+				sums[name] = sum
+			}
+		}
+		return sums, nil
+	}
+
+	// No "--" before the names, since openssl does not accept it; a name cannot pass for an option
+	paths := make([]string, len(names))
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = dashSafePath(path.Join(root, name))
+		quoted[i] = shellQuote(paths[i])
+	}
+	output, err := executeCommandContext(ctx, h.command+" "+strings.Join(quoted, " ")+" 2>/dev/null || true", h.endpoint, sshConfig)
+	if err != nil {
+		return nil, fmt.Errorf("%w\nOutput:\n%s", err, string(output))
+	}
+
+	byPath := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		// e.g., "<64 hex digits>  /srv/data/file" or "<64 hex digits> */srv/data/file"
+		sum, file, found := strings.Cut(line, " ")
+		if !found || len(sum) != checksumHexLengths[h.algorithm] {
+			continue
+		}
+		if len(file) > 0 && (file[0] == ' ' || file[0] == '*') {
+			file = file[1:]
+		}
+		byPath[file] = strings.ToLower(sum)
+	}
+	for i, name := range names {
+		if sum, ok := byPath[paths[i]]; ok {
+			sums[name] = sum
+		}
+	}
+	return sums, nil
+}
+
+// nativeChecksum computes the checksum of a local file in Go.
+func nativeChecksum(algorithm ChecksumAlgorithm, name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := newNativeHash(algorithm)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// compareChecksums checksums the named files below the roots of both endpoints in batches of
+// batchSize and returns the names whose checksums differ or that are missing on either side.
+func compareChecksums(ctx context.Context, task DataMigrationModel, source EndpointDetails, sourceRoot, destinationRoot string, names []string, batchSize int) ([]string, error) {
+	algorithm := task.RsyncOptions.ChecksumAlgorithm
+	sourceHasher, err := detectHasher(ctx, source, task.RsyncOptions, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	destinationHasher, err := detectHasher(ctx, task.Destination, task.RsyncOptions, algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []string
+	for start := 0; start < len(names); start += batchSize {
+		batch := names[start:min(start+batchSize, len(names))]
+		sourceSums, err := sourceHasher.checksums(ctx, task.RsyncOptions, sourceRoot, batch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to checksum source files: %w", err)
+		}
+		destinationSums, err := destinationHasher.checksums(ctx, task.RsyncOptions, destinationRoot, batch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to checksum destination files: %w", err)
+		}
+		for _, name := range batch {
+			if sum, ok := sourceSums[name]; !ok || sum != destinationSums[name] {
+				mismatches = append(mismatches, name)
+			}
+		}
+	}
+	return mismatches, nil
+}
+
+// sourceTransferRoot returns the directory that the names logged by rsync are relative to: the source
+// directory itself with a trailing slash, or its parent without one (rsync's trailing-slash rule).
+func sourceTransferRoot(dataPath string) string {
+	if strings.HasSuffix(dataPath, "/") {
+		return dataPath
+	}
+	return path.Dir(dataPath)
+}
+
+// verifyByChecksums compares every regular file selected by the task's filters by the
+// RsyncOption.ChecksumAlgorithm checksums computed on both sides. The files are listed with an rsync
+// dry-run that ignores times (-I), so that every file is reported whether or not it differs.
+func verifyByChecksums(ctx context.Context, task DataMigrationModel, rsyncCmdPath string, args []string, sourceRsyncPaths []string, destinationRsyncPath string) error {
+	if len(task.Source.AdditionalDataPaths) > 0 {
+		return fmt.Errorf("verification with ChecksumAlgorithm is not supported with multiple source paths")
+	}
+	if task.Source.isContainer() || task.Destination.isContainer() {
+		return fmt.Errorf("verification with ChecksumAlgorithm is not supported with container endpoints")
+	}
+
+	listArgs := append(append([]string{}, args...), "-n", "-I", "--out-format="+dryRunEntryPrefix+"%i:%l:%n")
+	listArgs = append(listArgs, rsyncPathArgs(sourceRsyncPaths, destinationRsyncPath)...)
+	cmd := newLocalCommand(ctx, task.RsyncOptions, rsyncCmdPath, listArgs...)
+	start := time.Now()
+	output, err := commandOutput(ctx, task.RsyncOptions, cmd)
+	task.RsyncOptions.usage.record(cmd, start)
+	if err != nil {
+		return fmt.Errorf("rsync file listing failed from '%s' to '%s'\nCommand: %s %s\nError: %w\nOutput:\n%s",
+			strings.Join(sourceRsyncPaths, "', '"), destinationRsyncPath, rsyncCmdPath, strings.Join(listArgs, " "), err, string(output))
+	}
+
+	// Hashing commands escape names containing backslashes or newlines in their output
+	var names []string
+	skipped := 0
+	for _, name := range transferredFiles(string(output)) {
+		if strings.ContainsAny(name, "\\\n") {
+			skipped++
+			continue
+		}
+		names = append(names, name)
+	}
+	if skipped > 0 {
+		fmt.Printf("Warning: %d file(s) with backslashes or newlines in their names are not verified\n", skipped)
+	}
+
+	source, sourceRoot := task.Source, sourceTransferRoot(task.Source.DataPath)
+	if task.Topology() == RemoteToRemoteRelay {
+		source, sourceRoot = EndpointDetails{DataPath: task.RsyncOptions.StagingDir}, task.RsyncOptions.StagingDir
+	}
+	algorithm := task.RsyncOptions.ChecksumAlgorithm.orDefault()
+	fmt.Printf("Verifying %d file(s) by %s checksums...\n", len(names), algorithm)
+	mismatches, err := compareChecksums(ctx, task, source, sourceRoot, task.Destination.DataPath, names, defaultSampleBatchSize)
+	if err != nil {
+		return err
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("verification found %d file(s) whose %s checksums differ between '%s' and '%s' (e.g., '%s')",
+			len(mismatches), algorithm, strings.Join(sourceRsyncPaths, "', '"), destinationRsyncPath, mismatches[0])
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package transx
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// CleanupResult records the cleanup of a temporary resource created during a migration
+// (e.g., a relay staging directory).
+type CleanupResult struct {
+	Resource string // Description of the resource (e.g., "relay staging directory /tmp/transx-relay-123")
+	Cleaned  bool   // Whether the resource was removed; false means it was leaked
+	Error    string // Error message if the cleanup failed
+}
+
+// cleanupRegistry tracks the temporary resources created during a migration, so that every one of
+// them is cleaned up on success, failure, cancellation, or panic, and the outcome is reported.
+// Creators release their resources as soon as they are done with them; run cleans up whatever is
+// left. A nil registry runs cleanups directly when they are released.
+type cleanupRegistry struct {
+	mu      sync.Mutex
+	pending []*cleanupEntry
+	results []CleanupResult
+}
+
+// cleanupEntry is a registered cleanup.
+type cleanupEntry struct {
+	resource string
+	fn       func() error
+	done     bool
+}
+
+// track registers the cleanup of a resource and returns a function that runs it (at most once),
+// typically deferred by the creator of the resource.
+func (r *cleanupRegistry) track(resource string, fn func() error) func() {
+	entry := &cleanupEntry{resource: resource, fn: fn}
+	if r != nil {
+		r.mu.Lock()
+		r.pending = append(r.pending, entry)
+		r.mu.Unlock()
+	}
+	return func() { r.release(entry) }
+}
+
+// release runs the cleanup of the entry unless it already ran, printing a warning if it fails.
+func (r *cleanupRegistry) release(entry *cleanupEntry) {
+	if r != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+	}
+	if entry.done {
+		return
+	}
+	entry.done = true
+
+	err := entry.fn()
+	if err != nil {
+		fmt.Printf("Warning: failed to clean up %s: %v\n", entry.resource, err)
+	}
+	if r != nil {
+		r.pending = slices.DeleteFunc(r.pending, func(e *cleanupEntry) bool { return e == entry })
+		result := CleanupResult{Resource: entry.resource, Cleaned: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		r.results = append(r.results, result)
+	}
+}
+
+// run cleans up the resources that have not been released, most recently registered first,
+// and returns the results of all cleanups since the previous run.
+func (r *cleanupRegistry) run() []CleanupResult {
+	for {
+		r.mu.Lock()
+		if len(r.pending) == 0 {
+			results := r.results
+			r.results = nil
+			r.mu.Unlock()
+			return results
+		}
+		entry := r.pending[len(r.pending)-1]
+		r.mu.Unlock()
+		r.release(entry)
+	}
+}
@@ -0,0 +1,164 @@
+package transx
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCleanupRegistry(t *testing.T) {
+	var order []string
+	cleanup := func(name string, err error) func() error {
+		return func() error {
+			order = append(order, name)
+			return err
+		}
+	}
+	r := &cleanupRegistry{}
+	r.track("first", cleanup("first", nil))
+	releaseSecond := r.track("second", cleanup("second", nil))
+	r.track("third", cleanup("third", errors.New("device busy")))
+	r.track("fourth", cleanup("fourth", nil))
+
+	releaseSecond()
+	releaseSecond() // Runs at most once
+	results := r.run()
+
+	if want := []string{"second", "fourth", "third", "first"}; !slices.Equal(order, want) {
+		t.Errorf("cleanups ran in order %q, want the released one, then the rest LIFO %q", order, want)
+	}
+	want := []CleanupResult{
+		{Resource: "second", Cleaned: true},
+		{Resource: "fourth", Cleaned: true},
+		{Resource: "third", Error: "device busy"},
+		{Resource: "first", Cleaned: true},
+	}
+	if !slices.Equal(results, want) {
+		t.Errorf("run() = %+v, want %+v", results, want)
+	}
+	if results := r.run(); len(results) != 0 {
+		t.Errorf("second run() = %+v, want no results", results)
+	}
+}
+
+// Without a registry (e.g., Transfer outside MigrateData), a cleanup runs when it is released.
+func TestNilCleanupRegistry(t *testing.T) {
+	var r *cleanupRegistry
+	calls := 0
+	release := r.track("resource", func() error { calls++; return nil })
+	if calls != 0 {
+		t.Fatal("cleanup ran before its release")
+	}
+	release()
+	release()
+	if calls != 1 {
+		t.Errorf("cleanup ran %d times, want once", calls)
+	}
+}
+
+func TestReportLeakedCleanups(t *testing.T) {
+	report := &MigrationReport{}
+	report.addCleanups([]CleanupResult{
+		{Resource: "relay staging directory /tmp/a", Cleaned: true},
+		{Resource: "filter file /tmp/b", Error: "permission denied"},
+	})
+	if len(report.Cleanups) != 2 {
+		t.Errorf("Cleanups = %+v, want both results", report.Cleanups)
+	}
+	want := []string{"failed to clean up filter file /tmp/b (leaked): permission denied"}
+	if !slices.Equal(report.Warnings, want) {
+		t.Errorf("Warnings = %q, want %q", report.Warnings, want)
+	}
+}
+
+// A migration canceled (or panicking) at any stage removes everything it created: the relay
+// staging directory and its lock, and the spilled files-from list.
+func TestMigrationCanceledLeaksNothing(t *testing.T) {
+	stages := []struct {
+		name  string
+		match func(args []string) bool
+		panic bool
+	}{
+		{name: "backup", match: func(args []string) bool { return args[len(args)-1] == "dump" }},
+		{name: "download", match: func(args []string) bool { return isRsync(args) && slices.Contains(args, "user@source:/data/") }},
+		{name: "upload", match: func(args []string) bool { return isRsync(args) && slices.Contains(args, "user@destination:/data/") }},
+		{name: "restore", match: func(args []string) bool { return args[len(args)-1] == "load" }},
+		{name: "panic during upload", panic: true,
+			match: func(args []string) bool { return isRsync(args) && slices.Contains(args, "user@destination:/data/") }},
+	}
+	for _, stage := range stages {
+		t.Run(stage.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("TMPDIR", tmp)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			reached := false
+			runner := &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+				if !stage.match(args) {
+					return nil, nil
+				}
+				reached = true
+				if entries, _ := os.ReadDir(tmp); len(entries) == 0 {
+					t.Errorf("nothing staged in %s when the %s stage ran", tmp, stage.name)
+				}
+				if stage.panic {
+					panic("injected")
+				}
+				cancel()
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}}
+			task := DataMigrationModel{
+				Source:       EndpointDetails{Username: "user", HostIP: "source", DataPath: "/data/", BackupCmd: "dump"},
+				Destination:  EndpointDetails{Username: "user", HostIP: "destination", DataPath: "/data/", RestoreCmd: "load"},
+				RsyncOptions: RsyncOption{Archive: true, FilesFromList: []string{"a.txt"}, CommandRunner: runner},
+			}
+
+			var report *MigrationReport
+			var err error
+			func() {
+				defer func() {
+					if p := recover(); p != nil && !stage.panic {
+						panic(p)
+					}
+				}()
+				report, err = MigrateDataWithReportContext(ctx, task)
+			}()
+
+			if !reached {
+				t.Fatalf("the %s stage was not reached", stage.name)
+			}
+			if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+				var names []string
+				for _, e := range entries {
+					names = append(names, filepath.Join(tmp, e.Name()))
+				}
+				t.Errorf("leaked after the %s stage: %s", stage.name, strings.Join(names, ", "))
+			}
+			if stage.panic {
+				return
+			}
+			if err == nil {
+				t.Fatal("MigrateDataWithReportContext() succeeded, want the cancellation")
+			}
+			if len(report.Cleanups) == 0 {
+				t.Error("report lists no cleanups")
+			}
+			for _, c := range report.Cleanups {
+				if !c.Cleaned {
+					t.Errorf("report lists %s as leaked: %s", c.Resource, c.Error)
+				}
+			}
+		})
+	}
+}
+
+// isRsync reports whether a recorded command line runs rsync.
+func isRsync(args []string) bool {
+	return filepath.Base(args[0]) == "rsync"
+}
@@ -0,0 +1,66 @@
+// Command transx runs transx operations on configuration files.
+//
+// Usage:
+//
+//	transx check <file>...
+//
+// check runs transx.CheckConfigFile on each file without contacting any host and prints the findings.
+// It exits with status 1 if any file has a finding of error severity, and 2 on a usage error.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yunkon-kim/transx"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "check":
+		if len(os.Args) < 3 {
+			usage()
+		}
+		os.Exit(check(os.Args[2:]))
+	default:
+		usage()
+	}
+}
+
+// usage prints the usage and exits with status 2.
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: transx check <file>...")
+	os.Exit(2)
+}
+
+// check checks each configuration file and returns the exit status.
+func check(paths []string) int {
+	status := 0
+	for _, path := range paths {
+		report, err := transx.CheckConfigFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			status = 1
+			continue
+		}
+		for _, finding := range report.Findings {
+			fmt.Printf("%s: %s\n", path, finding)
+		}
+		for _, role := range report.Roles {
+			fmt.Printf("%s: plan: %s\n", path, role)
+		}
+		for _, command := range report.Commands {
+			fmt.Printf("%s: plan: %s\n", path, strings.Join(command, " "))
+		}
+		if report.HasErrors() {
+			status = 1
+		} else {
+			fmt.Printf("%s: ok (%s)\n", path, report.Topology)
+		}
+	}
+	return status
+}
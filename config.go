@@ -0,0 +1,221 @@
+package transx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envOverridePrefix is the prefix of the environment variables read by LoadConfigWithEnv.
+const envOverridePrefix = "TRANSX"
+
+// LoadOption defines options for LoadConfig.
+type LoadOption struct {
+	// ValidateSchema, if true, validates the document against ConfigJSONSchema before decoding it,
+	// reporting unknown properties and type mismatches with their JSON paths.
+	ValidateSchema bool
+}
+
+// LoadConfig reads a DataMigrationModel from a JSON file, expands "~/" in SSH private key paths,
+// and validates the result with Validate.
+func LoadConfig(path string, opts LoadOption) (DataMigrationModel, error) {
+	return loadConfig(path, opts, false)
+}
+
+// LoadConfigWithEnv is like LoadConfig, but applies overrides from environment variables after
+// decoding the file and before validation, so a static base config can be kept in version control
+// while secrets and environment-specific fields are injected at runtime.
+//
+// The variable for a field is "TRANSX_" followed by the upper-cased Go field names of its path,
+// joined by "_", e.g., TRANSX_SOURCE_HOSTIP, TRANSX_DESTINATION_SSHPRIVATEKEYPATH,
+// TRANSX_RSYNCOPTIONS_DELETE, or TRANSX_WORKFLOWOPTIONS_PATHAUDIT_ENABLED. Values are parsed
+// according to the field type: booleans with strconv.ParseBool, durations with time.ParseDuration
+// (e.g., "90m"), times as RFC 3339, file modes in octal (e.g., "0755"), and string lists as
+// comma-separated values. A variable that is set to an empty string clears the field (e.g., an
+// empty TRANSX_SOURCE_HOSTIP makes the source local).
+// Lists of structs (e.g., ownership mappings) cannot be overridden.
+func LoadConfigWithEnv(path string, opts LoadOption) (DataMigrationModel, error) {
+	return loadConfig(path, opts, true)
+}
+
+// loadConfig implements LoadConfig and LoadConfigWithEnv.
+func loadConfig(path string, opts LoadOption, withEnv bool) (DataMigrationModel, error) {
+	var dmm DataMigrationModel
+
+	jsonData, err := os.ReadFile(path)
+	if err != nil {
+		return dmm, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	if opts.ValidateSchema {
+		var document any
+		if err := json.Unmarshal(jsonData, &document); err != nil {
+			return dmm, fmt.Errorf("failed to parse config JSON %s: %w", path, err)
+		}
+		if violations := validateAgainstSchema(document); len(violations) > 0 {
+			return dmm, fmt.Errorf("config %s does not match the schema:\n  %s", path, strings.Join(violations, "\n  "))
+		}
+	}
+
+	if err := json.Unmarshal(jsonData, &dmm); err != nil {
+		return dmm, fmt.Errorf("failed to parse config JSON %s: %w", path, err)
+	}
+
+	if withEnv {
+		if err := applyEnvOverrides(reflect.ValueOf(&dmm).Elem(), envOverridePrefix); err != nil {
+			return dmm, err
+		}
+	}
+
+	if err := expandHomeDir(&dmm.Source.SSHPrivateKeyPath); err != nil {
+		return dmm, err
+	}
+	if err := expandHomeDir(&dmm.Destination.SSHPrivateKeyPath); err != nil {
+		return dmm, err
+	}
+	if dmm.BackupEndpoint != nil {
+		if err := expandHomeDir(&dmm.BackupEndpoint.SSHPrivateKeyPath); err != nil {
+			return dmm, err
+		}
+	}
+
+	if err := Validate(dmm); err != nil {
+		return dmm, fmt.Errorf("invalid migration configuration in %s: %w", path, err)
+	}
+	if found := dmm.plaintextSecrets(); len(found) > 0 {
+		fmt.Printf("Warning: %s in %s contain(s) plaintext secrets; use secret references (secret://<name>) with a SecretsProvider instead\n",
+			strings.Join(found, ", "), path)
+	}
+	return dmm, nil
+}
+
+// expandHomeDir replaces a leading "~/" in *p with the current user's home directory.
+func expandHomeDir(p *string) error {
+	if !strings.HasPrefix(*p, "~/") {
+		return nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to expand '%s': %w", *p, err)
+	}
+	*p = filepath.Join(homeDir, (*p)[2:])
+	return nil
+}
+
+// applyEnvOverrides sets the fields of the struct v from environment variables named
+// prefix + "_" + upper-cased field name, recursing into nested structs.
+func applyEnvOverrides(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("json") == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(field.Name)
+		fv := v.Field(i)
+
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+			if err := applyEnvOverrides(fv, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setFieldFromEnv(fv, value); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setFieldFromEnv parses value according to the type of fv and stores it.
+func setFieldFromEnv(fv reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+	switch fv.Type() {
+	case reflect.TypeOf(time.Duration(0)):
+		if value == "" {
+			fv.SetInt(0)
+			return nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	case reflect.TypeOf(time.Time{}):
+		if value == "" {
+			fv.Set(reflect.ValueOf(time.Time{}))
+			return nil
+		}
+		ts, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(ts))
+		return nil
+	case reflect.TypeOf(os.FileMode(0)):
+		if value == "" {
+			fv.SetUint(0)
+			return nil
+		}
+		mode, err := strconv.ParseUint(value, 8, 32) // Octal, e.g., "0755"
+		if err != nil {
+			return err
+		}
+		fv.SetUint(mode)
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		if value == "" {
+			fv.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value == "" {
+			fv.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("fields of type %s cannot be set from the environment", fv.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		list := reflect.MakeSlice(fv.Type(), len(items), len(items))
+		for i, item := range items {
+			list.Index(i).SetString(item)
+		}
+		fv.Set(list)
+	default:
+		return fmt.Errorf("fields of type %s cannot be set from the environment", fv.Type())
+	}
+	return nil
+}
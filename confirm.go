@@ -0,0 +1,107 @@
+package transx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Confirmation codes identify the dangerous operations a Confirmer is asked about.
+const (
+	ConfirmRemoveSourceFiles = "remove-source-files" // RsyncOption.RemoveSourceFiles deletes files from the source
+	ConfirmMultiSourceDelete = "multi-source-delete" // RsyncOption.Delete with multiple source paths
+)
+
+// ConfirmationRequest describes a dangerous operation awaiting confirmation.
+type ConfirmationRequest struct {
+	Code    string            // One of the Confirm* constants, for policies keyed on the operation
+	Message string            // Human-readable description of the operation and its risk
+	Details map[string]string // Context of the operation (e.g., "source", "destination")
+}
+
+// Confirmer decides whether a dangerous operation may proceed, e.g., by prompting on a terminal or
+// by applying a policy keyed on the request's Code. An error aborts the migration like a refusal.
+type Confirmer interface {
+	Confirm(ctx context.Context, req ConfirmationRequest) (bool, error)
+}
+
+// ConfirmerFunc adapts a function to the Confirmer interface.
+type ConfirmerFunc func(ctx context.Context, req ConfirmationRequest) (bool, error)
+
+// Confirm calls f(ctx, req).
+func (f ConfirmerFunc) Confirm(ctx context.Context, req ConfirmationRequest) (bool, error) {
+	return f(ctx, req)
+}
+
+// ConfirmationDecision records the answer to a confirmation request, for audit.
+type ConfirmationDecision struct {
+	Code     string
+	Message  string
+	Approved bool
+	Error    string // Error returned by the Confirmer, if any
+	Time     time.Time
+}
+
+// pendingConfirmation is a dangerous operation of a task with the Force flag that an approval sets.
+type pendingConfirmation struct {
+	request ConfirmationRequest
+	force   *bool
+}
+
+// pendingConfirmations returns the dangerous operations of the task that are not acknowledged
+// by their Force flag.
+func (task *DataMigrationModel) pendingConfirmations() []pendingConfirmation {
+	details := map[string]string{"source": task.Source.displayPath(), "destination": task.Destination.displayPath()}
+
+	var requests []pendingConfirmation
+	if task.RsyncOptions.RemoveSourceFiles && !task.WorkflowOptions.ForceRemoveSourceFiles {
+		requests = append(requests, pendingConfirmation{
+			request: ConfirmationRequest{Code: ConfirmRemoveSourceFiles, Message: "RemoveSourceFiles deletes the transferred files from the source", Details: details},
+			force:   &task.WorkflowOptions.ForceRemoveSourceFiles,
+		})
+	}
+	if task.RsyncOptions.Delete && len(task.Source.AdditionalDataPaths) > 0 && !task.WorkflowOptions.ForceMultiSourceDelete {
+		multiDetails := map[string]string{"sources": strings.Join(task.Source.dataPaths(), ", ")}
+		for k, v := range details {
+			multiDetails[k] = v
+		}
+		requests = append(requests, pendingConfirmation{
+			request: ConfirmationRequest{Code: ConfirmMultiSourceDelete, Message: "Delete with multiple source paths removes destination files missing from every source", Details: multiDetails},
+			force:   &task.WorkflowOptions.ForceMultiSourceDelete,
+		})
+	}
+	return requests
+}
+
+// confirmDangerousOperations asks WorkflowOptions.Confirmer about each dangerous operation that is not
+// acknowledged by its Force flag, and sets the flag on approval. Without a Confirmer nothing is asked,
+// so Validate refuses the unacknowledged operations as before. The decisions are printed and returned.
+func (task *DataMigrationModel) confirmDangerousOperations(ctx context.Context) ([]ConfirmationDecision, error) {
+	confirmer := task.WorkflowOptions.Confirmer
+	if confirmer == nil {
+		return nil, nil
+	}
+
+	var decisions []ConfirmationDecision
+	for _, p := range task.pendingConfirmations() {
+		approved, err := confirmer.Confirm(ctx, p.request)
+		decision := ConfirmationDecision{Code: p.request.Code, Message: p.request.Message, Approved: approved && err == nil, Time: time.Now()}
+		if err != nil {
+			decision.Error = err.Error()
+		}
+		decisions = append(decisions, decision)
+
+		switch {
+		case err != nil:
+			fmt.Printf("Confirmation %s: failed: %v\n", p.request.Code, err)
+			return decisions, fmt.Errorf("confirmation of %s failed: %w", p.request.Code, err)
+		case !approved:
+			fmt.Printf("Confirmation %s: declined\n", p.request.Code)
+			return decisions, fmt.Errorf("%s was not confirmed: %s", p.request.Code, p.request.Message)
+		}
+		fmt.Printf("Confirmation %s: approved\n", p.request.Code)
+		*p.force = true
+	}
+	return decisions, nil
+}
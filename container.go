@@ -0,0 +1,193 @@
+package transx
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const defaultContainerRuntime = "docker"
+
+// isContainer determines if the EndpointDetails represent data inside a container.
+func (e *EndpointDetails) isContainer() bool {
+	return strings.TrimSpace(e.ContainerName) != ""
+}
+
+// containerRuntime returns the container runtime CLI to use for the endpoint.
+func (e *EndpointDetails) containerRuntime() string {
+	if strings.TrimSpace(e.ContainerRuntime) == "" {
+		return defaultContainerRuntime
+	}
+	return e.ContainerRuntime
+}
+
+// hostEndpoint returns the endpoint of the host running the container,
+// i.e., the same connection settings without the container fields.
+func (e *EndpointDetails) hostEndpoint() EndpointDetails {
+	host := *e
+	host.ContainerName = ""
+	host.ContainerRuntime = ""
+	host.VolumeHostPath = ""
+	return host
+}
+
+// wrapContainerCommand wraps a shell command so that it runs inside the endpoint's container.
+// The "-i" flag keeps stdin attached so that commands reading input (e.g., restores) work.
+func (e *EndpointDetails) wrapContainerCommand(command string) string {
+	return fmt.Sprintf("%s exec -i %s sh -c %s", e.containerRuntime(), shellQuote(e.ContainerName), shellQuote(command))
+}
+
+// validateContainer checks the container fields of the endpoint.
+func (e *EndpointDetails) validateContainer() error {
+	if !e.isContainer() {
+		if strings.TrimSpace(e.ContainerRuntime) != "" || strings.TrimSpace(e.VolumeHostPath) != "" {
+			return fmt.Errorf("ContainerRuntime and VolumeHostPath require ContainerName")
+		}
+		return nil
+	}
+	if strings.ContainsAny(e.ContainerName, " \t\n'\"") {
+		return fmt.Errorf("container name '%s' contains invalid characters", e.ContainerName)
+	}
+	if strings.ContainsAny(e.containerRuntime(), " \t\n'\"") {
+		return fmt.Errorf("container runtime '%s' must be a single executable name", e.ContainerRuntime)
+	}
+	if !strings.HasPrefix(e.DataPath, "/") {
+		return fmt.Errorf("DataPath '%s' must be an absolute path inside the container", e.DataPath)
+	}
+	if e.VolumeHostPath != "" && !strings.HasPrefix(e.VolumeHostPath, "/") {
+		return fmt.Errorf("VolumeHostPath '%s' must be an absolute host path", e.VolumeHostPath)
+	}
+	return nil
+}
+
+// verifyContainerRunning checks that the container runtime is available on the host
+// and that the container is running.
+func verifyContainerRunning(e EndpointDetails, sshConfig RsyncOption) error {
+	host := e.hostEndpoint()
+	inspectCmd := fmt.Sprintf("%s inspect --format '{{.State.Running}}' %s", e.containerRuntime(), shellQuote(e.ContainerName))
+	output, err := executeCommand(inspectCmd, host, sshConfig)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container '%s' with %s: %w\nOutput:\n%s", e.ContainerName, e.containerRuntime(), err, string(output))
+	}
+	if !strings.Contains(string(output), "true") {
+		return fmt.Errorf("container '%s' is not running", e.ContainerName)
+	}
+	return nil
+}
+
+// stagedPath returns the host-side path corresponding to the container's DataPath
+// once its content is available in dir, preserving the trailing-slash semantics of rsync.
+func stagedPath(dataPath, dir string) string {
+	p := path.Join(dir, path.Base(path.Clean(dataPath)))
+	if strings.HasSuffix(dataPath, "/") {
+		p += "/"
+	}
+	return p
+}
+
+// withVolumePath returns the host-side path for a container path backed by VolumeHostPath,
+// preserving the trailing-slash semantics of rsync.
+func withVolumePath(dataPath, volumeHostPath string) string {
+	p := path.Clean(volumeHostPath)
+	if strings.HasSuffix(dataPath, "/") {
+		p += "/"
+	}
+	return p
+}
+
+// makeHostStagingDir creates a staging directory on the container's host and returns its path.
+func makeHostStagingDir(e EndpointDetails, sshConfig RsyncOption) (string, error) {
+	// mktemp creates the directory 0700 whatever the umask, and chmod sets SessionDirMode
+	output, err := executeCommand(fmt.Sprintf(`dir=$(mktemp -d /tmp/transx-container-XXXXXX) && chmod %04o "$dir" && echo "$dir"`,
+		uint32(sshConfig.sessionDirMode())), e.hostEndpoint(), sshConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory on container host: %w\nOutput:\n%s", err, string(output))
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	dir := strings.TrimSpace(lines[len(lines)-1])
+	if !strings.HasPrefix(dir, "/tmp/transx-container-") {
+		return "", fmt.Errorf("unexpected output from mktemp on container host: %q", dir)
+	}
+	return dir, nil
+}
+
+// removeHostStagingDir removes a staging directory from the container's host.
+func removeHostStagingDir(e EndpointDetails, dir string, sshConfig RsyncOption) error {
+	if output, err := executeCommand("rm -rf "+shellQuote(dir), e.hostEndpoint(), sshConfig); err != nil {
+		return fmt.Errorf("failed to remove staging directory '%s' on container host: %w\nOutput:\n%s", dir, err, string(output))
+	}
+	return nil
+}
+
+// transferWithContainers transfers data from or to container endpoints.
+// A container endpoint with VolumeHostPath is transferred directly through the host volume path.
+// Otherwise, the source container's data is copied out with "<runtime> cp" into a staging directory
+// on its host before the transfer, and the destination's data is transferred into a staging directory
+// on its host and copied into the container afterwards. Staging directories are always removed.
+func transferWithContainers(ctx context.Context, task DataMigrationModel) (*TransferResult, error) {
+	hostTask := task
+	hostTask.Source = task.Source.hostEndpoint()
+	hostTask.Destination = task.Destination.hostEndpoint()
+
+	if task.Source.isContainer() {
+		if err := verifyContainerRunning(task.Source, task.RsyncOptions); err != nil {
+			return nil, fmt.Errorf("source container check failed: %w", err)
+		}
+		if task.Source.VolumeHostPath != "" {
+			hostTask.Source.DataPath = withVolumePath(task.Source.DataPath, task.Source.VolumeHostPath)
+		} else {
+			stagingDir, err := makeHostStagingDir(task.Source, task.RsyncOptions)
+			if err != nil {
+				return nil, err
+			}
+			defer task.RsyncOptions.cleanups.track("container host staging directory "+stagingDir, func() error {
+				return removeHostStagingDir(task.Source, stagingDir, task.RsyncOptions)
+			})()
+
+			cpCmd := fmt.Sprintf("%s cp %s %s", task.Source.containerRuntime(),
+				shellQuote(task.Source.ContainerName+":"+path.Clean(task.Source.DataPath)), shellQuote(stagingDir+"/"))
+			fmt.Printf("Copying data out of source container '%s'...\n", task.Source.ContainerName)
+			if output, err := executeCommandContext(ctx, cpCmd, hostTask.Source, task.RsyncOptions); err != nil {
+				return nil, fmt.Errorf("failed to copy data out of source container\nCommand: %s\nError: %w\nOutput:\n%s", cpCmd, err, string(output))
+			}
+			hostTask.Source.DataPath = stagedPath(task.Source.DataPath, stagingDir)
+		}
+	}
+
+	destinationStagingDir := ""
+	if task.Destination.isContainer() {
+		if err := verifyContainerRunning(task.Destination, task.RsyncOptions); err != nil {
+			return nil, fmt.Errorf("destination container check failed: %w", err)
+		}
+		if task.Destination.VolumeHostPath != "" {
+			hostTask.Destination.DataPath = withVolumePath(task.Destination.DataPath, task.Destination.VolumeHostPath)
+		} else {
+			stagingDir, err := makeHostStagingDir(task.Destination, task.RsyncOptions)
+			if err != nil {
+				return nil, err
+			}
+			defer task.RsyncOptions.cleanups.track("container host staging directory "+stagingDir, func() error {
+				return removeHostStagingDir(task.Destination, stagingDir, task.RsyncOptions)
+			})()
+			destinationStagingDir = stagingDir
+			hostTask.Destination.DataPath = stagingDir + "/"
+		}
+	}
+
+	result, err := runRsyncTransfer(ctx, hostTask)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy the staged data into the destination container
+	if destinationStagingDir != "" && !task.RsyncOptions.DryRun {
+		cpCmd := fmt.Sprintf("%s cp %s %s", task.Destination.containerRuntime(),
+			shellQuote(destinationStagingDir+"/."), shellQuote(task.Destination.ContainerName+":"+path.Clean(task.Destination.DataPath)))
+		fmt.Printf("Copying data into destination container '%s'...\n", task.Destination.ContainerName)
+		if output, err := executeCommandContext(ctx, cpCmd, hostTask.Destination, task.RsyncOptions); err != nil {
+			return nil, fmt.Errorf("failed to copy data into destination container\nCommand: %s\nError: %w\nOutput:\n%s", cpCmd, err, string(output))
+		}
+	}
+	return result, nil
+}
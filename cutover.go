@@ -0,0 +1,293 @@
+package transx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ConfirmCutover is the code of the request asking the CutoverOption.Confirmer whether to cut over
+// after a pre-cutover round.
+const ConfirmCutover = "cutover"
+
+// defaultCutoverSyncInterval is the pause between pre-cutover rounds when CutoverOption.SyncInterval is zero.
+const defaultCutoverSyncInterval = time.Minute
+
+// CutoverOption defines a CutoverMigration.
+type CutoverOption struct {
+	SourceStopCmd       string // Stops the service on the source before the final pass, so its data is quiescent (required)
+	SourceStartCmd      string // Restarts the service on the source if the cutover fails after it was stopped (the safety net)
+	DestinationStartCmd string // Starts the service on the destination after the restore
+
+	// ReadinessCmd, if set, is polled once per second on the destination after DestinationStartCmd until
+	// it succeeds; the cutover fails if it does not succeed within ReadinessTimeout (0 uses 60 seconds).
+	ReadinessCmd     string
+	ReadinessTimeout time.Duration
+
+	SyncInterval time.Duration // Pause between pre-cutover rounds (0 uses 1 minute)
+	MaxSyncTime  time.Duration // Cut over at the latest once the pre-cutover rounds have run this long (0 waits for a signal)
+
+	// Cutover signals the cutover once a value is received or the channel is closed; a round running
+	// at that time completes first.
+	Cutover <-chan struct{} `json:"-"`
+
+	// Confirmer, if set, is asked after each pre-cutover round whether to cut over (code ConfirmCutover);
+	// a refusal keeps syncing, and an error aborts before the source is stopped.
+	Confirmer Confirmer `json:"-"`
+}
+
+// CutoverRound records a pre-cutover round.
+type CutoverRound struct {
+	Duration         time.Duration
+	FilesTransferred int64
+	BytesTransferred int64
+}
+
+// CutoverReport is the consolidated report of a CutoverMigration.
+type CutoverReport struct {
+	Rounds           []CutoverRound   // Pre-cutover rounds, in order
+	Final            *MigrationReport // Stages of the cutover: source stop, final transfer, restore, destination start (and source restart on failure)
+	CutoverStart     time.Time        // Time the source service was stopped (zero if the cutover did not start)
+	Downtime         time.Duration    // From stopping the source until the destination was ready, or until the source was restarted on failure
+	SourceRestarted  bool             // Whether the safety net restarted the source service after a failed cutover
+	SourceRestartErr string           // Error of the safety net restart, if it failed (the service is then down on both hosts)
+	Success          bool
+	Error            string
+}
+
+// PreCutoverRounds returns the number of pre-cutover rounds.
+func (r *CutoverReport) PreCutoverRounds() int {
+	return len(r.Rounds)
+}
+
+// validate checks the options of a CutoverMigration.
+func (o CutoverOption) validate() error {
+	switch {
+	case strings.TrimSpace(o.SourceStopCmd) == "":
+		return fmt.Errorf("cutover requires a source stop command")
+	case o.SyncInterval < 0 || o.MaxSyncTime < 0 || o.ReadinessTimeout < 0:
+		return fmt.Errorf("SyncInterval, MaxSyncTime, and ReadinessTimeout must not be negative")
+	case o.Cutover == nil && o.Confirmer == nil && o.MaxSyncTime == 0:
+		return fmt.Errorf("cutover requires a signal: Cutover, Confirmer, or MaxSyncTime")
+	}
+	return nil
+}
+
+// CutoverMigration migrates a live service with a short downtime. While the service runs on the
+// source, it transfers the data in rounds (without Delete) every SyncInterval until the cutover is
+// signaled through opts.Cutover, approved by opts.Confirmer, or MaxSyncTime has elapsed. It then stops
+// the service on the source, runs the final transfer (with Delete if the task sets it), the
+// destination RestoreCmd (if defined), and DestinationStartCmd with the readiness wait.
+//
+// If any step fails once the source was stopped, SourceStartCmd restarts the source service, even
+// if ctx was canceled. Canceling ctx during the pre-cutover rounds returns without touching the
+// service. Backup and pre-transfer commands of the task are not run.
+func CutoverMigration(ctx context.Context, task DataMigrationModel, opts CutoverOption) (*CutoverReport, error) {
+	report := &CutoverReport{}
+	err := cutover(ctx, task, opts, report)
+	report.Success = err == nil
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report, err
+}
+
+// cutover runs the pre-cutover rounds and the cutover, recording them in the report.
+func cutover(ctx context.Context, task DataMigrationModel, opts CutoverOption, report *CutoverReport) error {
+	if err := opts.validate(); err != nil {
+		return fmt.Errorf("invalid cutover options: %w", err)
+	}
+	task.attachAuditTrail()
+	if _, err := task.confirmDangerousOperations(ctx); err != nil {
+		return err
+	}
+	if err := Validate(task); err != nil {
+		return fmt.Errorf("rsync task validation failed: %w", err)
+	}
+	if err := syncUntilCutover(ctx, task, opts, report); err != nil {
+		return err
+	}
+
+	final := newMigrationReport(task)
+	report.Final = final
+	report.CutoverStart = time.Now()
+	err := finalCutover(ctx, task, opts, final)
+	if err != nil && len(final.Stages) > 0 { // The source stop ran first and may have stopped the service even if it failed
+		err = restartSource(task, opts, report, err)
+	}
+	report.Downtime = time.Since(report.CutoverStart)
+	final.finish(err)
+	fmt.Printf("Cutover downtime: %s\n", report.Downtime.Round(time.Millisecond))
+	return err
+}
+
+// syncUntilCutover runs the pre-cutover rounds until the cutover is signaled.
+func syncUntilCutover(ctx context.Context, task DataMigrationModel, opts CutoverOption, report *CutoverReport) error {
+	interval := opts.SyncInterval
+	if interval == 0 {
+		interval = defaultCutoverSyncInterval
+	}
+	var deadline <-chan time.Time
+	if opts.MaxSyncTime > 0 {
+		timer := time.NewTimer(opts.MaxSyncTime)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	roundTask := task
+	roundTask.RsyncOptions.Delete = false // The final pass prunes what the source deleted meanwhile
+	for {
+		fmt.Printf("Cutover: pre-cutover round %d...\n", len(report.Rounds)+1)
+		start := time.Now()
+		result, err := transfer(ctx, roundTask)
+		if err != nil {
+			return fmt.Errorf("pre-cutover round %d failed: %w", len(report.Rounds)+1, err)
+		}
+		report.Rounds = append(report.Rounds, CutoverRound{Duration: time.Since(start), FilesTransferred: result.FilesTransferred, BytesTransferred: result.BytesTransferred})
+
+		select {
+		case <-opts.Cutover:
+			return nil
+		case <-deadline:
+			fmt.Println("Cutover: MaxSyncTime elapsed")
+			return nil
+		default:
+		}
+		if opts.Confirmer != nil {
+			last := report.Rounds[len(report.Rounds)-1]
+			approved, err := opts.Confirmer.Confirm(ctx, ConfirmationRequest{
+				Code:    ConfirmCutover,
+				Message: fmt.Sprintf("Cut over now? Round %d transferred %d file(s) in %s", len(report.Rounds), last.FilesTransferred, last.Duration.Round(time.Second)),
+				Details: map[string]string{"source": task.Source.displayPath(), "destination": task.Destination.displayPath()},
+			})
+			if err != nil {
+				return fmt.Errorf("confirmation of %s failed: %w", ConfirmCutover, err)
+			}
+			if approved {
+				return nil
+			}
+		}
+
+		wait := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			wait.Stop()
+			return fmt.Errorf("cutover canceled before the source was stopped: %w", ctx.Err())
+		case <-opts.Cutover:
+			wait.Stop()
+			return nil
+		case <-deadline:
+			wait.Stop()
+			fmt.Println("Cutover: MaxSyncTime elapsed")
+			return nil
+		case <-wait.C:
+		}
+	}
+}
+
+// finalCutover stops the source service and runs the final transfer, the restore, and the
+// destination start, recording each stage in the report.
+func finalCutover(ctx context.Context, task DataMigrationModel, opts CutoverOption, report *MigrationReport) error {
+	fmt.Println("Cutover: stopping the source service...")
+	err := report.runCommandStage(StageSourceStop, func() ([]byte, error) {
+		return runStageCommand(ctx, report.stageTask(task, StageSourceStop), StageSourceStop, opts.SourceStopCmd, task.Source, 0)
+	})
+	if err != nil {
+		return fmt.Errorf("source stop command failed: %w", err)
+	}
+
+	fmt.Println("Cutover: transferring the final delta...")
+	report.EffectiveOptions = effectiveRsyncArgs(task)
+	err = report.runStage(StageTransfer, func() error {
+		result, attempts, err := transferWithFallback(ctx, report.stageTask(task, StageTransfer))
+		report.Transfer = result
+		report.TransferAttempts = attempts
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("final data transfer failed: %w", err)
+	}
+
+	if strings.TrimSpace(task.Destination.RestoreCmd) != "" {
+		fmt.Println("Cutover: restoring data...")
+		err := report.runCommandStage(StageRestore, func() ([]byte, error) { return restore(ctx, report.stageTask(task, StageRestore)) })
+		if err != nil {
+			return fmt.Errorf("restore operation failed: %w", err)
+		}
+	}
+
+	if startCmd := destinationStartCommand(opts); startCmd != "" {
+		fmt.Println("Cutover: starting the destination service...")
+		err := report.runCommandStage(StageDestinationStart, func() ([]byte, error) {
+			return runStageCommand(ctx, report.stageTask(task, StageDestinationStart), StageDestinationStart, startCmd, task.Destination, 0)
+		})
+		if err != nil {
+			return fmt.Errorf("destination start command failed: %w", err)
+		}
+	}
+	fmt.Println("Cutover completed successfully!")
+	return nil
+}
+
+// destinationStartCommand returns DestinationStartCmd followed by the readiness wait, or only the
+// readiness wait without a start command.
+func destinationStartCommand(opts CutoverOption) string {
+	startCmd := strings.TrimSpace(opts.DestinationStartCmd)
+	if strings.TrimSpace(opts.ReadinessCmd) == "" {
+		return startCmd
+	}
+	timeout := opts.ReadinessTimeout
+	if timeout == 0 {
+		timeout = defaultReadinessTimeout
+	}
+	if startCmd == "" {
+		return readinessCommand(opts.ReadinessCmd, timeout)
+	}
+	return fmt.Sprintf("(%s) && %s", startCmd, readinessCommand(opts.ReadinessCmd, timeout))
+}
+
+// restartSource restarts the source service after a failed cutover and returns the cutover error,
+// joined with the restart error if the restart failed as well. It runs even if ctx was canceled.
+func restartSource(task DataMigrationModel, opts CutoverOption, report *CutoverReport, cutoverErr error) error {
+	if strings.TrimSpace(opts.SourceStartCmd) == "" {
+		fmt.Println("Warning: the cutover failed with the source service stopped, and no SourceStartCmd is set to restart it")
+		report.Final.addWarnings("the source service is stopped: the cutover failed and no SourceStartCmd is set")
+		return cutoverErr
+	}
+	fmt.Println("Cutover failed; restarting the source service...")
+	err := report.Final.runCommandStage(StageSourceRestart, func() ([]byte, error) {
+		return runStageCommand(context.Background(), report.Final.stageTask(task, StageSourceRestart), StageSourceRestart, opts.SourceStartCmd, task.Source, 0)
+	})
+	if err != nil {
+		report.SourceRestartErr = err.Error()
+		return fmt.Errorf("%w; restarting the source service failed as well: %v", cutoverErr, err)
+	}
+	report.SourceRestarted = true
+	fmt.Println("Source service restarted")
+	return cutoverErr
+}
+
+// PrintCutoverSummary writes a human-readable summary of the cutover report to w: the pre-cutover
+// rounds, the downtime, and the summary of the cutover stages.
+func PrintCutoverSummary(w io.Writer, report CutoverReport) {
+	fmt.Fprintln(w, "=== Cutover Summary ===")
+	fmt.Fprintf(w, "Rounds:      %d pre-cutover round(s)\n", report.PreCutoverRounds())
+	for i, round := range report.Rounds {
+		fmt.Fprintf(w, "  #%d %s, %d file(s), %d bytes\n", i+1, round.Duration.Round(time.Millisecond), round.FilesTransferred, round.BytesTransferred)
+	}
+	if !report.CutoverStart.IsZero() {
+		fmt.Fprintf(w, "Downtime:    %s (from %s)\n", report.Downtime.Round(time.Millisecond), report.CutoverStart.Format(time.RFC3339))
+	}
+	if report.SourceRestarted {
+		fmt.Fprintln(w, "Safety net:  source service restarted")
+	} else if report.SourceRestartErr != "" {
+		fmt.Fprintf(w, "Safety net:  source service restart failed: %s\n", report.SourceRestartErr)
+	}
+	if report.Final != nil {
+		PrintSummary(w, *report.Final)
+	} else if !report.Success {
+		fmt.Fprintf(w, "Status:      FAILED: %s\n", report.Error)
+	}
+}
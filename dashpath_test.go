@@ -0,0 +1,153 @@
+package transx
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDashSafePath(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"-old-backups", "./-old-backups"},
+		{"--delete", "./--delete"},
+		{"-", "./-"},
+		{"data/-x", "data/-x"},
+		{"/srv/-old", "/srv/-old"},
+		{"./-old", "./-old"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := dashSafePath(tt.in); got != tt.want {
+			t.Errorf("dashSafePath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if got, want := mkdirCommand("-old", 0), "mkdir -p './-old'"; got != want {
+		t.Errorf("mkdirCommand() = %q, want %q", got, want)
+	}
+}
+
+// chdir changes the working directory for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestDashLeadingPaths(t *testing.T) {
+	chdir(t, t.TempDir())
+	for _, dir := range []string{"-src", "-dst"} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remote := func(path string) EndpointDetails {
+		return EndpointDetails{Username: "user", HostIP: "host", DataPath: path}
+	}
+	tests := []struct {
+		name      string
+		src, dst  EndpointDetails
+		filesFrom []string
+		wantPaths [][]string // Trailing arguments of each rsync process, from "--" on
+	}{
+		{name: "local source", src: EndpointDetails{DataPath: "-src/"}, dst: remote("/backups/"),
+			wantPaths: [][]string{{"--", "./-src/", "user@host:/backups/"}}},
+		{name: "local destination", src: remote("/data/"), dst: EndpointDetails{DataPath: "-dst"},
+			wantPaths: [][]string{{"--", "user@host:/data/", "./-dst"}}},
+		{name: "remote source", src: remote("-data/"), dst: EndpointDetails{DataPath: "-dst"},
+			wantPaths: [][]string{{"--", "user@host:./-data/", "./-dst"}}},
+		{name: "remote destination", src: EndpointDetails{DataPath: "-src/"}, dst: remote("-old-backups"),
+			wantPaths: [][]string{{"--", "./-src/", "user@host:./-old-backups"}}},
+		{name: "absolute paths", src: remote("/srv/-data/"), dst: EndpointDetails{DataPath: "-dst"},
+			wantPaths: [][]string{{"--", "user@host:/srv/-data/", "./-dst"}}},
+		{name: "files-from", src: remote("-data/"), dst: EndpointDetails{DataPath: "-dst"},
+			filesFrom: []string{"-rf", "--delete", "sub/-x"},
+			wantPaths: [][]string{{"--", "user@host:./-data/", "./-dst"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filesFrom []string
+			runner := &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+				for _, arg := range args {
+					if p, ok := strings.CutPrefix(arg, "--files-from="); ok {
+						data, _ := os.ReadFile(p)
+						filesFrom = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+					}
+				}
+				return []byte("sent 1 bytes\n"), nil
+			}}
+			task := DataMigrationModel{
+				Source:       tt.src,
+				Destination:  tt.dst,
+				RsyncOptions: RsyncOption{Archive: true, FilesFromList: tt.filesFrom, CommandRunner: runner},
+			}
+			if err := Transfer(task); err != nil {
+				t.Fatalf("Transfer() error = %v", err)
+			}
+
+			calls := runner.rsyncCalls()
+			if len(calls) != len(tt.wantPaths) {
+				t.Fatalf("rsync ran %d times, want %d", len(calls), len(tt.wantPaths))
+			}
+			for i, args := range calls {
+				want := tt.wantPaths[i]
+				if len(args) < len(want) || !slices.Equal(args[len(args)-len(want):], want) {
+					t.Errorf("rsync arguments %q, want them to end with %q", args, want)
+				}
+				// Options, including --files-from, come before the end-of-options marker
+				if end := slices.Index(args, "--"); end != len(args)-len(want) {
+					t.Errorf("rsync arguments %q have \"--\" at %d, want it right before the paths", args, end)
+				}
+			}
+			if tt.filesFrom != nil && !slices.Equal(filesFrom, tt.filesFrom) {
+				t.Errorf("files-from file holds %q, want %q read by rsync as paths", filesFrom, tt.filesFrom)
+			}
+		})
+	}
+}
+
+// In relay mode, both legs protect their paths, and the shell commands run on the endpoints
+// (e.g., the empty-source check) pass the paths so that no command takes them for options.
+func TestDashLeadingPathsRelay(t *testing.T) {
+	runner := &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+		return []byte("sent 1 bytes\n"), nil
+	}}
+	task := DataMigrationModel{
+		Source:       EndpointDetails{Username: "user", HostIP: "source", DataPath: "-data/"},
+		Destination:  EndpointDetails{Username: "user", HostIP: "destination", DataPath: "-old-backups"},
+		RsyncOptions: RsyncOption{Archive: true, Delete: true, CommandRunner: runner},
+	}
+	if err := Transfer(task); err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+
+	calls := runner.rsyncCalls()
+	if len(calls) != 2 {
+		t.Fatalf("rsync ran %d times, want both relay legs", len(calls))
+	}
+	download, upload := calls[0], calls[1]
+	if got := download[len(download)-3:]; got[0] != "--" || got[1] != "user@source:./-data/" {
+		t.Errorf("download leg ends with %q, want \"--\" and the protected source", got)
+	}
+	if got := upload[len(upload)-3:]; got[0] != "--" || got[2] != "user@destination:./-old-backups" {
+		t.Errorf("upload leg ends with %q, want \"--\" and the protected destination", got)
+	}
+
+	var listed bool
+	for _, cmd := range runner.commands() {
+		if strings.Contains(cmd, "'-") {
+			t.Errorf("shell command %q passes a path starting with a dash", cmd)
+		}
+		listed = listed || strings.Contains(cmd, "ls -A './-data/'")
+	}
+	if !listed {
+		t.Errorf("commands %q do not list the source './-data/'", runner.commands())
+	}
+}
@@ -0,0 +1,108 @@
+package transx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// BatchConfig is the document read by LoadBatchConfig: shared defaults and the tasks they apply to.
+type BatchConfig struct {
+	Defaults DataMigrationModel   // Settings shared by all tasks (e.g., Archive, Compress, SSH key paths)
+	Tasks    []DataMigrationModel // Tasks; their non-zero fields override Defaults
+}
+
+// MergeDefaults returns task with every zero-valued field taken from defaults. Nested structs
+// (endpoints, options) are merged field by field, so a task overrides individual settings;
+// slices and times are replaced as a whole. Since only non-zero task fields take precedence,
+// a task cannot turn off a boolean that defaults to true.
+func MergeDefaults(defaults, task DataMigrationModel) DataMigrationModel {
+	merged := task
+	mergeZeroFields(reflect.ValueOf(&merged).Elem(), reflect.ValueOf(defaults))
+	return merged
+}
+
+// mergeZeroFields sets the zero-valued exported fields of the struct dst from def, recursing into nested structs.
+func mergeZeroFields(dst, def reflect.Value) {
+	for i := 0; i < dst.NumField(); i++ {
+		if !dst.Type().Field(i).IsExported() {
+			continue
+		}
+		field, defField := dst.Field(i), def.Field(i)
+		if field.Kind() == reflect.Struct && field.Type() != reflect.TypeOf(time.Time{}) {
+			mergeZeroFields(field, defField)
+			continue
+		}
+		if field.IsZero() {
+			field.Set(defField)
+		}
+	}
+}
+
+// LoadBatchConfig reads a BatchConfig from a JSON file and returns its tasks with the defaults
+// merged in (see MergeDefaults). Like LoadConfig, it expands "~/" in SSH private key paths and
+// validates every merged task; errors name the index of the offending task.
+func LoadBatchConfig(path string, opts LoadOption) ([]DataMigrationModel, error) {
+	jsonData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch config file %s: %w", path, err)
+	}
+
+	if opts.ValidateSchema {
+		if violations := validateBatchAgainstSchema(jsonData); len(violations) > 0 {
+			return nil, fmt.Errorf("batch config %s does not match the schema:\n  %s", path, strings.Join(violations, "\n  "))
+		}
+	}
+
+	var batch BatchConfig
+	if err := json.Unmarshal(jsonData, &batch); err != nil {
+		return nil, fmt.Errorf("failed to parse batch config JSON %s: %w", path, err)
+	}
+	if len(batch.Tasks) == 0 {
+		return nil, fmt.Errorf("batch config %s defines no tasks", path)
+	}
+
+	tasks := make([]DataMigrationModel, 0, len(batch.Tasks))
+	for i, task := range batch.Tasks {
+		merged := MergeDefaults(batch.Defaults, task)
+		if err := expandHomeDir(&merged.Source.SSHPrivateKeyPath); err != nil {
+			return nil, fmt.Errorf("task %d: %w", i, err)
+		}
+		if err := expandHomeDir(&merged.Destination.SSHPrivateKeyPath); err != nil {
+			return nil, fmt.Errorf("task %d: %w", i, err)
+		}
+		if err := Validate(merged); err != nil {
+			return nil, fmt.Errorf("invalid migration configuration for task %d in %s: %w", i, path, err)
+		}
+		tasks = append(tasks, merged)
+	}
+	return tasks, nil
+}
+
+// validateBatchAgainstSchema checks the defaults and each task of a batch document against the
+// DataMigrationModel schema. Required properties are not enforced on the defaults, which are partial by nature.
+func validateBatchAgainstSchema(jsonData []byte) []string {
+	var document struct {
+		Defaults any
+		Tasks    []any
+	}
+	if err := json.Unmarshal(jsonData, &document); err != nil {
+		return []string{fmt.Sprintf("$: %v", err)}
+	}
+
+	var violations []string
+	for _, violation := range validateAgainstSchema(document.Defaults) {
+		if !strings.Contains(violation, "missing required property") {
+			violations = append(violations, strings.Replace(violation, "$", "$.Defaults", 1))
+		}
+	}
+	for i, task := range document.Tasks {
+		for _, violation := range validateAgainstSchema(task) {
+			violations = append(violations, strings.Replace(violation, "$", fmt.Sprintf("$.Tasks[%d]", i), 1))
+		}
+	}
+	return violations
+}
@@ -0,0 +1,171 @@
+package transx
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	defaultDirectoryStatsTop     = 10
+	defaultDirectoryStatsMaxKeys = 10000
+
+	// directoryStatsOther is the directory of the bucket aggregating the directories beyond the top rows
+	// and those beyond MaxKeys.
+	directoryStatsOther = "(other)"
+)
+
+// DirectoryStatsOption configures the per-directory statistics of the transfer, which show the
+// subtrees dominating a migration (e.g., "uploads/2023 was 78% of the bytes"). They are computed from
+// the entries rsync logs for each file sent, so with RsyncOption.MaxCapturedOutput they only cover
+// the files logged in the captured tail of the output.
+type DirectoryStatsOption struct {
+	Depth   int // Leading directory components the files are grouped by (e.g., 1 for "uploads", 2 for "uploads/2023"); 0 disables
+	Top     int // Directories reported, by bytes; the rest are summed up in "(other)" (0 uses 10)
+	MaxKeys int // Distinct directories tracked; files of further directories go to "(other)" (0 uses 10000)
+}
+
+// enabled reports whether per-directory statistics are requested.
+func (o DirectoryStatsOption) enabled() bool {
+	return o.Depth > 0
+}
+
+// validate checks the per-directory statistics settings.
+func (o DirectoryStatsOption) validate() error {
+	if o.Depth < 0 || o.Top < 0 || o.MaxKeys < 0 {
+		return fmt.Errorf("DirectoryStats Depth, Top, and MaxKeys must not be negative")
+	}
+	return nil
+}
+
+// DirectoryStat is the share of one directory in the files sent by the transfer.
+type DirectoryStat struct {
+	Directory    string  // Directory relative to the transfer root ("." for files directly in it, "(other)" for the rest)
+	Files        int64   // Regular files sent below the directory
+	Bytes        int64   // Size of those files in bytes
+	BytesPercent float64 // Share of the bytes of all files sent (0-100)
+}
+
+// DirectoryStats is the breakdown of the files sent by the transfer by directory.
+type DirectoryStats struct {
+	Depth       int
+	Directories []DirectoryStat // The top directories by bytes, followed by "(other)" if anything was left out
+	TotalFiles  int64
+	TotalBytes  int64
+}
+
+// directoryAggregator sums up the sent files by directory, tracking at most MaxKeys directories.
+type directoryAggregator struct {
+	opts  DirectoryStatsOption
+	dirs  map[string]*DirectoryStat
+	other DirectoryStat
+}
+
+// newDirectoryAggregator creates an aggregator for the options.
+func newDirectoryAggregator(opts DirectoryStatsOption) *directoryAggregator {
+	if opts.Top == 0 {
+		opts.Top = defaultDirectoryStatsTop
+	}
+	if opts.MaxKeys == 0 {
+		opts.MaxKeys = defaultDirectoryStatsMaxKeys
+	}
+	return &directoryAggregator{opts: opts, dirs: make(map[string]*DirectoryStat), other: DirectoryStat{Directory: directoryStatsOther}}
+}
+
+// addOutput adds the regular files sent by a transfer, parsed from the entries logged with
+// --out-format (see buildRsyncArgs).
+func (a *directoryAggregator) addOutput(output string) {
+	for _, line := range strings.Split(output, "\n") {
+		if entry, ok := parseDryRunEntry(line); ok && entry.isFileTransfer() {
+			a.add(entry.Name, entry.Size)
+		}
+	}
+}
+
+// add adds a file of the given size.
+func (a *directoryAggregator) add(name string, size int64) {
+	key := directoryKey(name, a.opts.Depth)
+	stat, ok := a.dirs[key]
+	if !ok {
+		if len(a.dirs) >= a.opts.MaxKeys {
+			stat = &a.other
+		} else {
+			stat = &DirectoryStat{Directory: key}
+			a.dirs[key] = stat
+		}
+	}
+	stat.Files++
+	stat.Bytes += size
+}
+
+// stats returns the top directories by bytes, with the rest summed up in "(other)".
+func (a *directoryAggregator) stats() *DirectoryStats {
+	result := &DirectoryStats{Depth: a.opts.Depth}
+	dirs := make([]DirectoryStat, 0, len(a.dirs))
+	for _, stat := range a.dirs {
+		dirs = append(dirs, *stat)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if dirs[i].Bytes != dirs[j].Bytes {
+			return dirs[i].Bytes > dirs[j].Bytes
+		}
+		return dirs[i].Directory < dirs[j].Directory
+	})
+
+	other := a.other
+	for i, stat := range dirs {
+		if i < a.opts.Top {
+			result.Directories = append(result.Directories, stat)
+		} else {
+			other.Files += stat.Files
+			other.Bytes += stat.Bytes
+		}
+	}
+	if other.Files > 0 {
+		result.Directories = append(result.Directories, other)
+	}
+
+	for _, stat := range result.Directories {
+		result.TotalFiles += stat.Files
+		result.TotalBytes += stat.Bytes
+	}
+	for i := range result.Directories {
+		if result.TotalBytes > 0 {
+			result.Directories[i].BytesPercent = float64(result.Directories[i].Bytes) * 100 / float64(result.TotalBytes)
+		}
+	}
+	return result
+}
+
+// directoryKey returns the first depth directory components of the name ("." for a file
+// directly in the transfer root).
+func directoryKey(name string, depth int) string {
+	parts := strings.Split(strings.Trim(name, "/"), "/")
+	dirs := parts[:len(parts)-1]
+	if len(dirs) == 0 {
+		return "."
+	}
+	return strings.Join(dirs[:min(depth, len(dirs))], "/")
+}
+
+// collectDirectoryStats returns the per-directory statistics of the files sent by a transfer with
+// the given output, or nil if they are not requested.
+func collectDirectoryStats(opts DirectoryStatsOption, output string) *DirectoryStats {
+	if !opts.enabled() {
+		return nil
+	}
+	aggregator := newDirectoryAggregator(opts)
+	aggregator.addOutput(output)
+	return aggregator.stats()
+}
+
+// printDirectoryStats writes the per-directory statistics as a table.
+func printDirectoryStats(w io.Writer, stats *DirectoryStats) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, stat := range stats.Directories {
+		fmt.Fprintf(tw, "  %s\t%d file(s)\t%d bytes\t%.1f%%\n", stat.Directory, stat.Files, stat.Bytes, stat.BytesPercent)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,122 @@
+package transx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// diskFullMarker is the error rsync reports when a write fails with ENOSPC.
+var diskFullMarker = []byte("No space left on device (28)")
+
+// DiskFullError is returned when an rsync transfer ran out of space on the receiving side. transx
+// stops rsync as soon as it reports the error, rather than letting it fail on every remaining file,
+// and measures the free space left.
+type DiskFullError struct {
+	Leg          RelayLeg // Relay leg that ran out of space ("" for direct transfers)
+	Path         string   // Display form of the full location (the destination, or the relay staging directory)
+	BytesWritten int64    // Bytes transferred before, per the last progress snapshot (-1 if no progress was streamed)
+	Available    int64    // Free bytes at Path after the failure (-1 if they could not be measured)
+	PartialKept  bool     // Whether the partially transferred file was kept (RsyncOption.Partial), so a retry resumes it
+	Retry        bool     // Whether RsyncOption.OnDiskFull asked for the transfer to be retried
+	Err          error    // Error of the stopped rsync process
+}
+
+func (e *DiskFullError) Error() string {
+	var b strings.Builder
+	b.WriteString("no space left on device")
+	if e.Path != "" {
+		fmt.Fprintf(&b, " at '%s'", e.Path)
+	}
+	if e.Leg != "" {
+		fmt.Fprintf(&b, " (relay %s leg)", e.Leg)
+	}
+	if e.BytesWritten >= 0 {
+		fmt.Fprintf(&b, "; stopped after %d bytes", e.BytesWritten)
+	}
+	if e.Available >= 0 {
+		fmt.Fprintf(&b, "; %d bytes free", e.Available)
+	}
+	if e.PartialKept {
+		b.WriteString("; the partially transferred file was kept (--partial), so a retry resumes it")
+	} else {
+		b.WriteString("; the partially transferred file was removed (no --partial), files completed before remain")
+	}
+	return b.String()
+}
+
+// Unwrap returns the error of the stopped rsync process.
+func (e *DiskFullError) Unwrap() error {
+	return e.Err
+}
+
+// diskFullDetector watches the output of an rsync process for diskFullMarker and kills the
+// process once it appears.
+type diskFullDetector struct {
+	kill func()
+
+	mu       sync.Mutex
+	carry    []byte // End of the previous write, in case the marker spans two writes
+	detected bool
+}
+
+// newDiskFullDetector returns a detector killing cmd, or its process group if killGroup is set
+// (see setProcessGroup).
+func newDiskFullDetector(cmd *exec.Cmd, killGroup bool) *diskFullDetector {
+	kill := func() {
+		if cmd.Process != nil {
+			cmd.Process.Kill()
+		}
+	}
+	if killGroup {
+		kill = func() { killProcessGroup(cmd) }
+	}
+	return &diskFullDetector{kill: kill}
+}
+
+func (d *diskFullDetector) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.detected {
+		return len(p), nil
+	}
+	data := append(d.carry, p...)
+	if bytes.Contains(data, diskFullMarker) {
+		d.detected = true
+		d.kill()
+		return len(p), nil
+	}
+	d.carry = append(d.carry[:0], data[max(0, len(data)-len(diskFullMarker)+1):]...)
+	return len(p), nil
+}
+
+// fired reports whether the marker appeared.
+func (d *diskFullDetector) fired() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.detected
+}
+
+// handleDiskFull completes a *DiskFullError in err with the full location target (the endpoint
+// receiving the data), the free space left there, and the decision of RsyncOption.OnDiskFull.
+func (task *DataMigrationModel) handleDiskFull(err error, target EndpointDetails) {
+	var diskFull *DiskFullError
+	if !errors.As(err, &diskFull) {
+		return
+	}
+	diskFull.Path = target.displayPath()
+	diskFull.PartialKept = task.RsyncOptions.Partial
+	diskFull.Available = -1
+	if available, _, measureErr := measureFreeSpace(target, task.RsyncOptions); measureErr == nil {
+		diskFull.Available = available
+	} else {
+		fmt.Printf("Warning: failed to measure the free space at '%s' after running out of space: %v\n", diskFull.Path, measureErr)
+	}
+	fmt.Printf("Transfer stopped: %v\n", diskFull)
+	if task.RsyncOptions.OnDiskFull != nil {
+		diskFull.Retry = task.RsyncOptions.OnDiskFull(diskFull)
+	}
+}
@@ -0,0 +1,166 @@
+package transx
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dryRunEntryPrefix marks the per-entry lines emitted by --out-format during a dry-run scan,
+// so they can be told apart from rsync's other output.
+const dryRunEntryPrefix = "transx-entry:"
+
+// dryRunEntry is an entry that a transfer would create, update, or delete.
+type dryRunEntry struct {
+	Itemize string // rsync's itemized change string (e.g., ">f+++++++++" or "*deleting")
+	Size    int64  // File length in bytes
+	Name    string // Path relative to the transfer root
+}
+
+// isDeletion reports whether the entry would be deleted from the destination.
+func (e dryRunEntry) isDeletion() bool {
+	return strings.HasPrefix(e.Itemize, "*deleting")
+}
+
+// isFileTransfer reports whether the entry is a regular file whose data is sent to the receiver
+// ("<f" when pushing to a remote destination, ">f" otherwise).
+func (e dryRunEntry) isFileTransfer() bool {
+	return len(e.Itemize) >= 2 && (e.Itemize[0] == '<' || e.Itemize[0] == '>') && e.Itemize[1] == 'f'
+}
+
+// dryRunScan is the result of a dry-run of the transfer: the would-be changes and the statistics.
+type dryRunScan struct {
+	Entries []dryRunEntry
+	Stats   *TransferResult
+}
+
+// scanDryRun runs the transfer as an rsync dry-run and lists the entries it would change.
+// In relay mode, the download leg is scanned against the staging directory (an empty temporary
+// directory unless StagingDir is set), since rsync cannot compare two remote endpoints directly.
+func scanDryRun(task DataMigrationModel) (*dryRunScan, error) {
+	task, releaseFilters, err := spillFilterRules(task)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseFilters()
+	rsyncCmdPath, args := buildRsyncArgs(task)
+	args = withoutArg(args, "--remove-source-files") // A dry-run must never modify the source
+	args = append(args, "-n", "--out-format="+dryRunEntryPrefix+"%i:%l:%n")
+
+	sourceRsyncPaths := task.Source.rsyncSourcePaths()
+	destinationRsyncPath := task.Destination.getRsyncPath()
+	if task.Topology() == RemoteToRemoteRelay {
+		dir, owned, err := relayStagingDir(task.RsyncOptions)
+		if err != nil {
+			return nil, err
+		}
+		if owned {
+			defer task.RsyncOptions.cleanups.track("dry-run staging directory "+dir, func() error {
+				return removeRelayStagingDir(task.RsyncOptions, dir)
+			})()
+		}
+		destinationRsyncPath = dir + "/"
+	}
+	args = append(args, rsyncPathArgs(sourceRsyncPaths, destinationRsyncPath)...)
+
+	if err := throttle(context.Background(), task.RsyncOptions, task.Source, task.Destination); err != nil {
+		return nil, err
+	}
+	cmd := newLocalCommand(context.Background(), task.RsyncOptions, rsyncCmdPath, args...)
+	start := time.Now()
+	output, err := commandOutput(context.Background(), task.RsyncOptions, cmd)
+	task.RsyncOptions.usage.record(cmd, start)
+	if err != nil {
+		return nil, fmt.Errorf("rsync dry-run failed from '%s' to '%s'\nCommand: %s %s\nError: %w\nOutput:\n%s",
+			strings.Join(sourceRsyncPaths, "', '"), destinationRsyncPath, rsyncCmdPath, strings.Join(args, " "), err, string(output))
+	}
+
+	scan := &dryRunScan{Stats: parseRsyncStats(string(output))}
+	for _, line := range strings.Split(string(output), "\n") {
+		if entry, ok := parseDryRunEntry(line); ok {
+			scan.Entries = append(scan.Entries, entry)
+		}
+	}
+	return scan, nil
+}
+
+// parseDryRunEntry parses a line emitted with the dry-run --out-format.
+func parseDryRunEntry(line string) (dryRunEntry, bool) {
+	rest, found := strings.CutPrefix(strings.TrimRight(line, "\r"), dryRunEntryPrefix)
+	if !found {
+		return dryRunEntry{}, false
+	}
+	parts := strings.SplitN(rest, ":", 3)
+	if len(parts) != 3 {
+		return dryRunEntry{}, false
+	}
+	size, _ := strconv.ParseInt(strings.ReplaceAll(parts[1], ",", ""), 10, 64)
+	return dryRunEntry{Itemize: strings.TrimSpace(parts[0]), Size: size, Name: parts[2]}, true
+}
+
+// dryRunCache memoizes dry-run scans within a single workflow run, so that every consumer of the
+// would-be file listing (e.g., the path audit) shares one tree walk. Scans are keyed by the
+// normalized task (rsync invocation and endpoints). The cache must be invalidated whenever the
+// data or the model may have changed, e.g., after a backup command ran on the source.
+type dryRunCache struct {
+	mu      sync.Mutex
+	scans   map[string]*dryRunScan
+	verbose bool // Log cache hits and misses
+}
+
+// newDryRunCache creates an empty dry-run cache.
+func newDryRunCache(verbose bool) *dryRunCache {
+	return &dryRunCache{scans: make(map[string]*dryRunScan), verbose: verbose}
+}
+
+// dryRunCacheKey returns the cache key of the normalized task.
+func dryRunCacheKey(task DataMigrationModel) string {
+	rsyncCmdPath, args := buildRsyncArgs(task)
+	parts := append([]string{rsyncCmdPath}, args...)
+	parts = append(parts, task.Source.rsyncSourcePaths()...)
+	parts = append(parts, task.Destination.getRsyncPath(), task.RsyncOptions.StagingDir)
+	return strings.Join(parts, "\x00")
+}
+
+// get returns the dry-run scan of the task, running it on a cache miss.
+// A nil cache always runs the scan.
+func (c *dryRunCache) get(task DataMigrationModel) (*dryRunScan, error) {
+	if c == nil {
+		return scanDryRun(task)
+	}
+	key := dryRunCacheKey(task)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if scan, ok := c.scans[key]; ok {
+		if c.verbose {
+			fmt.Println("Debug: dry-run cache hit")
+		}
+		return scan, nil
+	}
+	if c.verbose {
+		fmt.Println("Debug: dry-run cache miss, scanning source...")
+	}
+	scan, err := scanDryRun(task)
+	if err != nil {
+		return nil, err
+	}
+	c.scans[key] = scan
+	return scan, nil
+}
+
+// invalidate discards all cached scans.
+func (c *dryRunCache) invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.scans) > 0 && c.verbose {
+		fmt.Println("Debug: dry-run cache invalidated")
+	}
+	c.scans = make(map[string]*dryRunScan)
+}
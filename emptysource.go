@@ -0,0 +1,42 @@
+package transx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EmptySourceError is returned when a transfer is aborted because the source directory is empty.
+// With --delete, transferring an empty source (e.g., a mount that was not ready) would wipe the destination.
+type EmptySourceError struct {
+	Path string // Display form of the source endpoint
+}
+
+func (e *EmptySourceError) Error() string {
+	return fmt.Sprintf("source '%s' is empty; aborting to avoid wiping the destination (set AllowEmptySource to transfer anyway)", e.Path)
+}
+
+// shouldCheckEmptySource reports whether the source must be checked for emptiness before the transfer.
+// The check is on by default for delete-enabled transfers and can be extended to all transfers.
+func (task *DataMigrationModel) shouldCheckEmptySource() bool {
+	if task.WorkflowOptions.AllowEmptySource {
+		return false
+	}
+	return task.RsyncOptions.Delete || task.WorkflowOptions.AbortOnEmptySource
+}
+
+// checkSourceNotEmpty lists each source data path and returns an *EmptySourceError if one is an empty directory.
+// A source that is a file is never considered empty.
+func checkSourceNotEmpty(task DataMigrationModel) error {
+	for _, p := range task.Source.dataPaths() {
+		dataPath := shellQuotePath(p)
+		listCmd := fmt.Sprintf("if [ -d %s ]; then ls -A %s | head -n 1; else echo %s; fi", dataPath, dataPath, dataPath)
+		output, err := executeCommand(listCmd, task.Source, task.RsyncOptions)
+		if err != nil {
+			return fmt.Errorf("failed to list source '%s' for the empty-source check: %w\nOutput:\n%s", task.Source.rsyncPathFor(p), err, string(output))
+		}
+		if strings.TrimSpace(string(output)) == "" {
+			return &EmptySourceError{Path: task.Source.rsyncPathFor(p)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package transx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Under RedactionShareable, a failing BackupCmd on a BackupEndpoint must not reveal its host or user.
+func TestOperationErrorRedactsBackupEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		output   string
+		secrets  []string
+	}{
+		{name: "with username", username: "backupuser", output: "backupuser@nfs-head: Permission denied (publickey).",
+			secrets: []string{"backupuser", "nfs-head"}},
+		{name: "without username", output: "ssh: connect to host nfs-head port 22: Connection refused",
+			secrets: []string{"nfs-head"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+				return []byte(tt.output), exitError(255)
+			}}
+			task := DataMigrationModel{
+				Source:          EndpointDetails{Username: "app", HostIP: "db-host", DataPath: "/mnt/backups/dump.sql", BackupCmd: "mysqldump app > /mnt/backups/dump.sql"},
+				Destination:     EndpointDetails{DataPath: t.TempDir()},
+				BackupEndpoint:  &EndpointDetails{Username: tt.username, HostIP: "nfs-head", DataPath: "/mnt/backups"},
+				RsyncOptions:    RsyncOption{CommandRunner: runner},
+				WorkflowOptions: WorkflowOption{RedactionMode: RedactionShareable},
+			}
+
+			_, err := BackupContext(context.Background(), task)
+			var opErr *OperationError
+			if !errors.As(err, &opErr) || opErr.ExitCode != 255 {
+				t.Fatalf("BackupContext() error = %v, want an *OperationError with exit code 255", err)
+			}
+			for _, secret := range tt.secrets {
+				if strings.Contains(err.Error(), secret) {
+					t.Errorf("redacted error reveals %q:\n%s", secret, err.Error())
+				}
+			}
+			if !strings.Contains(err.Error(), "host-") {
+				t.Errorf("redacted error has no host placeholder:\n%s", err.Error())
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"exit error", exitError(23), 23},
+		{"wrapped exit error", fmt.Errorf("rsync: %w", exitError(12)), 12},
+		{"ssh failure", exitError(255), 255},
+		{"not an exit error", errors.New("executable file not found"), -1},
+		{"canceled", context.Canceled, -1},
+		{"nil", nil, -1},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("%s: exitCode() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOperationErrorStages(t *testing.T) {
+	remote := func(host, path string) EndpointDetails {
+		return EndpointDetails{Username: "user", HostIP: host, DataPath: path}
+	}
+	local := t.TempDir()
+	tests := []struct {
+		name      string
+		task      DataMigrationModel
+		call      func(DataMigrationModel) error
+		fail      func(args []string) bool // Whether the command fails, with exit code wantCode
+		wantStage Stage
+		wantCode  int
+		wantCmd   string // First word of OperationError.Command
+		wantLeg   RelayLeg
+	}{
+		{
+			name:      "transfer",
+			task:      DataMigrationModel{Source: remote("source", "/data/"), Destination: EndpointDetails{DataPath: local}},
+			call:      Transfer,
+			fail:      isRsync,
+			wantStage: StageTransfer, wantCode: 23, wantCmd: "rsync",
+		},
+		{
+			name: "relay download",
+			task: DataMigrationModel{Source: remote("source", "/data/"), Destination: remote("destination", "/data/")},
+			call: Transfer,
+			fail: func(args []string) bool {
+				return isRsync(args) && slices.Contains(args, "user@source:/data/")
+			},
+			wantStage: StageRelayDownload, wantCode: 23, wantCmd: "rsync", wantLeg: RelayDownload,
+		},
+		{
+			name: "relay upload",
+			task: DataMigrationModel{Source: remote("source", "/data/"), Destination: remote("destination", "/data/")},
+			call: Transfer,
+			fail: func(args []string) bool {
+				return isRsync(args) && args[len(args)-1] == "user@destination:/data/"
+			},
+			wantStage: StageRelayUpload, wantCode: 12, wantCmd: "rsync", wantLeg: RelayUpload,
+		},
+		{
+			name: "backup",
+			task: DataMigrationModel{Source: EndpointDetails{Username: "user", HostIP: "source", DataPath: "/data/", BackupCmd: "pg_dump app"},
+				Destination: EndpointDetails{DataPath: local}},
+			call:      Backup,
+			fail:      func(args []string) bool { return args[len(args)-1] == "pg_dump app" },
+			wantStage: StageBackup, wantCode: 2, wantCmd: "pg_dump",
+		},
+		{
+			name: "restore",
+			task: DataMigrationModel{Source: EndpointDetails{DataPath: local},
+				Destination: EndpointDetails{Username: "user", HostIP: "destination", DataPath: "/data/", RestoreCmd: "psql app"}},
+			call:      Restore,
+			fail:      func(args []string) bool { return args[len(args)-1] == "psql app" },
+			wantStage: StageRestore, wantCode: 3, wantCmd: "psql",
+		},
+		{
+			name: "migration",
+			task: DataMigrationModel{Source: EndpointDetails{Username: "user", HostIP: "source", DataPath: "/data/", BackupCmd: "pg_dump app"},
+				Destination: EndpointDetails{DataPath: local}},
+			call:      MigrateData,
+			fail:      func(args []string) bool { return args[len(args)-1] == "pg_dump app" },
+			wantStage: StageBackup, wantCode: 2, wantCmd: "pg_dump",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+				if tt.fail(args) {
+					return []byte("something went wrong\n"), exitError(tt.wantCode)
+				}
+				return []byte("sent 1 bytes\n"), nil
+			}}
+			tt.task.RsyncOptions.CommandRunner = runner
+			err := tt.call(tt.task)
+
+			var opErr *OperationError
+			if !errors.As(err, &opErr) {
+				t.Fatalf("error = %v, want an *OperationError", err)
+			}
+			if opErr.Stage != tt.wantStage || FailedStage(err) != tt.wantStage {
+				t.Errorf("Stage = %q, FailedStage() = %q, want %q", opErr.Stage, FailedStage(err), tt.wantStage)
+			}
+			if opErr.ExitCode != tt.wantCode {
+				t.Errorf("ExitCode = %d, want %d", opErr.ExitCode, tt.wantCode)
+			}
+			if len(opErr.Command) == 0 || !strings.HasPrefix(filepath.Base(opErr.Command[0]), tt.wantCmd) {
+				t.Errorf("Command = %q, want it to start with %s", opErr.Command, tt.wantCmd)
+			}
+			if !strings.Contains(opErr.Output, "something went wrong") {
+				t.Errorf("Output = %q, want the output of the command", opErr.Output)
+			}
+			var exitErr interface{ ExitCode() int }
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() != tt.wantCode {
+				t.Errorf("errors.As(err, *exec.ExitError) failed for %v", err)
+			}
+			if got := IsTransferError(err); got != (tt.wantStage == StageTransfer || tt.wantLeg != "") {
+				t.Errorf("IsTransferError() = %v", got)
+			}
+			var relayErr *RelayError
+			if got := errors.As(err, &relayErr); got != (tt.wantLeg != "") || (got && relayErr.Leg != tt.wantLeg) {
+				t.Errorf("error = %v, want a *RelayError for leg %q", err, tt.wantLeg)
+			}
+		})
+	}
+}
+
+func TestOperationErrorText(t *testing.T) {
+	underlying := exitError(23)
+	err := newOperationError(DataMigrationModel{}, StageTransfer, "rsync execution failed",
+		[]string{"rsync", "-a", "src/", "dst/"}, []byte("rsync error: some files could not be transferred\n"), underlying)
+	err.Attempts = 3
+
+	if !errors.Is(err, underlying) {
+		t.Error("errors.Is() does not find the underlying error")
+	}
+	text := err.Error()
+	for _, want := range []string{"rsync execution failed", "Command: rsync -a src/ dst/", "exit status 23", "(after 3 attempts)", "some files could not be transferred"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Error() = %q, want it to contain %q", text, want)
+		}
+	}
+
+	if FailedStage(errors.New("plain")) != "" || IsTransferError(errors.New("plain")) {
+		t.Error("a plain error is reported as a failed stage")
+	}
+	if FailedStage(fmt.Errorf("wrapped: %w", err)) != StageTransfer {
+		t.Error("FailedStage() does not unwrap")
+	}
+}
+
+// A failed shell command comes back as an *OperationError of the stage its options run for, which
+// formats as the underlying error (its callers report the command and output themselves) and is not
+// classified by rsync's exit codes.
+func TestExecuteCommandOperationError(t *testing.T) {
+	runner := &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+		return []byte("df: /data: No such file or directory\n"), exitError(23)
+	}}
+	endpoint := EndpointDetails{Username: "user", HostIP: "source", DataPath: "/data/"}
+	opts := RsyncOption{CommandRunner: runner, stage: StagePreflight}
+
+	_, err := executeCommand("df -P /data", endpoint, opts)
+	var opErr *OperationError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("executeCommand() error = %v, want an *OperationError", err)
+	}
+	if opErr.Stage != StagePreflight || opErr.ExitCode != 23 || !slices.Equal(opErr.Command, []string{"df -P /data"}) ||
+		!strings.Contains(opErr.Output, "No such file") {
+		t.Errorf("OperationError = %+v, want stage, exit code, command, and output of df", opErr)
+	}
+	if err.Error() != "exit status 23" {
+		t.Errorf("Error() = %q, want the underlying error only", err.Error())
+	}
+	if IsRetryableError(err) || IsRemoteRsyncMissing(err) || IsTransferError(err) {
+		t.Error("a shell command failure is classified by rsync's exit codes")
+	}
+
+	// The stage commands and the transfer set their stage
+	_, err = runStageCommand(context.Background(), DataMigrationModel{RsyncOptions: RsyncOption{CommandRunner: runner}},
+		StageHealthBefore, "systemctl is-active app", endpoint, 0)
+	if FailedStage(err) != StageHealthBefore {
+		t.Errorf("FailedStage() = %q, want %q", FailedStage(err), StageHealthBefore)
+	}
+}
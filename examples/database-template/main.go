@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/yunkon-kim/transx"
+)
+
+func main() {
+	var sourceDir, destinationDir string
+
+	// Setting up command-line flags
+	flag.StringVar(&sourceDir, "source", "/tmp/transx-db/source/", "Local directory the dump is written to")
+	flag.StringVar(&destinationDir, "destination", "/tmp/transx-db/destination/", "Local directory the dump is transferred to")
+	flag.Parse()
+
+	// Dump the database, transfer the dump, and load it on the destination.
+	// Replace the commands with e.g. mariadb-dump / mariadb invocations for a real database.
+	dmm, err := transx.NewDatabaseMigration(
+		transx.EndpointDetails{DataPath: sourceDir},
+		transx.EndpointDetails{DataPath: destinationDir},
+		"mkdir -p "+sourceDir+" && echo 'INSERT INTO t VALUES (1);' > "+sourceDir+"dump.sql",
+		"cat "+destinationDir+"dump.sql",
+		transx.RsyncOption{Verbose: true},
+	)
+	if err != nil {
+		log.Fatalf("Failed to create migration: %v", err)
+	}
+
+	// Execute the complete data migration workflow
+	if err := transx.MigrateData(dmm); err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+}
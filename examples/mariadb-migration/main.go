@@ -2,13 +2,11 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/yunkon-kim/transx"
@@ -35,54 +33,28 @@ func main() {
 		}
 	}
 
-	// Read JSON file
-	jsonData, err := os.ReadFile(configFile)
+	// Read, parse, and validate the migration configuration file
+	dmm, err := transx.LoadConfig(configFile, transx.LoadOption{})
 	if err != nil {
-		log.Fatalf("Failed to read config file %s: %v", configFile, err)
-	}
-
-	// Parse JSON data
-	var dmm transx.DataMigrationModel
-	err = json.Unmarshal(jsonData, &dmm)
-	if err != nil {
-		log.Fatalf("Failed to parse config JSON: %v", err)
-	}
-
-	// Validate migration configuration file
-	err = transx.Validate(dmm)
-	if err != nil {
-		log.Fatalf("Invalid migration configuration: %v", err)
+		log.Fatalf("Failed to load config: %v", err)
 	}
 
 	// Detect and validate migration scenario
-	isRelayMode := dmm.IsRelayMode()
-
-	if isRelayMode {
+	switch dmm.Topology() {
+	case transx.RemoteToRemoteRelay:
 		fmt.Println("Relay mode detected: Source and destination are both remote.")
 		fmt.Println("This machine will act as an intermediary relay for the data transfer.")
 		fmt.Printf("Source: %s@%s:%s\n", dmm.Source.Username, dmm.Source.HostIP, dmm.Source.DataPath)
 		fmt.Printf("Destination: %s@%s:%s\n", dmm.Destination.Username, dmm.Destination.HostIP, dmm.Destination.DataPath)
-	} else {
+	case transx.LocalToLocal:
 		fmt.Println("Direct mode detected.")
-
-		// Check if it's entirely local or involves remote endpoints
-		if dmm.Source.HostIP == "" && dmm.Destination.HostIP == "" {
-			fmt.Println("Local-to-local migration (both source and destination are on this machine).")
-		} else if dmm.Source.HostIP == "" && dmm.Destination.HostIP != "" {
-			fmt.Println("Local-to-remote migration (source is on this machine).")
-		} else if dmm.Source.HostIP != "" && dmm.Destination.HostIP == "" {
-			fmt.Println("Remote-to-local migration (destination is on this machine).")
-		}
-	}
-
-	// Expand tilde (~) in SSH private key paths
-	if strings.HasPrefix(dmm.Source.SSHPrivateKeyPath, "~/") {
-		homeDir, _ := os.UserHomeDir()
-		dmm.Source.SSHPrivateKeyPath = filepath.Join(homeDir, dmm.Source.SSHPrivateKeyPath[2:])
-	}
-	if strings.HasPrefix(dmm.Destination.SSHPrivateKeyPath, "~/") {
-		homeDir, _ := os.UserHomeDir()
-		dmm.Destination.SSHPrivateKeyPath = filepath.Join(homeDir, dmm.Destination.SSHPrivateKeyPath[2:])
+		fmt.Println("Local-to-local migration (both source and destination are on this machine).")
+	case transx.LocalToRemote:
+		fmt.Println("Direct mode detected.")
+		fmt.Println("Local-to-remote migration (source is on this machine).")
+	case transx.RemoteToLocal:
+		fmt.Println("Direct mode detected.")
+		fmt.Println("Remote-to-local migration (destination is on this machine).")
 	}
 
 	// Display commands (in verbose mode)
@@ -95,7 +67,7 @@ func main() {
 		}
 
 		// Display additional information for relay migration
-		if dmm.IsRelayMode() {
+		if dmm.Topology() == transx.RemoteToRemoteRelay {
 			fmt.Println("Relay transfer: Data will flow through this machine as an intermediary")
 			fmt.Printf("Source path: %s\n", dmm.Source.DataPath)
 			fmt.Printf("Destination path: %s\n", dmm.Destination.DataPath)
@@ -103,15 +75,14 @@ func main() {
 	}
 
 	// Execute the complete data migration workflow
-	if err := transx.MigrateData(dmm); err != nil {
-		log.Fatalf("Migration failed: %v", err)
-	}
+	report, err := transx.MigrateDataWithReport(dmm)
 
 	// Display summary information
-	totalTime := time.Since(startTime)
-	fmt.Println("\n=== Migration Summary ===")
-	fmt.Printf("Source: %s@%s:%s\n", dmm.Source.Username, dmm.Source.HostIP, dmm.Source.DataPath)
-	fmt.Printf("Destination: %s@%s:%s\n", dmm.Destination.Username, dmm.Destination.HostIP, dmm.Destination.DataPath)
-	fmt.Printf("Total migration time: %s\n", totalTime)
+	fmt.Println()
+	transx.PrintSummary(os.Stdout, *report)
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+	fmt.Printf("Total elapsed time (including setup): %s\n", time.Since(startTime))
 	fmt.Println("MariaDB migration completed successfully!")
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/yunkon-kim/transx"
+)
+
+func main() {
+	var sourceDir, destinationDir string
+
+	// Setting up command-line flags
+	flag.StringVar(&sourceDir, "source", "", "Directory to mirror (e.g., /srv/www/)")
+	flag.StringVar(&destinationDir, "destination", "", "Mirror directory (e.g., /backup/www/)")
+	flag.Parse()
+
+	// Make the destination an exact copy of the source
+	dmm, err := transx.NewMirror(
+		transx.EndpointDetails{DataPath: sourceDir},
+		transx.EndpointDetails{DataPath: destinationDir},
+		transx.RsyncOption{Verbose: true},
+	)
+	if err != nil {
+		log.Fatalf("Failed to create migration: %v", err)
+	}
+
+	// Execute the complete data migration workflow
+	if err := transx.MigrateData(dmm); err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+}
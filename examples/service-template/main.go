@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/yunkon-kim/transx"
+)
+
+func main() {
+	var sourceDir, destinationDir string
+
+	// Setting up command-line flags
+	flag.StringVar(&sourceDir, "source", "/tmp/transx-service/source/", "Local data directory of the source service")
+	flag.StringVar(&destinationDir, "destination", "/tmp/transx-service/destination/", "Local data directory of the destination service")
+	flag.Parse()
+
+	// Create some service data to migrate
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		log.Fatalf("Failed to create source directory: %v", err)
+	}
+	if err := os.WriteFile(sourceDir+"state.db", []byte("service state\n"), 0644); err != nil {
+		log.Fatalf("Failed to create source data: %v", err)
+	}
+
+	// Stop the service on both sides, mirror its data, then start it on the destination and wait
+	// until it is ready. Replace the commands with e.g. systemctl invocations for a real service.
+	dmm, err := transx.NewServiceMigration(
+		transx.EndpointDetails{DataPath: sourceDir},
+		transx.EndpointDetails{DataPath: destinationDir},
+		transx.ServiceHooks{
+			SourceStopCmd:       "echo 'stopping source service'",
+			DestinationStopCmd:  "mkdir -p " + destinationDir + " && echo 'stopping destination service'",
+			DestinationStartCmd: "touch " + destinationDir + ".ready",
+			ReadinessCmd:        "test -f " + destinationDir + ".ready",
+			ReadinessTimeout:    10 * time.Second,
+		},
+		transx.RsyncOption{Verbose: true, Exclude: []string{".ready"}},
+	)
+	if err != nil {
+		log.Fatalf("Failed to create migration: %v", err)
+	}
+
+	// Execute the complete data migration workflow
+	if err := transx.MigrateData(dmm); err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+}
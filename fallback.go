@@ -0,0 +1,213 @@
+package transx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Transfer backends (see RsyncOption.FallbackBackends).
+const (
+	BackendRsync = "rsync" // rsync, the primary backend
+	BackendTar   = "tar"   // tar streamed over ssh, for endpoints without rsync
+	BackendSFTP  = "sftp"  // Recognized, but not available (transx has no SFTP client)
+)
+
+// rsyncRemoteCommandNotFound is rsync's exit code when the remote rsync could not be started
+// (RERR_CMD_NOTFOUND, "remote command not found").
+const rsyncRemoteCommandNotFound = 127
+
+// TransferAttempt records the outcome of the transfer with one backend.
+type TransferAttempt struct {
+	Backend string
+	Success bool
+	Error   string // Error message if the attempt failed
+}
+
+// newTransferAttempt creates the attempt record of a backend that finished with err.
+func newTransferAttempt(backend string, err error) TransferAttempt {
+	attempt := TransferAttempt{Backend: backend, Success: err == nil}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	return attempt
+}
+
+// IsRemoteRsyncMissing reports whether err is an rsync failure caused by rsync not being installed
+// (or not in PATH) on the remote endpoint, based on the exit code of the *OperationError it wraps.
+// Authentication and connection failures are not classified as such.
+func IsRemoteRsyncMissing(err error) bool {
+	var opErr *OperationError
+	if !errors.As(err, &opErr) || opErr.shell {
+		return false
+	}
+	return opErr.ExitCode == rsyncRemoteCommandNotFound
+}
+
+// validateFallbackBackends checks that every fallback backend is available and can honor the
+// task's options with the same semantics as rsync.
+func (task *DataMigrationModel) validateFallbackBackends() error {
+	for _, backend := range task.RsyncOptions.FallbackBackends {
+		switch backend {
+		case BackendTar:
+			if unsupported := task.tarUnsupportedOptions(); len(unsupported) > 0 {
+				return fmt.Errorf("the tar backend cannot honor %s; remove them or drop the tar fallback", strings.Join(unsupported, ", "))
+			}
+		case BackendSFTP:
+			return fmt.Errorf("the sftp backend is not available")
+		case BackendRsync:
+			return fmt.Errorf("rsync is the primary backend and cannot be a fallback")
+		default:
+			return fmt.Errorf("unknown backend '%s' (use '%s')", backend, BackendTar)
+		}
+	}
+	return nil
+}
+
+// tarUnsupportedOptions returns the options of the task that the tar backend cannot honor.
+// tar always copies recursively and preserves permissions and times (and owners when run as root),
+// like rsync's archive mode, but it can neither compare nor prune the destination. Exclude patterns
+// are passed to tar if they name files anywhere in the tree (i.e., contain no slash).
+func (task *DataMigrationModel) tarUnsupportedOptions() []string {
+	opts := task.RsyncOptions
+	var unsupported []string
+	add := func(set bool, name string) {
+		if set {
+			unsupported = append(unsupported, name)
+		}
+	}
+	add(!opts.Archive, "non-archive mode (Archive disabled)")
+	add(opts.Delete, "Delete")
+	add(opts.DeleteDelay, "DeleteDelay")
+	add(opts.DryRun, "DryRun")
+	add(opts.Update, "Update")
+	add(opts.Partial, "Partial")
+	add(opts.BandwidthLimitKBps > 0 || opts.DownloadBandwidthLimitKBps > 0 || opts.UploadBandwidthLimitKBps > 0, "BandwidthLimitKBps")
+	add(opts.CopyDirlinks, "CopyDirlinks")
+	add(opts.RemoveSourceFiles, "RemoveSourceFiles")
+	add(opts.NoPerms || opts.NoOwner || opts.NoGroup || opts.NoTimes, "NoPerms/NoOwner/NoGroup/NoTimes")
+	add(len(opts.Include) > 0, "Include")
+	add(len(opts.FilesFromList) > 0, "FilesFromList")
+	add(slices.ContainsFunc(opts.tarExcludes(), func(p string) bool { return strings.Contains(p, "/") }),
+		"Exclude patterns containing '/' (tar anchors them differently)")
+	add(!opts.StopAt.IsZero() || opts.TimeLimit > 0, "StopAt/TimeLimit")
+	add(len(opts.MtimeSplit.Boundaries) > 0, "MtimeSplit")
+	add(len(opts.OwnershipMap.Users) > 0 || len(opts.OwnershipMap.Groups) > 0, "OwnershipMap")
+	add(len(task.Source.AdditionalDataPaths) > 0, "AdditionalDataPaths")
+	add(task.Source.isContainer() || task.Destination.isContainer(), "container endpoints")
+	return unsupported
+}
+
+// runFallbackBackend transfers the task with the given fallback backend.
+func runFallbackBackend(ctx context.Context, task DataMigrationModel, backend string) (*TransferResult, error) {
+	switch backend {
+	case BackendTar:
+		return transferWithTar(ctx, task)
+	default:
+		return nil, fmt.Errorf("backend '%s' is not available", backend)
+	}
+}
+
+// transferWithTar streams a tar archive of the source into tar extracting on the destination,
+// each run locally or over ssh, following rsync's trailing-slash rule for the source path.
+// Compression and progress reporting are not applied; the result only carries the stream size
+// (BytesSent) and the duration.
+func transferWithTar(ctx context.Context, task DataMigrationModel) (*TransferResult, error) {
+	startTime := time.Now()
+
+	sourcePath := task.Source.DataPath
+	var excludeArgs string
+	for _, pattern := range task.RsyncOptions.tarExcludes() {
+		excludeArgs += " --exclude=" + shellQuote(pattern)
+	}
+	var createCmd string
+	if strings.HasSuffix(sourcePath, "/") {
+		createCmd = fmt.Sprintf("tar -C %s -cf -%s .", shellQuotePath(sourcePath), excludeArgs)
+	} else {
+		createCmd = fmt.Sprintf("tar -C %s -cf -%s %s", shellQuotePath(path.Dir(sourcePath)), excludeArgs, shellQuotePath(path.Base(sourcePath)))
+	}
+	extractCmd := fmt.Sprintf("%s && tar -C %s -xpf -", mkdirCommand(task.Destination.DataPath, task.RsyncOptions.CreateDestDirMode),
+		shellQuotePath(task.Destination.DataPath))
+
+	if err := throttle(ctx, task.RsyncOptions, task.Source, task.Destination); err != nil {
+		return nil, err
+	}
+	sender := endpointShellCommand(ctx, task.Source, task.RsyncOptions, createCmd)
+	receiver := endpointShellCommand(ctx, task.Destination, task.RsyncOptions, extractCmd)
+
+	stream, err := sender.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	counter := &countingReader{r: stream}
+	receiver.Stdin = counter
+	var senderErrOutput, receiverOutput bytes.Buffer
+	sender.Stderr = &senderErrOutput
+	receiver.Stdout = &receiverOutput
+	receiver.Stderr = &receiverOutput
+
+	fmt.Printf("Tar transfer: streaming from '%s' to '%s'...\n", task.Source.displayPath(), task.Destination.displayPath())
+	start := time.Now()
+	if err := sender.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start tar on the source: %w", err)
+	}
+	receiveErr := receiver.Run()
+	stream.Close() // A sender still writing after the receiver exited gets SIGPIPE instead of blocking
+	sendErr := sender.Wait()
+	task.RsyncOptions.usage.record(sender, start)
+	task.RsyncOptions.usage.record(receiver, start)
+	err = task.RsyncOptions.audit.record(sender.String()+" | "+receiver.String(), errors.Join(sendErr, receiveErr), task.Source, task.Destination)
+	if err != nil {
+		message := fmt.Sprintf("tar transfer failed from '%s' to '%s'", task.Source.displayPath(), task.Destination.displayPath())
+		switch {
+		case sendErr != nil && receiveErr != nil:
+			message += " (tar failed on both endpoints)"
+		case sendErr != nil:
+			message += " (tar failed on the source)"
+		case receiveErr != nil:
+			message += " (tar failed on the destination)"
+		}
+		output := append(senderErrOutput.Bytes(), receiverOutput.Bytes()...)
+		return nil, newOperationError(task, StageTransfer, message, []string{createCmd + " | " + extractCmd}, output, hostKeyFailure(output, err))
+	}
+	return &TransferResult{BytesSent: counter.n, Duration: time.Since(startTime)}, nil
+}
+
+// endpointShellCommand creates the command running a shell command on the endpoint: over ssh
+// (with the endpoint's own connection settings) or RsyncOption.RemoteShellCommand for remote
+// endpoints, or with "sh -c" locally.
+// Both run as RsyncOption.LocalRunAs, if set, like the ssh client started by rsync.
+func endpointShellCommand(ctx context.Context, endpoint EndpointDetails, opts RsyncOption, command string) *exec.Cmd {
+	if !endpoint.isRemote() {
+		return newLocalCommand(ctx, opts, "sh", "-c", command)
+	}
+	if strings.TrimSpace(opts.RemoteShellCommand) != "" {
+		shellCmdParts := append(customRemoteShellArgs(endpoint, opts), command)
+		return newLocalCommand(ctx, opts, shellCmdParts[0], shellCmdParts[1:]...)
+	}
+	userHost := endpoint.HostIP
+	if strings.TrimSpace(endpoint.Username) != "" {
+		userHost = endpoint.Username + "@" + endpoint.HostIP
+	}
+	sshCmdParts := append(sshBaseArgs(endpoint, opts), "-o", "ConnectTimeout=30", userHost, command)
+	return newLocalCommand(ctx, opts, sshCmdParts[0], sshCmdParts[1:]...)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
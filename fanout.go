@@ -0,0 +1,239 @@
+package transx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// defaultFanOutMaxDifferences is the number of differing paths listed per replica when
+// FanOutVerifyOption.MaxDifferences is zero.
+const defaultFanOutMaxDifferences = 100
+
+// FanOutVerifyOption defines the consistency check of a fan-out run by MigrateBatch: the succeeded
+// tasks that transfer the same source to different destinations are verified to hold identical
+// replicas, by comparing a digest of the tree of each destination with that of the source.
+//
+// The digest covers the regular files below the DataPath (with the trailing-slash rule of rsync),
+// except those excluded by the filters of the task, by their relative path and either their size and
+// modification time, or their checksum with Checksum. Directories, symlinks, and other entries are
+// not covered. The listings are taken with GNU find on each host.
+type FanOutVerifyOption struct {
+	Enabled        bool
+	Checksum       bool // Compare file checksums (RsyncOptions.ChecksumAlgorithm) instead of sizes and mtimes; reads every file
+	DrillDown      bool // List the paths that differ for each mismatching replica
+	MaxDifferences int  // Maximum number of differing paths listed per replica with DrillDown (0 uses 100)
+}
+
+// ReplicaStatus is the outcome of the fan-out verification of a destination.
+type ReplicaStatus string
+
+const (
+	ReplicaConsistent  ReplicaStatus = "consistent"  // The digest matches the source
+	ReplicaMismatch    ReplicaStatus = "mismatch"    // The digest differs from the source
+	ReplicaUnreachable ReplicaStatus = "unreachable" // The destination could not be listed, so its state is unknown
+	ReplicaSkipped     ReplicaStatus = "skipped"     // The task failed, so the destination was not verified
+)
+
+// FanOutVerification records the fan-out verification of one source and its destinations.
+type FanOutVerification struct {
+	Source   string         // Display form of the source endpoint
+	Digest   string         // Hex SHA-256 tree digest of the source ("" if it could not be listed)
+	Files    int            // Number of files covered by the source digest
+	Error    string         // Why the source could not be listed, leaving every replica unverified
+	Replicas []ReplicaCheck // Destinations of the source, in batch order
+}
+
+// ReplicaCheck records the fan-out verification of one destination.
+type ReplicaCheck struct {
+	Index       int    // Index of the task in the batch
+	Destination string // Display form of the destination endpoint
+	Status      ReplicaStatus
+	Digest      string   // Hex SHA-256 tree digest of the destination ("" unless listed)
+	Files       int      // Number of files covered by the digest
+	Error       string   // Why the destination could not be listed (ReplicaUnreachable) or was skipped
+	Differences []string // Differing paths with DrillDown (e.g., "db/a.sql: differs"), at most MaxDifferences
+	Truncated   int      // Number of further differing paths left out of Differences
+}
+
+// fanOutGroups returns the indexes of the tasks grouped by source and filters, in batch order,
+// keeping the groups of at least two tasks.
+func fanOutGroups(tasks []DataMigrationModel) [][]int {
+	var keys []string
+	groups := make(map[string][]int)
+	for i, task := range tasks {
+		rules, _ := task.RsyncOptions.filterRules()
+		parts := append([]string{task.Source.displayPath(), task.Source.ContainerName}, task.Source.AdditionalDataPaths...)
+		for _, p := range task.RsyncOptions.FilesFromList {
+			rules = append(rules, "files-from "+p)
+		}
+		key := strings.Join(append(parts, rules...), "\x00")
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+	var result [][]int
+	for _, key := range keys {
+		if len(groups[key]) > 1 {
+			result = append(result, groups[key])
+		}
+	}
+	return result
+}
+
+// treeListing maps the relative paths of the files of a tree to what is compared of them (the size
+// and modification time, or the checksum).
+type treeListing map[string]string
+
+// digest returns the hex SHA-256 digest of the sorted listing.
+func (l treeListing) digest() string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%s\n", name, l[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// listTree lists the regular files below root on the endpoint that the filters of the task do not
+// exclude. prefix is the path of root relative to the transfer root, which the filters apply to.
+func listTree(ctx context.Context, task DataMigrationModel, endpoint EndpointDetails, root, prefix string, checksum bool) (treeListing, error) {
+	findCmd := fmt.Sprintf(`find %s -type f -printf '%%P\t%%s\t%%T@\n'`, shellQuotePath(root))
+	output, err := executeCommandContext(ctx, findCmd, endpoint, task.RsyncOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list '%s': %w\nOutput:\n%s", root, err, string(output))
+	}
+	listing := make(treeListing)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || fields[0] == "" {
+			continue
+		}
+		if excludingPattern(task.RsyncOptions, prefix+fields[0]) != "" {
+			continue
+		}
+		mtime, _, _ := strings.Cut(fields[2], ".") // rsync preserves whole seconds on every filesystem
+		listing[fields[0]] = fields[1] + " " + mtime
+	}
+	if !checksum {
+		return listing, nil
+	}
+
+	hasher, err := detectHasher(ctx, endpoint, task.RsyncOptions, task.RsyncOptions.ChecksumAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(listing))
+	for name := range listing {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for start := 0; start < len(names); start += defaultSampleBatchSize {
+		batch := names[start:min(start+defaultSampleBatchSize, len(names))]
+		sums, err := hasher.checksums(ctx, task.RsyncOptions, root, batch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to checksum the files of '%s': %w", root, err)
+		}
+		for _, name := range batch {
+			listing[name] = sums[name] // "" if the file vanished or is unreadable, which differs from any checksum
+		}
+	}
+	return listing, nil
+}
+
+// treeDifferences returns the paths whose entries differ between the listings of the source and a replica.
+func treeDifferences(source, replica treeListing) []string {
+	var differences []string
+	for name, value := range source {
+		if other, ok := replica[name]; !ok {
+			differences = append(differences, name+": missing on the destination")
+		} else if other != value {
+			differences = append(differences, name+": differs")
+		}
+	}
+	for name := range replica {
+		if _, ok := source[name]; !ok {
+			differences = append(differences, name+": not on the source")
+		}
+	}
+	slices.Sort(differences)
+	return differences
+}
+
+// verifyFanOut verifies the replicas of a fan-out group: tasks is the batch, group the indexes of the
+// tasks sharing the source, and reports their reports. Tasks that failed are skipped.
+func verifyFanOut(ctx context.Context, opts FanOutVerifyOption, tasks []DataMigrationModel, reports []*MigrationReport, group []int) FanOutVerification {
+	first := tasks[group[0]]
+	verification := FanOutVerification{Source: first.Source.displayPath()}
+
+	// The listed directories hold the transferred files: with a trailing slash, the contents of the source
+	// DataPath are transferred into the destination DataPath, and without it, the directory itself
+	sourceRoot := strings.TrimSuffix(first.Source.DataPath, "/")
+	prefix := ""
+	if !strings.HasSuffix(first.Source.DataPath, "/") {
+		prefix = path.Base(sourceRoot) + "/"
+	}
+	var sourceListing treeListing
+	var sourceErr error
+	if len(first.Source.AdditionalDataPaths) > 0 {
+		sourceErr = fmt.Errorf("fan-out verification is not supported with multiple source paths")
+	} else {
+		sourceListing, sourceErr = listTree(ctx, first, first.Source, sourceRoot, prefix, opts.Checksum)
+	}
+	if sourceErr != nil {
+		verification.Error = sourceErr.Error()
+	} else {
+		verification.Digest = sourceListing.digest()
+		verification.Files = len(sourceListing)
+	}
+
+	maxDifferences := opts.MaxDifferences
+	if maxDifferences <= 0 {
+		maxDifferences = defaultFanOutMaxDifferences
+	}
+	for _, i := range group {
+		task := tasks[i]
+		replica := ReplicaCheck{Index: i, Destination: task.Destination.displayPath()}
+		switch {
+		case !reports[i].Success:
+			replica.Status = ReplicaSkipped
+			replica.Error = "the task failed"
+		case sourceErr != nil:
+			replica.Status = ReplicaSkipped
+			replica.Error = "the source could not be listed"
+		default:
+			root := path.Join(task.Destination.DataPath, prefix)
+			listing, err := listTree(ctx, task, task.Destination, root, prefix, opts.Checksum)
+			if err != nil {
+				replica.Status = ReplicaUnreachable
+				replica.Error = err.Error()
+				break
+			}
+			replica.Digest = listing.digest()
+			replica.Files = len(listing)
+			replica.Status = ReplicaConsistent
+			if replica.Digest != verification.Digest {
+				replica.Status = ReplicaMismatch
+				if opts.DrillDown {
+					differences := treeDifferences(sourceListing, listing)
+					if len(differences) > maxDifferences {
+						replica.Truncated = len(differences) - maxDifferences
+						differences = differences[:maxDifferences]
+					}
+					replica.Differences = differences
+				}
+			}
+		}
+		verification.Replicas = append(verification.Replicas, replica)
+	}
+	return verification
+}
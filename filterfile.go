@@ -0,0 +1,187 @@
+package transx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxFilterArgBytes is the size of the Exclude, Include, and junk pattern arguments above which they
+// are passed to rsync in a merge file rather than on the command line. The command line of a process
+// is limited by ARG_MAX (e.g., 256 KiB on some systems, shared with the environment), and exec fails
+// with E2BIG beyond it; thousands of generated patterns easily exceed it.
+const maxFilterArgBytes = 64 << 10
+
+// filterRules returns the Exclude, Include, and junk patterns of the options as merge-file rules, in
+// the order of their command line arguments, and the size of those arguments.
+func (o RsyncOption) filterRules() (rules []string, argBytes int) {
+	for _, ex := range o.Exclude {
+		if strings.TrimSpace(ex) != "" {
+			rules = append(rules, "- "+ex)
+			argBytes += len("--exclude=") + len(ex) + 1
+		}
+	}
+	for _, inc := range o.Include {
+		if strings.TrimSpace(inc) != "" {
+			rules = append(rules, "+ "+inc)
+			argBytes += len("--include=") + len(inc) + 1
+		}
+	}
+	for _, junk := range o.junkExcludes() {
+		rules = append(rules, "- "+junk)
+		argBytes += len("--exclude=") + len(junk) + 1
+	}
+	return rules, argBytes
+}
+
+// filterFilePlaceholder stands in for the merge file holding the filter patterns, when they are too
+// many for the command line, in command lines built before it is written (see BuildRsyncCommands).
+const filterFilePlaceholder = "<filter-file>"
+
+// filesFromPlaceholder stands in for the file holding FilesFromList in command lines built before
+// it is written (see BuildRsyncCommands).
+const filesFromPlaceholder = "<files-from-file>"
+
+// validateFilesFrom checks the FilesFromList of the task: rsync reads it one path per line, relative
+// to a single source directory.
+func (task *DataMigrationModel) validateFilesFrom() error {
+	list := task.RsyncOptions.FilesFromList
+	if len(list) == 0 {
+		return nil
+	}
+	for _, p := range list {
+		if strings.TrimSpace(p) == "" {
+			return fmt.Errorf("FilesFromList must not contain empty paths")
+		}
+		if strings.ContainsAny(p, "\r\n") {
+			return fmt.Errorf("FilesFromList path %q contains a line break", p)
+		}
+	}
+	switch {
+	case task.Source.isURL():
+		return fmt.Errorf("FilesFromList does not apply to a URL source")
+	case len(task.Source.AdditionalDataPaths) > 0:
+		return fmt.Errorf("FilesFromList cannot be combined with multiple source paths")
+	case len(task.RsyncOptions.MtimeSplit.Boundaries) > 0:
+		return fmt.Errorf("FilesFromList cannot be combined with MtimeSplit, which transfers file lists of its own")
+	case task.RsyncOptions.BigFileParallelStreams >= 2:
+		return fmt.Errorf("FilesFromList cannot be combined with BigFileParallelStreams")
+	case task.Source.isContainer() || task.Destination.isContainer():
+		return fmt.Errorf("FilesFromList is not supported with container endpoints")
+	}
+	return nil
+}
+
+// spillFilterRules keeps the filter patterns and the file list of the task off the rsync command line.
+// If the arguments of the patterns exceed maxFilterArgBytes, they are written into a temporary merge
+// file passed to rsync as --filter=merge instead of one argument per pattern; the rules keep the order,
+// and so the semantics, of the arguments. FilesFromList, which rsync only reads from a file, is always
+// written into a temporary --files-from file. It returns the task using the files (or the task
+// unchanged) and a function removing them, which are also tracked for cleanup.
+func spillFilterRules(task DataMigrationModel) (DataMigrationModel, func(), error) {
+	var releases []func()
+	release := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+
+	if rules, argBytes := task.RsyncOptions.filterRules(); task.RsyncOptions.filterFile == "" && argBytes > maxFilterArgBytes {
+		for _, rule := range rules {
+			if strings.ContainsAny(rule, "\r\n") {
+				return task, nil, fmt.Errorf("filter pattern %q contains a line break and cannot be written to a filter file", rule[2:])
+			}
+		}
+		path, err := writeListFile(task.RsyncOptions, "transx-filter-*", rules)
+		if err != nil {
+			return task, nil, fmt.Errorf("failed to write the filter file: %w", err)
+		}
+		fmt.Printf("Passing %d filter patterns (%d KiB) to rsync in the filter file %s\n", len(rules), argBytes>>10, path)
+		task.RsyncOptions.filterFile = path
+		releases = append(releases, task.RsyncOptions.cleanups.track("filter file "+path, removeListFile(path)))
+	}
+
+	if list := task.RsyncOptions.FilesFromList; task.RsyncOptions.filesFromFile == "" && len(list) > 0 {
+		path, err := writeListFile(task.RsyncOptions, "transx-files-from-*", list)
+		if err != nil {
+			release()
+			return task, nil, fmt.Errorf("failed to write the files-from file: %w", err)
+		}
+		if task.RsyncOptions.Verbose {
+			fmt.Printf("Passing %d paths of FilesFromList to rsync in the file %s\n", len(list), path)
+		}
+		task.RsyncOptions.filesFromFile = path
+		releases = append(releases, task.RsyncOptions.cleanups.track("files-from file "+path, removeListFile(path)))
+	}
+	return task, release, nil
+}
+
+// writeListFile writes the lines into a new 0600 file named after pattern, in a private temporary
+// directory of its own, and returns its path. With LocalRunAs, the local rsync reads the file as that
+// user, so the file is handed to it (see chownToRunAs) and the directory only lets it reach the file
+// by name (0711); the file is not made readable by anyone else.
+func writeListFile(opts RsyncOption, pattern string, lines []string) (string, error) {
+	dir, err := os.MkdirTemp("", "transx-list-*")
+	if err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		os.Remove(dir)
+		return "", err
+	}
+	path := file.Name()
+	_, err = file.WriteString(strings.Join(lines, "\n") + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && strings.TrimSpace(opts.LocalRunAs) != "" {
+		err = chownToRunAs(opts, path)
+		if err == nil {
+			err = os.Chmod(dir, 0711)
+		}
+	}
+	if err != nil {
+		removeListFile(path)()
+		return "", err
+	}
+	return path, nil
+}
+
+// chownToRunAs makes the LocalRunAs user the owner of a file transx created, so that the local rsync
+// running as that user can read it while it stays 0600. As root, transx changes the owner itself;
+// otherwise it runs "sudo -n chown" (through the CommandRunner, if set).
+func chownToRunAs(opts RsyncOption, path string) error {
+	runAs := strings.TrimSpace(opts.LocalRunAs)
+	if os.Geteuid() == 0 {
+		if u, err := user.Lookup(runAs); err == nil {
+			uid, err := strconv.Atoi(u.Uid)
+			if err == nil {
+				return os.Chown(path, uid, -1)
+			}
+		}
+	}
+	cmd := exec.Command("sudo", "-n", "chown", "--", runAs, path)
+	if output, err := commandOutput(context.Background(), opts, cmd); err != nil {
+		return fmt.Errorf("failed to give LocalRunAs user %s the file %s (sudo -n chown): %w\nOutput:\n%s", runAs, path, err, string(output))
+	}
+	return nil
+}
+
+// removeListFile returns the function removing the file written by writeListFile and its directory.
+func removeListFile(path string) func() error {
+	return func() error {
+		for _, p := range []string{path, filepath.Dir(path)} {
+			if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,171 @@
+package transx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tens of thousands of patterns and listed paths must not end up on the rsync command line, where
+// exec fails with E2BIG beyond ARG_MAX.
+func TestHugeFilterAndFileListsLaunch(t *testing.T) {
+	const n = 50000
+	var excludes, files []string
+	for i := 0; i < n; i++ {
+		excludes = append(excludes, fmt.Sprintf("assets/generated/%06d/*.tmp", i))
+		files = append(files, fmt.Sprintf("assets/%06d.bin", i))
+	}
+
+	var spilled []string
+	runner := &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+		argBytes := 0
+		for _, arg := range args {
+			argBytes += len(arg) + 1
+		}
+		if argBytes > maxFilterArgBytes {
+			t.Errorf("rsync command line is %d bytes, want at most %d", argBytes, maxFilterArgBytes)
+		}
+		for _, arg := range args {
+			var path, want string
+			var wantLines int
+			if p, ok := strings.CutPrefix(arg, "--filter=merge "); ok {
+				path, want, wantLines = p, "- "+excludes[0], n
+			} else if p, ok := strings.CutPrefix(arg, "--files-from="); ok {
+				path, want, wantLines = p, files[0], n
+			} else {
+				continue
+			}
+			spilled = append(spilled, path)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("reading %s: %v", path, err)
+			}
+			lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+			if len(lines) != wantLines || lines[0] != want {
+				t.Errorf("%s holds %d lines starting with %q, want %d starting with %q", arg, len(lines), lines[0], wantLines, want)
+			}
+			if info, err := os.Stat(path); err == nil && info.Mode().Perm() != 0600 {
+				t.Errorf("%s has mode %v, want 0600", path, info.Mode().Perm())
+			}
+		}
+		return []byte("sent 1 bytes\n"), nil
+	}}
+	task := DataMigrationModel{
+		Source:       EndpointDetails{Username: "user", HostIP: "source", DataPath: "/data/"},
+		Destination:  EndpointDetails{DataPath: t.TempDir()},
+		RsyncOptions: RsyncOption{Archive: true, Exclude: excludes, FilesFromList: files, CommandRunner: runner},
+	}
+
+	if err := Transfer(task); err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+	if len(runner.rsyncCalls()) != 1 || len(spilled) != 2 {
+		t.Fatalf("rsync ran %d times with %d spilled files, want once with 2", len(runner.rsyncCalls()), len(spilled))
+	}
+	for _, path := range spilled {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s after the transfer: %v, want it removed", path, err)
+		}
+	}
+}
+
+func TestSpillFilterRules(t *testing.T) {
+	many := make([]string, 10000)
+	for i := range many {
+		many[i] = fmt.Sprintf("pattern-%05d", i)
+	}
+	tests := []struct {
+		name          string
+		opts          RsyncOption
+		wantFilter    bool
+		wantFilesFrom bool
+	}{
+		{name: "few patterns stay on the command line", opts: RsyncOption{Exclude: []string{"*.log"}, Include: []string{"keep/"}}},
+		{name: "many patterns", opts: RsyncOption{Exclude: many}, wantFilter: true},
+		{name: "many include patterns", opts: RsyncOption{Include: many}, wantFilter: true},
+		{name: "short file list", opts: RsyncOption{FilesFromList: []string{"a"}}, wantFilesFrom: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := DataMigrationModel{Source: EndpointDetails{DataPath: "/src/"}, Destination: EndpointDetails{DataPath: "/dst/"}, RsyncOptions: tt.opts}
+			spilled, release, err := spillFilterRules(task)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+			if got := spilled.RsyncOptions.filterFile != ""; got != tt.wantFilter {
+				t.Errorf("filter file written = %v, want %v", got, tt.wantFilter)
+			}
+			if got := spilled.RsyncOptions.filesFromFile != ""; got != tt.wantFilesFrom {
+				t.Errorf("files-from file written = %v, want %v", got, tt.wantFilesFrom)
+			}
+			_, args := buildRsyncArgs(spilled)
+			for _, arg := range args {
+				if strings.HasPrefix(arg, "--exclude=pattern-") || strings.HasPrefix(arg, "--include=pattern-") {
+					if tt.wantFilter {
+						t.Fatalf("spilled pattern %s still on the command line", arg)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestValidateFilesFromList(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(task *DataMigrationModel)
+		wantErr string
+	}{
+		{name: "valid", modify: func(task *DataMigrationModel) {}},
+		{name: "empty path", modify: func(task *DataMigrationModel) { task.RsyncOptions.FilesFromList = []string{" "} }, wantErr: "empty paths"},
+		{name: "line break", modify: func(task *DataMigrationModel) { task.RsyncOptions.FilesFromList = []string{"a\nb"} }, wantErr: "line break"},
+		{name: "multiple source paths", modify: func(task *DataMigrationModel) { task.Source.AdditionalDataPaths = []string{"/other/"} },
+			wantErr: "multiple source paths"},
+		{name: "mtime split", modify: func(task *DataMigrationModel) {
+			task.RsyncOptions.MtimeSplit.Boundaries = []time.Time{time.Now()}
+		}, wantErr: "MtimeSplit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := DataMigrationModel{
+				Source:       EndpointDetails{DataPath: "/src/"},
+				Destination:  EndpointDetails{DataPath: "/dst/"},
+				RsyncOptions: RsyncOption{FilesFromList: []string{"a/b.txt", "-c.txt"}},
+			}
+			tt.modify(&task)
+			err := task.validateFilesFrom()
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("validateFilesFrom() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// The preview shows the merge file the transfer passes instead of the patterns it spills.
+func TestBuildRsyncCommandsShowsFilterFile(t *testing.T) {
+	many := make([]string, 10000)
+	for i := range many {
+		many[i] = fmt.Sprintf("pattern-%05d", i)
+	}
+	task := DataMigrationModel{
+		Source:       EndpointDetails{DataPath: "/src/"},
+		Destination:  EndpointDetails{DataPath: "/dst/"},
+		RsyncOptions: RsyncOption{Exclude: many},
+	}
+	commands, err := BuildRsyncCommands(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.Join(commands[0].Args, " ")
+	if !strings.Contains(line, "--filter=merge "+filterFilePlaceholder) || strings.Contains(line, "--exclude=pattern-") {
+		t.Errorf("previewed command = %.200s..., want the patterns in %s", line, filterFilePlaceholder)
+	}
+	if len(line) > maxFilterArgBytes {
+		t.Errorf("previewed command has %d bytes, want it to fit the command line", len(line))
+	}
+}
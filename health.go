@@ -0,0 +1,127 @@
+package transx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const defaultHealthCheckInterval = 5 * time.Second
+
+// Health check phases (see HealthCheckResult.Phase).
+const (
+	HealthBefore = "before"
+	HealthAfter  = "after"
+)
+
+// HealthCheckOption configures the health checks of the endpoints' HealthCmd, which run before the
+// workflow (e.g., the source service is healthy) and after it (e.g., the destination service came up).
+// Unlike the verify stage, which checks the data, they check the status of the services.
+type HealthCheckOption struct {
+	Attempts int           // Attempts until a check passes (0 or 1 runs it once)
+	Interval time.Duration // Delay between attempts (0 uses 5 seconds)
+	Timeout  time.Duration // Time limit of each attempt; a command still running is killed (0 means no limit)
+
+	// By default, a failed check before the workflow blocks the migration, and a failed check after it
+	// fails the migration. The Allow flags only record the failure as a warning.
+	AllowUnhealthyBefore bool
+	AllowUnhealthyAfter  bool
+}
+
+// validate checks the health check settings.
+func (o HealthCheckOption) validate() error {
+	if o.Attempts < 0 || o.Interval < 0 || o.Timeout < 0 {
+		return fmt.Errorf("HealthCheck Attempts, Interval, and Timeout must not be negative")
+	}
+	return nil
+}
+
+// HealthCheckResult records the outcome of the health check of an endpoint.
+type HealthCheckResult struct {
+	Phase    string // HealthBefore or HealthAfter
+	Endpoint string // "source" or "destination"
+	Healthy  bool
+	Attempts int    // Attempts run (the last one decided the outcome)
+	Error    string // Error of the last attempt if the endpoint is unhealthy
+	Output   string // Tail of the output of the last attempt, with secrets redacted
+}
+
+// runHealthChecks runs the HealthCmd of the source and the destination for the phase, recording the
+// results in the report. An unhealthy endpoint is an error unless the phase's Allow flag is set, in
+// which case it is recorded as a warning.
+func runHealthChecks(ctx context.Context, dmm DataMigrationModel, report *MigrationReport, phase string) error {
+	opts := dmm.WorkflowOptions.HealthCheck
+	allowed := opts.AllowUnhealthyBefore
+	stage := StageHealthBefore
+	if phase == HealthAfter {
+		allowed = opts.AllowUnhealthyAfter
+		stage = StageHealthAfter
+	}
+	dmm = report.stageTask(dmm, stage)
+
+	return report.runStage(stage, func() error {
+		endpoints := []struct {
+			name     string
+			endpoint EndpointDetails
+		}{{"source", dmm.Source}, {"destination", dmm.Destination}}
+		for _, e := range endpoints {
+			if strings.TrimSpace(e.endpoint.HealthCmd) == "" {
+				continue
+			}
+			result := checkHealth(ctx, dmm, stage, e.endpoint, opts)
+			result.Phase = phase
+			result.Endpoint = e.name
+			report.HealthChecks = append(report.HealthChecks, result)
+			if result.Healthy {
+				fmt.Printf("Health check of the %s passed\n", e.name)
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("health check of the %s was canceled: %w", e.name, err)
+			}
+			unhealthy := fmt.Sprintf("%s is unhealthy %s the migration after %d attempt(s): %s", e.name, phase, result.Attempts, result.Error)
+			if !allowed {
+				return errors.New(unhealthy)
+			}
+			fmt.Printf("Warning: %s\n", unhealthy)
+			report.addWarnings(unhealthy)
+		}
+		return nil
+	})
+}
+
+// checkHealth runs the HealthCmd of the endpoint until it passes or the attempts are exhausted,
+// waiting Interval between attempts.
+func checkHealth(ctx context.Context, dmm DataMigrationModel, stage Stage, endpoint EndpointDetails, opts HealthCheckOption) HealthCheckResult {
+	attempts := max(opts.Attempts, 1)
+	interval := opts.Interval
+	if interval == 0 {
+		interval = defaultHealthCheckInterval
+	}
+
+	var result HealthCheckResult
+	for attempt := 1; attempt <= attempts; attempt++ {
+		output, err := runStageCommand(ctx, dmm, stage, endpoint.HealthCmd, endpoint, opts.Timeout)
+		result = HealthCheckResult{Healthy: err == nil, Attempts: attempt, Output: stageOutput(output, dmm.WorkflowOptions.OutputTailLines)}
+		if err == nil {
+			return result
+		}
+		result.Error = err.Error()
+		if attempt == attempts || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return result
+		case <-time.After(interval):
+		}
+	}
+	return result
+}
+
+// hasHealthCmd reports whether either endpoint defines a HealthCmd.
+func (task *DataMigrationModel) hasHealthCmd() bool {
+	return strings.TrimSpace(task.Source.HealthCmd) != "" || strings.TrimSpace(task.Destination.HealthCmd) != ""
+}
@@ -0,0 +1,214 @@
+package transx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Default anomaly thresholds of CompareReports.
+const (
+	defaultBytesAnomalyRatio    = 10
+	defaultFilesAnomalyRatio    = 10
+	defaultDurationAnomalyRatio = 3
+)
+
+// AnomalyThresholds are the ratios between the current and the previous run of a task above which
+// (or below whose inverse) CompareReports flags a metric as anomalous. Zero uses the defaults:
+// 10 for bytes and files, 3 for the duration.
+type AnomalyThresholds struct {
+	BytesRatio    float64
+	FilesRatio    float64
+	DurationRatio float64
+}
+
+// MetricDelta compares a metric of two runs.
+type MetricDelta struct {
+	Previous float64
+	Current  float64
+	Ratio    float64 // Current / Previous (0 if Previous is 0)
+}
+
+// ReportDelta is the difference between two runs of the same task (see CompareReports).
+type ReportDelta struct {
+	PreviousStart     time.Time
+	BytesTransferred  MetricDelta
+	FilesTransferred  MetricDelta
+	Duration          MetricDelta // In seconds
+	WarningsDelta     int         // Change of the number of warnings
+	NewFailureClasses []string    // Failure classes of the current run absent from the previous one (see failureClasses)
+	Anomalies         []string    // Human-readable anomaly flags (e.g., "bytes transferred is 40.0x the previous run")
+}
+
+// CompareReports compares the current run of a task with the previous one with the default thresholds.
+func CompareReports(prev, curr MigrationReport) ReportDelta {
+	return CompareReportsWithThresholds(prev, curr, AnomalyThresholds{})
+}
+
+// CompareReportsWithThresholds compares the current run of a task with the previous one and flags the
+// metrics whose ratio exceeds the thresholds, and the failure classes that are new.
+func CompareReportsWithThresholds(prev, curr MigrationReport, thresholds AnomalyThresholds) ReportDelta {
+	delta := ReportDelta{
+		PreviousStart:    prev.StartTime,
+		BytesTransferred: newMetricDelta(float64(prev.bytesTransferred()), float64(curr.bytesTransferred())),
+		FilesTransferred: newMetricDelta(float64(prev.filesTransferred()), float64(curr.filesTransferred())),
+		Duration:         newMetricDelta(prev.duration().Seconds(), curr.duration().Seconds()),
+		WarningsDelta:    len(curr.Warnings) - len(prev.Warnings),
+	}
+
+	previousClasses := prev.failureClasses()
+	for _, class := range curr.failureClasses() {
+		if !slices.Contains(previousClasses, class) {
+			delta.NewFailureClasses = append(delta.NewFailureClasses, class)
+		}
+	}
+
+	delta.flag("bytes transferred", delta.BytesTransferred, thresholds.BytesRatio, defaultBytesAnomalyRatio)
+	delta.flag("files transferred", delta.FilesTransferred, thresholds.FilesRatio, defaultFilesAnomalyRatio)
+	delta.flag("duration", delta.Duration, thresholds.DurationRatio, defaultDurationAnomalyRatio)
+	for _, class := range delta.NewFailureClasses {
+		delta.Anomalies = append(delta.Anomalies, fmt.Sprintf("new failure: %s", class))
+	}
+	return delta
+}
+
+// newMetricDelta creates the delta of a metric.
+func newMetricDelta(previous, current float64) MetricDelta {
+	d := MetricDelta{Previous: previous, Current: current}
+	if previous > 0 {
+		d.Ratio = current / previous
+	}
+	return d
+}
+
+// flag records an anomaly if the metric changed by more than the threshold ratio in either direction.
+// Metrics that were zero in the previous run are not flagged, since they have no meaningful ratio.
+func (d *ReportDelta) flag(name string, metric MetricDelta, threshold, defaultThreshold float64) {
+	if threshold <= 0 {
+		threshold = defaultThreshold
+	}
+	switch {
+	case metric.Previous == 0:
+	case metric.Ratio > threshold || metric.Ratio < 1/threshold:
+		d.Anomalies = append(d.Anomalies, fmt.Sprintf("%s is %.1fx the previous run", name, metric.Ratio))
+	}
+}
+
+// bytesTransferred returns the bytes transferred by the run (0 if the transfer did not complete).
+func (r MigrationReport) bytesTransferred() int64 {
+	if r.Transfer == nil {
+		return 0
+	}
+	return r.Transfer.BytesTransferred
+}
+
+// filesTransferred returns the files transferred by the run (0 if the transfer did not complete).
+func (r MigrationReport) filesTransferred() int64 {
+	if r.Transfer == nil {
+		return 0
+	}
+	return r.Transfer.FilesTransferred
+}
+
+// duration returns the wall-clock duration of the run.
+func (r MigrationReport) duration() time.Duration {
+	if r.EndTime.IsZero() {
+		return 0
+	}
+	return r.EndTime.Sub(r.StartTime)
+}
+
+// failureClasses classifies the failures of the run: "<stage> failed" for each failed stage,
+// "fallback to <backend>" for each fallback backend attempted, and "leaked cleanup" for temporary
+// resources that could not be removed.
+func (r MigrationReport) failureClasses() []string {
+	var classes []string
+	add := func(class string) {
+		if !slices.Contains(classes, class) {
+			classes = append(classes, class)
+		}
+	}
+	for _, stage := range r.Stages {
+		if !stage.Success {
+			add(fmt.Sprintf("%s failed", stage.Stage))
+		}
+	}
+	for i, attempt := range r.TransferAttempts {
+		if i > 0 {
+			add(fmt.Sprintf("fallback to %s", attempt.Backend))
+		}
+	}
+	for _, cleanup := range r.Cleanups {
+		if !cleanup.Cleaned {
+			add("leaked cleanup")
+		}
+	}
+	return classes
+}
+
+// reportHistoryPath returns the path of the last successful report of the task in dir, keyed by
+// the configuration hash of the task.
+func reportHistoryPath(dir string, task DataMigrationModel) string {
+	return filepath.Join(dir, task.Hash()+".report.json")
+}
+
+// LoadPreviousReport loads the report of the last successful run of the task saved in the report
+// history directory (see WorkflowOption.ReportHistoryDir). It returns nil without an error if there
+// is none.
+func LoadPreviousReport(dir string, task DataMigrationModel) (*MigrationReport, error) {
+	data, err := os.ReadFile(reportHistoryPath(dir, task))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read previous report: %w", err)
+	}
+	report := &MigrationReport{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("failed to parse previous report: %w", err)
+	}
+	return report, nil
+}
+
+// saveReport saves the report as the last successful run of the task in the report history directory.
+func saveReport(dir string, task DataMigrationModel, report *MigrationReport) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := reportHistoryPath(dir, task)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// compareWithHistory compares the finished report with the previous successful run of the task in the
+// report history directory, recording the delta in the report, and saves the report as the new
+// baseline if the run succeeded (simulations are never saved).
+func compareWithHistory(dir string, task DataMigrationModel, report *MigrationReport) {
+	previous, err := LoadPreviousReport(dir, task)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	} else if previous != nil {
+		delta := CompareReportsWithThresholds(*previous, *report, task.WorkflowOptions.AnomalyThresholds)
+		report.Delta = &delta
+		for _, anomaly := range delta.Anomalies {
+			fmt.Printf("Anomaly: %s\n", anomaly)
+		}
+	}
+
+	if report.Success && !report.Simulation {
+		if err := saveReport(dir, task, report); err != nil {
+			fmt.Printf("Warning: failed to save the report to the history: %v\n", err)
+		}
+	}
+}
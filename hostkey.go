@@ -0,0 +1,63 @@
+package transx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// hostKeyFailedMarker is the message of ssh when it refuses to connect to a host whose key it cannot verify.
+var hostKeyFailedMarker = []byte("Host key verification failed.")
+
+var (
+	hostKeyUnknownPattern = regexp.MustCompile(`host key is known for (\S+) and you have requested strict checking`)
+	hostKeyChangedPattern = regexp.MustCompile(`Host key for (\S+) has changed and you have requested strict checking`)
+)
+
+// HostKeyError is returned when ssh refused to connect to a remote endpoint because it could not
+// verify its host key: no key is known for the host, and ssh cannot ask whether to accept one (it
+// runs with BatchMode unless RsyncOption.InteractiveSSH is set), or the key differs from the one
+// recorded in known_hosts.
+type HostKeyError struct {
+	Host    string // Host named by ssh ("" if its output did not name it)
+	Changed bool   // Whether the recorded key differs, rather than no key being known
+	Err     error  // Error of the failed command
+}
+
+func (e *HostKeyError) Error() string {
+	host := e.Host
+	if host == "" {
+		host = "the remote host"
+	}
+	if e.Changed {
+		return fmt.Sprintf("ssh refused to connect to %s: its host key differs from the one in known_hosts, "+
+			"which means the host was reinstalled or the connection is intercepted; verify the new key with the host's "+
+			"administrator, then replace the old entry (ssh-keygen -R %s)", host, host)
+	}
+	return fmt.Sprintf("ssh could not verify the host key of %s: no key is known for it, and ssh cannot ask whether to accept one; "+
+		"add the key to the known_hosts of the user running ssh after checking its fingerprint (e.g., with ssh-keyscan), "+
+		"pass another known_hosts file with RemoteShellCommand (ssh -o UserKnownHostsFile=...), "+
+		"or set InsecureSkipHostKeyVerification to accept unknown keys", host)
+}
+
+// Unwrap returns the error of the failed command.
+func (e *HostKeyError) Unwrap() error {
+	return e.Err
+}
+
+// hostKeyFailure returns err as a *HostKeyError if the output of the failed command shows that ssh
+// could not verify a host key, or err unchanged otherwise.
+func hostKeyFailure(output []byte, err error) error {
+	var hostKeyErr *HostKeyError
+	if err == nil || !bytes.Contains(output, hostKeyFailedMarker) || errors.As(err, &hostKeyErr) {
+		return err
+	}
+	hostKeyErr = &HostKeyError{Err: err}
+	if m := hostKeyChangedPattern.FindSubmatch(output); m != nil {
+		hostKeyErr.Host, hostKeyErr.Changed = string(m[1]), true
+	} else if m := hostKeyUnknownPattern.FindSubmatch(output); m != nil {
+		hostKeyErr.Host = string(m[1])
+	}
+	return hostKeyErr
+}
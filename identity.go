@@ -0,0 +1,126 @@
+package transx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HostIdentity is the expected identity of the host of an endpoint, checked by Preflight before the
+// migration touches any data, so that a stale HostIP cannot migrate onto the wrong machine. Exactly
+// one of Hostname, MachineID, and Command is set.
+type HostIdentity struct {
+	Hostname  string // Expected output of "hostname -f" (e.g., "db2.prod.example.com"), compared case-insensitively
+	MachineID string // Expected content of /etc/machine-id
+	Command   string // Command printing the identity, compared with Expected (e.g., "cat /etc/cluster-name")
+	Expected  string // Expected output of Command
+}
+
+// enabled reports whether an identity is expected.
+func (h HostIdentity) enabled() bool {
+	return h != HostIdentity{}
+}
+
+// validate checks that exactly one way of identifying the host is set.
+func (h HostIdentity) validate() error {
+	if !h.enabled() {
+		return nil
+	}
+	set := 0
+	for _, v := range []string{h.Hostname, h.MachineID, h.Command} {
+		if strings.TrimSpace(v) != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("exactly one of Hostname, MachineID, and Command must be set")
+	}
+	if strings.TrimSpace(h.Command) != "" && strings.TrimSpace(h.Expected) == "" {
+		return fmt.Errorf("Command requires Expected")
+	}
+	if strings.TrimSpace(h.Command) == "" && h.Expected != "" {
+		return fmt.Errorf("Expected only applies to Command")
+	}
+	return nil
+}
+
+// check returns the method, the command printing the identity, and the expected value.
+func (h HostIdentity) check() (method, command, expected string) {
+	switch {
+	case strings.TrimSpace(h.Hostname) != "":
+		return "hostname", "hostname -f 2>/dev/null || hostname", h.Hostname
+	case strings.TrimSpace(h.MachineID) != "":
+		return "machine-id", "cat /etc/machine-id 2>/dev/null || cat /var/lib/dbus/machine-id", h.MachineID
+	default:
+		return "command", h.Command, h.Expected
+	}
+}
+
+// HostIdentityCheck records the outcome of the identity check of an endpoint.
+type HostIdentityCheck struct {
+	Endpoint string // "source" or "destination"
+	Host     string // HostIP of the checked endpoint ("localhost" for a local endpoint)
+	Method   string // "hostname", "machine-id", or "command"
+	Expected string
+	Actual   string // Identity reported by the host
+	Match    bool
+}
+
+// HostIdentityMismatchError is returned by Preflight when the host of an endpoint is not the one
+// expected by EndpointDetails.ExpectedHostIdentity.
+type HostIdentityMismatchError struct {
+	Endpoint string // "source" or "destination"
+	Host     string // HostIP of the endpoint ("localhost" for a local endpoint)
+	Method   string // "hostname", "machine-id", or "command"
+	Expected string
+	Actual   string
+}
+
+func (e *HostIdentityMismatchError) Error() string {
+	return fmt.Sprintf("%s host '%s' is not the expected host: %s is '%s', expected '%s' (is HostIP stale?)",
+		e.Endpoint, e.Host, e.Method, e.Actual, e.Expected)
+}
+
+// checkHostIdentities checks the identity of each endpoint that expects one and records the results.
+// A container endpoint is identified by its host.
+func checkHostIdentities(task DataMigrationModel, report *PreflightReport) error {
+	endpoints := []struct {
+		label    string
+		endpoint EndpointDetails
+	}{
+		{"source", task.Source},
+		{"destination", task.Destination},
+	}
+	for _, ep := range endpoints {
+		identity := ep.endpoint.ExpectedHostIdentity
+		if !identity.enabled() {
+			continue
+		}
+		endpoint := ep.endpoint
+		if endpoint.isContainer() {
+			endpoint = endpoint.hostEndpoint()
+		}
+		host := "localhost"
+		if endpoint.isRemote() {
+			host = strings.TrimSpace(endpoint.HostIP)
+		}
+		method, command, expected := identity.check()
+		output, err := executeCommand(command, endpoint, task.RsyncOptions)
+		if err != nil {
+			return fmt.Errorf("failed to read the %s of the %s host '%s': %w\nOutput:\n%s", method, ep.label, host, err, string(output))
+		}
+		// The identity is the last line; anything before it is an SSH banner or warning
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		actual := strings.TrimSpace(lines[len(lines)-1])
+		expected = strings.TrimSpace(expected)
+		match := actual == expected || (method == "hostname" && strings.EqualFold(actual, expected))
+
+		report.HostIdentities = append(report.HostIdentities, HostIdentityCheck{
+			Endpoint: ep.label, Host: host, Method: method, Expected: expected, Actual: actual, Match: match,
+		})
+		if !match {
+			return &HostIdentityMismatchError{Endpoint: ep.label, Host: host, Method: method, Expected: expected, Actual: actual}
+		}
+		fmt.Printf("Host identity of the %s confirmed (%s %s)\n", ep.label, method, actual)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package transx
+
+// DefaultJunkPatterns are the exclude patterns added by RsyncOption.ExcludeCommonJunk: version control
+// metadata, dependency caches, OS metadata files, and temporary files.
+//
+// The list is append-only across releases: removing or changing a pattern would silently start
+// transferring files that earlier runs excluded.
+var DefaultJunkPatterns = []string{
+	".git",
+	".svn",
+	".hg",
+	"node_modules",
+	".DS_Store",
+	"Thumbs.db",
+	"lost+found",
+	"*.tmp",
+}
+
+// junkExcludes returns the exclude patterns added by RsyncOption.ExcludeCommonJunk, if it is set.
+func (o RsyncOption) junkExcludes() []string {
+	if !o.ExcludeCommonJunk {
+		return nil
+	}
+	return append([]string{}, DefaultJunkPatterns...)
+}
@@ -0,0 +1,257 @@
+package transx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultProbePayloadSize = 32 << 20 // Bytes of the probe payload when AutoTuneOption.PayloadSize is zero
+	probeRTTSamples         = 3        // No-op commands timed per remote endpoint; the fastest is kept
+
+	autoTuneCompressGain    = 1.2                   // Compression is enabled if it speeds up the payload by at least this factor
+	autoTuneWholeFileSpeed  = 64 << 20              // Throughput (bytes/s) above which the delta algorithm costs more than it saves
+	autoTuneHighRTT         = 20 * time.Millisecond // RTT above which a single TCP stream is latency bound
+	autoTuneParallelStreams = 4
+)
+
+// LinkProfile is the measured link between two endpoints (see ProbeLink).
+type LinkProfile struct {
+	PayloadBytes         int64         // Size of the synthetic payload (half random, half zeros, so compression halves it at best)
+	Throughput           float64       // Payload bytes per second transferred uncompressed (-W)
+	CompressedThroughput float64       // Payload bytes per second transferred compressed (-W -z)
+	SourceRTT            time.Duration // Fastest no-op command on the source (0 if local), including the ssh connection unless multiplexed
+	DestinationRTT       time.Duration // Fastest no-op command on the destination (0 if local)
+	ProbedAt             time.Time
+}
+
+// RTT returns the larger round trip of both endpoints.
+func (p *LinkProfile) RTT() time.Duration {
+	return max(p.SourceRTT, p.DestinationRTT)
+}
+
+// AutoTuneOption defines the tuning of the transfer options from a LinkProfile before the transfer
+// of MigrateData. The tuned options are Compress (with CompressAuto cleared), WholeFile, and
+// BigFileParallelStreams; each decision is printed and recorded in MigrationReport.AutoTune.
+type AutoTuneOption struct {
+	Enabled     bool
+	PayloadSize int64        // Bytes of the probe payload (0 uses 32 MiB)
+	Profile     *LinkProfile // Profile to tune from instead of probing, e.g., from an earlier ProbeLink
+	SkipProbe   bool         // Never probe the link (e.g., air-gapped validation runs); without Profile, nothing is tuned
+	Fixed       []string     // Options kept as configured ("Compress", "WholeFile", "BigFileParallelStreams")
+}
+
+// autoTunedOptions are the options AutoTuneOption may change.
+var autoTunedOptions = []string{"Compress", "WholeFile", "BigFileParallelStreams"}
+
+// validate checks the auto-tune options.
+func (o AutoTuneOption) validate() error {
+	if o.PayloadSize < 0 {
+		return fmt.Errorf("AutoTune.PayloadSize must not be negative")
+	}
+	for _, name := range o.Fixed {
+		if !slices.Contains(autoTunedOptions, name) {
+			return fmt.Errorf("AutoTune.Fixed: unknown option '%s' (expected one of %s)", name, strings.Join(autoTunedOptions, ", "))
+		}
+	}
+	return nil
+}
+
+// AutoTuneDecision records the value chosen for an option by AutoTune.
+type AutoTuneDecision struct {
+	Option string // e.g., "Compress"
+	Value  string // Chosen value, e.g., "true"
+	Reason string
+}
+
+// AutoTuneResult records the profile and the decisions of AutoTune.
+type AutoTuneResult struct {
+	Profile   *LinkProfile // nil if the probe was skipped
+	Probed    bool         // Whether the profile was measured by this run (false if given or skipped)
+	Decisions []AutoTuneDecision
+}
+
+// ProbeLink measures the link between the endpoints: it writes a synthetic payload of 32 MiB on the
+// source, transfers it to the destination with rsync uncompressed and compressed (the way the task
+// would, e.g., through a local staging directory if both endpoints are remote), and times no-op
+// commands on each remote endpoint. The connection settings of opts (e.g., RsyncPath, LocalRunAs,
+// RemoteShellCommand) are applied; the other options are not. The payload is removed from both
+// endpoints afterwards, also on failure.
+func ProbeLink(source, destination EndpointDetails, opts RsyncOption) (*LinkProfile, error) {
+	return probeLink(context.Background(), source, destination, opts, defaultProbePayloadSize)
+}
+
+// probeLink is ProbeLink with the payload size.
+func probeLink(ctx context.Context, source, destination EndpointDetails, opts RsyncOption, payloadSize int64) (*LinkProfile, error) {
+	if source.isContainer() || destination.isContainer() {
+		return nil, fmt.Errorf("link probe is not supported with container endpoints")
+	}
+	probeOpts := RsyncOption{
+		RsyncPath:                       opts.RsyncPath,
+		CommandWrapper:                  opts.CommandWrapper,
+		CommandRunner:                   opts.CommandRunner,
+		LocalRunAs:                      opts.LocalRunAs,
+		RemoteShellCommand:              opts.RemoteShellCommand,
+		DebugSSH:                        opts.DebugSSH,
+		SSHMultiplexing:                 opts.SSHMultiplexing,
+		InsecureSkipHostKeyVerification: opts.InsecureSkipHostKeyVerification,
+		InteractiveSSH:                  opts.InteractiveSSH,
+		RateLimit:                       opts.RateLimit,
+		WholeFile:                       true, // Measure the link, not the delta algorithm
+		probes:                          opts.probes,
+		cleanups:                        opts.cleanups,
+		audit:                           opts.audit,
+		usage:                           opts.usage,
+	}
+	id := make([]byte, 4)
+	rand.Read(id)
+	name := "transx-probe-" + hex.EncodeToString(id)
+	sourceDir := path.Join(probeTempDir(source), name)
+	destinationDir := path.Join(probeTempDir(destination), name)
+
+	profile := &LinkProfile{PayloadBytes: payloadSize, ProbedAt: time.Now()}
+	var err error
+	if profile.SourceRTT, err = probeRTT(ctx, source, probeOpts); err != nil {
+		return nil, fmt.Errorf("failed to reach the source: %w", err)
+	}
+	if profile.DestinationRTT, err = probeRTT(ctx, destination, probeOpts); err != nil {
+		return nil, fmt.Errorf("failed to reach the destination: %w", err)
+	}
+
+	defer probeOpts.cleanups.track("link probe payload "+sourceDir+" on the source", func() error {
+		return removeProbeDir(source, probeOpts, sourceDir)
+	})()
+	half := payloadSize / 2
+	createCmd := fmt.Sprintf("mkdir -p %s && (head -c %d /dev/urandom; head -c %d /dev/zero) > %s",
+		shellQuotePath(sourceDir), half, payloadSize-half, shellQuotePath(path.Join(sourceDir, "payload")))
+	if output, err := executeCommandContext(ctx, createCmd, source, probeOpts); err != nil {
+		return nil, fmt.Errorf("failed to write the probe payload on the source: %w\nOutput:\n%s", err, string(output))
+	}
+
+	defer probeOpts.cleanups.track("link probe payload "+destinationDir+" on the destination", func() error {
+		return removeProbeDir(destination, probeOpts, destinationDir)
+	})()
+	for _, compress := range []bool{false, true} {
+		task := DataMigrationModel{
+			Source:       EndpointDetails{Username: source.Username, HostIP: source.HostIP, SSHPort: source.SSHPort, SSHPrivateKeyPath: source.SSHPrivateKeyPath, DataPath: sourceDir + "/"},
+			Destination:  EndpointDetails{Username: destination.Username, HostIP: destination.HostIP, SSHPort: destination.SSHPort, SSHPrivateKeyPath: destination.SSHPrivateKeyPath},
+			RsyncOptions: probeOpts,
+		}
+		task.RsyncOptions.Compress = compress
+		task.Destination.DataPath = path.Join(destinationDir, "plain") + "/"
+		if compress {
+			task.Destination.DataPath = path.Join(destinationDir, "compressed") + "/"
+		}
+		start := time.Now()
+		if _, err := transfer(ctx, task); err != nil {
+			return nil, fmt.Errorf("probe transfer failed: %w", err)
+		}
+		throughput := float64(payloadSize) / max(time.Since(start).Seconds(), 1e-9)
+		if compress {
+			profile.CompressedThroughput = throughput
+		} else {
+			profile.Throughput = throughput
+		}
+	}
+	return profile, nil
+}
+
+// probeTempDir returns the directory of the probe payload on the endpoint.
+func probeTempDir(endpoint EndpointDetails) string {
+	if endpoint.isRemote() {
+		return "/tmp"
+	}
+	return os.TempDir()
+}
+
+// removeProbeDir removes the probe payload directory from the endpoint.
+func removeProbeDir(endpoint EndpointDetails, opts RsyncOption, dir string) error {
+	if output, err := executeCommand("rm -rf "+shellQuotePath(dir), endpoint, opts); err != nil {
+		return fmt.Errorf("%w\nOutput:\n%s", err, string(output))
+	}
+	return nil
+}
+
+// probeRTT returns the fastest of probeRTTSamples no-op commands on a remote endpoint, or 0 for a local one.
+func probeRTT(ctx context.Context, endpoint EndpointDetails, opts RsyncOption) (time.Duration, error) {
+	if !endpoint.isRemote() {
+		return 0, nil
+	}
+	var fastest time.Duration
+	for i := 0; i < probeRTTSamples; i++ {
+		start := time.Now()
+		if output, err := executeCommandContext(ctx, "true", endpoint, opts); err != nil {
+			return 0, fmt.Errorf("%w\nOutput:\n%s", err, string(output))
+		}
+		if elapsed := time.Since(start); i == 0 || elapsed < fastest {
+			fastest = elapsed
+		}
+	}
+	return fastest, nil
+}
+
+// autoTune sets the tuned options of opts from the profile, except those in tune.Fixed, and returns the decisions.
+func autoTune(profile *LinkProfile, tune AutoTuneOption, opts *RsyncOption) []AutoTuneDecision {
+	var decisions []AutoTuneDecision
+	decide := func(option, value, reason string) {
+		decisions = append(decisions, AutoTuneDecision{Option: option, Value: value, Reason: reason})
+	}
+	mib := func(bytesPerSecond float64) string {
+		return fmt.Sprintf("%.1f MiB/s", bytesPerSecond/(1<<20))
+	}
+
+	if !slices.Contains(tune.Fixed, "Compress") {
+		opts.Compress = profile.CompressedThroughput >= autoTuneCompressGain*profile.Throughput
+		opts.CompressAuto = false
+		decide("Compress", fmt.Sprint(opts.Compress), fmt.Sprintf("the payload moved at %s compressed and %s uncompressed",
+			mib(profile.CompressedThroughput), mib(profile.Throughput)))
+	}
+	if !slices.Contains(tune.Fixed, "WholeFile") {
+		opts.WholeFile = profile.Throughput >= autoTuneWholeFileSpeed
+		reason := fmt.Sprintf("the link moves %s, slower than the delta algorithm computes", mib(profile.Throughput))
+		if opts.WholeFile {
+			reason = fmt.Sprintf("the link moves %s, faster than the delta algorithm saves", mib(profile.Throughput))
+		}
+		decide("WholeFile", fmt.Sprint(opts.WholeFile), reason)
+	}
+	if !slices.Contains(tune.Fixed, "BigFileParallelStreams") && opts.BigFileParallelStreams == 0 && profile.RTT() >= autoTuneHighRTT {
+		opts.BigFileParallelStreams = autoTuneParallelStreams
+		decide("BigFileParallelStreams", fmt.Sprint(autoTuneParallelStreams), fmt.Sprintf("a round trip of %s limits a single stream (applies if the source is a single file)",
+			profile.RTT().Round(time.Millisecond)))
+	}
+	return decisions
+}
+
+// runAutoTune probes the link of the task (unless a profile is given or the probe is skipped) and
+// tunes its rsync options. A dry run never probes, since the probe transfers data.
+func runAutoTune(ctx context.Context, task DataMigrationModel, opts *RsyncOption) (*AutoTuneResult, error) {
+	tune := task.WorkflowOptions.AutoTune
+	result := &AutoTuneResult{Profile: tune.Profile}
+	if result.Profile == nil {
+		if tune.SkipProbe || task.RsyncOptions.DryRun {
+			fmt.Println("Auto-tune: link probe skipped; options are kept as configured")
+			return result, nil
+		}
+		size := tune.PayloadSize
+		if size == 0 {
+			size = defaultProbePayloadSize
+		}
+		profile, err := probeLink(ctx, task.Source, task.Destination, task.RsyncOptions, size)
+		if err != nil {
+			return result, fmt.Errorf("link probe failed: %w", err)
+		}
+		result.Profile, result.Probed = profile, true
+	}
+	result.Decisions = autoTune(result.Profile, tune, opts)
+	for _, decision := range result.Decisions {
+		fmt.Printf("Auto-tune: %s=%s (%s)\n", decision.Option, decision.Value, decision.Reason)
+	}
+	return result, nil
+}
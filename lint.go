@@ -0,0 +1,117 @@
+package transx
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// systemPathPrefixes lists path prefixes that commonly appear in commands (binaries, devices,
+// configuration) and are never expected to match an endpoint's DataPath.
+var systemPathPrefixes = []string{"/dev/", "/proc/", "/usr/", "/bin/", "/sbin/", "/etc/", "/tmp/"}
+
+// Lint runs heuristic checks over the task configuration and returns warnings for
+// settings that are valid but likely to be mistakes. Lint never fails; its findings
+// are reported as warnings by MigrateData.
+func Lint(task DataMigrationModel) []string {
+	var warnings []string
+
+	if !task.WorkflowOptions.SkipCommandPathLint {
+		backupLabel := "source"
+		if task.BackupEndpoint != nil {
+			backupLabel = "backup endpoint"
+		}
+		if w := lintCommandPaths("backup command", task.Source.BackupCmd, backupLabel, task.backupEndpoint().DataPath); w != "" {
+			warnings = append(warnings, w)
+		}
+		if w := lintCommandPaths("restore command", task.Destination.RestoreCmd, "destination", task.Destination.DataPath); w != "" {
+			warnings = append(warnings, w)
+		}
+	}
+
+	if strings.TrimSpace(task.RsyncOptions.RemoteShellCommand) != "" {
+		if ignored := sshSettingsIgnoredByRemoteShell(task); len(ignored) > 0 {
+			warnings = append(warnings, fmt.Sprintf("ssh settings %s are not applied with RemoteShellCommand '%s'; configure them in the remote shell instead",
+				strings.Join(ignored, ", "), task.RsyncOptions.RemoteShellCommand))
+		}
+	}
+
+	return warnings
+}
+
+// sshSettingsIgnoredByRemoteShell returns the ssh settings of the task that a custom remote shell does not receive.
+func sshSettingsIgnoredByRemoteShell(task DataMigrationModel) []string {
+	var ignored []string
+	if task.Source.SSHPort != 0 || task.Destination.SSHPort != 0 {
+		ignored = append(ignored, "SSHPort")
+	}
+	if task.Source.SSHPrivateKeyPath != "" || task.Destination.SSHPrivateKeyPath != "" {
+		ignored = append(ignored, "SSHPrivateKeyPath")
+	}
+	if task.RsyncOptions.DebugSSH {
+		ignored = append(ignored, "DebugSSH")
+	}
+	if task.RsyncOptions.InsecureSkipHostKeyVerification {
+		ignored = append(ignored, "InsecureSkipHostKeyVerification")
+	}
+	if task.RsyncOptions.InteractiveSSH {
+		ignored = append(ignored, "InteractiveSSH")
+	}
+	return ignored
+}
+
+// lintCommandPaths checks whether the absolute path tokens in command agree with dataPath.
+// It returns a warning naming both values when the command references absolute paths
+// but none of them matches, contains, or is contained in dataPath.
+func lintCommandPaths(commandLabel, command, endpointLabel, dataPath string) string {
+	if strings.TrimSpace(command) == "" || !strings.HasPrefix(dataPath, "/") {
+		return ""
+	}
+	dataPath = path.Clean(dataPath)
+
+	var candidates []string
+	for _, token := range commandPathTokens(command) {
+		if isSystemPath(token) {
+			continue
+		}
+		if pathsOverlap(token, dataPath) {
+			return "" // At least one referenced path agrees with the DataPath
+		}
+		candidates = append(candidates, token)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s references '%s', which is not within %s DataPath '%s'",
+		commandLabel, strings.Join(candidates, "', '"), endpointLabel, dataPath)
+}
+
+// commandPathTokens splits a shell command into words and returns those that look like absolute paths.
+// Redirections (e.g., ">/backup/db.sql") and assignments (e.g., "--result-file=/backup/db.sql") are unwrapped.
+func commandPathTokens(command string) []string {
+	isSeparator := func(r rune) bool {
+		return strings.ContainsRune(" \t\n;|&<>()'\"`=", r)
+	}
+	var tokens []string
+	for _, word := range strings.FieldsFunc(command, isSeparator) {
+		if strings.HasPrefix(word, "/") && len(word) > 1 {
+			tokens = append(tokens, path.Clean(word))
+		}
+	}
+	return tokens
+}
+
+// isSystemPath reports whether p lies under a well-known system directory.
+func isSystemPath(p string) bool {
+	for _, prefix := range systemPathPrefixes {
+		if strings.HasPrefix(p+"/", prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathsOverlap reports whether a equals b or one of them contains the other.
+func pathsOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/") || b == "/"
+}
@@ -0,0 +1,165 @@
+package transx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stagingLockSuffix is appended to the staging directory path to name its lock file, which is kept
+// next to the directory so that it is never transferred by the upload leg.
+const stagingLockSuffix = ".transx-lock"
+
+// stagingLock is the content of the lock file of a staging directory in use by a relay transfer.
+type stagingLock struct {
+	PID       int
+	Host      string
+	CreatedAt time.Time
+}
+
+// StagingLockedError is returned when the staging directory of a relay transfer is locked by
+// another live transx run (see RsyncOption.ForceUnlockStaging).
+type StagingLockedError struct {
+	StagingDir string
+	LockFile   string
+	PID        int       // Process holding the lock
+	Host       string    // Host of that process
+	CreatedAt  time.Time // When the lock was taken
+}
+
+func (e *StagingLockedError) Error() string {
+	return fmt.Sprintf("relay staging directory '%s' is in use by transx (pid %d on %s since %s); wait for that run to finish, or remove %s or set ForceUnlockStaging if it is dead",
+		e.StagingDir, e.PID, e.Host, e.CreatedAt.Format(time.RFC3339), e.LockFile)
+}
+
+// stagingLockPath returns the path of the lock file of the staging directory.
+func stagingLockPath(dir string) string {
+	return filepath.Clean(dir) + stagingLockSuffix
+}
+
+// lockStagingDir takes the lock of a staging directory adopted by a relay transfer and returns the
+// function releasing it. The lock file is held with flock for the whole run, so the lock of a run
+// that died is released with its process and taken over without a race between runs. A lock held
+// by a live run is taken over only if it is older than RsyncOption.StagingLockMaxAge, if set (e.g.,
+// one left on a host whose runs cannot be checked), or with ForceUnlockStaging.
+func lockStagingDir(opts RsyncOption, dir string) (func() error, error) {
+	path := stagingLockPath(dir)
+	host, _ := os.Hostname()
+	data, err := json.Marshal(stagingLock{PID: os.Getpid(), Host: host, CreatedAt: time.Now()})
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create staging lock %s: %w", path, err)
+		}
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock staging lock %s: %w", path, err)
+		}
+		if !locked {
+			holder, readErr := readStagingLock(path)
+			switch {
+			case opts.ForceUnlockStaging:
+				fmt.Printf("Warning: forcibly taking over the staging lock %s\n", path)
+			case readErr == nil && holder.expired(opts.StagingLockMaxAge):
+				fmt.Printf("Warning: taking over the staging lock %s older than %s (pid %d on %s since %s)\n",
+					path, opts.StagingLockMaxAge, holder.PID, holder.Host, holder.CreatedAt.Format(time.RFC3339))
+			case readErr != nil:
+				f.Close()
+				return nil, fmt.Errorf("staging lock %s is held by another run and unreadable: %w", path, readErr)
+			default:
+				f.Close()
+				return nil, &StagingLockedError{StagingDir: dir, LockFile: path, PID: holder.PID, Host: holder.Host, CreatedAt: holder.CreatedAt}
+			}
+			// The held lock file is unlinked, so that the next attempt locks a new one; it is left
+			// alone if another run already replaced it
+			if sameFile(f, path) {
+				if err := removeStagingLock(path); err != nil {
+					f.Close()
+					return nil, err
+				}
+			}
+			f.Close()
+			continue
+		}
+
+		// A run taking over the lock may have unlinked the file between its opening and locking
+		if !sameFile(f, path) {
+			f.Close()
+			continue
+		}
+		if holder, err := readStagingLock(path); err == nil {
+			fmt.Printf("Warning: taking over the staging lock %s left by a dead run (pid %d on %s since %s)\n",
+				path, holder.PID, holder.Host, holder.CreatedAt.Format(time.RFC3339))
+		}
+		if err := writeStagingLock(f, data); err != nil {
+			removeStagingLock(path)
+			f.Close()
+			return nil, fmt.Errorf("failed to write staging lock %s: %w", path, err)
+		}
+		return func() error {
+			// Removed while still locked, so that no other run locks the file being removed
+			var err error
+			if sameFile(f, path) {
+				err = removeStagingLock(path)
+			}
+			f.Close()
+			return err
+		}, nil
+	}
+	return nil, fmt.Errorf("failed to lock staging lock %s: it kept being replaced by other runs", path)
+}
+
+// writeStagingLock replaces the content of the locked lock file with data.
+func writeStagingLock(f *os.File, data []byte) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// sameFile reports whether the open file f is still the file at path.
+func sameFile(f *os.File, path string) bool {
+	openInfo, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pathInfo, err := os.Stat(path)
+	return err == nil && os.SameFile(openInfo, pathInfo)
+}
+
+// readStagingLock reads the lock file at path.
+func readStagingLock(path string) (*stagingLock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lock := &stagingLock{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// expired reports whether the lock is older than maxAge (if positive).
+func (l *stagingLock) expired(maxAge time.Duration) bool {
+	return maxAge > 0 && time.Since(l.CreatedAt) > maxAge
+}
+
+// removeStagingLock removes the lock file at path, if it exists.
+func removeStagingLock(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove staging lock %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package transx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeLockFile writes a lock file for the staging directory with the given holder.
+func writeLockFile(t *testing.T, dir string, holder stagingLock) {
+	t.Helper()
+	data, err := json.Marshal(holder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stagingLockPath(dir), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// holdLockFile writes a lock file with the given holder and holds its flock until the test ends, as
+// a live run does.
+func holdLockFile(t *testing.T, dir string, holder stagingLock) {
+	t.Helper()
+	writeLockFile(t, dir, holder)
+	f, err := os.OpenFile(stagingLockPath(dir), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	if locked, err := tryLockFile(f); !locked || err != nil {
+		t.Fatalf("tryLockFile() = %v, %v", locked, err)
+	}
+}
+
+func TestLockStagingDir(t *testing.T) {
+	host, _ := os.Hostname()
+	live := stagingLock{PID: os.Getpid(), Host: host, CreatedAt: time.Now()}
+	old := stagingLock{PID: os.Getpid(), Host: "other-host", CreatedAt: time.Now().Add(-2 * time.Hour)}
+	dead := stagingLock{PID: 1 << 30, Host: host, CreatedAt: time.Now()}
+
+	tests := []struct {
+		name   string
+		opts   RsyncOption
+		setup  func(t *testing.T, dir string)
+		locked bool // Whether *StagingLockedError is expected
+	}{
+		{name: "free", setup: func(t *testing.T, dir string) {}},
+		{name: "live lock", setup: func(t *testing.T, dir string) { holdLockFile(t, dir, live) }, locked: true},
+		{name: "dead pid on this host", setup: func(t *testing.T, dir string) { writeLockFile(t, dir, dead) }},
+		{name: "left by a finished run without content", setup: func(t *testing.T, dir string) {
+			os.WriteFile(stagingLockPath(dir), nil, 0600)
+		}},
+		{name: "live lock younger than StagingLockMaxAge", opts: RsyncOption{StagingLockMaxAge: 3 * time.Hour},
+			setup: func(t *testing.T, dir string) { holdLockFile(t, dir, old) }, locked: true},
+		{name: "live lock past StagingLockMaxAge", opts: RsyncOption{StagingLockMaxAge: time.Hour},
+			setup: func(t *testing.T, dir string) { holdLockFile(t, dir, old) }},
+		{name: "ForceUnlockStaging", opts: RsyncOption{ForceUnlockStaging: true},
+			setup: func(t *testing.T, dir string) { holdLockFile(t, dir, live) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "staging")
+			tt.setup(t, dir)
+
+			unlock, err := lockStagingDir(tt.opts, dir)
+			var lockedErr *StagingLockedError
+			if tt.locked {
+				if !errors.As(err, &lockedErr) {
+					t.Fatalf("lockStagingDir() error = %v, want *StagingLockedError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("lockStagingDir() error = %v", err)
+			}
+			holder, err := readStagingLock(stagingLockPath(dir))
+			if err != nil || holder.PID != os.Getpid() || holder.Host != host {
+				t.Errorf("lock holder = %+v, %v; want this process", holder, err)
+			}
+			if err := unlock(); err != nil {
+				t.Errorf("unlock() error = %v", err)
+			}
+			if _, err := os.Stat(stagingLockPath(dir)); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("lock file after unlock: %v, want it removed", err)
+			}
+		})
+	}
+}
+
+func TestLockStagingDirRefusesWhileHeld(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "staging")
+	unlock, err := lockStagingDir(RsyncOption{}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lockedErr *StagingLockedError
+	if _, err := lockStagingDir(RsyncOption{}, dir); !errors.As(err, &lockedErr) || lockedErr.PID != os.Getpid() {
+		t.Fatalf("second lockStagingDir() error = %v, want *StagingLockedError naming this process", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = lockStagingDir(RsyncOption{}, dir)
+	if err != nil {
+		t.Fatalf("lockStagingDir() after unlock error = %v", err)
+	}
+	unlock()
+}
+
+// Runs racing to take over the lock of a dead run must not both get it.
+func TestLockStagingDirTakeOverRace(t *testing.T) {
+	host, _ := os.Hostname()
+	for i := 0; i < 20; i++ {
+		dir := filepath.Join(t.TempDir(), "staging")
+		writeLockFile(t, dir, stagingLock{PID: 1 << 30, Host: host, CreatedAt: time.Now()})
+
+		const runs = 8
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var holders int
+		var unlocks []func() error
+		for j := 0; j < runs; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				unlock, err := lockStagingDir(RsyncOption{}, dir)
+				var lockedErr *StagingLockedError
+				switch {
+				case err == nil:
+					mu.Lock()
+					holders++
+					unlocks = append(unlocks, unlock)
+					mu.Unlock()
+				case !errors.As(err, &lockedErr):
+					t.Errorf("lockStagingDir() error = %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		if holders != 1 {
+			t.Fatalf("%d runs hold the lock, want 1", holders)
+		}
+		for _, unlock := range unlocks {
+			unlock()
+		}
+	}
+}
+
+func TestRelayTransferRemovesLockWhenCanceled(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "staging")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runner := &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+		if filepath.Base(args[0]) != "rsync" {
+			return nil, nil
+		}
+		if _, err := os.Stat(stagingLockPath(dir)); err != nil {
+			t.Errorf("staging lock missing during the transfer: %v", err)
+		}
+		cancel()
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+	task := DataMigrationModel{
+		Source:       EndpointDetails{Username: "user", HostIP: "source", DataPath: "/data/"},
+		Destination:  EndpointDetails{Username: "user", HostIP: "destination", DataPath: "/data/"},
+		RsyncOptions: RsyncOption{StagingDir: dir, CommandRunner: runner},
+	}
+
+	if err := TransferContext(ctx, task); err == nil {
+		t.Fatal("TransferContext() succeeded, want the cancellation")
+	}
+	if len(runner.rsyncCalls()) == 0 {
+		t.Fatal("rsync was not run")
+	}
+	if _, err := os.Stat(stagingLockPath(dir)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("staging lock after the canceled run: %v, want it removed", err)
+	}
+}
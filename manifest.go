@@ -0,0 +1,117 @@
+package transx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// stagingManifestName is the file written into a relay staging directory (RsyncOption.StagingDir)
+// once the download leg completed. It is excluded from both relay legs.
+const stagingManifestName = ".transx-staging-manifest.json"
+
+// stagingManifestExclude keeps the manifest (and its temporary file) out of both relay legs.
+const stagingManifestExclude = "--exclude=/" + stagingManifestName + "*"
+
+// defaultStagingMaxAge is the age above which a staging manifest is considered stale if
+// RsyncOption.StagingMaxAge is not set.
+const defaultStagingMaxAge = time.Hour
+
+// stagingManifest records a completed download leg, so that a relay interrupted before or during the
+// upload leg can resume with the upload leg.
+type stagingManifest struct {
+	TaskHash    string    // stagingManifestHash of the task that downloaded the staged data
+	FileCount   int64     // Number of files considered by the download leg
+	TotalBytes  int64     // Total size of the considered files in bytes
+	CompletedAt time.Time // When the download leg completed
+}
+
+// stagingManifestEnabled reports whether the relay transfer of the task writes and honors a staging
+// manifest: only for a persistent StagingDir owned by the current user, and not for dry-runs.
+func stagingManifestEnabled(task DataMigrationModel, owned bool) bool {
+	opts := task.RsyncOptions
+	return !owned && !opts.DryRun && strings.TrimSpace(opts.LocalRunAs) == ""
+}
+
+// loadStagingManifest returns the manifest of the staging directory if the staged data can be uploaded
+// without downloading it again: the manifest was written for the same task and is not older than
+// RsyncOption.StagingMaxAge. It returns nil if there is no usable manifest, printing why one is ignored.
+func loadStagingManifest(task DataMigrationModel, dir string) *stagingManifest {
+	path := filepath.Join(dir, stagingManifestName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		fmt.Printf("Warning: ignoring staging manifest %s: %v\n", path, err)
+		return nil
+	}
+	if task.RsyncOptions.NoStagingResume {
+		fmt.Printf("Relay transfer mode: Staging manifest found but resuming is disabled; downloading again\n")
+		return nil
+	}
+
+	var m stagingManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		fmt.Printf("Warning: ignoring staging manifest %s: %v\n", path, err)
+		return nil
+	}
+	hash, err := stagingManifestHash(task)
+	if err != nil || m.TaskHash != hash {
+		fmt.Printf("Relay transfer mode: Staging manifest was written for a different configuration; downloading again\n")
+		return nil
+	}
+	maxAge := task.RsyncOptions.StagingMaxAge
+	if maxAge == 0 {
+		maxAge = defaultStagingMaxAge
+	}
+	if age := time.Since(m.CompletedAt); age > maxAge {
+		fmt.Printf("Relay transfer mode: Staging manifest is %s old (limit %s); downloading again\n", age.Round(time.Second), maxAge)
+		return nil
+	}
+	return &m
+}
+
+// stagingManifestHash returns the configHash of the task, ignoring the options that only control resuming.
+func stagingManifestHash(task DataMigrationModel) (string, error) {
+	task.RsyncOptions.NoStagingResume = false
+	task.RsyncOptions.StagingMaxAge = 0
+	return configHash(task)
+}
+
+// writeStagingManifest records the completed download leg in the staging directory.
+func writeStagingManifest(task DataMigrationModel, dir string, download *TransferResult) error {
+	hash, err := stagingManifestHash(task)
+	if err != nil {
+		return err
+	}
+	m := stagingManifest{
+		TaskHash:    hash,
+		FileCount:   download.TotalFileCount,
+		TotalBytes:  download.TotalFileSize,
+		CompletedAt: time.Now(),
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, stagingManifestName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// removeStagingManifest removes the manifest of the staging directory, if any.
+func removeStagingManifest(dir string) error {
+	err := os.Remove(filepath.Join(dir, stagingManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,205 @@
+package transx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MtimeSplitOption defines how a transfer is partitioned by file modification time.
+// N boundaries split the source into N+1 windows: (-inf, b0], (b0, b1], ..., (bN-1, +inf).
+// Each window's file list is generated with GNU find on the source endpoint and transferred
+// by its own rsync process using --files-from. This suits flat directories with many files
+// spread over time, where splitting by subdirectory is not possible.
+//
+// A DataPath without a trailing slash lands in <destination>/<name>/ like a plain transfer: the
+// windows are transferred from its parent directory, with the listed entries prefixed by its name.
+// Only non-directory entries are listed; parent directories are created implicitly by rsync,
+// so empty directories are not transferred and directory attributes are not preserved.
+// The split requires Delete to be disabled and is not supported in relay mode.
+type MtimeSplitOption struct {
+	Boundaries  []time.Time // Ascending mtime boundaries separating the windows
+	MaxParallel int         // Maximum number of concurrent rsync processes (0 runs all windows at once)
+}
+
+// validateMtimeSplit checks that the mtime split can be applied safely to the task.
+func (task *DataMigrationModel) validateMtimeSplit() error {
+	split := task.RsyncOptions.MtimeSplit
+	if len(split.Boundaries) == 0 {
+		return nil
+	}
+	if task.RsyncOptions.Delete {
+		return fmt.Errorf("mtime split cannot be combined with --delete (each window only sees part of the source)")
+	}
+	if task.Topology() == RemoteToRemoteRelay {
+		return fmt.Errorf("mtime split is not supported in relay mode")
+	}
+	if task.Source.isContainer() || task.Destination.isContainer() {
+		return fmt.Errorf("mtime split is not supported with container endpoints")
+	}
+	if split.MaxParallel < 0 {
+		return fmt.Errorf("MaxParallel must not be negative")
+	}
+	for i := 1; i < len(split.Boundaries); i++ {
+		if !split.Boundaries[i].After(split.Boundaries[i-1]) {
+			return fmt.Errorf("boundaries must be strictly ascending (boundary %d is not after boundary %d)", i, i-1)
+		}
+	}
+	return nil
+}
+
+// findCommandForWindow returns the find command listing the entries of the source whose
+// modification time falls within the given window, NUL-separated (for rsync --from0) and relative to
+// dataPath with prefix prepended. A nil bound is open.
+func findCommandForWindow(dataPath, prefix string, lower, upper *time.Time) string {
+	parts := []string{"find", shellQuotePath(dataPath), "!", "-type", "d"}
+	if lower != nil {
+		parts = append(parts, "-newermt", shellQuote(fmt.Sprintf("@%d", lower.Unix())))
+	}
+	if upper != nil {
+		parts = append(parts, "!", "-newermt", shellQuote(fmt.Sprintf("@%d", upper.Unix())))
+	}
+	format := strings.NewReplacer(`\`, `\\`, "%", "%%").Replace(prefix) + `%P\0`
+	parts = append(parts, "-printf", shellQuote(format))
+	return strings.Join(parts, " ")
+}
+
+// listWindowFiles runs the find command of a window on the source endpoint and returns its stdout
+// alone and uncapped: ssh banners and warnings on stderr, or a MaxCapturedOutput truncation note,
+// would otherwise become entries of the file list. stderr is part of the error if find fails.
+// With RsyncOption.CommandRunner, the list is the output the runner returns.
+func listWindowFiles(ctx context.Context, task DataMigrationModel, findCmd string) ([]byte, error) {
+	opts := task.RsyncOptions
+	if err := throttle(ctx, opts, task.Source); err != nil {
+		return nil, err
+	}
+	cmd := endpointShellCommand(ctx, task.Source, opts, findCmd)
+	var stdout, stderr bytes.Buffer
+	start := time.Now()
+	var err error
+	if opts.CommandRunner != nil {
+		var output []byte
+		output, err = runWithRunner(ctx, opts, cmd)
+		if err != nil {
+			stderr.Write(output)
+		} else {
+			stdout.Write(output)
+		}
+	} else {
+		cmd.WaitDelay = commandWaitDelay
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err = cmd.Run()
+	}
+	opts.usage.record(cmd, start)
+	err = hostKeyFailure(stderr.Bytes(), err)
+	if err = opts.audit.record(findCmd, err, task.Source); err != nil {
+		return nil, fmt.Errorf("%w\nOutput:\n%s", err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// transferByMtimeWindows lists the source entries of each mtime window, transfers the windows
+// with parallel rsync processes, and merges their statistics into one result.
+func transferByMtimeWindows(ctx context.Context, task DataMigrationModel, rsyncCmdPath string, args []string) (*TransferResult, error) {
+	split := task.RsyncOptions.MtimeSplit
+	boundaries := split.Boundaries
+
+	// Generate the file list of each window on the source endpoint.
+	// The lists are fed to rsync on stdin, so no local file has to be readable by RsyncOption.LocalRunAs.
+	type window struct {
+		index int
+		list  []byte
+	}
+	var windows []window
+	// --files-from entries are relative to the source directory
+	sourceRsyncPath, prefix := task.Source.rsyncPathRoot(task.Source.DataPath)
+	for i := 0; i <= len(boundaries); i++ {
+		var lower, upper *time.Time
+		if i > 0 {
+			lower = &boundaries[i-1]
+		}
+		if i < len(boundaries) {
+			upper = &boundaries[i]
+		}
+
+		findCmd := findCommandForWindow(task.Source.DataPath, prefix, lower, upper)
+		output, err := listWindowFiles(ctx, task, findCmd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files of mtime window %d\nCommand: %s\nError: %w", i, findCmd, err)
+		}
+		if len(output) == 0 {
+			continue // Nothing to transfer in this window
+		}
+
+		windows = append(windows, window{index: i, list: output})
+	}
+
+	destinationRsyncPath := task.Destination.getRsyncPath()
+
+	parallel := split.MaxParallel
+	if parallel == 0 || parallel > len(windows) {
+		parallel = len(windows)
+	}
+	fmt.Printf("Mtime split: transferring %d non-empty window(s) with up to %d parallel rsync process(es)...\n", len(windows), parallel)
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		errs     []error
+		combined = &TransferResult{}
+		dirs     = newDirectoryAggregator(task.WorkflowOptions.DirectoryStats)
+	)
+	sem := make(chan struct{}, max(parallel, 1))
+	for _, w := range windows {
+		wg.Add(1)
+		go func(w window) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			windowArgs := make([]string, len(args))
+			copy(windowArgs, args)
+			windowArgs = append(windowArgs, "--files-from=-", "--from0")
+			windowArgs = append(windowArgs, rsyncPathArgs([]string{sourceRsyncPath}, destinationRsyncPath)...)
+			task.RsyncOptions.recorder.command(rsyncCmdPath, windowArgs)
+
+			if err := throttle(ctx, task.RsyncOptions, task.Source, task.Destination); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("mtime window %d: %w", w.index, err))
+				mu.Unlock()
+				return
+			}
+			cmd := newLocalCommand(ctx, task.RsyncOptions, rsyncCmdPath, windowArgs...)
+			cmd.Stdin = bytes.NewReader(w.list)
+			start := time.Now()
+			output, err := cmd.CombinedOutput()
+			task.RsyncOptions.usage.record(cmd, start)
+			err = task.RsyncOptions.audit.record(cmd.String(), err, task.Source, task.Destination)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("rsync execution failed for mtime window %d\nCommand: %s %s\nError: %w\nOutput:\n%s",
+					w.index, rsyncCmdPath, strings.Join(windowArgs, " "), err, string(output)))
+				return
+			}
+			combined.add(parseRsyncStats(string(output)))
+			combined.files = append(combined.files, transferredFiles(string(output))...)
+			dirs.addOutput(string(output))
+		}(w)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if task.WorkflowOptions.DirectoryStats.enabled() {
+		combined.Directories = dirs.stats()
+	}
+	return combined, nil
+}
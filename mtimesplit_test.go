@@ -0,0 +1,73 @@
+package transx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRsyncPathRoot(t *testing.T) {
+	tests := []struct {
+		source     EndpointDetails
+		wantPath   string
+		wantPrefix string
+	}{
+		{EndpointDetails{DataPath: "/srv/data/"}, "/srv/data/", ""},
+		{EndpointDetails{DataPath: "/srv/data"}, "/srv/", "data/"},
+		{EndpointDetails{DataPath: "/data"}, "/", "data/"},
+		{EndpointDetails{DataPath: "-data"}, "./", "-data/"},
+		{EndpointDetails{Username: "user", HostIP: "10.0.0.1", DataPath: "/srv/data"}, "user@10.0.0.1:/srv/", "data/"},
+	}
+	for _, tt := range tests {
+		rsyncPath, prefix := tt.source.rsyncPathRoot(tt.source.DataPath)
+		if rsyncPath != tt.wantPath || prefix != tt.wantPrefix {
+			t.Errorf("rsyncPathRoot(%q) = %q, %q, want %q, %q",
+				tt.source.DataPath, rsyncPath, prefix, tt.wantPath, tt.wantPrefix)
+		}
+	}
+}
+
+// The window lists are NUL-separated stdout only, complete regardless of MaxCapturedOutput, and keep
+// names containing newlines and printf directives intact.
+func TestListWindowFiles(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"a", "new\nline", "100%d"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	task := DataMigrationModel{
+		Source:       EndpointDetails{DataPath: dir},
+		RsyncOptions: RsyncOption{MaxCapturedOutput: 4},
+	}
+	upper := time.Now().Add(time.Hour)
+	findCmd := "echo 'banner' >&2; " + findCommandForWindow(dir, `da%ta\`+"/", nil, &upper)
+
+	output, err := listWindowFiles(context.Background(), task, findCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := strings.Split(strings.TrimSuffix(string(output), "\x00"), "\x00")
+	slices.Sort(entries)
+	var want []string
+	for _, name := range names {
+		want = append(want, `da%ta\`+"/"+name)
+	}
+	slices.Sort(want)
+	if !slices.Equal(entries, want) {
+		t.Errorf("entries = %q, want %q", entries, want)
+	}
+}
+
+func TestListWindowFilesFailure(t *testing.T) {
+	task := DataMigrationModel{Source: EndpointDetails{DataPath: "/nonexistent"}}
+	_, err := listWindowFiles(context.Background(), task, "echo 'find: permission denied' >&2; exit 1")
+	if err == nil || !strings.Contains(err.Error(), "find: permission denied") {
+		t.Errorf("listWindowFiles() error = %v, want the stderr of find", err)
+	}
+}
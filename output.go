@@ -0,0 +1,37 @@
+package transx
+
+import "fmt"
+
+// tailBuffer is an io.Writer that keeps the last limit bytes written to it (all bytes if limit is 0),
+// so that a command producing huge output cannot exhaust memory. The tail is kept because it usually
+// holds the error and, for rsync, the --stats summary.
+type tailBuffer struct {
+	limit   int64
+	buf     []byte
+	dropped int64
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	t.buf = append(t.buf, p...)
+	if t.limit > 0 && int64(len(t.buf)) > t.limit {
+		excess := int64(len(t.buf)) - t.limit
+		t.dropped += excess
+		t.buf = append(t.buf[:0], t.buf[excess:]...)
+	}
+	return n, nil
+}
+
+// WriteString writes s like Write.
+func (t *tailBuffer) WriteString(s string) (int, error) {
+	return t.Write([]byte(s))
+}
+
+// Bytes returns the kept output, preceded by a note if output was dropped.
+func (t *tailBuffer) Bytes() []byte {
+	if t.dropped == 0 {
+		return t.buf
+	}
+	note := fmt.Sprintf("[transx: %d bytes of earlier output truncated (MaxCapturedOutput)]\n", t.dropped)
+	return append([]byte(note), t.buf...)
+}
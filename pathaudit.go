@@ -0,0 +1,89 @@
+package transx
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultMaxPathLength = 260        // Windows MAX_PATH
+	defaultMaxNameLength = 255        // Common filesystem limit for a single name
+	defaultDeniedChars   = `<>:"\|?*` // Characters not allowed in Windows file names
+)
+
+// PathAuditOption defines an audit of the paths a transfer would create on the destination,
+// for destinations that are later consumed on platforms with stricter path rules (e.g., Windows).
+// The audit reuses the dry-run file listing of the transfer instead of walking the tree separately.
+type PathAuditOption struct {
+	Enabled       bool
+	MaxPathLength int    // Maximum length of the full destination path in characters (0 uses default 260)
+	MaxNameLength int    // Maximum length of a single path component in characters (0 uses default 255)
+	DeniedChars   string // Characters not allowed in path components (empty uses `<>:"\|?*`)
+	Strict        bool   // Fail the migration on findings instead of reporting them as warnings
+}
+
+// PathAuditFinding describes a path that violates the audit rules.
+type PathAuditFinding struct {
+	Path   string // Destination path of the entry
+	Reason string
+}
+
+// auditPaths checks the entries of a dry-run scan against the audit rules and returns the findings.
+func auditPaths(opts PathAuditOption, destinationDataPath string, entries []dryRunEntry) []PathAuditFinding {
+	maxPath := opts.MaxPathLength
+	if maxPath <= 0 {
+		maxPath = defaultMaxPathLength
+	}
+	maxName := opts.MaxNameLength
+	if maxName <= 0 {
+		maxName = defaultMaxNameLength
+	}
+	denied := opts.DeniedChars
+	if denied == "" {
+		denied = defaultDeniedChars
+	}
+
+	var findings []PathAuditFinding
+	for _, entry := range entries {
+		if entry.isDeletion() {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name, "/")
+		destPath := path.Join(destinationDataPath, name)
+
+		if n := utf8.RuneCountInString(destPath); n > maxPath {
+			findings = append(findings, PathAuditFinding{Path: destPath, Reason: fmt.Sprintf("path length %d exceeds %d", n, maxPath)})
+		}
+		for _, component := range strings.Split(name, "/") {
+			if n := utf8.RuneCountInString(component); n > maxName {
+				findings = append(findings, PathAuditFinding{Path: destPath, Reason: fmt.Sprintf("name '%s' length %d exceeds %d", component, n, maxName)})
+			}
+			if i := strings.IndexAny(component, denied); i >= 0 {
+				findings = append(findings, PathAuditFinding{Path: destPath, Reason: fmt.Sprintf("name '%s' contains denied character %q", component, component[i])})
+			}
+		}
+	}
+	return findings
+}
+
+// runPathAudit performs the path audit of the task and returns warnings for the findings.
+// In strict mode, any finding makes it return an error instead.
+// The dry-run listing is taken from cache when one is provided.
+func runPathAudit(task DataMigrationModel, cache *dryRunCache) ([]string, error) {
+	scan, err := cache.get(task)
+	if err != nil {
+		return nil, err
+	}
+	findings := auditPaths(task.WorkflowOptions.PathAudit, task.Destination.DataPath, scan.Entries)
+
+	var warnings []string
+	for _, f := range findings {
+		warnings = append(warnings, fmt.Sprintf("path audit: %s: %s", f.Path, f.Reason))
+	}
+	if task.WorkflowOptions.PathAudit.Strict && len(findings) > 0 {
+		return warnings, fmt.Errorf("path audit found %d violation(s), first: %s: %s", len(findings), findings[0].Path, findings[0].Reason)
+	}
+	return warnings, nil
+}
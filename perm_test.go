@@ -0,0 +1,207 @@
+//go:build unix
+
+package transx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// shellRunner returns a fake CommandRunner running the remote commands of ssh with a local shell.
+func shellRunner() *fakeRunner {
+	return &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+		if filepath.Base(args[0]) != "ssh" {
+			return nil, nil
+		}
+		return exec.CommandContext(ctx, "sh", "-c", args[len(args)-1]).CombinedOutput()
+	}}
+}
+
+// The directories and files transx creates must get their modes whatever the umask is.
+func TestCreatedPathModes(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   RsyncOption
+		create func(t *testing.T, opts RsyncOption) string // Returns the created path
+		want   os.FileMode
+	}{
+		{name: "relay staging directory", create: createRelayStagingDir, want: 0700},
+		{name: "relay staging directory with SessionDirMode", opts: RsyncOption{SessionDirMode: 0750}, create: createRelayStagingDir, want: 0750},
+		{name: "missing StagingDir", opts: RsyncOption{SessionDirMode: 0770}, create: func(t *testing.T, opts RsyncOption) string {
+			opts.StagingDir = filepath.Join(t.TempDir(), "parent", "staging")
+			return createRelayStagingDir(t, opts)
+		}, want: 0770},
+		{name: "URL staging directory", opts: RsyncOption{SessionDirMode: 0750}, create: func(t *testing.T, opts RsyncOption) string {
+			dir, _, err := urlStagingDir(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.RemoveAll(dir) })
+			return dir
+		}, want: 0750},
+		{name: "container host staging directory", opts: RsyncOption{SessionDirMode: 0750}, create: func(t *testing.T, opts RsyncOption) string {
+			opts.CommandRunner = shellRunner()
+			dir, err := makeHostStagingDir(EndpointDetails{HostIP: "host", DataPath: "/data"}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.RemoveAll(dir) })
+			return dir
+		}, want: 0750},
+		{name: "filter file", create: func(t *testing.T, opts RsyncOption) string {
+			opts.Exclude = make([]string, 10000)
+			for i := range opts.Exclude {
+				opts.Exclude[i] = fmt.Sprintf("pattern-%05d", i)
+			}
+			task, release, err := spillFilterRules(DataMigrationModel{RsyncOptions: opts})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(release)
+			return task.RsyncOptions.filterFile
+		}, want: 0600},
+		{name: "files-from file", create: func(t *testing.T, opts RsyncOption) string {
+			opts.FilesFromList = []string{"a"}
+			task, release, err := spillFilterRules(DataMigrationModel{RsyncOptions: opts})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(release)
+			return task.RsyncOptions.filesFromFile
+		}, want: 0600},
+		{name: "staging lock", create: func(t *testing.T, opts RsyncOption) string {
+			dir := filepath.Join(t.TempDir(), "staging")
+			unlock, err := lockStagingDir(opts, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { unlock() })
+			return stagingLockPath(dir)
+		}, want: 0600},
+		{name: "destination directory with CreateDestDirMode", opts: RsyncOption{CreateDestDirMode: 0755}, create: func(t *testing.T, opts RsyncOption) string {
+			dir := filepath.Join(t.TempDir(), "new", "dest")
+			if output, err := exec.Command("sh", "-c", mkdirCommand(dir, opts.CreateDestDirMode)).CombinedOutput(); err != nil {
+				t.Fatalf("%v: %s", err, output)
+			}
+			if info, err := os.Stat(filepath.Dir(dir)); err != nil || info.Mode().Perm() != 0755 {
+				t.Errorf("created parent: %v, %v; want mode 0755", info.Mode().Perm(), err)
+			}
+			return dir
+		}, want: 0755},
+	}
+	for _, umask := range []int{0077, 0000} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("umask %04o/%s", umask, tt.name), func(t *testing.T) {
+				old := syscall.Umask(umask)
+				defer syscall.Umask(old)
+				created := tt.create(t, tt.opts)
+				info, err := os.Stat(created)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := info.Mode().Perm(); got != tt.want {
+					t.Errorf("%s has mode %04o, want %04o", created, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func createRelayStagingDir(t *testing.T, opts RsyncOption) string {
+	dir, owned, err := relayStagingDir(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owned {
+		t.Cleanup(func() { os.RemoveAll(dir) })
+	}
+	return dir
+}
+
+// An existing StagingDir is the caller's and keeps its mode.
+func TestExistingStagingDirKeepsMode(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := relayStagingDir(RsyncOption{StagingDir: dir, SessionDirMode: 0700}); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(dir); info.Mode().Perm() != 0755 {
+		t.Errorf("StagingDir has mode %04o, want 0755 kept", info.Mode().Perm())
+	}
+}
+
+func TestValidateSessionDirMode(t *testing.T) {
+	for _, tt := range []struct {
+		mode    os.FileMode
+		wantErr bool
+	}{{0, false}, {0700, false}, {0750, false}, {0640, true}, {os.ModeDir | 0700, true}} {
+		task := DataMigrationModel{
+			Source:       EndpointDetails{DataPath: "/src/"},
+			Destination:  EndpointDetails{DataPath: "/dst/"},
+			RsyncOptions: RsyncOption{SessionDirMode: tt.mode},
+		}
+		if err := Validate(task); (err != nil) != tt.wantErr || err != nil && !strings.Contains(err.Error(), "SessionDirMode") {
+			t.Errorf("Validate() with SessionDirMode %v: %v, want error %v", tt.mode, err, tt.wantErr)
+		}
+	}
+}
+
+// With LocalRunAs, the list files stay 0600 and are given to that user rather than made readable by
+// everyone; sudo changes the owner when transx does not run as root.
+func TestListFileForLocalRunAs(t *testing.T) {
+	runner := &fakeRunner{}
+	opts := RsyncOption{LocalRunAs: "transx-no-such-user", CommandRunner: runner, FilesFromList: []string{"a"}}
+	task, release, err := spillFilterRules(DataMigrationModel{RsyncOptions: opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := task.RsyncOptions.filesFromFile
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("files-from file: %v, %v; want mode 0600", info.Mode().Perm(), err)
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || info.Mode().Perm() != 0711 {
+		t.Errorf("files-from directory: %v, %v; want mode 0711", info.Mode().Perm(), err)
+	}
+	if cmds := runner.commands(); len(cmds) != 1 || cmds[0] != "sudo -n chown -- transx-no-such-user "+path {
+		t.Errorf("commands run = %q, want sudo chown of the file", cmds)
+	}
+	release()
+	if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+		t.Errorf("files-from directory not removed: %v", err)
+	}
+
+	if os.Geteuid() != 0 {
+		return
+	}
+	u, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no nobody user to give the file to")
+	}
+	runner = &fakeRunner{}
+	opts.LocalRunAs, opts.CommandRunner = "nobody", runner
+	task, release, err = spillFilterRules(DataMigrationModel{RsyncOptions: opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	info, err := os.Stat(task.RsyncOptions.filesFromFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid := strconv.Itoa(int(info.Sys().(*syscall.Stat_t).Uid)); uid != u.Uid || info.Mode().Perm() != 0600 {
+		t.Errorf("files-from file owned by %s with mode %04o, want %s (nobody) and 0600", uid, info.Mode().Perm(), u.Uid)
+	}
+	if cmds := runner.commands(); len(cmds) != 0 {
+		t.Errorf("commands run as root = %q, want none", cmds)
+	}
+}
@@ -0,0 +1,288 @@
+package transx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultClockSkewWarnSeconds = 2  // Default skew above which a warning is reported
+	defaultMaxClockSkewSeconds  = 60 // Default skew above which preflight fails for time-sensitive transfers
+)
+
+// PreflightOption defines checks to be performed before a migration touches any data.
+type PreflightOption struct {
+	// CheckClockSkew, if true, measures the clock of each endpoint (and the local machine)
+	// and compares them pairwise. rsync's mtime-based decisions (--update) and MtimeSplit windows
+	// become unreliable when the endpoints disagree on the current time. The clocks are measured on
+	// every run, never reused from the probe cache of a batch.
+	CheckClockSkew       bool
+	ClockSkewWarnSeconds int // Skew (in seconds) above which a warning is reported (0 uses default 2)
+	MaxClockSkewSeconds  int // Skew (in seconds) above which preflight fails when time-sensitive options are used (0 uses default 60)
+
+	// CheckFreeSpace, if true, estimates the bytes and inodes the transfer writes with an rsync
+	// dry-run (or the Estimate of DataMigrationModel.Backend) and fails with an *InsufficientSpaceError or *InsufficientInodesError if the destination
+	// (or, in relay mode, the local staging directory) cannot hold them. The estimate reflects the
+	// source at preflight time, i.e., before Source.BackupCmd runs.
+	CheckFreeSpace bool
+
+	// ResolveHosts, if true, resolves the HostIP of each remote endpoint (unless it is a literal IP
+	// address) with the local resolver and fails with a *ResolutionError naming the hosts that do not
+	// resolve. Leave it off if HostIP is a Host alias of the ssh client configuration.
+	ResolveHosts bool
+}
+
+// hostResolutionTimeout bounds the DNS lookup of each host.
+const hostResolutionTimeout = 10 * time.Second
+
+// clockProbeTimeout bounds the date command run to measure the clock of an endpoint. It exceeds the
+// 30-second ConnectTimeout of ssh, so a slow handshake fails with the error of ssh instead.
+const clockProbeTimeout = 45 * time.Second
+
+// ResolutionError is returned by Preflight when the host names of remote endpoints cannot be resolved.
+type ResolutionError struct {
+	Hosts []string // Host names that could not be resolved
+	Err   error    // Lookup errors of the hosts
+}
+
+func (e *ResolutionError) Error() string {
+	return fmt.Sprintf("cannot resolve remote host(s) '%s' (check HostIP for typos): %v", strings.Join(e.Hosts, "', '"), e.Err)
+}
+
+// Unwrap returns the lookup errors.
+func (e *ResolutionError) Unwrap() error {
+	return e.Err
+}
+
+// ClockSkew records the measured clock difference between two endpoints.
+type ClockSkew struct {
+	From string        // Label of the reference endpoint (e.g., "local", "source", "destination")
+	To   string        // Label of the compared endpoint
+	Skew time.Duration // Clock of To minus clock of From
+}
+
+// PreflightReport holds the results of the preflight checks.
+type PreflightReport struct {
+	HostIdentities []HostIdentityCheck // Identity checks of the endpoints with an ExpectedHostIdentity
+	ClockSkews     []ClockSkew         // Pairwise clock skews between the measured endpoints
+	FreeSpace      []FreeSpaceCheck    // Capacity of the transfer targets, if the free-space check ran
+	Warnings       []string            // Non-fatal findings
+}
+
+// enabled reports whether any preflight check is requested.
+func (p PreflightOption) enabled() bool {
+	return p.CheckClockSkew || p.CheckFreeSpace || p.ResolveHosts
+}
+
+// needsPreflight reports whether the workflow must run Preflight: a check is requested,
+// or an option (e.g., RsyncOption.LocalRunAs or ExpectedHostIdentity) requires its own check.
+func (task *DataMigrationModel) needsPreflight() bool {
+	return task.PreflightOptions.enabled() || strings.TrimSpace(task.RsyncOptions.LocalRunAs) != "" ||
+		task.Source.ExpectedHostIdentity.enabled() || task.Destination.ExpectedHostIdentity.enabled()
+}
+
+// usesTimeSensitiveOptions reports whether the rsync options rely on modification times written by
+// one endpoint's clock being compared with another's, which makes clock skew harmful: Update skips
+// files whose destination copy looks newer (with NoTimes or without Archive, that copy carries the
+// destination clock), and MtimeSplit selects source files by boundaries usually derived from the
+// local clock.
+func (o RsyncOption) usesTimeSensitiveOptions() bool {
+	return o.Update || len(o.MtimeSplit.Boundaries) > 0
+}
+
+// Preflight runs the checks enabled in the task's PreflightOptions and returns their findings.
+// The endpoints with an ExpectedHostIdentity are identified before any other command runs on them,
+// and if RsyncOption.LocalRunAs is set, it also checks that non-interactive sudo to that user works.
+// It returns an error (along with the partial report) when a check fails.
+func Preflight(task DataMigrationModel) (*PreflightReport, error) {
+	task.attachAuditTrail()
+	report := &PreflightReport{}
+
+	if task.PreflightOptions.ResolveHosts {
+		if err := resolveHosts(task); err != nil {
+			return report, err
+		}
+	}
+
+	if err := checkHostIdentities(task, report); err != nil {
+		return report, err
+	}
+
+	if strings.TrimSpace(task.RsyncOptions.LocalRunAs) != "" {
+		_, err := cachedProbe(task.RsyncOptions.probes, "sudo|"+task.RsyncOptions.LocalRunAs+"|"+strings.Join(task.RsyncOptions.CommandWrapper, " "),
+			func() (struct{}, error) { return struct{}{}, runAsLocalUser(task.RsyncOptions, "true") })
+		if err != nil {
+			return report, fmt.Errorf("cannot run local commands as '%s' with non-interactive sudo (sudo -n -u %s true): %w",
+				task.RsyncOptions.LocalRunAs, task.RsyncOptions.LocalRunAs, err)
+		}
+	}
+
+	if task.PreflightOptions.CheckClockSkew {
+		if err := checkClockSkew(task, report); err != nil {
+			return report, err
+		}
+	}
+
+	if task.PreflightOptions.CheckFreeSpace {
+		if err := checkFreeSpace(task, report); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// resolveHosts looks up the host name of each remote endpoint (the host of a container endpoint)
+// and returns a *ResolutionError listing those that do not resolve. Literal IP addresses are skipped.
+func resolveHosts(task DataMigrationModel) error {
+	var hosts []string
+	for _, e := range task.endpoints() {
+		if e.isContainer() {
+			e = e.hostEndpoint()
+		}
+		host := strings.Trim(strings.TrimSpace(e.HostIP), "[]")
+		if !e.isRemote() || host == "" || net.ParseIP(host) != nil || slices.Contains(hosts, host) {
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+
+	resolutionErr := &ResolutionError{}
+	var errs []error
+	for _, host := range hosts {
+		_, err := cachedProbe(task.RsyncOptions.probes, "resolve|"+host, func() ([]string, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), hostResolutionTimeout)
+			defer cancel()
+			return net.DefaultResolver.LookupHost(ctx, host)
+		})
+		if err != nil {
+			resolutionErr.Hosts = append(resolutionErr.Hosts, host)
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		resolutionErr.Err = errors.Join(errs...)
+		return resolutionErr
+	}
+	return nil
+}
+
+// checkClockSkew measures the clock of the local machine and each remote endpoint,
+// records the pairwise skews in the report, and fails when the skew is too large
+// for the configured rsync options.
+func checkClockSkew(task DataMigrationModel, report *PreflightReport) error {
+	warnThreshold := time.Duration(task.PreflightOptions.ClockSkewWarnSeconds) * time.Second
+	if warnThreshold <= 0 {
+		warnThreshold = defaultClockSkewWarnSeconds * time.Second
+	}
+	maxSkew := time.Duration(task.PreflightOptions.MaxClockSkewSeconds) * time.Second
+	if maxSkew <= 0 {
+		maxSkew = defaultMaxClockSkewSeconds * time.Second
+	}
+
+	type clock struct {
+		label  string
+		offset time.Duration // Offset from the local clock
+	}
+	clocks := []clock{{label: "local"}}
+
+	endpoints := []struct {
+		label    string
+		endpoint EndpointDetails
+	}{
+		{"source", task.Source},
+		{"destination", task.Destination},
+	}
+	for _, ep := range endpoints {
+		if !ep.endpoint.isRemote() {
+			continue
+		}
+		// Not cached across the tasks of a batch: a clock may be stepped (e.g., by NTP) in between
+		offset, err := measureClockOffset(ep.endpoint, task.RsyncOptions)
+		if err != nil {
+			return fmt.Errorf("failed to measure clock of %s '%s': %w", ep.label, ep.endpoint.HostIP, err)
+		}
+		clocks = append(clocks, clock{label: ep.label, offset: offset})
+	}
+
+	var worst time.Duration
+	var worstSkew ClockSkew
+	for i := 0; i < len(clocks); i++ {
+		for j := i + 1; j < len(clocks); j++ {
+			skew := ClockSkew{From: clocks[i].label, To: clocks[j].label, Skew: clocks[j].offset - clocks[i].offset}
+			report.ClockSkews = append(report.ClockSkews, skew)
+
+			abs := skew.Skew
+			if abs < 0 {
+				abs = -abs
+			}
+			if abs > worst {
+				worst = abs
+				worstSkew = skew
+			}
+			if abs > warnThreshold {
+				warning := fmt.Sprintf("clock skew between %s and %s is %s", skew.From, skew.To, skew.Skew)
+				report.Warnings = append(report.Warnings, warning)
+				fmt.Printf("Warning: %s\n", warning)
+			}
+		}
+	}
+
+	if worst > maxSkew && task.RsyncOptions.usesTimeSensitiveOptions() {
+		return fmt.Errorf("clock skew between %s and %s is %s, exceeding the maximum of %s allowed with time-sensitive rsync options (--update or MtimeSplit)",
+			worstSkew.From, worstSkew.To, worstSkew.Skew, maxSkew)
+	}
+	return nil
+}
+
+// measureClockOffset runs "date +%s.%N" on the endpoint and returns its clock offset from the local clock.
+// The local time is taken as the midpoint of the round trip to compensate for connection latency.
+// A date without %N support (e.g., BSD or BusyBox) prints it literally, and whole seconds are used.
+func measureClockOffset(endpoint EndpointDetails, sshConfig RsyncOption) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), clockProbeTimeout)
+	defer cancel()
+
+	before := time.Now()
+	output, err := executeCommandContext(ctx, "date +%s.%N", endpoint, sshConfig)
+	after := time.Now()
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, fmt.Errorf("date did not complete within %s", clockProbeTimeout)
+		}
+		return 0, fmt.Errorf("%w\nOutput:\n%s", err, string(output))
+	}
+
+	// Take the last non-empty line to skip any SSH banners or warnings
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	remote, err := parseDateOutput(last)
+	if err != nil {
+		return 0, err
+	}
+
+	localMidpoint := before.Add(after.Sub(before) / 2)
+	return remote.Sub(localMidpoint), nil
+}
+
+// parseDateOutput parses the output of "date +%s.%N". A fraction other than digits (a literal
+// "N" or "%N") is ignored, leaving the whole seconds of "date +%s".
+func parseDateOutput(out string) (time.Time, error) {
+	secPart, fracPart, _ := strings.Cut(out, ".")
+	seconds, err := strconv.ParseInt(secPart, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected output from 'date +%%s.%%N': %q", out)
+	}
+	var nanos int64
+	if fracPart != "" && strings.Trim(fracPart, "0123456789") == "" {
+		// Scale the fraction to nanoseconds whatever its number of digits
+		frac := (fracPart + "000000000")[:9]
+		nanos, _ = strconv.ParseInt(frac, 10, 64)
+	}
+	return time.Unix(seconds, nanos), nil
+}
@@ -0,0 +1,189 @@
+package transx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDateOutput(t *testing.T) {
+	tests := []struct {
+		out  string
+		want time.Time
+	}{
+		{"1700000000.123456789", time.Unix(1700000000, 123456789)},
+		{"1700000000.5", time.Unix(1700000000, 500000000)},
+		{"1700000000.000000001", time.Unix(1700000000, 1)},
+		{"1700000000.N", time.Unix(1700000000, 0)},  // BSD date
+		{"1700000000.%N", time.Unix(1700000000, 0)}, // BusyBox without nanoseconds
+		{"1700000000", time.Unix(1700000000, 0)},
+	}
+	for _, tt := range tests {
+		got, err := parseDateOutput(tt.out)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseDateOutput(%q) = %v, %v, want %v", tt.out, got, err, tt.want)
+		}
+	}
+
+	for _, out := range []string{"", "N", "Thu Jan  1 00:00:00 UTC 2026", ".5"} {
+		if _, err := parseDateOutput(out); err == nil {
+			t.Errorf("parseDateOutput(%q) succeeded, want an error", out)
+		}
+	}
+}
+
+func TestMeasureClockOffset(t *testing.T) {
+	const skew = 1500 * time.Millisecond
+	var hasDeadline bool
+	runner := &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+		_, hasDeadline = ctx.Deadline()
+		now := time.Now().Add(skew)
+		return []byte(fmt.Sprintf("Banner line\n%d.%09d\n", now.Unix(), now.Nanosecond())), nil
+	}}
+	endpoint := EndpointDetails{Username: "user", HostIP: "10.0.0.1"}
+
+	offset, err := measureClockOffset(endpoint, RsyncOption{CommandRunner: runner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Whole-second resolution could not tell 1.5s from 1s or 2s
+	if diff := offset - skew; diff < -100*time.Millisecond || diff > 100*time.Millisecond {
+		t.Errorf("offset = %s, want about %s", offset, skew)
+	}
+	if !hasDeadline {
+		t.Error("date ran without a timeout")
+	}
+	cmds := runner.commands()
+	if len(cmds) != 1 || !strings.HasSuffix(cmds[0], "user@10.0.0.1 date +%s.%N") {
+		t.Errorf("commands run = %q, want ssh running date +%%s.%%N", cmds)
+	}
+}
+
+func TestMeasureClockOffsetFailure(t *testing.T) {
+	runner := &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+		return []byte("date: not found\n"), exitError(127)
+	}}
+	_, err := measureClockOffset(EndpointDetails{HostIP: "10.0.0.1"}, RsyncOption{CommandRunner: runner})
+	if err == nil || !strings.Contains(err.Error(), "date: not found") {
+		t.Errorf("measureClockOffset() error = %v, want the output of date", err)
+	}
+}
+
+// sshLogRunner is a fake ssh writing the verbose log of "ssh -vvv" to the -E file, the way ssh
+// does, and failing with it if fail is set.
+func sshLogRunner(t *testing.T, stdout string, fail bool) *fakeRunner {
+	return &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+		i := slices.Index(args, "-E")
+		if i < 0 || i+1 >= len(args) {
+			t.Errorf("ssh ran without -E: %q", args)
+			return nil, exitError(255)
+		}
+		log := "OpenSSH_9.6p1\ndebug1: Connecting to 10.0.0.1\nAuthenticated to 10.0.0.1 ([10.0.0.1]:22) using \"publickey\".\n" +
+			"Transferred: sent 2960, received 2968 bytes, in 0.1 seconds\nBytes per second: sent 29600.0, received 29680.0\n"
+		if err := os.WriteFile(args[i+1], []byte(log), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if fail {
+			return nil, exitError(255)
+		}
+		return []byte(stdout), nil
+	}}
+}
+
+// With DebugSSH, the verbose lines ssh prints without a debug prefix stay out of successful output.
+func TestMeasureClockOffsetDebugSSH(t *testing.T) {
+	now := time.Now()
+	runner := sshLogRunner(t, fmt.Sprintf("%d.%09d\n", now.Unix(), now.Nanosecond()), false)
+	opts := RsyncOption{DebugSSH: true, CommandRunner: runner}
+
+	if _, err := measureClockOffset(EndpointDetails{HostIP: "10.0.0.1"}, opts); err != nil {
+		t.Fatal(err)
+	}
+	output, err := executeCommand("date +%s.%N", EndpointDetails{HostIP: "10.0.0.1"}, opts)
+	if err != nil || strings.Count(string(output), "\n") != 1 {
+		t.Errorf("executeCommand() = %q, %v, want only the output of date", output, err)
+	}
+}
+
+// With DebugSSH, a failed command carries the ssh log in its output, and the log file is removed.
+func TestDebugSSHLogOnFailure(t *testing.T) {
+	runner := sshLogRunner(t, "", true)
+	opts := RsyncOption{DebugSSH: true, CommandRunner: runner}
+
+	output, err := executeCommand("true", EndpointDetails{HostIP: "10.0.0.1"}, opts)
+	if err == nil || !strings.Contains(string(output), "debug1: Connecting to 10.0.0.1") {
+		t.Errorf("executeCommand() = %q, %v, want an error with the ssh log", output, err)
+	}
+	args := runner.calls[0]
+	logPath := args[slices.Index(args, "-E")+1]
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Errorf("ssh log %s was not removed: %v", logPath, err)
+	}
+}
+
+// clockRunner is a fake ssh running date on a host whose clock is ahead of the local one by *skew.
+func clockRunner(skew *time.Duration) *fakeRunner {
+	return &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+		now := time.Now().Add(*skew)
+		return []byte(fmt.Sprintf("%d.%09d\n", now.Unix(), now.Nanosecond())), nil
+	}}
+}
+
+func TestCheckClockSkewTimeSensitiveOptions(t *testing.T) {
+	skew := 5 * time.Minute
+	tests := []struct {
+		name    string
+		opts    RsyncOption
+		wantErr bool
+	}{
+		{"archive", RsyncOption{Archive: true}, false},
+		{"update", RsyncOption{Archive: true, Update: true}, true},
+		{"update without times", RsyncOption{Archive: true, NoTimes: true, Update: true}, true},
+		{"mtime split", RsyncOption{Archive: true, MtimeSplit: MtimeSplitOption{Boundaries: []time.Time{time.Now().Add(-time.Hour)}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.CommandRunner = clockRunner(&skew)
+			task := DataMigrationModel{
+				Source:           EndpointDetails{Username: "user", HostIP: "10.0.0.1", DataPath: "/data/"},
+				Destination:      EndpointDetails{DataPath: t.TempDir() + "/"},
+				RsyncOptions:     tt.opts,
+				PreflightOptions: PreflightOption{CheckClockSkew: true},
+			}
+			report := &PreflightReport{}
+			err := checkClockSkew(task, report)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkClockSkew() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(report.Warnings) != 1 {
+				t.Errorf("warnings = %q, want one for the skew of the source", report.Warnings)
+			}
+		})
+	}
+}
+
+// The clock of an endpoint is measured again by every task of a batch, not reused from the probe cache.
+func TestCheckClockSkewNotCached(t *testing.T) {
+	var skew time.Duration
+	runner := clockRunner(&skew)
+	task := DataMigrationModel{
+		Source:       EndpointDetails{Username: "user", HostIP: "10.0.0.1", DataPath: "/data/"},
+		Destination:  EndpointDetails{DataPath: t.TempDir() + "/"},
+		RsyncOptions: RsyncOption{Archive: true, Update: true, CommandRunner: runner, probes: newProbeCache(time.Hour)},
+	}
+	if err := checkClockSkew(task, &PreflightReport{}); err != nil {
+		t.Fatalf("checkClockSkew() without skew: %v", err)
+	}
+
+	skew = 5 * time.Minute // e.g., NTP stepped the clock between two tasks
+	if err := checkClockSkew(task, &PreflightReport{}); err == nil {
+		t.Error("checkClockSkew() reused the clock measured before the skew")
+	}
+	if n := len(runner.commands()); n != 2 {
+		t.Errorf("date ran %d times, want once per task", n)
+	}
+}
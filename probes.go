@@ -0,0 +1,100 @@
+package transx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultProbeCacheTTL is how long a probe result is reused if BatchOption.ProbeCacheTTL is not set.
+const defaultProbeCacheTTL = 5 * time.Minute
+
+// probeCache memoizes the results of environment probes (the local rsync version, the LocalRunAs
+// sudo check, and host name resolution) across the tasks of one MigrateBatch run, so that tasks
+// against the same hosts do not repeat them. All methods are safe on a nil cache, which runs every
+// probe (WorkflowOption.BypassProbeCache, or a single MigrateData run).
+type probeCache struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	entries  map[string]probeEntry
+	settings map[string]string // SSH settings fingerprint of each host identity
+}
+
+// probeEntry is a memoized probe result.
+type probeEntry struct {
+	value   any
+	err     error
+	expires time.Time
+}
+
+// newProbeCache creates an empty cache whose entries expire after ttl (0 uses the default).
+func newProbeCache(ttl time.Duration) *probeCache {
+	if ttl <= 0 {
+		ttl = defaultProbeCacheTTL
+	}
+	return &probeCache{ttl: ttl, entries: map[string]probeEntry{}, settings: map[string]string{}}
+}
+
+// cachedProbe returns the memoized result of the probe under key, running it on a miss or after expiry.
+// Errors are memoized too, so a broken environment is not probed again for every task.
+func cachedProbe[T any](c *probeCache, key string, probe func() (T, error)) (T, error) {
+	if c == nil {
+		return probe()
+	}
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		value, _ := entry.value.(T)
+		return value, entry.err
+	}
+
+	value, err := probe()
+	c.mu.Lock()
+	c.entries[key] = probeEntry{value: value, err: err, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return value, err
+}
+
+// hostProbeKey returns the cache key of a probe of the endpoint's host: the host identity (HostIP,
+// SSHPort, and Username) plus the probe kind. If the SSH settings used for the identity differ from
+// those of earlier probes (e.g., another key or RemoteShellCommand), the host's entries are dropped.
+func (c *probeCache) hostProbeKey(kind string, e EndpointDetails, opts RsyncOption) string {
+	identity := fmt.Sprintf("%s@%s:%d", e.Username, e.HostIP, e.SSHPort)
+	key := kind + "|" + identity
+	if c == nil {
+		return key
+	}
+
+	settings := sshSettingsFingerprint(e, opts)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if previous, ok := c.settings[identity]; ok && previous != settings {
+		for k := range c.entries {
+			if strings.HasSuffix(k, "|"+identity) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.settings[identity] = settings
+	return key
+}
+
+// sshSettingsFingerprint summarizes the settings that affect connections to the endpoint, including
+// the content of its private key (so a replaced key file counts as a change).
+func sshSettingsFingerprint(e EndpointDetails, opts RsyncOption) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%t\x00%t\x00%t\x00%s\x00%s\x00%q\x00",
+		e.SSHPrivateKeyPath, opts.InsecureSkipHostKeyVerification, opts.InteractiveSSH, opts.DebugSSH, opts.RemoteShellCommand, opts.LocalRunAs, opts.CommandWrapper)
+	if path := strings.TrimSpace(e.SSHPrivateKeyPath); path != "" {
+		if key, err := os.ReadFile(path); err == nil {
+			h.Write(key)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,33 @@
+//go:build !unix
+
+package transx
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup does nothing on platforms without process groups.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the process started by cmd; the processes it started are left running.
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+}
+
+// tryLockFile reports whether f is empty, i.e., not written by another run, since files cannot be
+// locked on this platform; a lock left by a dead run is only taken over once it expires.
+func tryLockFile(f *os.File) (bool, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	return info.Size() == 0, nil
+}
+
+// maxRSS reports false, since the resource usage of processes is not available on this platform.
+func maxRSS(state *os.ProcessState) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,49 @@
+//go:build unix
+
+package transx
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// setProcessGroup makes cmd start a process group of its own, so that killProcessGroup also kills
+// the processes it starts (e.g., the ssh client of rsync). A canceled context kills the group as well.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		killProcessGroup(cmd)
+		return nil
+	}
+}
+
+// killProcessGroup kills the process group started by cmd (see setProcessGroup).
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// tryLockFile takes an exclusive flock of f without waiting, reporting false if another open file
+// holds it. The lock is released when f is closed, including by the exit of the process.
+func tryLockFile(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// maxRSS returns the peak resident set size of the finished process in bytes.
+func maxRSS(state *os.ProcessState) (int64, bool) {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0, false
+	}
+	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
+		return int64(rusage.Maxrss), true // Reported in bytes
+	}
+	return int64(rusage.Maxrss) * 1024, true // Reported in kilobytes
+}
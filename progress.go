@@ -0,0 +1,311 @@
+package transx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProgressEvent is a snapshot of a running rsync transfer, parsed from rsync's --info=progress2 output.
+type ProgressEvent struct {
+	Leg              RelayLeg // Relay leg the event belongs to ("" for direct transfers)
+	BytesTransferred int64    // Bytes transferred so far by this rsync process
+	Percent          float64  // Completion of the whole transfer (0-100)
+	Rate             string   // Current transfer rate as reported by rsync (e.g., "12.34MB/s")
+	ETA              string   // Estimated remaining time as reported by rsync (e.g., "0:01:23")
+}
+
+// ProgressFunc receives the progress snapshots of a running transfer (see RsyncOption.OnProgress).
+type ProgressFunc func(ProgressEvent)
+
+// FileEvent is an entry created, updated, or deleted by a running rsync transfer, parsed from the
+// entry log rsync writes for RsyncOption.OnFile.
+type FileEvent struct {
+	Leg     RelayLeg // Relay leg the event belongs to ("" for direct transfers)
+	Itemize string   // rsync's itemized change string (e.g., ">f+++++++++" or "*deleting")
+	Size    int64    // File length in bytes
+	Name    string   // Path relative to the transfer root
+}
+
+// FileFunc receives the file events of a running transfer (see RsyncOption.OnFile).
+type FileFunc func(FileEvent)
+
+// defaultFileEventBuffer is the number of file events queued for a busy OnFile if
+// RsyncOption.FileEventBuffer is 0.
+const defaultFileEventBuffer = 65536
+
+// FileEventOverflowError is returned when the OnFile consumer fell behind by more than
+// RsyncOption.FileEventBuffer events. rsync itself is not slowed down: the events that did not fit
+// in the queue were dropped, and the transfer finished (its own failure is reported instead, if any).
+type FileEventOverflowError struct {
+	Leg     RelayLeg // Relay leg whose events were dropped ("" for direct transfers)
+	Buffer  int      // Capacity of the queue
+	Dropped int64    // Events dropped
+}
+
+func (e *FileEventOverflowError) Error() string {
+	leg := ""
+	if e.Leg != "" {
+		leg = " of the " + string(e.Leg) + " leg"
+	}
+	return fmt.Sprintf("OnFile fell behind: %d file events%s were dropped after the queue of %d filled up; "+
+		"raise FileEventBuffer or make OnFile faster (the transfer itself completed)", e.Dropped, leg, e.Buffer)
+}
+
+// fileEventBuffer returns the capacity of the queue of file events.
+func (o RsyncOption) fileEventBuffer() int {
+	if o.FileEventBuffer > 0 {
+		return o.FileEventBuffer
+	}
+	return defaultFileEventBuffer
+}
+
+// progressFunc returns the consumer of the progress snapshots of the transfer: OnProgress and the
+// consumer attached by the workflow, or nil if there is none.
+func (o RsyncOption) progressFunc() func(ProgressEvent) {
+	switch {
+	case o.OnProgress == nil:
+		return o.onProgress
+	case o.onProgress == nil:
+		return o.OnProgress
+	}
+	return func(event ProgressEvent) {
+		o.OnProgress(event)
+		o.onProgress(event)
+	}
+}
+
+// progressLinePattern matches a --info=progress2 line, e.g., "  1,234,567  45%   12.34MB/s    0:00:12 (xfr#3, to-chk=10/20)".
+var progressLinePattern = regexp.MustCompile(`^\s*([\d,.]+)\s+(\d{1,3})%\s+(\S+/s)\s+(\d+:\d{2}:\d{2})`)
+
+// parseProgressLine parses a --info=progress2 line.
+func parseProgressLine(line string) (ProgressEvent, bool) {
+	m := progressLinePattern.FindStringSubmatch(line)
+	if m == nil {
+		return ProgressEvent{}, false
+	}
+	bytesTransferred, err := strconv.ParseInt(strings.NewReplacer(",", "", ".", "").Replace(m[1]), 10, 64)
+	if err != nil {
+		return ProgressEvent{}, false
+	}
+	percent, _ := strconv.ParseFloat(m[2], 64)
+	return ProgressEvent{BytesTransferred: bytesTransferred, Percent: percent, Rate: m[3], ETA: m[4]}, true
+}
+
+// scanOutputSegments splits rsync output at newlines and carriage returns, since progress lines
+// are rewritten in place with "\r".
+func scanOutputSegments(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// progressDeliverer decouples the delivery of progress snapshots and file events from the parsing of
+// rsync's output, so a slow consumer never stalls the parser (and, through the pipe, rsync itself).
+// It holds a single pending snapshot: a snapshot parsed while the consumer is busy replaces the
+// pending one, so the consumer always receives the newest state and intermediate snapshots are
+// coalesced away. File events must not be coalesced, so they are queued for their own goroutine up
+// to a capacity, beyond which they are dropped and counted (see FileEventOverflowError).
+type progressDeliverer struct {
+	onProgress func(ProgressEvent)
+	onFile     FileFunc
+
+	mu         sync.Mutex
+	latest     ProgressEvent
+	hasPending bool
+	wake       chan struct{}
+	done       chan struct{}
+
+	files     chan FileEvent
+	dropped   int64 // Written by the sender only
+	filesDone chan struct{}
+}
+
+// newProgressDeliverer starts the goroutines delivering snapshots to onProgress and file events to
+// onFile (each may be nil), queuing up to fileBuffer file events.
+func newProgressDeliverer(onProgress func(ProgressEvent), onFile FileFunc, fileBuffer int) *progressDeliverer {
+	d := &progressDeliverer{onProgress: onProgress, onFile: onFile, wake: make(chan struct{}, 1), done: make(chan struct{})}
+	go d.run()
+	if onFile != nil {
+		d.files = make(chan FileEvent, fileBuffer)
+		d.filesDone = make(chan struct{})
+		go d.runFiles()
+	}
+	return d
+}
+
+// sendFile queues a file event without blocking, dropping it if the queue is full.
+func (d *progressDeliverer) sendFile(event FileEvent) {
+	select {
+	case d.files <- event:
+	default:
+		d.dropped++
+	}
+}
+
+// runFiles delivers the queued file events in order.
+func (d *progressDeliverer) runFiles() {
+	defer close(d.filesDone)
+	for event := range d.files {
+		d.onFile(event)
+	}
+}
+
+// overflow returns a *FileEventOverflowError if file events were dropped, or nil.
+func (d *progressDeliverer) overflow(leg RelayLeg) error {
+	if d.dropped == 0 {
+		return nil
+	}
+	return &FileEventOverflowError{Leg: leg, Buffer: cap(d.files), Dropped: d.dropped}
+}
+
+// send queues a snapshot without blocking, replacing a snapshot not yet delivered.
+func (d *progressDeliverer) send(event ProgressEvent) {
+	d.mu.Lock()
+	d.latest = event
+	d.hasPending = true
+	d.mu.Unlock()
+	select {
+	case d.wake <- struct{}{}:
+	default: // The consumer is already signaled and will pick up the newest snapshot
+	}
+}
+
+// run delivers the pending snapshot each time it is signaled.
+func (d *progressDeliverer) run() {
+	defer close(d.done)
+	for range d.wake {
+		d.mu.Lock()
+		event, ok := d.latest, d.hasPending
+		d.hasPending = false
+		d.mu.Unlock()
+		if ok && d.onProgress != nil {
+			d.onProgress(event)
+		}
+	}
+}
+
+// close delivers the last pending snapshot and the queued file events, and waits for the delivery
+// goroutines to exit.
+func (d *progressDeliverer) close() {
+	close(d.wake)
+	<-d.done
+	if d.files != nil {
+		close(d.files)
+		<-d.filesDone
+	}
+}
+
+// runRsyncCommand runs an rsync command and returns its combined output. If a progress consumer is
+// set (see RsyncOption.progressFunc, and the command was built with --info=progress2), the output is
+// streamed: progress lines are delivered to the consumer as they arrive, tagged with leg, and left
+// out of the returned output. The consumer runs on its own goroutine and may be slow; snapshots
+// parsed meanwhile are coalesced (see progressDeliverer). Likewise, the entries logged for
+// RsyncOption.OnFile are delivered to it on its own goroutine, without being coalesced; if more
+// than RsyncOption.FileEventBuffer of them wait for it, the others are dropped and a
+// *FileEventOverflowError is returned unless rsync failed. The final snapshot and the queued file
+// events are delivered before runRsyncCommand returns. At most RsyncOption.MaxCapturedOutput bytes
+// of output are kept.
+// With RsyncOption.CommandRunner, the command runs through it instead (see runRsyncWithRunner).
+// If RsyncOption.StallTimeout is positive, the process group of the command is killed once it has produced no
+// output for that long, and a *StallError is returned (progress lines count as output).
+// If rsync reports that the receiving side is out of space, the command is killed at once and a
+// *DiskFullError is returned (see DataMigrationModel.handleDiskFull).
+func runRsyncCommand(ctx context.Context, cmd *exec.Cmd, leg RelayLeg, opts RsyncOption) ([]byte, error) {
+	if opts.CommandRunner != nil {
+		return runRsyncWithRunner(ctx, opts, cmd, leg)
+	}
+	onProgress, onFile, stallTimeout := opts.progressFunc(), opts.OnFile, opts.StallTimeout
+	output := &tailBuffer{limit: opts.MaxCapturedOutput}
+	diskFull := newDiskFullDetector(cmd, stallTimeout > 0)
+	cmd.WaitDelay = commandWaitDelay
+	if onProgress == nil && onFile == nil && stallTimeout <= 0 {
+		sink := io.MultiWriter(output, diskFull)
+		cmd.Stdout = sink
+		cmd.Stderr = sink // The same writer, so os/exec serializes the writes
+		err := cmd.Run()
+		err = hostKeyFailure(output.Bytes(), err)
+		if diskFull.fired() {
+			err = &DiskFullError{Leg: leg, BytesWritten: -1, Err: err}
+		}
+		return output.Bytes(), err
+	}
+
+	pr, pw := io.Pipe()
+	activity := &activityWriter{w: io.MultiWriter(pw, diskFull), last: time.Now()}
+	cmd.Stdout = activity
+	cmd.Stderr = activity // The same writer, so os/exec serializes the writes
+
+	var deliverer *progressDeliverer
+	if onProgress != nil || onFile != nil {
+		deliverer = newProgressDeliverer(onProgress, onFile, opts.fileEventBuffer())
+	}
+	bytesWritten := int64(-1) // Written by the scanner goroutine, read after done
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(pr)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		scanner.Split(scanOutputSegments)
+		for scanner.Scan() {
+			segment := scanner.Text()
+			if event, ok := parseProgressLine(segment); ok {
+				bytesWritten = event.BytesTransferred
+				if onProgress != nil {
+					event.Leg = leg
+					deliverer.send(event)
+				}
+				continue
+			}
+			if onFile != nil {
+				if entry, ok := parseDryRunEntry(segment); ok {
+					deliverer.sendFile(FileEvent{Leg: leg, Itemize: entry.Itemize, Size: entry.Size, Name: entry.Name})
+				}
+			}
+			if strings.TrimSpace(segment) != "" {
+				output.WriteString(segment + "\n")
+			}
+		}
+		io.Copy(output, pr) // Keep draining if the scanner stopped (e.g., on an overlong line)
+	}()
+
+	if stallTimeout > 0 {
+		setProcessGroup(cmd)
+	}
+	var watchdog *stallWatchdog
+	err := cmd.Start()
+	if err == nil {
+		if stallTimeout > 0 {
+			watchdog = watchStall(cmd, activity, stallTimeout)
+		}
+		err = cmd.Wait()
+	}
+	pw.Close()
+	<-done
+	if deliverer != nil {
+		deliverer.close()
+		if err == nil {
+			err = deliverer.overflow(leg)
+		}
+	}
+	err = hostKeyFailure(output.Bytes(), err)
+	if watchdog != nil && watchdog.finish() {
+		err = &StallError{Leg: leg, Timeout: stallTimeout}
+	}
+	if diskFull.fired() {
+		err = &DiskFullError{Leg: leg, BytesWritten: bytesWritten, Err: err}
+	}
+	return output.Bytes(), err
+}
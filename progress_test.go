@@ -0,0 +1,149 @@
+package transx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRsyncScript returns a shell script printing progress lines, one every delay, and count file
+// entries, as rsync does with --info=progress2 and the entry log of OnFile.
+func fakeRsyncScript(progressLines int, delay time.Duration, entries int) string {
+	return fmt.Sprintf(`
+i=1
+while [ $i -le %d ]; do
+	printf '%%12d %%3d%%%%   1.00MB/s    0:00:01 (xfr#%%d, to-chk=0/1)\r' $((i * 1000)) $((i * 100 / %d)) $i
+	sleep %f
+	i=$((i + 1))
+done
+i=1
+while [ $i -le %d ]; do
+	echo "%s>f+++++++++:10:file$i"
+	i=$((i + 1))
+done
+echo "sent 1 bytes"
+`, progressLines, progressLines, delay.Seconds(), entries, dryRunEntryPrefix)
+}
+
+// runFakeRsync runs the script as an rsync command and returns how long runRsyncCommand took.
+func runFakeRsync(t *testing.T, script string, opts RsyncOption) (time.Duration, error) {
+	t.Helper()
+	start := time.Now()
+	_, err := runRsyncCommand(context.Background(), exec.Command("sh", "-c", script), "", opts)
+	return time.Since(start), err
+}
+
+// A slow progress consumer must not slow down the transfer: snapshots parsed while it is busy are
+// coalesced, and only the last one is waited for.
+func TestSlowProgressConsumerDoesNotStallTransfer(t *testing.T) {
+	script := fakeRsyncScript(100, 10*time.Millisecond, 0)
+	baseline, err := runFakeRsync(t, script, RsyncOption{OnProgress: func(ProgressEvent) {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const consumerDelay = 100 * time.Millisecond // 10s if every snapshot were waited for
+	var mu sync.Mutex
+	var received []ProgressEvent
+	elapsed, err := runFakeRsync(t, script, RsyncOption{OnProgress: func(event ProgressEvent) {
+		time.Sleep(consumerDelay)
+		mu.Lock()
+		received = append(received, event)
+		mu.Unlock()
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if limit := baseline*3/2 + 2*consumerDelay + 200*time.Millisecond; elapsed > limit {
+		t.Errorf("transfer took %s with a slow consumer, want at most %s (%s without)", elapsed, limit, baseline)
+	}
+	if len(received) == 0 || len(received) >= 100 {
+		t.Fatalf("consumer received %d snapshots, want some coalesced away", len(received))
+	}
+	if last := received[len(received)-1]; last.BytesTransferred != 100*1000 || last.Percent != 100 {
+		t.Errorf("last snapshot = %+v, want the final one", last)
+	}
+}
+
+func TestFileEvents(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  int
+		buffer   int
+		delay    time.Duration // Of the consumer per event
+		overflow bool
+	}{
+		{name: "fast consumer", entries: 5000},
+		{name: "slow consumer within the buffer", entries: 200, buffer: 500, delay: time.Millisecond},
+		{name: "slow consumer overflowing the buffer", entries: 1000, buffer: 10, delay: 10 * time.Millisecond, overflow: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received []FileEvent // Delivered on a single goroutine, read after runRsyncCommand returned
+			opts := RsyncOption{FileEventBuffer: tt.buffer, OnFile: func(event FileEvent) {
+				time.Sleep(tt.delay)
+				received = append(received, event)
+			}}
+			_, err := runFakeRsync(t, fakeRsyncScript(1, 0, tt.entries), opts)
+
+			var overflowErr *FileEventOverflowError
+			if !tt.overflow {
+				if err != nil {
+					t.Fatalf("runRsyncCommand() error = %v", err)
+				}
+				if len(received) != tt.entries {
+					t.Fatalf("received %d file events, want %d", len(received), tt.entries)
+				}
+				for i, event := range received {
+					if want := fmt.Sprintf("file%d", i+1); event.Name != want || event.Itemize != ">f+++++++++" || event.Size != 10 {
+						t.Fatalf("event %d = %+v, want %s in order", i, event, want)
+					}
+				}
+				return
+			}
+			if !errors.As(err, &overflowErr) {
+				t.Fatalf("runRsyncCommand() error = %v, want *FileEventOverflowError", err)
+			}
+			if overflowErr.Buffer != tt.buffer || int(overflowErr.Dropped)+len(received) != tt.entries {
+				t.Errorf("overflow = %+v with %d received, want buffer %d and %d events in all",
+					overflowErr, len(received), tt.buffer, tt.entries)
+			}
+		})
+	}
+}
+
+func TestFileEventsWithCommandRunner(t *testing.T) {
+	runner := &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+		return []byte(dryRunEntryPrefix + ">f+++++++++:3:a\n" + dryRunEntryPrefix + "*deleting  :0:b\nsent 1 bytes\n"), nil
+	}}
+	var received []FileEvent
+	opts := RsyncOption{CommandRunner: runner, OnFile: func(event FileEvent) { received = append(received, event) }}
+	if _, err := runRsyncCommand(context.Background(), exec.Command("rsync"), RelayUpload, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := []FileEvent{
+		{Leg: RelayUpload, Itemize: ">f+++++++++", Size: 3, Name: "a"},
+		{Leg: RelayUpload, Itemize: "*deleting", Name: "b"},
+	}
+	if fmt.Sprint(received) != fmt.Sprint(want) {
+		t.Errorf("received %+v, want %+v", received, want)
+	}
+}
+
+func TestOnFileLogsEntries(t *testing.T) {
+	task := DataMigrationModel{
+		Source:       EndpointDetails{DataPath: "/src/"},
+		Destination:  EndpointDetails{DataPath: "/dst/"},
+		RsyncOptions: RsyncOption{OnFile: func(FileEvent) {}},
+	}
+	_, args := buildRsyncArgs(task)
+	if !slices.Contains(args, "--out-format="+dryRunEntryPrefix+"%i:%l:%n") {
+		t.Errorf("args %v do not log the entries for OnFile", args)
+	}
+}
@@ -0,0 +1,119 @@
+package transx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestProtectArgs(t *testing.T) {
+	local := t.TempDir()
+	remote := func(path string) EndpointDetails {
+		return EndpointDetails{Username: "user", HostIP: "host", DataPath: path}
+	}
+	tests := []struct {
+		name       string
+		src, dst   EndpointDetails
+		opts       RsyncOption
+		wantS      bool
+		wantReason string
+		wantPaths  []string // Trailing source and destination arguments, passed verbatim
+	}{
+		{name: "plain remote source", src: remote("/srv/app/"), dst: EndpointDetails{DataPath: local},
+			wantPaths: []string{"user@host:/srv/app/", local}},
+		{name: "space in remote source", src: remote("/srv/app data/"), dst: EndpointDetails{DataPath: local},
+			wantS: true, wantReason: "remote source path '/srv/app data/'", wantPaths: []string{"user@host:/srv/app data/", local}},
+		{name: "star in remote source", src: remote("/srv/build*/"), dst: EndpointDetails{DataPath: local},
+			wantS: true, wantReason: "remote source path '/srv/build*/'", wantPaths: []string{"user@host:/srv/build*/", local}},
+		{name: "question mark in remote source", src: remote("/srv/v?/"), dst: EndpointDetails{DataPath: local},
+			wantS: true, wantReason: "remote source path '/srv/v?/'"},
+		{name: "bracket in remote source", src: remote("/srv/[old]/"), dst: EndpointDetails{DataPath: local},
+			wantS: true, wantReason: "remote source path '/srv/[old]/'"},
+		{name: "tab in remote source", src: remote("/srv/a\tb/"), dst: EndpointDetails{DataPath: local},
+			wantS: true, wantReason: "remote source path"},
+		{name: "space in remote destination", src: EndpointDetails{DataPath: local + "/"}, dst: remote("/srv/in box/"),
+			wantS: true, wantReason: "remote destination path '/srv/in box/'", wantPaths: []string{local + "/", "user@host:/srv/in box/"}},
+		{name: "star in remote destination", src: EndpointDetails{DataPath: local + "/"}, dst: remote("/srv/*/"),
+			wantS: true, wantReason: "remote destination path '/srv/*/'"},
+		{name: "question mark in remote destination", src: EndpointDetails{DataPath: local + "/"}, dst: remote("/srv/a?/"),
+			wantS: true, wantReason: "remote destination path '/srv/a?/'"},
+		{name: "bracket in remote destination", src: EndpointDetails{DataPath: local + "/"}, dst: remote("/srv/[x]/"),
+			wantS: true, wantReason: "remote destination path '/srv/[x]/'"},
+		{name: "special characters in a local path", src: remote("/srv/app/"), dst: EndpointDetails{DataPath: filepath.Join(local, "a b*")}},
+		{name: "requested", src: remote("/srv/app/"), dst: EndpointDetails{DataPath: local}, opts: RsyncOption{ProtectArgs: true},
+			wantS: true, wantReason: "ProtectArgs is set"},
+		// A files-from list is read by rsync itself, never by a shell, so its entries need no protection
+		{name: "files-from entries", src: remote("/srv/app/"), dst: EndpointDetails{DataPath: local},
+			opts: RsyncOption{FilesFromList: []string{"a b.txt", "c*.log", "[d].bin"}}},
+		{name: "files-from with a protected source", src: remote("/srv/app data/"), dst: EndpointDetails{DataPath: local},
+			opts: RsyncOption{FilesFromList: []string{"a b.txt"}}, wantS: true, wantReason: "remote source path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filesFrom []string
+			runner := &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+				for _, arg := range args {
+					if p, ok := strings.CutPrefix(arg, "--files-from="); ok {
+						data, err := os.ReadFile(p)
+						if err != nil {
+							t.Fatal(err)
+						}
+						filesFrom = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+					}
+				}
+				return []byte("sent 1 bytes\n"), nil
+			}}
+			opts := tt.opts
+			opts.Archive = true
+			opts.CommandRunner = runner
+			task := DataMigrationModel{Source: tt.src, Destination: tt.dst, RsyncOptions: opts}
+
+			protect, reason := task.protectArgs()
+			if protect != tt.wantS || !strings.Contains(reason, tt.wantReason) {
+				t.Errorf("protectArgs() = %v, %q, want %v with a reason containing %q", protect, reason, tt.wantS, tt.wantReason)
+			}
+
+			if err := Transfer(task); err != nil {
+				t.Fatalf("Transfer() error = %v", err)
+			}
+			calls := runner.rsyncCalls()
+			if len(calls) != 1 {
+				t.Fatalf("rsync ran %d times, want once", len(calls))
+			}
+			args := calls[0]
+			if got := slices.Contains(args, "-s"); got != tt.wantS {
+				t.Errorf("rsync arguments %q include -s: %v, want %v", args, got, tt.wantS)
+			}
+			if tt.wantPaths != nil && !slices.Equal(args[len(args)-2:], tt.wantPaths) {
+				t.Errorf("rsync paths = %q, want %q", args[len(args)-2:], tt.wantPaths)
+			}
+			if tt.opts.FilesFromList != nil && !slices.Equal(filesFrom, tt.opts.FilesFromList) {
+				t.Errorf("files-from file holds %q, want the entries verbatim %q", filesFrom, tt.opts.FilesFromList)
+			}
+		})
+	}
+}
+
+// The arguments report the reason -s was added when it was not requested.
+func TestProtectArgsEffectiveArgs(t *testing.T) {
+	task := DataMigrationModel{
+		Source:       EndpointDetails{Username: "user", HostIP: "host", DataPath: "/srv/app data/"},
+		Destination:  EndpointDetails{DataPath: t.TempDir()},
+		RsyncOptions: RsyncOption{Archive: true},
+	}
+	for _, arg := range effectiveRsyncArgs(task) {
+		if arg.Arg == "-s" {
+			if !arg.Auto {
+				t.Error("-s is not marked as added by a rule")
+			}
+			if !strings.Contains(arg.Origin, "'/srv/app data/' contains whitespace or glob characters") {
+				t.Errorf("-s origin = %q, want the detected path", arg.Origin)
+			}
+			return
+		}
+	}
+	t.Error("effective arguments lack -s")
+}
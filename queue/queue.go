@@ -0,0 +1,249 @@
+// Package queue implements an on-disk queue of pending transx migrations processed by a worker loop.
+//
+// A queue directory contains one subdirectory per job state:
+//
+//	pending/     jobs waiting to be processed (<id>.json)
+//	processing/  jobs claimed by a worker
+//	done/        jobs that completed successfully, with their report (<id>.report.json)
+//	failed/      jobs that failed, with their report
+//
+// Jobs are claimed atomically by renaming them from pending/ into processing/, so several
+// workers may share one queue directory. A worker refreshes the modification time of the jobs
+// it processes; jobs left in processing/ for longer than the lease duration (e.g., after a crash)
+// are moved back to pending/.
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yunkon-kim/transx"
+)
+
+const (
+	pendingDir    = "pending"
+	processingDir = "processing"
+	doneDir       = "done"
+	failedDir     = "failed"
+
+	jobSuffix    = ".json"
+	reportSuffix = ".report.json"
+
+	defaultPollInterval  = 5 * time.Second
+	defaultLeaseDuration = 10 * time.Minute
+)
+
+// WorkerOption defines options for RunWorker.
+type WorkerOption struct {
+	PollInterval  time.Duration // Interval between scans of the pending directory (0 uses default 5s)
+	LeaseDuration time.Duration // Age after which a job in processing/ is considered abandoned (0 uses default 10m)
+}
+
+// Enqueue writes the migration as a pending job into the queue directory and returns its job ID.
+// The job file is written under a temporary name and renamed, so workers never see partial jobs.
+func Enqueue(dir string, dmm transx.DataMigrationModel) (string, error) {
+	if err := ensureLayout(dir); err != nil {
+		return "", err
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(dmm, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode job %s: %w", id, err)
+	}
+
+	tmpPath := filepath.Join(dir, pendingDir, "."+id+jobSuffix+".tmp")
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write job %s: %w", id, err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(dir, pendingDir, id+jobSuffix)); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to enqueue job %s: %w", id, err)
+	}
+	return id, nil
+}
+
+// RunWorker processes the queue directory one job at a time until ctx is canceled.
+// Each job is executed with transx.MigrateDataWithReport, its report is written next to the job,
+// and the job is moved to done/ or failed/. RunWorker returns ctx.Err() when canceled,
+// or an error if the queue directory itself cannot be used.
+func RunWorker(ctx context.Context, dir string, opts WorkerOption) error {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	if opts.LeaseDuration <= 0 {
+		opts.LeaseDuration = defaultLeaseDuration
+	}
+	if err := ensureLayout(dir); err != nil {
+		return err
+	}
+
+	for {
+		if err := requeueExpired(dir, opts.LeaseDuration); err != nil {
+			return err
+		}
+
+		id, err := claimNext(dir)
+		if err != nil {
+			return err
+		}
+		if id != "" {
+			processJob(ctx, dir, id, opts.LeaseDuration)
+			continue // Look for the next job immediately
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(opts.PollInterval):
+		}
+	}
+}
+
+// ensureLayout creates the state subdirectories of the queue directory.
+func ensureLayout(dir string) error {
+	for _, sub := range []string{pendingDir, processingDir, doneDir, failedDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return fmt.Errorf("failed to create queue directory %s: %w", filepath.Join(dir, sub), err)
+		}
+	}
+	return nil
+}
+
+// newJobID returns a unique, time-ordered job ID.
+func newJobID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return fmt.Sprintf("%d-%s", time.Now().UnixNano(), hex.EncodeToString(b)), nil
+}
+
+// jobIDs returns the IDs of the jobs in the given state subdirectory, oldest first.
+func jobIDs(dir, state string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, state))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queue directory %s: %w", filepath.Join(dir, state), err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, jobSuffix) || strings.HasSuffix(name, reportSuffix) {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, jobSuffix))
+	}
+	sort.Strings(ids) // IDs start with a timestamp
+	return ids, nil
+}
+
+// claimNext atomically moves the oldest pending job into processing/ and returns its ID,
+// or "" if there is no pending job. Jobs claimed concurrently by another worker are skipped.
+func claimNext(dir string) (string, error) {
+	ids, err := jobIDs(dir, pendingDir)
+	if err != nil {
+		return "", err
+	}
+	for _, id := range ids {
+		processingPath := filepath.Join(dir, processingDir, id+jobSuffix)
+		err := os.Rename(filepath.Join(dir, pendingDir, id+jobSuffix), processingPath)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // Claimed by another worker
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to claim job %s: %w", id, err)
+		}
+		now := time.Now()
+		os.Chtimes(processingPath, now, now) // Start the lease
+		return id, nil
+	}
+	return "", nil
+}
+
+// requeueExpired moves jobs whose lease in processing/ has expired back to pending/.
+func requeueExpired(dir string, lease time.Duration) error {
+	ids, err := jobIDs(dir, processingDir)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		processingPath := filepath.Join(dir, processingDir, id+jobSuffix)
+		info, err := os.Stat(processingPath)
+		if err != nil || time.Since(info.ModTime()) < lease {
+			continue
+		}
+		fmt.Printf("Queue: re-queuing abandoned job %s\n", id)
+		err = os.Rename(processingPath, filepath.Join(dir, pendingDir, id+jobSuffix))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to re-queue job %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// processJob executes a claimed job, writes its report, and moves it to done/ or failed/.
+// The job's lease is refreshed while it runs.
+func processJob(ctx context.Context, dir, id string, lease time.Duration) {
+	processingPath := filepath.Join(dir, processingDir, id+jobSuffix)
+
+	stopLease := make(chan struct{})
+	defer close(stopLease)
+	go func() {
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopLease:
+				return
+			case t := <-ticker.C:
+				os.Chtimes(processingPath, t, t)
+			}
+		}
+	}()
+
+	report, err := runJob(processingPath)
+	state := doneDir
+	if err != nil {
+		state = failedDir
+		fmt.Printf("Queue: job %s failed: %v\n", id, err)
+	} else {
+		fmt.Printf("Queue: job %s completed\n", id)
+	}
+
+	if report == nil {
+		report = &transx.MigrationReport{Error: err.Error()}
+	}
+	if data, merr := json.MarshalIndent(report, "", "  "); merr == nil {
+		if werr := os.WriteFile(filepath.Join(dir, state, id+reportSuffix), data, 0600); werr != nil {
+			fmt.Printf("Queue: failed to write report of job %s: %v\n", id, werr)
+		}
+	}
+	if rerr := os.Rename(processingPath, filepath.Join(dir, state, id+jobSuffix)); rerr != nil {
+		fmt.Printf("Queue: failed to move job %s to %s: %v\n", id, state, rerr)
+	}
+}
+
+// runJob decodes the job file and executes the migration.
+func runJob(path string) (*transx.MigrationReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job: %w", err)
+	}
+	var dmm transx.DataMigrationModel
+	if err := json.Unmarshal(data, &dmm); err != nil {
+		return nil, fmt.Errorf("failed to decode job: %w", err)
+	}
+	return transx.MigrateDataWithReport(dmm)
+}
@@ -0,0 +1,131 @@
+package transx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitOption limits how often commands are launched against remote hosts (rsync processes,
+// ssh commands such as preflight probes, and backup/restore commands), so that retries and checks
+// do not trip intrusion prevention such as fail2ban on a struggling host. Limits are token buckets
+// shared by all tasks of the process with the same settings. Zero values mean unlimited.
+type RateLimitOption struct {
+	CommandsPerMinute        float64            // Limit across all remote hosts
+	PerHostCommandsPerMinute float64            // Limit applied to each HostIP separately
+	HostCommandsPerMinute    map[string]float64 // Limits for specific HostIPs, overriding PerHostCommandsPerMinute
+	Burst                    int                // Commands that may be launched back to back before the limit applies (0 uses 1)
+}
+
+// validate checks that the limits are not negative.
+func (o RateLimitOption) validate() error {
+	if o.CommandsPerMinute < 0 || o.PerHostCommandsPerMinute < 0 {
+		return fmt.Errorf("commands per minute must not be negative")
+	}
+	for host, rate := range o.HostCommandsPerMinute {
+		if strings.TrimSpace(host) == "" {
+			return fmt.Errorf("HostCommandsPerMinute must not contain an empty host")
+		}
+		if rate < 0 {
+			return fmt.Errorf("commands per minute for host '%s' must not be negative", host)
+		}
+	}
+	if o.Burst < 0 {
+		return fmt.Errorf("Burst must not be negative")
+	}
+	return nil
+}
+
+// hostRate returns the limit of the host in commands per minute (0 if unlimited).
+func (o RateLimitOption) hostRate(host string) float64 {
+	if rate, ok := o.HostCommandsPerMinute[host]; ok {
+		return rate
+	}
+	return o.PerHostCommandsPerMinute
+}
+
+// tokenBucket is a token bucket refilled at rate tokens per second up to burst tokens.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token and returns how long the caller must wait before the token is available.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+var (
+	rateLimitMu      sync.Mutex
+	rateLimitBuckets = map[string]*tokenBucket{}
+)
+
+// rateLimitBucket returns the process-wide bucket of the scope ("" for the global limit, or a host)
+// with the given limit, creating it full on first use.
+func rateLimitBucket(scope string, perMinute float64, burst int) *tokenBucket {
+	burst = max(burst, 1)
+	key := fmt.Sprintf("%s|%g|%d", scope, perMinute, burst)
+
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	bucket, ok := rateLimitBuckets[key]
+	if !ok {
+		bucket = &tokenBucket{rate: perMinute / 60, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+		rateLimitBuckets[key] = bucket
+	}
+	return bucket
+}
+
+// throttle waits until a command contacting the endpoints may be launched under RsyncOption.RateLimit.
+// Local endpoints are not limited; container endpoints count against their host. A wait is printed and
+// reported to the workflow. It returns the context's error if ctx is canceled while waiting.
+func throttle(ctx context.Context, opts RsyncOption, endpoints ...EndpointDetails) error {
+	limit := opts.RateLimit
+	now := time.Now()
+
+	hosts := remoteHosts(endpoints...)
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	var wait time.Duration
+	if limit.CommandsPerMinute > 0 {
+		wait = rateLimitBucket("", limit.CommandsPerMinute, limit.Burst).reserve(now)
+	}
+	for _, host := range hosts {
+		if rate := limit.hostRate(host); rate > 0 {
+			wait = max(wait, rateLimitBucket(host, rate, limit.Burst).reserve(now))
+		}
+	}
+	if wait <= 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("Rate limit: waiting %s before the next command on %s", wait.Round(time.Millisecond), strings.Join(hosts, ", "))
+	fmt.Println(message)
+	if opts.onRateLimitWait != nil {
+		opts.onRateLimitWait(message)
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
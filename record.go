@@ -0,0 +1,177 @@
+package transx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecordBundle is a troubleshooting record of a MigrateData run (see WorkflowOption.RecordFile).
+// It is redacted like OperationError.Redacted, consistently across all fields, so the command lines
+// rebuilt from Model by Replay match the recorded Commands.
+type RecordBundle struct {
+	Model        DataMigrationModel // The task as executed (after defaults and state were applied)
+	GOOS         string
+	GOARCH       string
+	RsyncVersion string            // Version of the local rsync ("" if it could not be detected)
+	LookPaths    map[string]string // Resolved executables (rsync, ssh, sudo, command wrapper); "" if not found
+	Progress     bool              // Whether --info=progress2 was requested
+	StagingPath  string            // Relay staging directory used by the transfer
+	Commands     [][]string        // rsync command lines built for the transfer, in build order
+}
+
+// commandRecorder collects the rsync command lines of a transfer. It is nil-safe.
+type commandRecorder struct {
+	mu          sync.Mutex
+	commands    [][]string
+	progressOn  bool
+	stagingPath string
+}
+
+// command records an rsync command line.
+func (r *commandRecorder) command(name string, args []string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, append([]string{name}, args...))
+}
+
+// progress records whether progress reporting was requested.
+func (r *commandRecorder) progress(on bool) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progressOn = on
+}
+
+// staging records the relay staging directory.
+func (r *commandRecorder) staging(dir string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stagingPath = dir
+}
+
+// write writes the redacted bundle of the recorded run of task to path.
+func (r *commandRecorder) write(path string, task DataMigrationModel) error {
+	r.mu.Lock()
+	bundle := RecordBundle{
+		Model:       task,
+		GOOS:        runtime.GOOS,
+		GOARCH:      runtime.GOARCH,
+		LookPaths:   map[string]string{},
+		Progress:    r.progressOn,
+		StagingPath: r.stagingPath,
+		Commands:    r.commands,
+	}
+	r.mu.Unlock()
+
+	rsyncCmdPath, _ := buildRsyncArgs(task)
+	if v, err := detectRsyncVersion(task.RsyncOptions, rsyncCmdPath); err == nil {
+		bundle.RsyncVersion = v.String()
+	}
+	executables := []string{rsyncCmdPath, "ssh", "sudo"}
+	if len(task.RsyncOptions.CommandWrapper) > 0 {
+		executables = append(executables, task.RsyncOptions.CommandWrapper[0])
+	}
+	if shell := strings.Fields(task.RsyncOptions.RemoteShellCommand); len(shell) > 0 {
+		executables = append(executables, shell[0])
+	}
+	for _, name := range executables {
+		resolved, _ := exec.LookPath(name)
+		bundle.LookPaths[name] = resolved
+	}
+
+	bundle.redact()
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false) // Keep the "<redacted-N>" placeholders readable
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(bundle); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0600)
+}
+
+// redact replaces hosts, usernames, and data paths in all string fields of the bundle,
+// using one redactor so that a value gets the same placeholder wherever it appears.
+func (b *RecordBundle) redact() {
+	r := newRedactor(b.Model.endpoints())
+	redactStrings(reflect.ValueOf(&b.Model).Elem(), r)
+	b.StagingPath = r.redact(b.StagingPath)
+
+	lookPaths := make(map[string]string, len(b.LookPaths))
+	for name, resolved := range b.LookPaths {
+		lookPaths[r.redact(name)] = r.redact(resolved)
+	}
+	b.LookPaths = lookPaths
+	for _, command := range b.Commands {
+		for i := range command {
+			command[i] = r.redact(command[i])
+		}
+	}
+}
+
+// redactStrings redacts the exported string and string slice fields of a struct value, recursively.
+func redactStrings(v reflect.Value, r *redactor) {
+	for i := 0; i < v.NumField(); i++ {
+		if !v.Type().Field(i).IsExported() {
+			continue
+		}
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct && field.Type() != reflect.TypeOf(time.Time{}):
+			redactStrings(field, r)
+		case field.Kind() == reflect.String:
+			field.SetString(r.redact(field.String()))
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+			redacted := reflect.MakeSlice(field.Type(), field.Len(), field.Len())
+			for j := 0; j < field.Len(); j++ {
+				redacted.Index(j).SetString(r.redact(field.Index(j).String()))
+			}
+			field.Set(redacted)
+		}
+	}
+}
+
+// LoadRecordBundle reads a bundle written by a run with WorkflowOption.RecordFile.
+func LoadRecordBundle(path string) (*RecordBundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read record bundle: %w", err)
+	}
+	bundle := &RecordBundle{}
+	if err := json.Unmarshal(data, bundle); err != nil {
+		return nil, fmt.Errorf("failed to parse record bundle '%s': %w", path, err)
+	}
+	return bundle, nil
+}
+
+// Replay rebuilds the rsync command lines of the recorded transfer from the bundle's model,
+// without executing anything, so that a reported command line can be reproduced and compared
+// with bundle.Commands (e.g., in a regression test). Transfers whose command lines depend on the
+// state of the endpoints (mtime splits and container endpoints) cannot be replayed.
+func Replay(bundle RecordBundle) ([][]string, error) {
+	commands, err := rsyncCommands(bundle.Model, bundle.StagingPath, bundle.Progress)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([][]string, 0, len(commands))
+	for _, command := range commands {
+		lines = append(lines, append([]string{command.Path}, command.Args...))
+	}
+	return lines, nil
+}
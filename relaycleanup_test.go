@@ -0,0 +1,121 @@
+package transx
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// relayCleanupRunner fakes the rsync commands of removeRelaySourceFiles: the checksum dry-run from the
+// source to staging returns listing, the removal returns removal, and the upload leg fails if
+// failUpload is set. It records the --files-from list passed to the removal.
+type relayCleanupRunner struct {
+	fakeRunner
+	listing    string
+	removal    string
+	failUpload bool
+	removed    string
+}
+
+func newRelayCleanupRunner(t *testing.T, listing, removal string, failUpload bool) *relayCleanupRunner {
+	r := &relayCleanupRunner{listing: listing, removal: removal, failUpload: failUpload}
+	r.respond = func(ctx context.Context, args []string) ([]byte, error) {
+		switch {
+		case slices.Contains(args, "--info=name2"):
+			return []byte(r.listing), nil
+		case slices.Contains(args, "--remove-source-files"):
+			for _, arg := range args {
+				if path, ok := strings.CutPrefix(arg, "--files-from="); ok {
+					list, err := os.ReadFile(path)
+					if err != nil {
+						t.Errorf("reading the --files-from file: %v", err)
+					}
+					r.removed = string(list)
+				}
+			}
+			return []byte(r.removal), nil
+		case slices.Contains(args, "-n"):
+			return []byte("Number of regular files transferred: 0\n"), nil
+		case r.failUpload:
+			return []byte("rsync: connection unexpectedly closed\n"), exitError(12)
+		}
+		return []byte("Number of regular files transferred: 1\n"), nil
+	}
+	return r
+}
+
+func relayCleanupTask(runner CommandRunner) DataMigrationModel {
+	return DataMigrationModel{
+		Source:       EndpointDetails{Username: "user", HostIP: "10.0.0.1", DataPath: "/data"},
+		Destination:  EndpointDetails{Username: "user", HostIP: "10.0.0.2", DataPath: "/backup/"},
+		RsyncOptions: RsyncOption{RemoveSourceFiles: true, CommandRunner: runner},
+	}
+}
+
+// A source file modified between the download leg and the cleanup differs from its staged copy,
+// which is what reached the destination, so it is not removed from the source.
+func TestRelayCleanupKeepsFilesChangedAfterDownload(t *testing.T) {
+	listing := "transx-entry:cd+++++++++:4,096:data/\n" +
+		"transx-entry:.f         :5:data/a\n" +
+		"transx-entry:>fc.t......:7:data/b\n" +
+		"transx-entry:.f         :3:data/sub/c\n" +
+		"transx-entry:>f+++++++++:1:data/new\n"
+	removal := "Number of files: 3 (reg: 2, dir: 1)\nNumber of regular files transferred: 0\n"
+	runner := newRelayCleanupRunner(t, listing, removal, false)
+	uploadArgs := []string{"-a", "--stats", "--", "/tmp/stage/", "user@10.0.0.2:/backup/"}
+
+	removed, stagedOnly, err := removeRelaySourceFiles(context.Background(), relayCleanupTask(runner),
+		"rsync", []string{"-a", "--stats"}, uploadArgs, "/tmp/stage", "user@10.0.0.2:/backup/")
+	if err != nil || stagedOnly {
+		t.Fatalf("removeRelaySourceFiles() = %d, %v, %v", removed, stagedOnly, err)
+	}
+	if removed != 2 {
+		t.Errorf("removed = %d, want 2", removed)
+	}
+	if want := "data/a\ndata/sub/c\n"; runner.removed != want {
+		t.Errorf("files removed from the source = %q, want %q", runner.removed, want)
+	}
+	for _, call := range runner.rsyncCalls() {
+		if slices.Contains(call, "--remove-source-files") {
+			if !slices.Contains(call, "-c") || !strings.HasSuffix(strings.Join(call, " "), "-- user@10.0.0.1:/ /tmp/stage/") {
+				t.Errorf("removal = %q, want a checksum transfer from the parent of DataPath", call)
+			}
+		}
+		if !slices.Contains(call, "-n") && !slices.Contains(call, "--remove-source-files") {
+			t.Errorf("unexpected upload %q: no file changed during the cleanup", call)
+		}
+	}
+}
+
+// A listed file modified during the removal is sent into staging and removed from the source, so it
+// is uploaded again; if that fails, staging holds its only copy and must be kept.
+func TestRelayCleanupReuploadsFilesChangedDuringRemoval(t *testing.T) {
+	listing := "transx-entry:.f         :5:data/a\n"
+	removal := "Number of files: 1 (reg: 1)\nNumber of regular files transferred: 1\n"
+	uploadArgs := []string{"-a", "--stats", "--", "/tmp/stage/", "user@10.0.0.2:/backup/"}
+
+	runner := newRelayCleanupRunner(t, listing, removal, false)
+	_, stagedOnly, err := removeRelaySourceFiles(context.Background(), relayCleanupTask(runner),
+		"rsync", []string{"-a", "--stats"}, uploadArgs, "/tmp/stage", "user@10.0.0.2:/backup/")
+	if err != nil || stagedOnly {
+		t.Fatalf("removeRelaySourceFiles() = %v, %v, want the changed file uploaded again", stagedOnly, err)
+	}
+	uploads := 0
+	for _, call := range runner.rsyncCalls() {
+		if slices.Equal(call[1:], uploadArgs) {
+			uploads++
+		}
+	}
+	if uploads != 1 {
+		t.Errorf("upload leg ran %d time(s), want 1", uploads)
+	}
+
+	runner = newRelayCleanupRunner(t, listing, removal, true)
+	_, stagedOnly, err = removeRelaySourceFiles(context.Background(), relayCleanupTask(runner),
+		"rsync", []string{"-a", "--stats"}, uploadArgs, "/tmp/stage", "user@10.0.0.2:/backup/")
+	if err == nil || !stagedOnly {
+		t.Errorf("removeRelaySourceFiles() = %v, %v, want an error keeping staging", stagedOnly, err)
+	}
+}
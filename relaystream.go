@@ -0,0 +1,76 @@
+package transx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// tarExcludes returns the exclude patterns passed to tar: Exclude followed by the junk patterns.
+func (o RsyncOption) tarExcludes() []string {
+	return append(append([]string{}, o.Exclude...), o.junkExcludes()...)
+}
+
+// validateRelayStreaming checks that RelayStreaming applies to the task: it needs both endpoints
+// remote, and tar must honor the options (except DryRun, which relays through staging as usual).
+// Besides the options the tar backend cannot honor, the stream refuses those that only act on rsync
+// processes, which would otherwise silently do nothing.
+func (task *DataMigrationModel) validateRelayStreaming() error {
+	if !task.RsyncOptions.RelayStreaming {
+		return nil
+	}
+	if task.Topology() != RemoteToRemoteRelay {
+		return fmt.Errorf("RelayStreaming requires relay mode (both endpoints remote)")
+	}
+	var unsupported []string
+	for _, option := range task.tarUnsupportedOptions() {
+		if option != "DryRun" {
+			unsupported = append(unsupported, option)
+		}
+	}
+	opts := task.RsyncOptions
+	add := func(set bool, name string) {
+		if set {
+			unsupported = append(unsupported, name)
+		}
+	}
+	add(strings.TrimSpace(opts.TempDir) != "", "TempDir (tar writes files in place)")
+	add(opts.StallTimeout > 0, "StallTimeout (tar produces no output to watch)")
+	add(opts.Retry.MaxAttempts > 1, "Retry (a failed stream is neither retried nor resumed)")
+	add(task.WorkflowOptions.SampledVerify.enabled() || task.WorkflowOptions.DirectoryStats.enabled(),
+		"SampledVerify/DirectoryStats (tar logs no transferred files)")
+	add(opts.OnFile != nil, "OnFile (tar reports no file events)")
+	if len(unsupported) > 0 {
+		return fmt.Errorf("RelayStreaming cannot honor %s; remove them or disable RelayStreaming", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// streamRelay transfers a relay task as a tar stream piped from the source through this machine
+// into tar on the destination (see RsyncOption.RelayStreaming). It reports false, without an
+// error, if the task is relayed through a staging directory instead: on a dry run, or if tar is
+// not available on an endpoint.
+func streamRelay(ctx context.Context, task DataMigrationModel) (*TransferResult, bool, error) {
+	if task.RsyncOptions.DryRun {
+		fmt.Println("Relay streaming: a dry run is relayed through a staging directory, which receives nothing")
+		return nil, false, nil
+	}
+	for _, side := range []struct {
+		name     string
+		endpoint EndpointDetails
+	}{{"source", task.Source}, {"destination", task.Destination}} {
+		if output, err := executeCommandContext(ctx, "command -v tar", side.endpoint, task.RsyncOptions); err != nil {
+			if ctx.Err() != nil {
+				return nil, true, ctx.Err()
+			}
+			if strings.TrimSpace(string(output)) == "" && exitCode(err) == 1 {
+				fmt.Printf("Relay streaming: tar is not available on the %s; relaying through a staging directory\n", side.name)
+				return nil, false, nil
+			}
+			return nil, true, fmt.Errorf("failed to look for tar on the %s: %w\nOutput:\n%s", side.name, err, string(output))
+		}
+	}
+	fmt.Println("Relay streaming: piping a tar stream from the source to the destination (nothing is staged locally)")
+	result, err := transferWithTar(ctx, task)
+	return result, true, err
+}
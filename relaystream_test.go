@@ -0,0 +1,84 @@
+package transx
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// relayStreamingTask returns a relay task with RelayStreaming that Validate accepts.
+func relayStreamingTask() DataMigrationModel {
+	return DataMigrationModel{
+		Source:       EndpointDetails{Username: "user", HostIP: "source", DataPath: "/data/"},
+		Destination:  EndpointDetails{Username: "user", HostIP: "destination", DataPath: "/data/"},
+		RsyncOptions: RsyncOption{Archive: true, RelayStreaming: true},
+	}
+}
+
+func TestValidateRelayStreaming(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(task *DataMigrationModel)
+		wantErr string
+	}{
+		{name: "plain", modify: func(task *DataMigrationModel) {}},
+		{name: "dry run", modify: func(task *DataMigrationModel) { task.RsyncOptions.DryRun = true }},
+		{name: "simple excludes", modify: func(task *DataMigrationModel) {
+			task.RsyncOptions.Exclude = []string{"*.log"}
+			task.RsyncOptions.ExcludeCommonJunk = true
+		}},
+		{name: "not relay", modify: func(task *DataMigrationModel) { task.Source = EndpointDetails{DataPath: "/local/"} }, wantErr: "requires relay mode"},
+		{name: "Delete", modify: func(task *DataMigrationModel) { task.RsyncOptions.Delete = true }, wantErr: "Delete"},
+		{name: "Include", modify: func(task *DataMigrationModel) { task.RsyncOptions.Include = []string{"*.sql"} }, wantErr: "Include"},
+		{name: "anchored exclude", modify: func(task *DataMigrationModel) { task.RsyncOptions.Exclude = []string{"/cache"} }, wantErr: "containing '/'"},
+		{name: "TempDir", modify: func(task *DataMigrationModel) { task.RsyncOptions.TempDir = "/scratch" }, wantErr: "TempDir"},
+		{name: "StallTimeout", modify: func(task *DataMigrationModel) { task.RsyncOptions.StallTimeout = time.Minute }, wantErr: "StallTimeout"},
+		{name: "Retry", modify: func(task *DataMigrationModel) { task.RsyncOptions.Retry.MaxAttempts = 3 }, wantErr: "Retry"},
+		{name: "single attempt", modify: func(task *DataMigrationModel) { task.RsyncOptions.Retry.MaxAttempts = 1 }},
+		{name: "SampledVerify", modify: func(task *DataMigrationModel) { task.WorkflowOptions.SampledVerify.Count = 10 }, wantErr: "SampledVerify"},
+		{name: "DirectoryStats", modify: func(task *DataMigrationModel) { task.WorkflowOptions.DirectoryStats.Depth = 1 }, wantErr: "DirectoryStats"},
+		{name: "OnFile", modify: func(task *DataMigrationModel) { task.RsyncOptions.OnFile = func(FileEvent) {} }, wantErr: "OnFile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := relayStreamingTask()
+			tt.modify(&task)
+			err := Validate(task)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Without tar on an endpoint, or on a dry run, the relay goes through the staging directory.
+func TestStreamRelayFallsBackToStaging(t *testing.T) {
+	tests := []struct {
+		name    string
+		dryRun  bool
+		noTarOn string // Host without tar
+	}{
+		{name: "dry run", dryRun: true},
+		{name: "no tar on the source", noTarOn: "source"},
+		{name: "no tar on the destination", noTarOn: "destination"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+				if strings.Contains(strings.Join(args, " "), tt.noTarOn) && args[len(args)-1] == "command -v tar" {
+					return nil, exitError(1)
+				}
+				return []byte("/usr/bin/tar\n"), nil
+			}}
+			task := relayStreamingTask()
+			task.RsyncOptions.DryRun = tt.dryRun
+			task.RsyncOptions.CommandRunner = runner
+
+			result, streamed, err := streamRelay(context.Background(), task)
+			if streamed || err != nil || result != nil {
+				t.Errorf("streamRelay() = %v, %v, %v; want a fall back to staging", result, streamed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package transx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Stage identifies a step of the migration workflow.
+type Stage string
+
+const (
+	StagePreflight        Stage = "preflight"
+	StageBackup           Stage = "backup"
+	StageTransfer         Stage = "transfer"
+	StageRestore          Stage = "restore"
+	StageVerify           Stage = "verify"
+	StagePathAudit        Stage = "path-audit"
+	StageRestorePreview   Stage = "restore-preview"
+	StageSourceStop       Stage = "source-stop"
+	StageDestinationStart Stage = "destination-start"
+	StageSourceRestart    Stage = "source-restart"
+	StageLinkProbe        Stage = "link-probe"
+	StagePrepare          Stage = "pre-transfer"
+	StageSampledVerify    Stage = "sampled-verify"
+	StageHealthBefore     Stage = "health-before"
+	StageHealthAfter      Stage = "health-after"
+	StageFetch            Stage = "fetch"
+
+	// The stages of the rsync processes of the relay legs, in OperationError.Stage (the report records
+	// a relay transfer as StageTransfer).
+	StageRelayDownload Stage = "relay-download"
+	StageRelayUpload   Stage = "relay-upload"
+)
+
+// stageOutputMaxBytes is the maximum number of output bytes kept per stage with
+// WorkflowOption.OutputTailLines (the tail is kept).
+const stageOutputMaxBytes = 64 << 10
+
+// StageReport records the outcome of a single workflow stage.
+type StageReport struct {
+	Stage    Stage
+	Duration time.Duration
+	Success  bool
+	Error    string        // Error message if the stage failed
+	Output   string        // Tail of the command output for command stages (backup, pre-transfer, restore), with secrets redacted
+	Usage    *ProcessUsage // Resource usage of the external processes of the stage (nil if none ran)
+}
+
+// MigrationReport is the structured result of a MigrateData run.
+type MigrationReport struct {
+	Source             string // Display form of the source endpoint (e.g., "user@host:/path")
+	Destination        string // Display form of the destination endpoint
+	Topology           Topology
+	Simulation         bool     // Whether the transfer was an rsync dry run (RsyncOptions.DryRun), so nothing was migrated
+	JunkExcludes       []string // Patterns excluded by RsyncOptions.ExcludeCommonJunk
+	ResolvedSourcePath string   // Real path of the source DataPath with RsyncOptions.ResolveSourceSymlink (empty if it is not a symlink)
+	StartTime          time.Time
+	EndTime            time.Time
+	Stages             []StageReport          // Stages in execution order; skipped stages are omitted
+	Confirmations      []ConfirmationDecision // Answers of the Confirmer to dangerous operations, for audit
+	Preflight          *PreflightReport       // Preflight findings, if preflight checks ran
+	Fetch              *FetchResult           // Download of the URL source, if Source.URL is set
+	Transfer           *TransferResult        // Transfer statistics, if the transfer stage completed
+	TransferAttempts   []TransferAttempt      // Backend attempts of the transfer stage (more than one after a fallback)
+	AutoTune           *AutoTuneResult        // Link profile and option decisions, if WorkflowOptions.AutoTune ran
+	EffectiveOptions   []RsyncArg             // rsync option arguments of the transfer with their origins, if the transfer ran
+	RestorePreview     []RestoreInput         // Predicted restore inputs, if WorkflowOptions.RestorePreview ran
+	SampledVerify      *SampledVerifyResult   // Sampled verification outcome, if it ran
+	HealthChecks       []HealthCheckResult    // Outcomes of the endpoints' HealthCmd before and after the workflow
+	VerifyAlgorithm    ChecksumAlgorithm      // Checksum algorithm of the verify stage, if it ran ("" for rsync's own checksums)
+	Cleanups           []CleanupResult        // Temporary resources created during the run and whether they were removed
+	SSHThrottled       int64                  // Connections refused by sshd's MaxStartups throttling (see IsSSHThrottled)
+	Delta              *ReportDelta           // Comparison with the previous successful run, if WorkflowOptions.ReportHistoryDir has one
+	Warnings           []string               // Non-fatal findings collected during the run
+	Success            bool
+	Error              string // Error message if the migration failed
+
+	monitor         *statusMonitor // Receives stage and warning events while the migration runs (may be nil)
+	outputTailLines int            // WorkflowOption.OutputTailLines
+	usage           *stageUsage    // Process usage of the stages (see stageTask)
+}
+
+// newMigrationReport creates a report for the given task with the start time set to now.
+func newMigrationReport(dmm DataMigrationModel) *MigrationReport {
+	return &MigrationReport{
+		Source:       dmm.Source.displayPath(),
+		Destination:  dmm.Destination.displayPath(),
+		Topology:     dmm.Topology(),
+		Simulation:   dmm.RsyncOptions.DryRun,
+		JunkExcludes: dmm.RsyncOptions.junkExcludes(),
+		StartTime:    time.Now(),
+
+		outputTailLines: dmm.WorkflowOptions.OutputTailLines,
+		usage:           &stageUsage{},
+	}
+}
+
+// runStage executes fn as the given stage and records its duration and outcome.
+func (r *MigrationReport) runStage(stage Stage, fn func() error) error {
+	r.monitor.stageStarted(stage)
+	start := time.Now()
+	err := fn()
+	r.monitor.stageFinished(stage, err)
+	sr := StageReport{Stage: stage, Duration: time.Since(start), Success: err == nil, Usage: r.usage.accumulator(stage).snapshot()}
+	if err != nil {
+		sr.Error = err.Error()
+	}
+	r.Stages = append(r.Stages, sr)
+	return err
+}
+
+// runCommandStage executes fn as the given stage like runStage, additionally recording the tail of the command output.
+func (r *MigrationReport) runCommandStage(stage Stage, fn func() ([]byte, error)) error {
+	sr, err := r.timeCommandStage(stage, fn)
+	r.Stages = append(r.Stages, sr)
+	return err
+}
+
+// timeCommandStage executes fn and returns the stage report without recording it,
+// so that concurrently executed stages can be recorded after they are joined.
+func (r *MigrationReport) timeCommandStage(stage Stage, fn func() ([]byte, error)) (StageReport, error) {
+	r.monitor.stageStarted(stage)
+	start := time.Now()
+	output, err := fn()
+	r.monitor.stageFinished(stage, err)
+	sr := StageReport{Stage: stage, Duration: time.Since(start), Success: err == nil, Output: stageOutput(output, r.outputTailLines),
+		Usage: r.usage.accumulator(stage).snapshot()}
+	if err != nil {
+		sr.Error = err.Error()
+	}
+	return sr, err
+}
+
+// outputTail returns the last limit bytes of output as a string.
+func outputTail(output []byte, limit int) string {
+	if len(output) > limit {
+		output = output[len(output)-limit:]
+	}
+	return string(output)
+}
+
+// stageOutput returns the part of a command stage's output kept in its report: the last lines lines
+// (capped at stageOutputMaxBytes), or nothing if lines is not positive. Secrets are redacted.
+func stageOutput(output []byte, lines int) string {
+	if lines <= 0 {
+		return ""
+	}
+	trimmed := bytes.TrimRight(output, "\n")
+	start := len(trimmed)
+	for i := 0; i < lines && start > 0; i++ {
+		start = bytes.LastIndexByte(trimmed[:start], '\n')
+		if start < 0 {
+			start = 0
+			break
+		}
+	}
+	if start > 0 {
+		start++ // Skip the newline ending the last dropped line
+	}
+	return redactSecrets(outputTail(output[start:], stageOutputMaxBytes))
+}
+
+// addWarnings records non-fatal findings.
+func (r *MigrationReport) addWarnings(warnings ...string) {
+	r.Warnings = append(r.Warnings, warnings...)
+	for _, warning := range warnings {
+		r.monitor.warning(warning)
+	}
+}
+
+// addCleanups records the cleanup results and reports leaked resources as warnings.
+func (r *MigrationReport) addCleanups(results []CleanupResult) {
+	r.Cleanups = append(r.Cleanups, results...)
+	for _, result := range results {
+		if !result.Cleaned {
+			r.addWarnings(fmt.Sprintf("failed to clean up %s (leaked): %s", result.Resource, result.Error))
+		}
+	}
+}
+
+// finish records the end time and the final status of the migration.
+func (r *MigrationReport) finish(err error) {
+	r.EndTime = time.Now()
+	r.Success = err == nil
+	if err != nil {
+		r.Error = err.Error()
+	}
+	r.monitor.finished(err)
+}
+
+// PrintSummary writes a human-readable summary of the migration report to w.
+// The layout is stable: endpoints, per-stage durations, transfer statistics, warnings count, and final status.
+func PrintSummary(w io.Writer, report MigrationReport) {
+	fmt.Fprintln(w, "=== Migration Summary ===")
+	fmt.Fprintf(w, "Source:      %s\n", report.Source)
+	fmt.Fprintf(w, "Destination: %s\n", report.Destination)
+	fmt.Fprintf(w, "Topology:    %s\n", report.Topology)
+	if report.Simulation {
+		fmt.Fprintf(w, "Mode:        %s\n", dryRunBanner)
+	}
+	if report.Fetch != nil {
+		verified := "unverified"
+		if report.Fetch.Verified {
+			verified = "verified"
+		}
+		how := fmt.Sprintf("%d bytes in %s", report.Fetch.Bytes, report.Fetch.Duration.Round(time.Millisecond))
+		if report.Fetch.Reused {
+			how = "reused from an earlier run"
+		}
+		fmt.Fprintf(w, "Fetched:     %s (%s, %s)\n", report.Fetch.StagedPath, how, verified)
+	}
+	if report.ResolvedSourcePath != "" {
+		fmt.Fprintf(w, "Resolved:    source is %s\n", report.ResolvedSourcePath)
+	}
+	if len(report.JunkExcludes) > 0 {
+		fmt.Fprintf(w, "Junk:        excluded %s\n", strings.Join(report.JunkExcludes, ", "))
+	}
+
+	if len(report.Stages) > 0 {
+		fmt.Fprintln(w, "Stages:")
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, stage := range report.Stages {
+			status := "ok"
+			if !stage.Success {
+				status = "failed"
+			}
+			usage := ""
+			if stage.Usage != nil {
+				usage = stage.Usage.summary()
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", stage.Stage, stage.Duration.Round(time.Millisecond), status, usage)
+		}
+		tw.Flush()
+	}
+
+	if len(report.TransferAttempts) > 1 {
+		attempts := make([]string, 0, len(report.TransferAttempts))
+		for _, attempt := range report.TransferAttempts {
+			status := "ok"
+			if !attempt.Success {
+				status = "failed"
+			}
+			attempts = append(attempts, fmt.Sprintf("%s (%s)", attempt.Backend, status))
+		}
+		fmt.Fprintf(w, "Backends:    %s\n", strings.Join(attempts, ", "))
+	}
+	if report.AutoTune != nil && report.AutoTune.Profile != nil {
+		profile := report.AutoTune.Profile
+		fmt.Fprintf(w, "Link:        %.1f MiB/s, %.1f MiB/s compressed, RTT %s\n",
+			profile.Throughput/(1<<20), profile.CompressedThroughput/(1<<20), profile.RTT().Round(time.Millisecond))
+		for _, decision := range report.AutoTune.Decisions {
+			fmt.Fprintf(w, "  %s=%s (%s)\n", decision.Option, decision.Value, decision.Reason)
+		}
+	}
+	if len(report.EffectiveOptions) > 0 {
+		fmt.Fprintln(w, "Options:")
+		printEffectiveRsyncArgs(w, report.EffectiveOptions, "  ")
+	}
+	if report.Transfer != nil && report.Transfer.RelayStagingPath != "" {
+		fmt.Fprintf(w, "Staging:     %s\n", report.Transfer.RelayStagingPath)
+	}
+	if report.Transfer != nil {
+		fmt.Fprintf(w, "Files:       %d transferred of %d\n", report.Transfer.FilesTransferred, report.Transfer.TotalFileCount)
+		fmt.Fprintf(w, "Bytes:       %d transferred of %d\n", report.Transfer.BytesTransferred, report.Transfer.TotalFileSize)
+		if report.Transfer.Download != nil && report.Transfer.Upload != nil {
+			fmt.Fprintf(w, "Download:    %s\n", report.Transfer.Download.throughputSummary())
+			fmt.Fprintf(w, "Upload:      %s\n", report.Transfer.Upload.throughputSummary())
+		}
+		if report.Transfer.SourceFilesRemoved > 0 {
+			fmt.Fprintf(w, "Removed:     %d file(s) from source\n", report.Transfer.SourceFilesRemoved)
+		}
+		if report.Transfer.Directories != nil && len(report.Transfer.Directories.Directories) > 0 {
+			fmt.Fprintf(w, "Directories: top by bytes (depth %d)\n", report.Transfer.Directories.Depth)
+			printDirectoryStats(w, report.Transfer.Directories)
+		}
+	}
+
+	for _, input := range report.RestorePreview {
+		fmt.Fprintf(w, "Restore:     %s\n", input)
+	}
+	if report.SampledVerify != nil {
+		fmt.Fprintf(w, "Sampled:     %d of %d file(s) verified by %s, %d mismatch(es)\n",
+			report.SampledVerify.Sampled, report.SampledVerify.Transferred, report.SampledVerify.Algorithm, len(report.SampledVerify.Mismatches))
+	}
+	for _, check := range report.HealthChecks {
+		status := "healthy"
+		if !check.Healthy {
+			status = "unhealthy"
+		}
+		fmt.Fprintf(w, "Health:      %s %s: %s (%d attempt(s))\n", check.Endpoint, check.Phase, status, check.Attempts)
+	}
+	if report.Preflight != nil {
+		for _, check := range report.Preflight.HostIdentities {
+			status := "confirmed"
+			if !check.Match {
+				status = fmt.Sprintf("MISMATCH (expected '%s')", check.Expected)
+			}
+			fmt.Fprintf(w, "Identity:    %s %s '%s' %s\n", check.Endpoint, check.Method, check.Actual, status)
+		}
+	}
+	fmt.Fprintf(w, "Warnings:    %d\n", len(report.Warnings))
+	if report.Delta != nil {
+		fmt.Fprintf(w, "Previous:    run of %s, %d anomaly(ies)\n", report.Delta.PreviousStart.Format(time.RFC3339), len(report.Delta.Anomalies))
+		for _, anomaly := range report.Delta.Anomalies {
+			fmt.Fprintf(w, "  %s\n", anomaly)
+		}
+	}
+	if !report.EndTime.IsZero() {
+		fmt.Fprintf(w, "Total time:  %s\n", report.EndTime.Sub(report.StartTime).Round(time.Millisecond))
+	}
+	if report.Success && report.Simulation {
+		fmt.Fprintln(w, "Status:      SUCCESS (simulation; nothing was migrated)")
+	} else if report.Success {
+		fmt.Fprintln(w, "Status:      SUCCESS")
+	} else {
+		fmt.Fprintln(w, "Status:      FAILED")
+		fmt.Fprintf(w, "Error:       %s\n", report.Error)
+	}
+}
@@ -0,0 +1,57 @@
+package transx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStageOutput(t *testing.T) {
+	output := []byte("dumping\nmysql --password=hunter2\n42 rows affected\nCHANGE MASTER TO MASTER_LOG_POS=154;\n")
+	tests := []struct {
+		name  string
+		lines int
+		want  string
+	}{
+		{name: "zero keeps nothing", lines: 0, want: ""},
+		{name: "last line", lines: 1, want: "CHANGE MASTER TO MASTER_LOG_POS=154;\n"},
+		{name: "last two lines", lines: 2, want: "42 rows affected\nCHANGE MASTER TO MASTER_LOG_POS=154;\n"},
+		{name: "more lines than the output", lines: 10, want: "dumping\nmysql --password=<redacted>\n42 rows affected\nCHANGE MASTER TO MASTER_LOG_POS=154;\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stageOutput(output, tt.lines); got != tt.want {
+				t.Errorf("stageOutput(%d) = %q, want %q", tt.lines, got, tt.want)
+			}
+		})
+	}
+
+	long := []byte(strings.Repeat("x", 2*stageOutputMaxBytes) + "\n")
+	if got := stageOutput(long, 1); len(got) != stageOutputMaxBytes {
+		t.Errorf("stageOutput of a long line kept %d bytes, want %d", len(got), stageOutputMaxBytes)
+	}
+}
+
+func TestStageReportOutputRetention(t *testing.T) {
+	for _, tt := range []struct {
+		lines int
+		fail  bool
+		want  string
+	}{
+		{lines: 0, want: ""},
+		{lines: 0, fail: true, want: ""},
+		{lines: 1, want: "done\n"},
+		{lines: 1, fail: true, want: "done\n"},
+	} {
+		r := newMigrationReport(DataMigrationModel{WorkflowOptions: WorkflowOption{OutputTailLines: tt.lines}})
+		r.runCommandStage(StageRestore, func() ([]byte, error) {
+			if tt.fail {
+				return []byte("restoring\ndone\n"), errors.New("failed")
+			}
+			return []byte("restoring\ndone\n"), nil
+		})
+		if got := r.Stages[0].Output; got != tt.want {
+			t.Errorf("OutputTailLines %d (failed %v): Output = %q, want %q", tt.lines, tt.fail, got, tt.want)
+		}
+	}
+}
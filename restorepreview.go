@@ -0,0 +1,251 @@
+package transx
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// RestoreInputStatus is the state of a restore input after the transfer, as predicted by the restore preview.
+type RestoreInputStatus string
+
+const (
+	RestoreInputTransferred RestoreInputStatus = "transferred" // Sent by the transfer
+	RestoreInputExisting    RestoreInputStatus = "existing"    // Already on the destination and kept by the transfer
+	RestoreInputDeleted     RestoreInputStatus = "deleted"     // On the destination, but deleted by the transfer (RsyncOptions.Delete)
+	RestoreInputMissing     RestoreInputStatus = "missing"     // Neither sent by the transfer nor on the destination
+)
+
+// RestoreInput is a path referenced by Destination.RestoreCmd within the destination DataPath,
+// cross-referenced with the dry-run listing of the transfer and the destination
+// (see WorkflowOption.RestorePreview).
+type RestoreInput struct {
+	Path     string // Path as referenced by the command
+	Status   RestoreInputStatus
+	Size     int64  // Bytes sent by the transfer for the path (0 unless transferred)
+	Excluded string // Exclude pattern keeping the path out of the transfer, if any
+}
+
+// String describes what the restore will operate on, e.g.,
+// "restore will load /var/backups/db.sql.gz (3435973836 bytes, transferred this run)".
+func (in RestoreInput) String() string {
+	switch in.Status {
+	case RestoreInputTransferred:
+		return fmt.Sprintf("restore will load %s (%d bytes, transferred this run)", in.Path, in.Size)
+	case RestoreInputExisting:
+		return fmt.Sprintf("restore will load %s (already on the destination)", in.Path)
+	case RestoreInputDeleted:
+		return fmt.Sprintf("restore input %s would be deleted by the transfer (RsyncOptions.Delete)", in.Path)
+	}
+	if in.Excluded != "" {
+		return fmt.Sprintf("restore input %s would not exist after the transfer (excluded by '%s')", in.Path, in.Excluded)
+	}
+	return fmt.Sprintf("restore input %s would not exist after the transfer", in.Path)
+}
+
+// redirectTargetPattern matches the target of an output redirection (e.g., ">/var/log/restore.log").
+var redirectTargetPattern = regexp.MustCompile(`>>?\|?\s*([^\s;|&<>()'"` + "`" + `]+)`)
+
+// restoreInputPaths returns the absolute paths referenced by the restore command of the task within
+// the destination DataPath. This is heuristic: output redirection targets are left out, but other
+// outputs of the command (e.g., "--log-file=...") are taken for inputs, and paths with shell
+// expansions or globs are not considered.
+func restoreInputPaths(task DataMigrationModel) []string {
+	command := task.Destination.RestoreCmd
+	dataPath := task.Destination.DataPath
+	if strings.TrimSpace(command) == "" || !strings.HasPrefix(dataPath, "/") {
+		return nil
+	}
+	dataPath = path.Clean(dataPath)
+
+	outputs := make(map[string]bool)
+	for _, match := range redirectTargetPattern.FindAllStringSubmatch(command, -1) {
+		outputs[path.Clean(match[1])] = true
+	}
+	var paths []string
+	seen := make(map[string]bool)
+	for _, token := range commandPathTokens(command) {
+		switch {
+		case outputs[token], seen[token], token == dataPath:
+			continue
+		case strings.ContainsAny(token, "$*?[{~"):
+			continue
+		case dataPath != "/" && !strings.HasPrefix(token, dataPath+"/"):
+			continue
+		}
+		seen[token] = true
+		paths = append(paths, token)
+	}
+	return paths
+}
+
+// previewRestore predicts the state of each restore input after the transfer from the would-be
+// changes of the transfer (entries of its dry-run scan) and the paths existing on the destination.
+func previewRestore(task DataMigrationModel, entries []dryRunEntry, existing map[string]bool) []RestoreInput {
+	dataPath := path.Clean(task.Destination.DataPath)
+	var inputs []RestoreInput
+	for _, p := range restoreInputPaths(task) {
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, dataPath), "/")
+		input := RestoreInput{Path: p, Excluded: excludingPattern(task.RsyncOptions, rel)}
+
+		sent, deleted := false, false
+		for _, entry := range entries {
+			name := strings.TrimSuffix(entry.Name, "/")
+			if name != rel && !strings.HasPrefix(name, rel+"/") {
+				continue
+			}
+			if entry.isDeletion() {
+				deleted = deleted || name == rel
+				continue
+			}
+			sent = true
+			if entry.isFileTransfer() {
+				input.Size += entry.Size
+			}
+		}
+		switch {
+		case sent:
+			input.Status = RestoreInputTransferred
+		case deleted:
+			input.Status = RestoreInputDeleted
+		case existing[p]:
+			input.Status = RestoreInputExisting
+		default:
+			input.Status = RestoreInputMissing
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs
+}
+
+// existingDestinationPaths returns which of the paths exist on the destination.
+func existingDestinationPaths(ctx context.Context, task DataMigrationModel, paths []string) (map[string]bool, error) {
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = shellQuotePath(p)
+	}
+	command := fmt.Sprintf(`for p in %s; do [ -e "$p" ] && printf '%%s\n' "$p"; done; true`, strings.Join(quoted, " "))
+	output, err := executeCommandContext(ctx, command, task.Destination, task.RsyncOptions)
+	if err != nil {
+		return nil, fmt.Errorf("%w\nOutput:\n%s", err, string(output))
+	}
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		existing[strings.TrimSpace(line)] = true
+	}
+	return existing, nil
+}
+
+// runRestorePreview cross-references the restore inputs of the task with the dry-run listing of the
+// transfer (taken from cache when one is provided) and the destination. It returns the inputs and
+// warnings for those that would not exist after the transfer, which never stop the migration.
+func runRestorePreview(ctx context.Context, task DataMigrationModel, cache *dryRunCache) ([]RestoreInput, []string, error) {
+	paths := restoreInputPaths(task)
+	if len(paths) == 0 {
+		return nil, []string{"restore preview: the restore command references no path within the destination DataPath"}, nil
+	}
+	scan, err := cache.get(task)
+	if err != nil {
+		return nil, nil, err
+	}
+	existing, err := existingDestinationPaths(ctx, task, paths)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list the restore inputs on the destination: %w", err)
+	}
+
+	inputs := previewRestore(task, scan.Entries, existing)
+	var warnings []string
+	for _, input := range inputs {
+		if input.Status == RestoreInputDeleted || input.Status == RestoreInputMissing {
+			warnings = append(warnings, "restore preview: "+input.String())
+		}
+	}
+	return inputs, warnings, nil
+}
+
+// excludingPattern returns the Exclude (or junk) pattern that keeps the path, relative to the
+// transfer root, out of the transfer, or "" if none does. The rules are applied like rsync's
+// (first match wins, and excluding a directory excludes its contents), but the type of the entry is
+// unknown, so a pattern restricted to directories (trailing "/") is taken to match any entry.
+func excludingPattern(opts RsyncOption, rel string) string {
+	rules, _ := opts.filterRules()
+	components := strings.Split(rel, "/")
+	for i := range components {
+		prefix := strings.Join(components[:i+1], "/")
+		for _, rule := range rules {
+			pattern := rule[2:]
+			if !rsyncPatternMatches(pattern, prefix) {
+				continue
+			}
+			if rule[0] == '-' {
+				return pattern
+			}
+			break // Included; the contents may still be excluded
+		}
+	}
+	return ""
+}
+
+// rsyncPatternMatches reports whether the rsync filter pattern matches the path relative to the
+// transfer root: an anchored pattern ("/dir/file") matches the whole path, a pattern with a "/"
+// matches its trailing components, and any other pattern matches the last name.
+func rsyncPatternMatches(pattern, rel string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if pattern == "" {
+		return false
+	}
+	re, err := regexp.Compile("^" + globRegexp(strings.TrimPrefix(pattern, "/")) + "$")
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(pattern, "/") {
+		return re.MatchString(rel)
+	}
+	if !strings.Contains(pattern, "/") {
+		return re.MatchString(path.Base(rel))
+	}
+	for candidate := rel; ; {
+		if re.MatchString(candidate) {
+			return true
+		}
+		i := strings.Index(candidate, "/")
+		if i < 0 {
+			return false
+		}
+		candidate = candidate[i+1:]
+	}
+}
+
+// globRegexp translates an rsync wildcard pattern into a regular expression: "**" matches
+// anything, "*" and "?" do not match a "/", and character classes are kept.
+func globRegexp(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
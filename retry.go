@@ -0,0 +1,130 @@
+package transx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// RetryPolicy defines how a failed rsync process of a transfer is retried. Since rsync is
+// incremental, a retry reuses the destination (and, in relay mode, the staging directory and the
+// completed legs) and only transfers what is still missing. Mtime-split windows are not retried.
+type RetryPolicy struct {
+	MaxAttempts    int           // Total number of attempts (0 or 1 disables retries)
+	InitialBackoff time.Duration // Delay before the first retry (0 uses 1 second)
+	MaxBackoff     time.Duration // Upper bound of the delay between attempts (0 means no bound)
+	Multiplier     float64       // Growth factor of the delay after each retry (0 uses 2)
+
+	// ShouldRetry, if set, decides whether a failed attempt is retried, replacing the built-in
+	// classification (IsRetryableError). attempt is the 1-based number of the attempt that failed.
+	// It is only called while attempts remain, and never after the context was canceled.
+	ShouldRetry func(attempt int, err error) bool `json:"-"`
+
+	// OnRetry, if set, is called before each retry with the 1-based number of the attempt that
+	// failed, its error, and the delay before the next attempt, e.g., to log the retries.
+	OnRetry func(attempt int, err error, wait time.Duration) `json:"-"`
+}
+
+// retryableRsyncExitCodes are the rsync exit codes of failures that are usually transient:
+// socket and file I/O errors (10, 11), protocol data stream errors (12, typically a dropped
+// connection), partial transfers (23), and timeouts (30).
+var retryableRsyncExitCodes = []int{10, 11, 12, 23, 30}
+
+// IsRetryableError reports whether err is an rsync failure that is usually transient, based on
+// the exit code of the *OperationError it wraps. Configuration errors such as syntax errors (1)
+// or protocol incompatibilities (2) are not retryable. A stalled transfer (*StallError) is
+// retryable like rsync's own timeout, and so is a connection refused by sshd's MaxStartups
+// throttling (see IsSSHThrottled). Running out of space (*DiskFullError) is only retryable if
+// RsyncOption.OnDiskFull asked for it.
+func IsRetryableError(err error) bool {
+	var diskFullErr *DiskFullError
+	if errors.As(err, &diskFullErr) {
+		return diskFullErr.Retry
+	}
+	var stallErr *StallError
+	if errors.As(err, &stallErr) || IsSSHThrottled(err) {
+		return true
+	}
+	var opErr *OperationError
+	if !errors.As(err, &opErr) || opErr.shell {
+		return false
+	}
+	return slices.Contains(retryableRsyncExitCodes, opErr.ExitCode)
+}
+
+// validate checks that the policy's attempt count and backoff settings are consistent.
+func (p RetryPolicy) validate() error {
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("MaxAttempts must not be negative")
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return fmt.Errorf("backoff durations must not be negative")
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return fmt.Errorf("Multiplier %g must be at least 1", p.Multiplier)
+	}
+	if p.MaxBackoff > 0 && p.InitialBackoff > p.MaxBackoff {
+		return fmt.Errorf("InitialBackoff %s exceeds MaxBackoff %s", p.InitialBackoff, p.MaxBackoff)
+	}
+	return nil
+}
+
+// shouldRetry applies ShouldRetry if set, or the built-in classification otherwise.
+func (p RetryPolicy) shouldRetry(attempt int, err error) bool {
+	if p.ShouldRetry != nil {
+		return p.ShouldRetry(attempt, err)
+	}
+	return IsRetryableError(err)
+}
+
+// withAttempts records the number of attempts in the *OperationError that err wraps, if any, and
+// returns err.
+func withAttempts(err error, attempts int) error {
+	var opErr *OperationError
+	if errors.As(err, &opErr) {
+		opErr.Attempts = attempts
+	}
+	return err
+}
+
+// run executes fn, retrying it with exponential backoff while the policy allows it. The backoff is
+// jittered after a connection refused by sshd's MaxStartups throttling, so that concurrent tasks
+// spread their retries. The error of the last attempt is returned, with the number of attempts
+// recorded in the *OperationError it wraps, if any.
+func (p RetryPolicy) run(ctx context.Context, operation string, fn func() error) error {
+	backoff := p.InitialBackoff
+	if backoff == 0 {
+		backoff = time.Second
+	}
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !p.shouldRetry(attempt, err) {
+			return withAttempts(err, attempt)
+		}
+
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+		wait := backoff
+		if IsSSHThrottled(err) {
+			wait = jitter(backoff)
+		}
+		fmt.Printf("%s failed (attempt %d of %d); retrying in %s...\n", operation, attempt, p.MaxAttempts, wait.Round(time.Millisecond))
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, wait)
+		}
+		select {
+		case <-ctx.Done():
+			return withAttempts(err, attempt)
+		case <-time.After(wait):
+		}
+		backoff = time.Duration(float64(backoff) * multiplier)
+	}
+}
@@ -0,0 +1,86 @@
+package transx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyRun(t *testing.T) {
+	retryable := func() error {
+		return newOperationError(DataMigrationModel{}, StageTransfer, "rsync failed", nil, nil, exitError(12))
+	}
+	fatal := func() error {
+		return newOperationError(DataMigrationModel{}, StageTransfer, "rsync failed", nil, nil, exitError(1))
+	}
+	tests := []struct {
+		name         string
+		policy       RetryPolicy
+		results      []func() error // Of the attempts in order; nil succeeds
+		wantCalls    int
+		wantAttempts int // Recorded in the returned *OperationError (0 if none is returned)
+	}{
+		{name: "success", policy: RetryPolicy{MaxAttempts: 3}, results: []func() error{nil}, wantCalls: 1},
+		{name: "retried until success", policy: RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+			results: []func() error{retryable, retryable, nil}, wantCalls: 3},
+		{name: "attempts exhausted", policy: RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+			results: []func() error{retryable, retryable, retryable}, wantCalls: 3, wantAttempts: 3},
+		{name: "configuration error", policy: RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+			results: []func() error{fatal}, wantCalls: 1, wantAttempts: 1},
+		{name: "retries disabled", results: []func() error{retryable}, wantCalls: 1, wantAttempts: 1},
+		{name: "ShouldRetry overrides", policy: RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond,
+			ShouldRetry: func(int, error) bool { return true }}, results: []func() error{fatal, fatal}, wantCalls: 2, wantAttempts: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := tt.policy.run(context.Background(), "test", func() error {
+				result := tt.results[calls]
+				calls++
+				if result == nil {
+					return nil
+				}
+				return result()
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("fn called %d times, want %d", calls, tt.wantCalls)
+			}
+			var opErr *OperationError
+			if tt.wantAttempts == 0 {
+				if err != nil {
+					t.Errorf("run() error = %v, want success", err)
+				}
+			} else if !errors.As(err, &opErr) || opErr.Attempts != tt.wantAttempts {
+				t.Errorf("run() error = %v, want an *OperationError after %d attempts", err, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+// A run canceled while waiting for the next attempt reports the attempts made.
+func TestRetryPolicyRunCanceledDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var retries []int
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond, Multiplier: 1e6, // The second wait outlasts the test
+		OnRetry: func(attempt int, err error, wait time.Duration) {
+			retries = append(retries, attempt)
+			if attempt == 2 {
+				cancel()
+			}
+		}}
+
+	calls := 0
+	err := policy.run(ctx, "test", func() error {
+		calls++
+		return newOperationError(DataMigrationModel{}, StageTransfer, "rsync failed", nil, nil, exitError(30))
+	})
+	var opErr *OperationError
+	if !errors.As(err, &opErr) || opErr.Attempts != 2 || calls != 2 {
+		t.Fatalf("run() error = %v after %d calls, want an *OperationError after 2 attempts", err, calls)
+	}
+	if len(retries) != 2 {
+		t.Errorf("OnRetry called for attempts %v, want 1 and 2", retries)
+	}
+}
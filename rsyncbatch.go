@@ -0,0 +1,206 @@
+package transx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rsyncBatchMeta is the content of the metadata file written next to an rsync batch file
+// (see RsyncOption.BatchDir). It ties the batch to the task and to the state of the source.
+type rsyncBatchMeta struct {
+	ConfigHash  string    // Hash of the task the batch was written for
+	SourceMtime int64     // Modification time of the source DataPath (Unix seconds) when the batch was written
+	WrittenAt   time.Time // Time the batch was written
+}
+
+// validateRsyncBatch checks that the batch mode can be applied to the task.
+func (task *DataMigrationModel) validateRsyncBatch() error {
+	if task.RsyncOptions.BatchDir == "" {
+		return nil
+	}
+	if strings.TrimSpace(task.RsyncOptions.BatchDir) == "" {
+		return fmt.Errorf("BatchDir must not be blank")
+	}
+	switch {
+	case task.Topology() == RemoteToRemoteRelay:
+		return fmt.Errorf("BatchDir is not supported in relay mode")
+	case task.Source.isContainer() || task.Destination.isContainer():
+		return fmt.Errorf("BatchDir is not supported with container endpoints")
+	case len(task.Source.AdditionalDataPaths) > 0:
+		return fmt.Errorf("BatchDir cannot be combined with multiple source paths")
+	case len(task.RsyncOptions.MtimeSplit.Boundaries) > 0:
+		return fmt.Errorf("BatchDir cannot be combined with MtimeSplit")
+	case task.RsyncOptions.RemoveSourceFiles:
+		return fmt.Errorf("BatchDir cannot be combined with RemoveSourceFiles (applying a batch never reads the source)")
+	case strings.TrimSpace(task.RsyncOptions.LocalRunAs) != "":
+		return fmt.Errorf("BatchDir cannot be combined with LocalRunAs")
+	}
+	return nil
+}
+
+// rsyncBatchPath returns the path of the batch file of the task in BatchDir, named by the hash of
+// the task so that tasks sharing the directory do not collide. rsync writes a shell script next to
+// it ("<batch>.sh"), and transx its metadata ("<batch>.json").
+func rsyncBatchPath(task DataMigrationModel) (string, error) {
+	hash, err := configHash(task)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(task.RsyncOptions.BatchDir, "transx-"+hash[:16]+".batch"), nil
+}
+
+// removeRsyncBatch removes the batch file, its script, and its metadata.
+func removeRsyncBatch(batch string) error {
+	var errs []error
+	for _, p := range []string{batch, batch + ".sh", batch + ".json"} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sourceMtime returns the modification time of the source DataPath in Unix seconds. It only
+// guards against a changed source: a change deep in the tree does not always reach the top directory.
+func sourceMtime(ctx context.Context, task DataMigrationModel) (int64, error) {
+	source := strings.TrimRight(task.Source.DataPath, "/")
+	if source == "" {
+		source = "/"
+	}
+	if !task.Source.isRemote() {
+		info, err := os.Stat(source)
+		if err != nil {
+			return 0, err
+		}
+		return info.ModTime().Unix(), nil
+	}
+	quoted := shellQuotePath(source)
+	statCmd := fmt.Sprintf("stat -c %%Y %s 2>/dev/null || stat -f %%m %s", quoted, quoted) // GNU, then BSD stat
+	output, err := executeCommandContext(ctx, statCmd, task.Source, task.RsyncOptions)
+	if err != nil {
+		return 0, fmt.Errorf("%w\nOutput:\n%s", err, string(output))
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	mtime, err := strconv.ParseInt(strings.TrimSpace(lines[len(lines)-1]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected output of stat: %q", string(output))
+	}
+	return mtime, nil
+}
+
+// usableRsyncBatch reports whether the batch left by an earlier run can be applied: it exists, was
+// written for the same task, and the source has not been modified since. A batch that cannot be
+// applied is removed, with the reason printed.
+func usableRsyncBatch(task DataMigrationModel, batch string, mtime int64) bool {
+	data, err := os.ReadFile(batch + ".json")
+	if errors.Is(err, os.ErrNotExist) {
+		if err := removeRsyncBatch(batch); err != nil { // A batch without metadata was never completed
+			fmt.Printf("Warning: failed to remove the incomplete rsync batch %s: %v\n", batch, err)
+		}
+		return false
+	}
+	reason := ""
+	var meta rsyncBatchMeta
+	switch {
+	case err != nil:
+		reason = err.Error()
+	case json.Unmarshal(data, &meta) != nil:
+		reason = "its metadata is corrupt"
+	case meta.ConfigHash != task.Hash():
+		reason = "it was written for another configuration"
+	case meta.SourceMtime != mtime:
+		reason = "the source was modified after it was written"
+	}
+	if reason == "" {
+		if _, err := os.Stat(batch); err != nil {
+			reason = err.Error()
+		}
+	}
+	if reason != "" {
+		fmt.Printf("Discarding the rsync batch %s: %s\n", batch, reason)
+		if err := removeRsyncBatch(batch); err != nil {
+			fmt.Printf("Warning: failed to remove the rsync batch %s: %v\n", batch, err)
+		}
+		return false
+	}
+	return true
+}
+
+// transferWithRsyncBatch runs a direct transfer through an rsync batch file in RsyncOption.BatchDir,
+// so that a transfer failing after rsync walked both trees does not walk them again when it is rerun.
+//
+// Without a usable batch, rsync first computes the changes into the batch (--only-write-batch) and
+// then applies it (--read-batch); if the application fails, the batch is kept for the next run. A
+// rerun applies the kept batch without comparing the trees, and falls back to a normal transfer if
+// that fails, e.g., because the destination changed. The batch is removed once it has been applied.
+// It returns handled=false if the normal transfer must run instead.
+//
+// Applying a batch never reads the source: the data is what the source held when the batch was
+// written. A batch is therefore discarded if the modification time of the source DataPath changed
+// since; a change deeper in the tree does not always update it, so the source must not be modified
+// between a failed run and its rerun.
+func transferWithRsyncBatch(ctx context.Context, task DataMigrationModel, rsyncCmdPath string, args, progressArgs, sources []string, destination string) (output []byte, handled bool, err error) {
+	batch, err := rsyncBatchPath(task)
+	if err != nil {
+		return nil, true, err
+	}
+	mtime, err := sourceMtime(ctx, task)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to read the modification time of the source '%s': %w", task.Source.displayPath(), err)
+	}
+
+	readArgs := append(append([]string{}, args...), "--read-batch="+batch)
+	readArgs = append(append(readArgs, progressArgs...), "--", destination)
+	if usableRsyncBatch(task, batch, mtime) {
+		fmt.Printf("Applying the rsync batch %s left by an earlier run...\n", batch)
+		task.RsyncOptions.recorder.command(rsyncCmdPath, readArgs)
+		output, err := runRsyncAttempts(ctx, task, "Transfer (batch)", rsyncCmdPath, readArgs)
+		if removeErr := removeRsyncBatch(batch); removeErr != nil {
+			fmt.Printf("Warning: failed to remove the rsync batch %s: %v\n", batch, removeErr)
+		}
+		if err != nil {
+			fmt.Printf("Warning: the rsync batch could not be applied; transferring normally: %v\n", err)
+			return nil, false, nil
+		}
+		return output, true, nil
+	}
+
+	if err := os.MkdirAll(task.RsyncOptions.BatchDir, 0700); err != nil {
+		return nil, true, fmt.Errorf("failed to create the batch directory '%s': %w", task.RsyncOptions.BatchDir, err)
+	}
+	fmt.Printf("Writing the changes into the rsync batch %s...\n", batch)
+	writeArgs := rsyncLegArgs(append(append([]string{}, args...), "--only-write-batch="+batch), nil, sources, destination)
+	task.RsyncOptions.recorder.command(rsyncCmdPath, writeArgs)
+	if _, err := runRsyncAttempts(ctx, task, "Transfer (batch write)", rsyncCmdPath, writeArgs); err != nil {
+		if removeErr := removeRsyncBatch(batch); removeErr != nil {
+			fmt.Printf("Warning: failed to remove the rsync batch %s: %v\n", batch, removeErr)
+		}
+		return nil, true, err
+	}
+	meta, err := json.MarshalIndent(rsyncBatchMeta{ConfigHash: task.Hash(), SourceMtime: mtime, WrittenAt: time.Now()}, "", "  ")
+	if err != nil {
+		return nil, true, err
+	}
+	if err := os.WriteFile(batch+".json", meta, 0600); err != nil {
+		return nil, true, fmt.Errorf("failed to write the rsync batch metadata: %w", err)
+	}
+
+	fmt.Printf("Applying the rsync batch %s...\n", batch)
+	task.RsyncOptions.recorder.command(rsyncCmdPath, readArgs)
+	output, err = runRsyncAttempts(ctx, task, "Transfer (batch)", rsyncCmdPath, readArgs)
+	if err != nil {
+		fmt.Printf("The rsync batch %s is kept; a rerun of the task applies it without comparing the trees again\n", batch)
+		return nil, true, err
+	}
+	if err := removeRsyncBatch(batch); err != nil {
+		fmt.Printf("Warning: failed to remove the rsync batch %s: %v\n", batch, err)
+	}
+	return output, true, nil
+}
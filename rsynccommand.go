@@ -0,0 +1,93 @@
+package transx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// stagingPlaceholder stands in for the relay staging directory in command lines built before the
+// transfer, since the directory is created at runtime unless RsyncOption.StagingDir is set.
+const stagingPlaceholder = "<staging-dir>"
+
+// RsyncCommand is an rsync command line of a transfer.
+type RsyncCommand struct {
+	Leg  RelayLeg // Relay leg the command runs ("" for direct transfers)
+	Path string   // rsync executable
+	Args []string // Arguments, including the source and destination paths
+}
+
+// BuildRsyncCommand validates the task and returns the rsync command Transfer would run for it,
+// without executing anything, so that it can be logged or reviewed. A relay transfer runs two
+// commands, which BuildRsyncCommands returns.
+func BuildRsyncCommand(task DataMigrationModel) (path string, args []string, err error) {
+	commands, err := BuildRsyncCommands(task)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(commands) != 1 {
+		return "", nil, fmt.Errorf("a %s transfer runs %d rsync commands; use BuildRsyncCommands", task.Topology(), len(commands))
+	}
+	return commands[0].Path, commands[0].Args, nil
+}
+
+// BuildRsyncCommands validates the task and returns the rsync commands Transfer would run for it,
+// without executing anything: one for a direct transfer, and the download and upload legs for a
+// relay transfer. The staging directory of a relay transfer is RsyncOption.StagingDir, or
+// "<staging-dir>" if it is created at runtime. Likewise, the files the transfer writes for
+// FilesFromList and for filter patterns too many for the command line appear as "<files-from-file>"
+// and "<filter-file>", in the --files-from and --filter=merge arguments that replace them. Transfers whose command lines depend on the state of
+// the endpoints (see Replay) or that use another DataMigrationModel.Backend are refused.
+func BuildRsyncCommands(task DataMigrationModel) ([]RsyncCommand, error) {
+	if err := Validate(task); err != nil {
+		return nil, fmt.Errorf("rsync task validation failed: %w", err)
+	}
+	if task.usesCustomBackend() {
+		return nil, fmt.Errorf("the task is transferred by the %s backend, not rsync", task.Backend)
+	}
+	stagingPath := strings.TrimSuffix(task.RsyncOptions.StagingDir, "/")
+	if strings.TrimSpace(stagingPath) == "" {
+		stagingPath = stagingPlaceholder
+	}
+	return rsyncCommands(task, stagingPath, task.wantsProgress())
+}
+
+// rsyncCommands builds the rsync commands of the task with the given relay staging path, with
+// --info=progress2 if progress is set.
+func rsyncCommands(task DataMigrationModel, stagingPath string, progress bool) ([]RsyncCommand, error) {
+	if len(task.RsyncOptions.MtimeSplit.Boundaries) > 0 {
+		return nil, fmt.Errorf("the command lines of mtime split transfers are not known ahead (their file lists are generated on the source)")
+	}
+	if task.RsyncOptions.RelayStreaming && task.Topology() == RemoteToRemoteRelay && !task.RsyncOptions.DryRun {
+		return nil, fmt.Errorf("streamed relay transfers run tar, not rsync (see RelayStreaming)")
+	}
+	if task.Source.isURL() {
+		return nil, fmt.Errorf("the command lines of URL source transfers are not known ahead (the artifact is staged at runtime)")
+	}
+	if task.Source.isContainer() || task.Destination.isContainer() {
+		return nil, fmt.Errorf("the command lines of container transfers are not known ahead (they use staging directories created on the hosts)")
+	}
+	if task.RsyncOptions.BatchDir != "" && !task.RsyncOptions.DryRun {
+		return nil, fmt.Errorf("the command lines of batch transfers are not known ahead (they depend on a batch left by an earlier run)")
+	}
+
+	rsyncCmdPath, args := buildRsyncArgs(task)
+	var progressArgs []string
+	if progress {
+		progressArgs = []string{"--info=progress2"}
+	}
+	sourceRsyncPaths := task.Source.rsyncSourcePaths()
+	destinationRsyncPath := task.Destination.getRsyncPath()
+
+	if task.Topology() == RemoteToRemoteRelay {
+		if stagingPath == "" {
+			return nil, fmt.Errorf("relay transfer has no staging path")
+		}
+		owned := strings.TrimSpace(task.RsyncOptions.StagingDir) == ""
+		_, download, upload := relayArgs(task, args, stagingManifestEnabled(task, owned))
+		return []RsyncCommand{
+			{Leg: RelayDownload, Path: rsyncCmdPath, Args: rsyncLegArgs(download, progressArgs, sourceRsyncPaths, stagingPath+"/")},
+			{Leg: RelayUpload, Path: rsyncCmdPath, Args: rsyncLegArgs(upload, progressArgs, []string{stagingPath + "/"}, destinationRsyncPath)},
+		}, nil
+	}
+	return []RsyncCommand{{Path: rsyncCmdPath, Args: rsyncLegArgs(args, progressArgs, sourceRsyncPaths, destinationRsyncPath)}}, nil
+}
@@ -0,0 +1,90 @@
+package transx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+)
+
+// CommandRunner runs the external commands of transx (see RsyncOption.CommandRunner), e.g., a fake
+// returning canned output in tests. name and args are the complete command line, including
+// CommandWrapper, sudo for LocalRunAs, and ssh for remote commands. Run returns the combined stdout
+// and stderr of the command and, if it failed, an error (an *exec.ExitError carries the exit code).
+type CommandRunner interface {
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// ExecRunner is the CommandRunner running commands with os/exec, e.g., for a runner that records the
+// commands and delegates to it. Without RsyncOption.CommandRunner, transx runs the commands itself,
+// which also streams their output (progress, StreamCommandOutput) and kills their process groups.
+type ExecRunner struct{}
+
+// Run runs the command and returns its combined output.
+func (ExecRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
+
+// runner returns the CommandRunner of the options, or ExecRunner if none is set.
+func (o RsyncOption) runner() CommandRunner {
+	if o.CommandRunner != nil {
+		return o.CommandRunner
+	}
+	return ExecRunner{}
+}
+
+// runWithRunner runs the command line of cmd with the CommandRunner of the options.
+func runWithRunner(ctx context.Context, opts RsyncOption, cmd *exec.Cmd) ([]byte, error) {
+	return opts.CommandRunner.Run(ctx, cmd.Args[0], cmd.Args[1:]...)
+}
+
+// commandOutput runs cmd, with the CommandRunner of the options if set, and returns its combined
+// stdout and stderr.
+func commandOutput(ctx context.Context, opts RsyncOption, cmd *exec.Cmd) ([]byte, error) {
+	var output []byte
+	var err error
+	if opts.CommandRunner != nil {
+		output, err = runWithRunner(ctx, opts, cmd)
+	} else {
+		output, err = cmd.CombinedOutput()
+	}
+	return output, hostKeyFailure(output, err)
+}
+
+// runRsyncWithRunner is runRsyncCommand for a CommandRunner: the output is only available once the
+// command finished, so the progress lines and file events are delivered afterwards (none is
+// dropped) and a full destination is detected without stopping the command.
+func runRsyncWithRunner(ctx context.Context, opts RsyncOption, cmd *exec.Cmd, leg RelayLeg) ([]byte, error) {
+	raw, err := runWithRunner(ctx, opts, cmd)
+	output := &tailBuffer{limit: opts.MaxCapturedOutput}
+	onProgress := opts.progressFunc()
+	bytesWritten := int64(-1)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(make([]byte, 64*1024), len(raw)+1)
+	scanner.Split(scanOutputSegments)
+	for scanner.Scan() {
+		segment := scanner.Text()
+		if event, ok := parseProgressLine(segment); ok {
+			bytesWritten = event.BytesTransferred
+			if onProgress != nil {
+				event.Leg = leg
+				onProgress(event)
+			}
+			continue
+		}
+		if opts.OnFile != nil {
+			if entry, ok := parseDryRunEntry(segment); ok {
+				opts.OnFile(FileEvent{Leg: leg, Itemize: entry.Itemize, Size: entry.Size, Name: entry.Name})
+			}
+		}
+		if strings.TrimSpace(segment) != "" {
+			output.WriteString(segment + "\n")
+		}
+	}
+	err = hostKeyFailure(raw, err)
+	if bytes.Contains(raw, diskFullMarker) {
+		err = &DiskFullError{Leg: leg, BytesWritten: bytesWritten, Err: err}
+	}
+	return output.Bytes(), err
+}
@@ -0,0 +1,105 @@
+package transx
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRunner is a CommandRunner recording the command lines it runs. respond, if set, returns the
+// output and error of a command; other commands succeed without output.
+type fakeRunner struct {
+	mu      sync.Mutex
+	calls   [][]string
+	respond func(ctx context.Context, args []string) ([]byte, error)
+}
+
+func (r *fakeRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	call := append([]string{name}, args...)
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	r.mu.Unlock()
+	if r.respond != nil {
+		return r.respond(ctx, call)
+	}
+	return nil, nil
+}
+
+// commands returns the recorded command lines, each joined with spaces.
+func (r *fakeRunner) commands() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var commands []string
+	for _, call := range r.calls {
+		commands = append(commands, strings.Join(call, " "))
+	}
+	return commands
+}
+
+// rsyncCalls returns the recorded rsync command lines.
+func (r *fakeRunner) rsyncCalls() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var calls [][]string
+	for _, call := range r.calls {
+		if strings.HasSuffix(call[0], "rsync") {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// exitError returns an *exec.ExitError with the exit code.
+func exitError(code int) error {
+	err := exec.Command("sh", "-c", "exit "+strconv.Itoa(code)).Run()
+	return err
+}
+
+// The commands run as LocalRunAs go through the CommandRunner like every other command.
+func TestLocalRunAsCommandsUseRunner(t *testing.T) {
+	runner := &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+		if slices.Contains(args, "mktemp") {
+			return []byte("/tmp/transx-relay-abc123\n"), nil
+		}
+		return nil, nil
+	}}
+	opts := RsyncOption{LocalRunAs: "svc", SessionDirMode: 0750, CommandRunner: runner}
+
+	dir, owned, err := relayStagingDir(opts)
+	if err != nil || !owned || dir != "/tmp/transx-relay-abc123" {
+		t.Fatalf("relayStagingDir() = %q, %v, %v", dir, owned, err)
+	}
+	if err := removeRelayStagingDir(opts, dir); err != nil {
+		t.Fatal(err)
+	}
+	opts.StagingDir = "/srv/staging"
+	if _, _, err := relayStagingDir(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"sudo -n -u svc -- mktemp -d " + filepath.Join(os.TempDir(), "transx-relay-XXXXXX"),
+		"sudo -n -u svc -- chmod 0750 /tmp/transx-relay-abc123",
+		"sudo -n -u svc -- rm -rf -- /tmp/transx-relay-abc123",
+		"sudo -n -u svc -- mkdir -p -m 0750 /srv/staging",
+	}
+	if got := runner.commands(); !slices.Equal(got, want) {
+		t.Errorf("commands run:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLocalRunAsFailureIncludesOutput(t *testing.T) {
+	runner := &fakeRunner{respond: func(ctx context.Context, args []string) ([]byte, error) {
+		return []byte("sudo: a password is required\n"), exitError(1)
+	}}
+	_, _, err := relayStagingDir(RsyncOption{LocalRunAs: "svc", StagingDir: "/srv/staging", CommandRunner: runner})
+	if err == nil || !strings.Contains(err.Error(), "a password is required") {
+		t.Errorf("relayStagingDir() error = %v, want the output of sudo", err)
+	}
+}
@@ -0,0 +1,159 @@
+package transx
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SampleMismatchPolicy defines how a sampled verification reacts to a checksum mismatch.
+type SampleMismatchPolicy string
+
+const (
+	SampleMismatchFail       SampleMismatchPolicy = "fail"        // Fail the verification (default)
+	SampleMismatchFullVerify SampleMismatchPolicy = "full-verify" // Run a full checksum Verify and fail only if it fails
+)
+
+// defaultSampleBatchSize is the number of files checksummed per command when BatchSize is zero.
+const defaultSampleBatchSize = 100
+
+// SampledVerifyOption configures the verification of a random sample of the transferred files by
+// checksums computed on both endpoints (RsyncOption.ChecksumAlgorithm, SHA-256 by default), as a
+// cheaper alternative to a full checksum Verify.
+// The sample is drawn from the files the transfer actually sent, so an up-to-date destination
+// yields an empty sample.
+type SampledVerifyOption struct {
+	Percent   float64              // Percentage of the transferred files to verify (0-100)
+	Count     int                  // Fixed number of files to verify (alternative to Percent)
+	Seed      uint64               // Seed of the random selection, for reproducible samples (0 picks one and reports it)
+	BatchSize int                  // Files checksummed per command, limiting round-trips (0 uses 100)
+	Policy    SampleMismatchPolicy // Reaction to a mismatch ("" or "fail", or "full-verify")
+}
+
+// SampledVerifyResult records the outcome of a sampled verification.
+type SampledVerifyResult struct {
+	Seed            uint64            // Seed the sample was drawn with
+	Algorithm       ChecksumAlgorithm // Checksum algorithm the files were compared with
+	Transferred     int               // Number of files the transfer sent
+	Sampled         int               // Number of files verified
+	SampledFraction float64           // Sampled / Transferred (0 if nothing was transferred)
+	Matches         int               // Files whose checksums matched
+	Mismatches      []string          // Files (relative to the transfer root) whose checksums differed or that were missing
+	Escalated       bool              // Whether a mismatch escalated to a full Verify
+}
+
+// enabled reports whether a sampled verification is requested.
+func (o SampledVerifyOption) enabled() bool {
+	return o.Percent > 0 || o.Count > 0
+}
+
+// validateSampledVerify checks the sampled verification settings of the task.
+func (task *DataMigrationModel) validateSampledVerify() error {
+	opts := task.WorkflowOptions.SampledVerify
+	if opts.Percent < 0 || opts.Percent > 100 {
+		return fmt.Errorf("Percent %g must be between 0 and 100", opts.Percent)
+	}
+	if opts.Count < 0 || opts.BatchSize < 0 {
+		return fmt.Errorf("Count and BatchSize must not be negative")
+	}
+	if opts.Percent > 0 && opts.Count > 0 {
+		return fmt.Errorf("Percent and Count are mutually exclusive")
+	}
+	switch opts.Policy {
+	case "", SampleMismatchFail, SampleMismatchFullVerify:
+	default:
+		return fmt.Errorf("unknown mismatch policy '%s' (use '%s' or '%s')", opts.Policy, SampleMismatchFail, SampleMismatchFullVerify)
+	}
+	if !opts.enabled() {
+		return nil
+	}
+	if task.RsyncOptions.DryRun {
+		return fmt.Errorf("sampled verification cannot be combined with DryRun (nothing is transferred)")
+	}
+	if len(task.Source.AdditionalDataPaths) > 0 {
+		return fmt.Errorf("sampled verification is not supported with multiple source paths")
+	}
+	if task.Source.isContainer() || task.Destination.isContainer() {
+		return fmt.Errorf("sampled verification is not supported with container endpoints")
+	}
+	return nil
+}
+
+// transferredFiles returns the names of the regular files sent by a transfer, parsed from the
+// entries logged with --out-format (see buildRsyncArgs).
+func transferredFiles(output string) []string {
+	var files []string
+	for _, line := range strings.Split(output, "\n") {
+		if entry, ok := parseDryRunEntry(line); ok && entry.isFileTransfer() {
+			files = append(files, entry.Name)
+		}
+	}
+	return files
+}
+
+// sampledVerify checksums a random sample of the files sent by the transfer on both endpoints
+// and applies the mismatch policy.
+func sampledVerify(ctx context.Context, task DataMigrationModel, transferred []string) (*SampledVerifyResult, error) {
+	opts := task.WorkflowOptions.SampledVerify
+	result := &SampledVerifyResult{Seed: opts.Seed, Algorithm: task.RsyncOptions.ChecksumAlgorithm.orDefault(), Transferred: len(transferred)}
+	if result.Seed == 0 {
+		result.Seed = uint64(time.Now().UnixNano())
+	}
+
+	// Hashing commands escape names containing backslashes or newlines in its output, so they are not sampled
+	var candidates []string
+	for _, name := range transferred {
+		if !strings.ContainsAny(name, "\\\n") {
+			candidates = append(candidates, name)
+		}
+	}
+	n := opts.Count
+	if opts.Percent > 0 {
+		n = int(math.Ceil(float64(len(candidates)) * opts.Percent / 100))
+	}
+	n = min(n, len(candidates))
+
+	rng := rand.New(rand.NewPCG(result.Seed, result.Seed))
+	rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	sample := candidates[:n]
+	slices.Sort(sample)
+	result.Sampled = len(sample)
+	if result.Transferred > 0 {
+		result.SampledFraction = float64(result.Sampled) / float64(result.Transferred)
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultSampleBatchSize
+	}
+	if len(sample) > 0 {
+		mismatches, err := compareChecksums(ctx, task, task.Source, sourceTransferRoot(task.Source.DataPath), task.Destination.DataPath, sample, batchSize)
+		if err != nil {
+			return result, err
+		}
+		result.Mismatches = mismatches
+		result.Matches = len(sample) - len(mismatches)
+	}
+	fmt.Printf("Sampled verification: %d of %d transferred file(s) checked by %s (seed %d), %d mismatch(es)\n",
+		result.Sampled, result.Transferred, result.Algorithm, result.Seed, len(result.Mismatches))
+
+	if len(result.Mismatches) == 0 {
+		return result, nil
+	}
+	mismatchErr := fmt.Errorf("sampled verification found %d of %d sampled file(s) differing (e.g., '%s')",
+		len(result.Mismatches), result.Sampled, result.Mismatches[0])
+	if opts.Policy != SampleMismatchFullVerify {
+		return result, mismatchErr
+	}
+
+	fmt.Println("Sampled verification found mismatches; escalating to a full verification...")
+	result.Escalated = true
+	if err := Verify(task); err != nil {
+		return result, fmt.Errorf("%w; full verification failed: %w", mismatchErr, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,214 @@
+package transx
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// schemaDraft is the JSON Schema dialect of the generated schema.
+const schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaTypeDescriptions holds the descriptions of the config structs in the generated schema.
+// Field descriptions are taken from a `desc` struct tag when present.
+var schemaTypeDescriptions = map[reflect.Type]string{
+	reflect.TypeOf(DataMigrationModel{}): "A single transx data migration task.",
+	reflect.TypeOf(EndpointDetails{}):    "Source or destination endpoint (local if HostIP is empty, otherwise reached via SSH).",
+	reflect.TypeOf(RsyncOption{}):        "Options applied when executing rsync and SSH.",
+	reflect.TypeOf(PreflightOption{}):    "Checks performed before the migration touches any data.",
+	reflect.TypeOf(WorkflowOption{}):     "Options controlling the MigrateData workflow.",
+}
+
+// schemaEnums lists the allowed values of mode-like string fields, keyed by "Type.Field".
+var schemaEnums = map[string][]string{
+	"WorkflowOption.RedactionMode":  {"", string(RedactionNone), string(RedactionShareable)},
+	"SampledVerifyOption.Policy":    {"", string(SampleMismatchFail), string(SampleMismatchFullVerify)},
+	"RsyncOption.ChecksumAlgorithm": {"", string(ChecksumSHA256), string(ChecksumSHA1), string(ChecksumMD5), string(ChecksumXXH64)},
+}
+
+// schemaRequired lists the required fields of each struct, matching the checks in Validate.
+var schemaRequired = map[reflect.Type][]string{
+	reflect.TypeOf(DataMigrationModel{}): {"Source", "Destination"},
+	reflect.TypeOf(EndpointDetails{}):    {"DataPath"},
+}
+
+// ConfigJSONSchema returns a JSON Schema (draft 2020-12) describing DataMigrationModel documents,
+// generated from the current structs. Property names are the Go field names; like encoding/json,
+// LoadConfig matches them case-insensitively (e.g., "hostIP" matches HostIP).
+func ConfigJSONSchema() ([]byte, error) {
+	schema := schemaForType(reflect.TypeOf(DataMigrationModel{}))
+	schema["$schema"] = schemaDraft
+	schema["title"] = "transx DataMigrationModel"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// schemaForType returns the schema of a Go type as a JSON-compatible map.
+func schemaForType(t reflect.Type) map[string]any {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(time.Duration(0)):
+		return map[string]any{"type": "integer", "description": "Duration in nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaForType(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaForType(t.Elem())}
+	case reflect.Pointer:
+		return schemaForType(t.Elem())
+	case reflect.Struct:
+		properties := map[string]any{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() || field.Tag.Get("json") == "-" || field.Type.Kind() == reflect.Func {
+				continue
+			}
+			prop := schemaForType(field.Type)
+			if desc := field.Tag.Get("desc"); desc != "" {
+				prop["description"] = desc
+			}
+			if enum, ok := schemaEnums[t.Name()+"."+field.Name]; ok {
+				prop["enum"] = enum
+			}
+			properties[field.Name] = prop
+		}
+		schema := map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if desc, ok := schemaTypeDescriptions[t]; ok {
+			schema["description"] = desc
+		}
+		if required, ok := schemaRequired[t]; ok {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]any{}
+}
+
+// validateAgainstSchema checks a decoded JSON document against the generated schema and returns
+// all violations, each prefixed with its JSON path. It supports the subset of JSON Schema produced
+// by schemaForType (types, properties, required, enum, items, additionalProperties).
+func validateAgainstSchema(document any) []string {
+	var violations []string
+	validateSchemaValue("$", document, schemaForType(reflect.TypeOf(DataMigrationModel{})), &violations)
+	return violations
+}
+
+// validateSchemaValue validates value at the given JSON path against schema.
+func validateSchemaValue(jsonPath string, value any, schema map[string]any, violations *[]string) {
+	if value == nil {
+		return // null leaves the zero value in place
+	}
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			*violations = append(*violations, fmt.Sprintf("%s: expected object", jsonPath))
+			return
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		if properties == nil {
+			additional, _ := schema["additionalProperties"].(map[string]any)
+			for key, v := range obj {
+				validateSchemaValue(jsonPath+"."+key, v, additional, violations)
+			}
+			return
+		}
+		present := map[string]bool{}
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			name, prop := lookupSchemaProperty(properties, key)
+			if prop == nil {
+				*violations = append(*violations, fmt.Sprintf("%s: unknown property '%s'", jsonPath, key))
+				continue
+			}
+			present[name] = true
+			validateSchemaValue(jsonPath+"."+key, obj[key], prop, violations)
+		}
+		if required, ok := schema["required"].([]string); ok {
+			for _, name := range required {
+				if !present[name] {
+					*violations = append(*violations, fmt.Sprintf("%s: missing required property '%s'", jsonPath, name))
+				}
+			}
+		}
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			*violations = append(*violations, fmt.Sprintf("%s: expected array", jsonPath))
+			return
+		}
+		items, _ := schema["items"].(map[string]any)
+		for i, v := range arr {
+			validateSchemaValue(fmt.Sprintf("%s[%d]", jsonPath, i), v, items, violations)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			*violations = append(*violations, fmt.Sprintf("%s: expected string", jsonPath))
+			return
+		}
+		if enum, ok := schema["enum"].([]string); ok && !containsString(enum, str) {
+			*violations = append(*violations, fmt.Sprintf("%s: '%s' is not one of %s", jsonPath, str, strings.Join(enum, ", ")))
+		}
+	case "integer":
+		num, ok := value.(float64)
+		if !ok || num != float64(int64(num)) {
+			*violations = append(*violations, fmt.Sprintf("%s: expected integer", jsonPath))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			*violations = append(*violations, fmt.Sprintf("%s: expected number", jsonPath))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			*violations = append(*violations, fmt.Sprintf("%s: expected boolean", jsonPath))
+		}
+	}
+}
+
+// lookupSchemaProperty finds the property matching key, preferring an exact match and
+// falling back to a case-insensitive one like encoding/json.
+func lookupSchemaProperty(properties map[string]any, key string) (string, map[string]any) {
+	if prop, ok := properties[key].(map[string]any); ok {
+		return key, prop
+	}
+	for name, p := range properties {
+		if strings.EqualFold(name, key) {
+			prop, _ := p.(map[string]any)
+			return name, prop
+		}
+	}
+	return "", nil
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package transx
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// The schema in testdata is what the portal consumes; a struct change that alters it fails here
+// until the file is regenerated with "go test -run TestConfigJSONSchemaGolden -update".
+func TestConfigJSONSchemaGolden(t *testing.T) {
+	got, err := ConfigJSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "config.schema.json")
+	if *updateGolden {
+		if err := os.WriteFile(golden, append(got, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(got, '\n'), want) {
+		t.Errorf("ConfigJSONSchema() differs from %s; regenerate it with -update and review the diff", golden)
+	}
+}
+
+func TestConfigJSONSchemaContents(t *testing.T) {
+	data, err := ConfigJSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("ConfigJSONSchema() is not valid JSON: %v", err)
+	}
+	if schema["$schema"] != "https://json-schema.org/draft/2020-12/schema" {
+		t.Errorf("$schema = %v, want draft 2020-12", schema["$schema"])
+	}
+
+	lookup := func(path ...string) map[string]any {
+		t.Helper()
+		node := schema
+		for _, name := range path {
+			props, _ := node["properties"].(map[string]any)
+			next, ok := props[name].(map[string]any)
+			if !ok {
+				t.Fatalf("schema has no property %s", strings.Join(path, "."))
+			}
+			node = next
+		}
+		return node
+	}
+
+	tests := []struct {
+		path []string
+		key  string
+		want any
+	}{
+		{[]string{"Source", "HostIP"}, "type", "string"},
+		{[]string{"Source", "SSHPort"}, "type", "integer"},
+		{[]string{"RsyncOptions", "Delete"}, "type", "boolean"},
+		{[]string{"RsyncOptions", "Exclude"}, "type", "array"},
+		{[]string{"RsyncOptions", "StallTimeout"}, "type", "integer"},
+		{[]string{"RsyncOptions", "ChecksumAlgorithm"}, "enum", []any{"", "sha256", "sha1", "md5", "xxh64"}},
+		{[]string{"WorkflowOptions", "RedactionMode"}, "enum", []any{"", "none", "shareable"}},
+		{nil, "required", []any{"Source", "Destination"}},
+		{[]string{"Source"}, "required", []any{"DataPath"}},
+		{[]string{"Source"}, "additionalProperties", false},
+	}
+	for _, tt := range tests {
+		if got := lookup(tt.path...)[tt.key]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %s = %v, want %v", strings.Join(tt.path, "."), tt.key, got, tt.want)
+		}
+	}
+
+	// Callbacks and interfaces set from code have no JSON form
+	for _, name := range []string{"OnProgress", "OnFile", "CommandRunner"} {
+		if _, ok := lookup("RsyncOptions")["properties"].(map[string]any)[name]; ok {
+			t.Errorf("schema includes RsyncOptions.%s", name)
+		}
+	}
+}
+
+func TestSchemaFieldDescriptionFromTag(t *testing.T) {
+	type described struct {
+		Name string `desc:"Name of the thing"`
+		Size int
+	}
+	props := schemaForType(reflect.TypeOf(described{}))["properties"].(map[string]any)
+	if got := props["Name"].(map[string]any)["description"]; got != "Name of the thing" {
+		t.Errorf("Name description = %v, want the desc tag", got)
+	}
+	if _, ok := props["Size"].(map[string]any)["description"]; ok {
+		t.Error("Size has a description without a desc tag")
+	}
+}
+
+func TestLoadConfigValidateSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     []string // Substrings of the error; none means the document loads
+	}{
+		{
+			name:     "valid",
+			document: `{"Source": {"DataPath": "/src"}, "Destination": {"DataPath": "/dst"}}`,
+		},
+		{
+			name:     "case-insensitive names",
+			document: `{"source": {"dataPath": "/src"}, "destination": {"datapath": "/dst"}}`,
+		},
+		{
+			name:     "unknown property",
+			document: `{"Source": {"DataPath": "/src", "Pth": "/x"}, "Destination": {"DataPath": "/dst"}}`,
+			want:     []string{"$.Source: unknown property 'Pth'"},
+		},
+		{
+			name:     "type mismatch",
+			document: `{"Source": {"DataPath": "/src", "SSHPort": "22"}, "Destination": {"DataPath": "/dst"}, "RsyncOptions": {"Delete": 1}}`,
+			want:     []string{"$.Source.SSHPort: expected integer", "$.RsyncOptions.Delete: expected boolean"},
+		},
+		{
+			name:     "enum",
+			document: `{"Source": {"DataPath": "/src"}, "Destination": {"DataPath": "/dst"}, "RsyncOptions": {"ChecksumAlgorithm": "crc32"}}`,
+			want:     []string{"$.RsyncOptions.ChecksumAlgorithm: 'crc32' is not one of"},
+		},
+		{
+			name:     "array items",
+			document: `{"Source": {"DataPath": "/src"}, "Destination": {"DataPath": "/dst"}, "RsyncOptions": {"Exclude": ["*.tmp", 3]}}`,
+			want:     []string{"$.RsyncOptions.Exclude[1]: expected string"},
+		},
+		{
+			name:     "missing required",
+			document: `{"Source": {"HostIP": "10.0.0.1"}}`,
+			want:     []string{"$: missing required property 'Destination'", "$.Source: missing required property 'DataPath'"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.document), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadConfig(path, LoadOption{ValidateSchema: true})
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("LoadConfig() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("LoadConfig() succeeded, want schema violations")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("LoadConfig() error = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+// Without ValidateSchema, unknown properties are ignored as before.
+func TestLoadConfigWithoutSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	document := `{"Source": {"DataPath": "/src", "Pth": "/x"}, "Destination": {"DataPath": "/dst"}}`
+	if err := os.WriteFile(path, []byte(document), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path, LoadOption{}); err != nil {
+		t.Errorf("LoadConfig() error = %v", err)
+	}
+}
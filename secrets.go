@@ -0,0 +1,160 @@
+package transx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// secretRefPattern matches a secret reference ("secret://<name>") in a command.
+var secretRefPattern = regexp.MustCompile(`secret://([A-Za-z0-9._-]+)`)
+
+// SecretsProvider resolves the secret references ("secret://<name>") in the endpoint commands
+// (BackupCmd, PreTransferCmd, RestoreCmd, and HealthCmd), e.g., "mysqldump --password=secret://db-pass",
+// so that passwords and passphrases are kept out of the configuration (see WorkflowOption.SecretsProvider).
+// References are resolved just before the command runs and replaced by the shell-quoted value, so they
+// must not be quoted in the command. The value is never stored in the task and is redacted from the
+// command output, the errors, and the audit trail.
+// Get returns the value of the secret named ref.
+type SecretsProvider interface {
+	Get(ctx context.Context, ref string) (string, error)
+}
+
+// SecretsProviderFunc adapts a function to the SecretsProvider interface.
+type SecretsProviderFunc func(ctx context.Context, ref string) (string, error)
+
+// Get calls f(ctx, ref).
+func (f SecretsProviderFunc) Get(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+// EnvSecretsProvider reads secrets from environment variables named Prefix followed by the upper-cased
+// reference with each character other than a letter or digit replaced by "_", e.g., "db-ssh-pass" from
+// TRANSX_SECRET_DB_SSH_PASS with the default prefix.
+type EnvSecretsProvider struct {
+	Prefix string // Prefix of the variable names (empty uses "TRANSX_SECRET_")
+}
+
+// Get returns the value of the environment variable of the reference.
+func (p EnvSecretsProvider) Get(_ context.Context, ref string) (string, error) {
+	prefix := p.Prefix
+	if prefix == "" {
+		prefix = "TRANSX_SECRET_"
+	}
+	name := prefix + strings.Map(func(r rune) rune {
+		if ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		if 'a' <= r && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, ref)
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// FileSecretsProvider reads each secret from the file named like the reference in Dir (e.g., a
+// mounted Kubernetes or Docker secret), without the trailing newline.
+type FileSecretsProvider struct {
+	Dir string
+}
+
+// Get returns the content of the file of the reference.
+func (p FileSecretsProvider) Get(_ context.Context, ref string) (string, error) {
+	if ref == "" || ref == "." || ref == ".." || strings.ContainsAny(ref, `/\`) {
+		return "", fmt.Errorf("invalid secret reference '%s'", ref)
+	}
+	data, err := os.ReadFile(filepath.Join(p.Dir, ref))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveSecretRefs replaces the secret references in the command with their shell-quoted values from
+// the provider, and returns the command with the values, which is only to be executed, and the values
+// (raw and quoted), which are to be redacted from anything derived from it.
+func resolveSecretRefs(ctx context.Context, provider SecretsProvider, command string) (string, []string, error) {
+	refs := secretRefPattern.FindAllStringSubmatch(command, -1)
+	if len(refs) == 0 {
+		return command, nil, nil
+	}
+	if provider == nil {
+		return "", nil, fmt.Errorf("the command references secret '%s', but no SecretsProvider is set", refs[0][1])
+	}
+
+	values := make(map[string]string, len(refs))
+	var secrets []string
+	for _, ref := range refs {
+		if _, ok := values[ref[1]]; ok {
+			continue
+		}
+		value, err := provider.Get(ctx, ref[1])
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to resolve secret '%s': %w", ref[1], err)
+		}
+		values[ref[1]] = shellQuote(value)
+		if value != "" {
+			secrets = append(secrets, value, values[ref[1]])
+		}
+	}
+	resolved := secretRefPattern.ReplaceAllStringFunc(command, func(ref string) string {
+		return values[strings.TrimPrefix(ref, "secret://")]
+	})
+	return resolved, secrets, nil
+}
+
+// hideSecrets replaces each of the secret values in text with "<redacted>", the quoted forms first.
+func hideSecrets(text string, secrets []string) string {
+	for i := len(secrets) - 1; i >= 0; i-- {
+		secret := secrets[i]
+		text = strings.ReplaceAll(text, secret, "<redacted>")
+	}
+	return text
+}
+
+// plaintextSecrets returns the descriptions of the commands of the task that contain a secret
+// matched by secretPatterns (e.g., "password=...") that is not a secret reference.
+func (task *DataMigrationModel) plaintextSecrets() []string {
+	commands := []struct{ name, command string }{
+		{"Source.BackupCmd", task.Source.BackupCmd},
+		{"Source.HealthCmd", task.Source.HealthCmd},
+		{"Destination.PreTransferCmd", task.Destination.PreTransferCmd},
+		{"Destination.RestoreCmd", task.Destination.RestoreCmd},
+		{"Destination.HealthCmd", task.Destination.HealthCmd},
+	}
+	var found []string
+	for _, c := range commands {
+		if containsPlaintextSecret(c.command) {
+			found = append(found, c.name)
+		}
+	}
+	return found
+}
+
+// containsPlaintextSecret reports whether the command contains a secret matched by secretPatterns
+// whose value is not a secret reference.
+func containsPlaintextSecret(command string) bool {
+	for _, pattern := range secretPatterns {
+		for _, m := range pattern.FindAllStringSubmatchIndex(command, -1) {
+			if strings.HasPrefix(command[m[0]:m[1]], "secret://") {
+				continue // The reference itself
+			}
+			end := m[1]
+			if len(m) > 4 && m[4] >= 0 {
+				end = m[4] // Before the part after the secret
+			}
+			if value := strings.Trim(command[m[3]:end], `"'`); !strings.HasPrefix(value, "secret://") {
+				return true
+			}
+		}
+	}
+	return false
+}
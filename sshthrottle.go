@@ -0,0 +1,105 @@
+package transx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+const (
+	// sshThrottleAttempts is the number of connection attempts of a remote command refused by sshd's
+	// MaxStartups throttling. The command never ran on a refused connection, so retrying it is safe.
+	sshThrottleAttempts = 4
+
+	// sshControlPath is the ControlPath of the multiplexed connections (see RsyncOption.SSHMultiplexing).
+	// %C is a hash of the connection parameters, which keeps the path within the socket length limit.
+	sshControlPath = "/tmp/transx-ssh-%C"
+)
+
+// sshThrottleSignatures are the messages of ssh when sshd closes a connection before the protocol
+// exchange, as it does when MaxStartups unauthenticated connections are pending.
+var sshThrottleSignatures = []string{
+	"exchange_identification: Connection closed",              // "ssh_exchange_identification:" before OpenSSH 8.0, "kex_exchange_identification:" since
+	"exchange_identification: read: Connection reset by peer", // The same with the connection reset instead of closed
+}
+
+// sshThrottled reports whether output contains the signature of a connection refused by sshd's
+// MaxStartups throttling.
+func sshThrottled(output string) bool {
+	for _, signature := range sshThrottleSignatures {
+		if strings.Contains(output, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSSHThrottled reports whether err is a command failure caused by sshd refusing the connection
+// under its MaxStartups throttling (typically from many concurrent connections to the same host).
+// Such failures are transient, so IsRetryableError treats them as retryable.
+func IsSSHThrottled(err error) bool {
+	if err == nil {
+		return false
+	}
+	var opErr *OperationError
+	if errors.As(err, &opErr) && sshThrottled(opErr.Output) {
+		return true
+	}
+	return sshThrottled(err.Error())
+}
+
+// jitter returns a random duration between half and one and a half times d, so that the retries of
+// concurrent tasks throttled at the same time do not hit the host at the same time again.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return d/2 + rand.N(d)
+}
+
+// reportSSHThrottle warns that sshd on the host (empty if not known) refused a connection under its
+// MaxStartups throttling and notifies the workflow.
+func (o RsyncOption) reportSSHThrottle(host string) {
+	on := ""
+	if host != "" {
+		on = " on " + host
+	}
+	fmt.Printf("Warning: sshd%s refused a connection (MaxStartups throttling); lower the concurrency or raise MaxStartups\n", on)
+	if o.onSSHThrottled != nil {
+		o.onSSHThrottled()
+	}
+}
+
+// retry runs fn with the Retry policy, reporting the attempts refused by sshd's MaxStartups throttling.
+func (o RsyncOption) retry(ctx context.Context, operation string, fn func() error) error {
+	return o.Retry.run(ctx, operation, func() error {
+		err := fn()
+		if IsSSHThrottled(err) {
+			o.reportSSHThrottle("")
+		}
+		return err
+	})
+}
+
+// waitSSHThrottle waits before the next connection attempt of a throttled remote command, with a
+// jittered backoff doubling from 1 second. It returns false if ctx is canceled first.
+func waitSSHThrottle(ctx context.Context, attempt int) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(jitter(time.Second << (attempt - 1))):
+		return true
+	}
+}
+
+// sshMultiplexingArgs returns the ssh options sharing one connection per host between the ssh
+// commands and rsync, if RsyncOption.SSHMultiplexing is set.
+func sshMultiplexingArgs(opts RsyncOption) []string {
+	if !opts.SSHMultiplexing {
+		return nil
+	}
+	return []string{"-o", "ControlMaster=auto", "-o", "ControlPath=" + sshControlPath, "-o", "ControlPersist=60"}
+}
@@ -0,0 +1,83 @@
+package transx
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// StallError is returned when an rsync transfer produced no output for RsyncOption.StallTimeout
+// and was killed.
+type StallError struct {
+	Leg     RelayLeg      // Relay leg that stalled ("" for direct transfers)
+	Timeout time.Duration // Time without output after which the process was killed
+}
+
+func (e *StallError) Error() string {
+	if e.Leg != "" {
+		return fmt.Sprintf("relay %s leg produced no output for %s and was killed (stalled)", e.Leg, e.Timeout)
+	}
+	return fmt.Sprintf("rsync produced no output for %s and was killed (stalled)", e.Timeout)
+}
+
+// activityWriter passes writes through to w and records when the last one happened.
+type activityWriter struct {
+	w    io.Writer
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (a *activityWriter) Write(p []byte) (int, error) {
+	a.mu.Lock()
+	a.last = time.Now()
+	a.mu.Unlock()
+	return a.w.Write(p)
+}
+
+// idle returns how long ago the last write happened.
+func (a *activityWriter) idle() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return time.Since(a.last)
+}
+
+// stallWatchdog kills a command that writes nothing to its activityWriter for timeout.
+type stallWatchdog struct {
+	stop    chan struct{}
+	done    chan struct{}
+	stalled bool // Set before done is closed
+}
+
+// watchStall starts cmd's watchdog, which kills the process group of the started cmd
+// (see setProcessGroup) once output has been idle for timeout.
+func watchStall(cmd *exec.Cmd, output *activityWriter, timeout time.Duration) *stallWatchdog {
+	w := &stallWatchdog{stop: make(chan struct{}), done: make(chan struct{})}
+	interval := min(timeout/4, time.Second)
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				if output.idle() >= timeout {
+					w.stalled = true
+					killProcessGroup(cmd)
+					return
+				}
+			}
+		}
+	}()
+	return w
+}
+
+// finish stops the watchdog and reports whether it killed the command.
+func (w *stallWatchdog) finish() bool {
+	close(w.stop)
+	<-w.done
+	return w.stalled
+}
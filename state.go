@@ -0,0 +1,196 @@
+package transx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// migrationState is the content of the state file of a restartable migration
+// (WorkflowOption.StateFile). It records the stages completed so far, so that a re-invocation
+// of MigrateData with the same task resumes after them.
+type migrationState struct {
+	ConfigHash  string    // Hash of the task the state belongs to
+	Completed   []Stage   // Stages completed successfully, in execution order
+	StagingPath string    // Relay staging directory created for the migration (kept until it succeeds)
+	UpdatedAt   time.Time // Time the state file was last written
+
+	path string
+}
+
+// configHash returns a hash identifying the configuration of the task. The state file path
+// itself, the actor, and the options that only control output and observability (e.g., Verbose,
+// Progress, PrintSummary) are excluded, so moving the state file, resuming as another operator,
+// or debugging a rerun does not invalidate it. Exclude and Include patterns are sorted and
+// deduplicated, which keeps their meaning since all excludes precede all includes (see buildRsyncArgs).
+func configHash(task DataMigrationModel) (string, error) {
+	task.WorkflowOptions.StateFile = ""
+	task.Actor = ""
+	task.RsyncOptions.Verbose = false
+	task.RsyncOptions.Progress = false
+	task.WorkflowOptions.PrintSummary = false
+	task.WorkflowOptions.StatusSocket = ""
+	task.WorkflowOptions.RecordFile = ""
+	task.WorkflowOptions.ReportHistoryDir = ""
+	task.WorkflowOptions.AnomalyThresholds = AnomalyThresholds{}
+	task.WorkflowOptions.BypassProbeCache = false
+	task.WorkflowOptions.StreamCommandOutput = false
+	task.WorkflowOptions.DirectoryStats = DirectoryStatsOption{}
+	task.WorkflowOptions.RedactionMode = ""
+	task.RsyncOptions.Exclude = normalizedPatterns(task.RsyncOptions.Exclude)
+	task.RsyncOptions.Include = normalizedPatterns(task.RsyncOptions.Include)
+	data, err := json.Marshal(task)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Hash returns a stable hash of the configuration of the task, e.g., to detect configuration drift
+// between scheduled runs or to key caches and state files by configuration identity. Options that only
+// control output and observability are ignored, and semantically equal Exclude and Include lists hash
+// equally regardless of their order (see configHash). It returns "" if the task cannot be encoded
+// (e.g., a NaN rate limit).
+func (task *DataMigrationModel) Hash() string {
+	hash, err := configHash(*task)
+	if err != nil {
+		return ""
+	}
+	return hash
+}
+
+// normalizedPatterns returns the non-blank patterns sorted and without duplicates.
+func normalizedPatterns(patterns []string) []string {
+	normalized := slices.DeleteFunc(slices.Clone(patterns), func(p string) bool { return strings.TrimSpace(p) == "" })
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// loadMigrationState reads the state file at path, or returns an empty state if it does not exist.
+// A state file written for a different configuration is rejected, since skipping stages based on
+// it could leave the destination inconsistent.
+func loadMigrationState(path string, task DataMigrationModel) (*migrationState, error) {
+	hash, err := configHash(task)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash the migration configuration: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &migrationState{ConfigHash: hash, path: path}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	state := &migrationState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file '%s': %w", path, err)
+	}
+	if state.ConfigHash != hash {
+		return nil, fmt.Errorf("state file '%s' was written for a different configuration; remove it to start over", path)
+	}
+	state.path = path
+	return state, nil
+}
+
+// completed reports whether the stage was completed by a previous run. A nil state has no completed stages.
+func (s *migrationState) completed(stage Stage) bool {
+	return s != nil && slices.Contains(s.Completed, stage)
+}
+
+// markCompleted records the stage as completed and persists the state.
+func (s *migrationState) markCompleted(stage Stage) error {
+	if s == nil || s.completed(stage) {
+		return nil
+	}
+	s.Completed = append(s.Completed, stage)
+	return s.save()
+}
+
+// save writes the state file atomically (via a temporary file in the same directory).
+func (s *migrationState) save() error {
+	s.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".transx-state-*")
+	if err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, s.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+// prepareStaging points a relay task at the staging directory recorded in the state, creating and
+// recording one on the first run, so that a resumed transfer reuses the data already staged.
+// A StagingDir set by the caller is used as is.
+func (s *migrationState) prepareStaging(task *DataMigrationModel) error {
+	if task.Topology() != RemoteToRemoteRelay || strings.TrimSpace(task.RsyncOptions.StagingDir) != "" {
+		return nil
+	}
+	if s.StagingPath == "" {
+		dir, _, err := relayStagingDir(task.RsyncOptions)
+		if err != nil {
+			return err
+		}
+		s.StagingPath = dir
+		if err := s.save(); err != nil {
+			removeRelayStagingDir(task.RsyncOptions, dir) // Best effort; the save error is reported
+			s.StagingPath = ""
+			return err
+		}
+	}
+	task.RsyncOptions.StagingDir = s.StagingPath
+	return nil
+}
+
+// finish removes the state file and the staging directory it owns once the migration succeeded.
+func (s *migrationState) finish(opts RsyncOption) {
+	if s.StagingPath != "" && !opts.KeepStaging {
+		if err := removeRelayStagingDir(opts, s.StagingPath); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("Warning: failed to remove state file %s: %v\n", s.path, err)
+	}
+}
+
+// skipCompleted reports whether the stage was completed by a previous run, announcing that it is skipped.
+func skipCompleted(state *migrationState, stage Stage) bool {
+	if !state.completed(stage) {
+		return false
+	}
+	fmt.Printf("Skipping %s stage (completed in a previous run)\n", stage)
+	return true
+}
+
+// joinStages returns the stages as a comma-separated list.
+func joinStages(stages []Stage) string {
+	names := make([]string, len(stages))
+	for i, stage := range stages {
+		names[i] = string(stage)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,236 @@
+package transx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TransferResult holds the statistics of an rsync transfer, parsed from its --stats output.
+type TransferResult struct {
+	TotalFileCount   int64         // Number of files considered (files, directories, links, etc.)
+	DirectoryCount   int64         // Number of directories among the considered files (rsync 3.1+)
+	FilesTransferred int64         // Number of regular files transferred
+	TotalFileSize    int64         // Total size of all considered files in bytes
+	BytesTransferred int64         // Total size of the transferred files in bytes
+	BytesSent        int64         // Bytes sent over the wire by rsync
+	BytesReceived    int64         // Bytes received over the wire by rsync
+	LiteralBytes     int64         // Bytes that had to be sent as literal data
+	MatchedBytes     int64         // Bytes reconstructed from matching blocks already on the receiver
+	Speedup          float64       // rsync's speedup factor (total size / bytes sent and received)
+	Duration         time.Duration // Wall-clock duration of the transfer
+	Usage            *ProcessUsage // Resource usage of the processes of the transfer (nil if none ran)
+
+	// Download and Upload hold the statistics of each leg in relay mode (nil otherwise).
+	Download *TransferResult
+	Upload   *TransferResult
+
+	// SourceFilesRemoved is the number of files removed from the source with RemoveSourceFiles.
+	SourceFilesRemoved int64
+
+	// RelayStagingPath is the local staging directory used in relay mode (empty otherwise).
+	// It no longer exists after the transfer unless RsyncOption.KeepStaging is set.
+	RelayStagingPath string
+
+	// Directories breaks down the files sent by directory, if WorkflowOption.DirectoryStats is enabled
+	// (in relay mode, those of the upload leg).
+	Directories *DirectoryStats
+
+	files []string // Regular files sent, if logged for the sampled verification
+}
+
+// largeTransferBytes is the transferred size above which tuning hints are printed.
+const largeTransferBytes = 1 << 30 // 1 GiB
+
+// parseRsyncStats extracts the transfer statistics from rsync's --stats output.
+// Lines that cannot be parsed are ignored, so a partial result is returned for unknown formats.
+// Both the rsync 3.0.x ("Number of files transferred") and the rsync 3.1+ ("Number of regular
+// files transferred") wording are supported, with the digit grouping of any locale.
+func parseRsyncStats(output string) *TransferResult {
+	result := &TransferResult{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		// e.g., "total size is 123,456  speedup is 9.42"
+		if _, speedup, found := strings.Cut(line, "speedup is "); found {
+			fields := strings.Fields(speedup)
+			if len(fields) > 0 {
+				result.Speedup = parseStatDecimal(fields[0])
+			}
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		switch key {
+		case "Number of files":
+			result.TotalFileCount = parseStatNumber(value)
+			result.DirectoryCount = parseStatBreakdown(value, "dir")
+		case "Number of regular files transferred", "Number of files transferred":
+			result.FilesTransferred = parseStatNumber(value)
+		case "Total file size":
+			result.TotalFileSize = parseStatNumber(value)
+		case "Total transferred file size":
+			result.BytesTransferred = parseStatNumber(value)
+		case "Total bytes sent":
+			result.BytesSent = parseStatNumber(value)
+		case "Total bytes received":
+			result.BytesReceived = parseStatNumber(value)
+		case "Literal data":
+			result.LiteralBytes = parseStatNumber(value)
+		case "Matched data":
+			result.MatchedBytes = parseStatNumber(value)
+		}
+	}
+	return result
+}
+
+// statDigitSeparators removes the digit grouping of rsync statistics, which follows the locale
+// (e.g., "1,234,567", "1.234.567", or "1'234'567"); rsync 3.0.x prints no grouping.
+var statDigitSeparators = strings.NewReplacer(",", "", ".", "", "'", "")
+
+// parseStatNumber parses the leading number of an rsync statistic value such as
+// " 1,234 (reg: 1,000, dir: 234)" or " 12,345 bytes". It returns 0 if no number is found.
+func parseStatNumber(value string) int64 {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0
+	}
+	n, err := strconv.ParseInt(statDigitSeparators.Replace(fields[0]), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// parseStatDecimal parses a decimal rsync statistic printed with two decimals, such as the speedup,
+// whose separators follow the locale (e.g., "1,234.56" or "1.234,56"). It returns 0 if it is not a number.
+func parseStatDecimal(value string) float64 {
+	if i := len(value) - 3; i > 0 && (value[i] == '.' || value[i] == ',') {
+		value = statDigitSeparators.Replace(value[:i]) + "." + value[i+1:]
+	} else {
+		value = statDigitSeparators.Replace(value)
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// parseStatBreakdown extracts a count from the parenthesized breakdown of an rsync statistic,
+// e.g., the "dir" count of " 1,234 (reg: 1,000, dir: 234)". It returns 0 if the key is not present.
+func parseStatBreakdown(value, key string) int64 {
+	_, breakdown, found := strings.Cut(value, "(")
+	if !found {
+		return 0
+	}
+	breakdown = strings.TrimSuffix(strings.TrimSpace(breakdown), ")")
+	for _, part := range strings.Split(breakdown, ", ") {
+		k, v, found := strings.Cut(part, ":")
+		if found && strings.TrimSpace(k) == key {
+			return parseStatNumber(v)
+		}
+	}
+	return 0
+}
+
+// TransferStats is a flat summary of a transfer for metrics (see TransferWithStats). In relay mode,
+// FilesTransferred and TotalBytes are those that reached the destination (the upload leg), while
+// LiteralBytes and SpeedupRatio cover the traffic of both legs.
+type TransferStats struct {
+	FilesTransferred int           // Number of regular files transferred
+	TotalBytes       int64         // Total size of the transferred files in bytes
+	LiteralBytes     int64         // Bytes that had to be sent as literal data
+	SpeedupRatio     float64       // Total size of the considered files / bytes sent and received
+	Duration         time.Duration // Wall-clock duration of the transfer
+}
+
+// Stats returns the summary of the result, aggregating the legs in relay mode.
+func (r *TransferResult) Stats() TransferStats {
+	if r == nil {
+		return TransferStats{}
+	}
+	stats := TransferStats{
+		FilesTransferred: int(r.FilesTransferred),
+		TotalBytes:       r.BytesTransferred,
+		LiteralBytes:     r.LiteralBytes,
+		SpeedupRatio:     r.Speedup,
+		Duration:         r.Duration,
+	}
+	if r.Upload == nil {
+		return stats
+	}
+	// The download leg is nil or empty if the relay resumed from staged data
+	wire := r.Upload.BytesSent + r.Upload.BytesReceived
+	if r.Download != nil {
+		stats.LiteralBytes += r.Download.LiteralBytes
+		wire += r.Download.BytesSent + r.Download.BytesReceived
+	}
+	if wire > 0 {
+		stats.SpeedupRatio = float64(r.TotalFileSize) / float64(wire)
+	}
+	return stats
+}
+
+// Throughput returns the transferred bytes per second over the duration of the transfer,
+// or 0 if the duration is unknown. In relay mode, compare Download.Throughput (source read)
+// with Upload.Throughput (destination write) to find the slower link.
+func (r *TransferResult) Throughput() float64 {
+	if r == nil || r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.BytesTransferred) / r.Duration.Seconds()
+}
+
+// throughputSummary formats the transferred size, duration, and throughput of a transfer
+// (e.g., "1073741824 bytes in 12.3s (83.2 MiB/s)").
+func (r *TransferResult) throughputSummary() string {
+	return fmt.Sprintf("%d bytes in %s (%.1f MiB/s)", r.BytesTransferred, r.Duration.Round(100*time.Millisecond), r.Throughput()/(1<<20))
+}
+
+// nonDirectoryCount returns the number of considered entries that are not directories.
+func (r *TransferResult) nonDirectoryCount() int64 {
+	return r.TotalFileCount - r.DirectoryCount
+}
+
+// add accumulates the counters of other into r. Durations are not summed, since
+// partial transfers may run concurrently.
+func (r *TransferResult) add(other *TransferResult) {
+	r.TotalFileCount += other.TotalFileCount
+	r.DirectoryCount += other.DirectoryCount
+	r.SourceFilesRemoved += other.SourceFilesRemoved
+	r.FilesTransferred += other.FilesTransferred
+	r.TotalFileSize += other.TotalFileSize
+	r.BytesTransferred += other.BytesTransferred
+	r.BytesSent += other.BytesSent
+	r.BytesReceived += other.BytesReceived
+	r.LiteralBytes += other.LiteralBytes
+	r.MatchedBytes += other.MatchedBytes
+	if total := r.BytesSent + r.BytesReceived; total > 0 {
+		r.Speedup = float64(r.TotalFileSize) / float64(total)
+	}
+}
+
+// tuningHints returns suggestions derived from the delta-transfer statistics of a large transfer.
+func tuningHints(r *TransferResult, opts RsyncOption) []string {
+	if r == nil || r.BytesTransferred < largeTransferBytes {
+		return nil
+	}
+	var hints []string
+	if !opts.WholeFile && r.Speedup > 0 && r.Speedup < 1.1 {
+		hints = append(hints, fmt.Sprintf("speedup is %.2f, so the delta algorithm is not helping; consider WholeFile to skip checksum computation", r.Speedup))
+	}
+	if total := r.LiteralBytes + r.MatchedBytes; total > 0 && float64(r.MatchedBytes)/float64(total) > 0.9 {
+		hints = append(hints, fmt.Sprintf("%.0f%% of the data was matched on the receiver, so the transfer was mostly unnecessary", 100*float64(r.MatchedBytes)/float64(total)))
+	}
+	return hints
+}
+
+// printTuningHints prints the tuning hints of a transfer result, prefixed with label.
+func printTuningHints(label string, r *TransferResult, opts RsyncOption) {
+	for _, hint := range tuningHints(r, opts) {
+		fmt.Printf("Hint: %s: %s\n", label, hint)
+	}
+}
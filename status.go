@@ -0,0 +1,280 @@
+package transx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Status event types.
+const (
+	StatusEventStageStart = "stage-start"
+	StatusEventStageEnd   = "stage-end"
+	StatusEventProgress   = "progress"
+	StatusEventWarning    = "warning"
+	StatusEventRateLimit  = "rate-limit"
+	StatusEventFinish     = "finish"
+)
+
+// StatusSnapshot is the current state of a running migration, served as JSON by GET /status
+// on the status socket (see WorkflowOption.StatusSocket).
+type StatusSnapshot struct {
+	Stage            Stage    // Stage currently running ("" between stages)
+	Leg              RelayLeg // Relay leg of the latest progress, if any
+	Percent          float64  // Completion of the current transfer (0-100)
+	BytesTransferred int64
+	Rate             string // Current transfer rate as reported by rsync
+	ETA              string // Estimated remaining time of the current transfer
+	Warnings         []string
+	StartTime        time.Time
+	Done             bool
+	Success          bool
+	Error            string
+}
+
+// StatusEvent is a migration event, streamed as NDJSON by GET /events on the status socket.
+type StatusEvent struct {
+	Time     time.Time
+	Type     string // One of the StatusEvent* constants
+	Stage    Stage
+	Success  bool           // Outcome of a stage-end or finish event
+	Error    string         // Error of a failed stage-end or finish event
+	Message  string         // Text of a warning or rate-limit event
+	Progress *ProgressEvent // Snapshot of a progress event
+}
+
+// statusSubscriberBuffer is the number of events buffered per /events client; a client that
+// falls further behind misses events rather than slowing down the migration.
+const statusSubscriberBuffer = 256
+
+// statusMonitor tracks the state of a running migration and fans its events out to subscribers.
+// All methods are safe on a nil monitor, which ignores the events.
+type statusMonitor struct {
+	mu          sync.Mutex
+	snapshot    StatusSnapshot
+	subscribers map[chan StatusEvent]struct{}
+	cancel      context.CancelFunc // Cancels the migration's context
+}
+
+// newStatusMonitor creates a monitor for a migration started at startTime.
+func newStatusMonitor(startTime time.Time, cancel context.CancelFunc) *statusMonitor {
+	return &statusMonitor{
+		snapshot:    StatusSnapshot{StartTime: startTime},
+		subscribers: make(map[chan StatusEvent]struct{}),
+		cancel:      cancel,
+	}
+}
+
+// publish updates the snapshot and delivers the event to all subscribers without blocking.
+func (m *statusMonitor) publish(event StatusEvent, update func(*StatusSnapshot)) {
+	if m == nil {
+		return
+	}
+	event.Time = time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	update(&m.snapshot)
+	for ch := range m.subscribers {
+		select {
+		case ch <- event:
+		default: // Slow subscriber; drop the event
+		}
+	}
+	if event.Type == StatusEventFinish {
+		for ch := range m.subscribers {
+			close(ch)
+			delete(m.subscribers, ch)
+		}
+	}
+}
+
+func (m *statusMonitor) stageStarted(stage Stage) {
+	m.publish(StatusEvent{Type: StatusEventStageStart, Stage: stage}, func(s *StatusSnapshot) {
+		s.Stage = stage
+		s.Leg, s.Percent, s.BytesTransferred, s.Rate, s.ETA = "", 0, 0, "", ""
+	})
+}
+
+func (m *statusMonitor) stageFinished(stage Stage, err error) {
+	event := StatusEvent{Type: StatusEventStageEnd, Stage: stage, Success: err == nil}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	m.publish(event, func(s *StatusSnapshot) { s.Stage = "" })
+}
+
+func (m *statusMonitor) progress(p ProgressEvent) {
+	m.publish(StatusEvent{Type: StatusEventProgress, Stage: StageTransfer, Progress: &p}, func(s *StatusSnapshot) {
+		s.Leg, s.Percent, s.BytesTransferred, s.Rate, s.ETA = p.Leg, p.Percent, p.BytesTransferred, p.Rate, p.ETA
+	})
+}
+
+func (m *statusMonitor) warning(message string) {
+	m.publish(StatusEvent{Type: StatusEventWarning, Message: message}, func(s *StatusSnapshot) {
+		s.Warnings = append(s.Warnings, message)
+	})
+}
+
+func (m *statusMonitor) rateLimited(message string) {
+	m.publish(StatusEvent{Type: StatusEventRateLimit, Message: message}, func(*StatusSnapshot) {})
+}
+
+func (m *statusMonitor) finished(err error) {
+	event := StatusEvent{Type: StatusEventFinish, Success: err == nil}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	m.publish(event, func(s *StatusSnapshot) {
+		s.Stage, s.Done, s.Success, s.Error = "", true, event.Success, event.Error
+	})
+}
+
+// current returns a copy of the snapshot.
+func (m *statusMonitor) current() StatusSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := m.snapshot
+	snapshot.Warnings = append([]string(nil), m.snapshot.Warnings...)
+	return snapshot
+}
+
+// subscribe registers a subscriber; the channel is closed when the migration finishes.
+// It returns nil if the migration has already finished.
+func (m *statusMonitor) subscribe() chan StatusEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.snapshot.Done {
+		return nil
+	}
+	ch := make(chan StatusEvent, statusSubscriberBuffer)
+	m.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (m *statusMonitor) unsubscribe(ch chan StatusEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.subscribers[ch]; ok {
+		delete(m.subscribers, ch)
+		close(ch)
+	}
+}
+
+// statusServer serves a statusMonitor over HTTP on a Unix domain socket.
+type statusServer struct {
+	path   string
+	server *http.Server
+}
+
+// startStatusServer listens on the Unix socket at path (created with 0600 permissions) and serves:
+//
+//	GET  /status  the current StatusSnapshot as JSON
+//	GET  /events  StatusEvents as NDJSON until the migration finishes
+//	POST /cancel  cancels the migration
+func startStatusServer(path string, monitor *statusMonitor) (*statusServer, error) {
+	listener, err := listenPrivateUnix(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(monitor.current())
+	})
+	mux.HandleFunc("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		ch := monitor.subscribe()
+		if ch == nil {
+			return // Already finished
+		}
+		defer monitor.unsubscribe(ch)
+		flusher, _ := w.(http.Flusher)
+		encoder := json.NewEncoder(w)
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-ch:
+				if !ok {
+					return
+				}
+				if err := encoder.Encode(event); err != nil {
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+		}
+	})
+	mux.HandleFunc("POST /cancel", func(w http.ResponseWriter, r *http.Request) {
+		monitor.cancel()
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	s := &statusServer{path: path, server: &http.Server{Handler: mux}}
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// statusShutdownTimeout bounds how long close waits for /events clients to receive the final events.
+const statusShutdownTimeout = 2 * time.Second
+
+// close stops the server and removes the socket. /events streams end once the migration has
+// finished, so they are given a moment to deliver the final events before being disconnected.
+func (s *statusServer) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), statusShutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.server.Close()
+	}
+	os.Remove(s.path)
+}
+
+// listenPrivateUnix listens on a Unix socket at path that is only accessible by the current user.
+// The socket is created in a private temporary directory, restricted to 0600, and then renamed
+// into place, so it is never reachable with broader permissions. A stale socket left behind by
+// a crashed process is replaced; a socket that still accepts connections is not.
+func listenPrivateUnix(path string) (*net.UnixListener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("status socket path '%s' exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("status socket '%s' is in use by another process", path)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to check status socket path '%s': %w", path, err)
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".transx-status-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory for status socket: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmpPath := filepath.Join(dir, "sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmpPath, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on status socket: %w", err)
+	}
+	listener.SetUnlinkOnClose(false) // The socket is removed at its final path by statusServer.close
+	if err := os.Chmod(tmpPath, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict status socket permissions: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to move status socket to '%s': %w", path, err)
+	}
+	return listener, nil
+}
@@ -0,0 +1,133 @@
+package transx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// validateSymlinks checks the symlink options of the task.
+func (task *DataMigrationModel) validateSymlinks() error {
+	opts := task.RsyncOptions
+	if opts.ResolveSourceSymlink {
+		if task.Source.isContainer() {
+			return fmt.Errorf("ResolveSourceSymlink is not supported with a container source")
+		}
+		if len(task.Source.AdditionalDataPaths) > 0 {
+			return fmt.Errorf("ResolveSourceSymlink cannot be combined with multiple source paths")
+		}
+	}
+	if opts.DestinationSymlinkTarget != "" {
+		target := strings.TrimSpace(opts.DestinationSymlinkTarget)
+		if target == "" {
+			return fmt.Errorf("DestinationSymlinkTarget must not be blank")
+		}
+		if task.Destination.isContainer() {
+			return fmt.Errorf("DestinationSymlinkTarget is not supported with a container destination")
+		}
+		if opts.destinationLink == "" && strings.TrimRight(target, "/") == strings.TrimRight(task.Destination.DataPath, "/") {
+			return fmt.Errorf("DestinationSymlinkTarget must differ from the destination DataPath")
+		}
+	}
+	return nil
+}
+
+// resolveSymlinks applies the symlink options to the task before it runs, and returns the real path
+// of the source DataPath if ResolveSourceSymlink changed it (empty otherwise).
+//
+// With ResolveSourceSymlink, the source DataPath is replaced by its final target (resolved locally, or
+// with "readlink -f" on a remote source), so rsync copies the data instead of the link. For a
+// directory without a trailing slash, the resolved source gets one and the directory name is appended
+// to the destination instead, so the data lands under the name of the link as before.
+//
+// With DestinationSymlinkTarget, the data is transferred to that path, and the destination DataPath
+// is recreated as a symlink to it after the transfer (see createDestinationSymlink).
+// Applying it again to the task is a no-op.
+func (task *DataMigrationModel) resolveSymlinks(ctx context.Context) (string, error) {
+	var resolved string
+	if task.RsyncOptions.ResolveSourceSymlink && !task.RsyncOptions.sourceResolved {
+		task.RsyncOptions.sourceResolved = true
+		source := task.Source.DataPath
+		target, isDir, err := resolveSymlink(ctx, task.Source, task.RsyncOptions, strings.TrimRight(source, "/"))
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve the source '%s': %w", task.Source.displayPath(), err)
+		}
+		switch {
+		case strings.HasSuffix(source, "/"):
+			target += "/"
+		case isDir:
+			// "link" copies a directory named like the link, i.e., the contents of "target/" into "destination/link"
+			task.Destination.DataPath = path.Join(task.Destination.DataPath, path.Base(source))
+			target += "/"
+		}
+		if target != source {
+			fmt.Printf("Resolved source symlink: %s -> %s\n", source, target)
+			task.Source.DataPath = target
+			resolved = target
+		}
+	}
+
+	if target := strings.TrimSpace(task.RsyncOptions.DestinationSymlinkTarget); target != "" && task.RsyncOptions.destinationLink == "" {
+		task.RsyncOptions.destinationLink = strings.TrimRight(task.Destination.DataPath, "/")
+		if strings.HasSuffix(task.Destination.DataPath, "/") && !strings.HasSuffix(target, "/") {
+			target += "/"
+		}
+		fmt.Printf("Destination data goes to %s, linked from %s\n", target, task.RsyncOptions.destinationLink)
+		task.Destination.DataPath = target
+	}
+	return resolved, nil
+}
+
+// resolveSymlink returns the final target of the path on the endpoint, and whether it is a directory.
+func resolveSymlink(ctx context.Context, endpoint EndpointDetails, opts RsyncOption, p string) (target string, isDir bool, err error) {
+	if !endpoint.isRemote() {
+		target, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			return "", false, err
+		}
+		if target, err = filepath.Abs(target); err != nil {
+			return "", false, err
+		}
+		info, err := os.Stat(target)
+		if err != nil {
+			return "", false, err
+		}
+		return target, info.IsDir(), nil
+	}
+
+	quoted := shellQuotePath(p)
+	resolveCmd := fmt.Sprintf(`t=$(readlink -f %s) && [ -e "$t" ] && if [ -d "$t" ]; then echo "d $t"; else echo "f $t"; fi`, quoted)
+	output, err := executeCommandContext(ctx, resolveCmd, endpoint, opts)
+	if err != nil {
+		return "", false, fmt.Errorf("%w\nOutput:\n%s", err, string(output))
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	kind, target, ok := strings.Cut(strings.TrimSpace(lines[len(lines)-1]), " ")
+	if !ok || !path.IsAbs(target) {
+		return "", false, fmt.Errorf("unexpected output of readlink: %q", string(output))
+	}
+	return target, kind == "d", nil
+}
+
+// createDestinationSymlink creates the destination DataPath recorded by resolveSymlinks as a symlink
+// to the DestinationSymlinkTarget the data was transferred to, replacing an existing symlink.
+// An existing file or directory at the path is never replaced.
+func createDestinationSymlink(ctx context.Context, task DataMigrationModel) error {
+	link := task.RsyncOptions.destinationLink
+	if link == "" || task.RsyncOptions.DryRun {
+		return nil
+	}
+	target := strings.TrimRight(task.Destination.DataPath, "/")
+	quotedLink := shellQuotePath(link)
+	linkCmd := fmt.Sprintf(`if [ -e %s ] && [ ! -L %s ]; then echo "not a symlink, not replaced" >&2; exit 1; fi; %s && ln -sfn %s %s`,
+		quotedLink, quotedLink, mkdirCommand(path.Dir(link), task.RsyncOptions.CreateDestDirMode), shellQuotePath(target), quotedLink)
+	output, err := executeCommandContext(ctx, linkCmd, task.Destination, task.RsyncOptions)
+	if err != nil {
+		return fmt.Errorf("failed to link %s to %s on the destination: %w\nOutput:\n%s", link, target, err, string(output))
+	}
+	fmt.Printf("Linked %s -> %s on the destination\n", link, target)
+	return nil
+}
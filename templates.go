@@ -0,0 +1,99 @@
+package transx
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The workflow templates assemble a DataMigrationModel for a common migration shape from a few
+// arguments and return it validated. The rsync options passed in are kept, except that the
+// options the shape depends on are forced (e.g., Archive); the returned model can be adjusted
+// further before it is passed to MigrateData.
+
+// NewDatabaseMigration returns a "dump-transfer-load" migration: backupCmd dumps the database into
+// the source DataPath, the dump is transferred, and restoreCmd loads it on the destination.
+// The destination is never pruned (Delete is off), so dumps of earlier runs are kept.
+func NewDatabaseMigration(source, destination EndpointDetails, backupCmd, restoreCmd string, opts RsyncOption) (DataMigrationModel, error) {
+	if strings.TrimSpace(backupCmd) == "" || strings.TrimSpace(restoreCmd) == "" {
+		return DataMigrationModel{}, fmt.Errorf("database migration requires both a backup and a restore command")
+	}
+	source.BackupCmd = backupCmd
+	destination.RestoreCmd = restoreCmd
+
+	opts.Archive = true
+	opts.Delete = false
+	return newTemplateModel(source, destination, opts)
+}
+
+// ServiceHooks defines the commands that stop and start a stateful service around its data transfer.
+type ServiceHooks struct {
+	SourceStopCmd       string // Stops the service on the source so its data is quiescent (runs as Source.BackupCmd)
+	DestinationStopCmd  string // Stops the service on the destination before the transfer (runs as Destination.PreTransferCmd)
+	DestinationStartCmd string // Starts the service on the destination after the transfer (runs as Destination.RestoreCmd)
+
+	// ReadinessCmd, if set, is polled once per second after DestinationStartCmd until it succeeds;
+	// the restore stage fails if it does not succeed within ReadinessTimeout (0 uses 60 seconds).
+	ReadinessCmd     string
+	ReadinessTimeout time.Duration
+}
+
+// defaultReadinessTimeout is the readiness timeout used when ServiceHooks.ReadinessTimeout is zero.
+const defaultReadinessTimeout = 60 * time.Second
+
+// NewServiceMigration returns a "stop-sync-start" migration of a stateful service: the service is
+// stopped on both endpoints, the destination DataPath is made an exact mirror of the source
+// (Delete is on, guarded by the empty-source check), and the service is started on the destination
+// and, if hooks.ReadinessCmd is set, waited for until it is ready.
+func NewServiceMigration(source, destination EndpointDetails, hooks ServiceHooks, opts RsyncOption) (DataMigrationModel, error) {
+	if strings.TrimSpace(hooks.DestinationStartCmd) == "" {
+		return DataMigrationModel{}, fmt.Errorf("service migration requires a destination start command")
+	}
+	if hooks.ReadinessTimeout < 0 {
+		return DataMigrationModel{}, fmt.Errorf("readiness timeout must not be negative")
+	}
+	source.BackupCmd = hooks.SourceStopCmd
+	destination.PreTransferCmd = hooks.DestinationStopCmd
+	destination.RestoreCmd = hooks.DestinationStartCmd
+	if strings.TrimSpace(hooks.ReadinessCmd) != "" {
+		timeout := hooks.ReadinessTimeout
+		if timeout == 0 {
+			timeout = defaultReadinessTimeout
+		}
+		destination.RestoreCmd = fmt.Sprintf("(%s) && %s", hooks.DestinationStartCmd, readinessCommand(hooks.ReadinessCmd, timeout))
+	}
+
+	opts.Archive = true
+	opts.Delete = true
+	return newTemplateModel(source, destination, opts)
+}
+
+// readinessCommand returns a shell command that runs check once per second until it succeeds,
+// failing once timeout has elapsed.
+func readinessCommand(check string, timeout time.Duration) string {
+	attempts := max(int(timeout.Round(time.Second)/time.Second), 1)
+	return fmt.Sprintf(`i=0; until sh -c %s; do i=$((i+1)); if [ "$i" -ge %d ]; then echo "service not ready after %s" >&2; exit 1; fi; sleep 1; done`,
+		shellQuote(check), attempts, timeout)
+}
+
+// NewMirror returns a plain directory mirror: the destination DataPath is made an exact copy of the
+// source (Archive and Delete are on, guarded by the empty-source check) without any commands.
+func NewMirror(source, destination EndpointDetails, opts RsyncOption) (DataMigrationModel, error) {
+	opts.Archive = true
+	opts.Delete = true
+	return newTemplateModel(source, destination, opts)
+}
+
+// newTemplateModel assembles and validates the model of a workflow template.
+func newTemplateModel(source, destination EndpointDetails, opts RsyncOption) (DataMigrationModel, error) {
+	task := DataMigrationModel{
+		Source:          source,
+		Destination:     destination,
+		RsyncOptions:    opts,
+		WorkflowOptions: WorkflowOption{PrintSummary: true},
+	}
+	if err := Validate(task); err != nil {
+		return DataMigrationModel{}, fmt.Errorf("invalid migration template: %w", err)
+	}
+	return task, nil
+}
@@ -0,0 +1,281 @@
+package transx
+
+import (
+	"context"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixtureRunner is a CommandRunner for end-to-end tests against local fixtures: shell commands run
+// for real, and rsync is emulated by copying the source tree (honoring --exclude and --delete), as
+// the test machines do not have rsync installed.
+type fixtureRunner struct {
+	t      *testing.T
+	rsyncs [][]string
+}
+
+func (r *fixtureRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if filepath.Base(name) != "rsync" {
+		return ExecRunner{}.Run(ctx, name, args...)
+	}
+	r.rsyncs = append(r.rsyncs, args)
+	if slices.Contains(args, "--version") {
+		return []byte("rsync  version 3.2.7  protocol version 31\n"), nil
+	}
+	if slices.Contains(args, "-n") || slices.Contains(args, "--dry-run") {
+		return nil, nil
+	}
+
+	var excludes []string
+	for _, arg := range args {
+		if p, ok := strings.CutPrefix(arg, "--exclude="); ok {
+			excludes = append(excludes, p)
+		}
+	}
+	excluded := func(rel string) bool {
+		for _, p := range excludes {
+			if ok, _ := filepath.Match(p, filepath.Base(rel)); ok {
+				return true
+			}
+		}
+		return false
+	}
+	src, dst := strings.TrimSuffix(args[len(args)-2], "/"), args[len(args)-1]
+
+	kept := map[string]bool{}
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		if rel != "." && excluded(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		kept[rel] = true
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+	if err == nil && slices.Contains(args, "--delete") {
+		err = filepath.WalkDir(dst, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(dst, path)
+			if kept[rel] || excluded(rel) {
+				return nil
+			}
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		r.t.Errorf("emulated rsync %q: %v", args, err)
+		return []byte(err.Error()), exitError(23)
+	}
+	return []byte("sent 1 bytes  received 1 bytes\n"), nil
+}
+
+// writeFixture creates the files of a fixture directory, mapping relative paths to contents.
+func writeFixture(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readFixture returns the contents of the regular files in dir, keyed by relative path.
+func readFixture(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		rel, _ := filepath.Rel(dir, path)
+		files[rel] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestNewDatabaseMigrationEndToEnd(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src")+"/", filepath.Join(root, "dst")+"/"
+	writeFixture(t, dst, map[string]string{"old.sql": "earlier dump\n"})
+	db := filepath.Join(root, "db.txt")
+	writeFixture(t, root, map[string]string{"db.txt": "rows\n"})
+	runner := &fixtureRunner{t: t}
+
+	dmm, err := NewDatabaseMigration(
+		EndpointDetails{DataPath: src},
+		EndpointDetails{DataPath: dst},
+		"mkdir -p "+src+" && cp "+db+" "+src+"dump.sql",
+		"cat "+dst+"dump.sql > "+filepath.Join(root, "restored.txt"),
+		RsyncOption{Delete: true, CommandRunner: runner}, // Delete is forced off
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dmm.RsyncOptions.Archive || dmm.RsyncOptions.Delete {
+		t.Errorf("Archive, Delete = %v, %v, want true, false", dmm.RsyncOptions.Archive, dmm.RsyncOptions.Delete)
+	}
+	if err := MigrateData(dmm); err != nil {
+		t.Fatalf("MigrateData() error = %v", err)
+	}
+
+	want := map[string]string{"dump.sql": "rows\n", "old.sql": "earlier dump\n"}
+	if got := readFixture(t, dst); !maps.Equal(got, want) {
+		t.Errorf("destination holds %v, want %v", got, want)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "restored.txt")); err != nil || string(data) != "rows\n" {
+		t.Errorf("restored data = %q, %v, want the transferred dump", data, err)
+	}
+}
+
+func TestNewServiceMigrationEndToEnd(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src")+"/", filepath.Join(root, "dst")+"/"
+	writeFixture(t, src, map[string]string{"state.db": "state\n", "conf/app.ini": "x=1\n"})
+	writeFixture(t, dst, map[string]string{"stale.db": "stale\n"})
+	log := filepath.Join(root, "hooks.log")
+	runner := &fixtureRunner{t: t}
+
+	dmm, err := NewServiceMigration(
+		EndpointDetails{DataPath: src},
+		EndpointDetails{DataPath: dst},
+		ServiceHooks{
+			SourceStopCmd:       "echo stop-source >> " + log,
+			DestinationStopCmd:  "echo stop-destination >> " + log,
+			DestinationStartCmd: "echo start-destination >> " + log + " && touch " + filepath.Join(root, "ready"),
+			ReadinessCmd:        "test -f " + filepath.Join(root, "ready"),
+			ReadinessTimeout:    5 * time.Second,
+		},
+		RsyncOption{CommandRunner: runner},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dmm.RsyncOptions.Archive || !dmm.RsyncOptions.Delete {
+		t.Errorf("Archive, Delete = %v, %v, want true, true", dmm.RsyncOptions.Archive, dmm.RsyncOptions.Delete)
+	}
+	if err := MigrateData(dmm); err != nil {
+		t.Fatalf("MigrateData() error = %v", err)
+	}
+
+	want := map[string]string{"state.db": "state\n", "conf/app.ini": "x=1\n"}
+	if got := readFixture(t, dst); !maps.Equal(got, want) {
+		t.Errorf("destination holds %v, want the mirrored source %v", got, want)
+	}
+	data, _ := os.ReadFile(log)
+	if got := strings.Fields(string(data)); !slices.Equal(got, []string{"stop-source", "stop-destination", "start-destination"}) {
+		t.Errorf("hooks ran in order %q", got)
+	}
+}
+
+func TestNewServiceMigrationNotReady(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src") + "/"
+	writeFixture(t, src, map[string]string{"state.db": "state\n"})
+
+	dmm, err := NewServiceMigration(
+		EndpointDetails{DataPath: src},
+		EndpointDetails{DataPath: filepath.Join(root, "dst") + "/"},
+		ServiceHooks{DestinationStartCmd: "true", ReadinessCmd: "false", ReadinessTimeout: time.Second},
+		RsyncOption{CommandRunner: &fixtureRunner{t: t}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = MigrateData(dmm)
+	if FailedStage(err) != StageRestore || !strings.Contains(err.Error(), "service not ready after 1s") {
+		t.Errorf("MigrateData() error = %v, want a restore failure reporting the readiness timeout", err)
+	}
+}
+
+func TestNewMirrorEndToEnd(t *testing.T) {
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "src")+"/", filepath.Join(root, "dst")+"/"
+	writeFixture(t, src, map[string]string{"a.txt": "a\n", "sub/b.txt": "b\n", "skip.tmp": "tmp\n"})
+	writeFixture(t, dst, map[string]string{"gone.txt": "gone\n", "sub/a.txt": "a\n"})
+	runner := &fixtureRunner{t: t}
+
+	dmm, err := NewMirror(EndpointDetails{DataPath: src}, EndpointDetails{DataPath: dst},
+		RsyncOption{Exclude: []string{"*.tmp"}, CommandRunner: runner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dmm.Source.BackupCmd != "" || dmm.Destination.RestoreCmd != "" {
+		t.Errorf("mirror has commands %q, %q", dmm.Source.BackupCmd, dmm.Destination.RestoreCmd)
+	}
+	if err := MigrateData(dmm); err != nil {
+		t.Fatalf("MigrateData() error = %v", err)
+	}
+
+	want := map[string]string{"a.txt": "a\n", "sub/b.txt": "b\n"}
+	if got := readFixture(t, dst); !maps.Equal(got, want) {
+		t.Errorf("destination holds %v, want %v", got, want)
+	}
+}
+
+func TestTemplatesRejectInvalidArguments(t *testing.T) {
+	src, dst := EndpointDetails{DataPath: "/src/"}, EndpointDetails{DataPath: "/dst/"}
+	tests := []struct {
+		name string
+		fn   func() (DataMigrationModel, error)
+		want string
+	}{
+		{"database without backup", func() (DataMigrationModel, error) {
+			return NewDatabaseMigration(src, dst, " ", "load", RsyncOption{})
+		}, "requires both a backup and a restore command"},
+		{"database without restore", func() (DataMigrationModel, error) {
+			return NewDatabaseMigration(src, dst, "dump", "", RsyncOption{})
+		}, "requires both a backup and a restore command"},
+		{"service without start", func() (DataMigrationModel, error) {
+			return NewServiceMigration(src, dst, ServiceHooks{}, RsyncOption{})
+		}, "requires a destination start command"},
+		{"service with negative timeout", func() (DataMigrationModel, error) {
+			return NewServiceMigration(src, dst, ServiceHooks{DestinationStartCmd: "start", ReadinessTimeout: -time.Second}, RsyncOption{})
+		}, "readiness timeout must not be negative"},
+		{"mirror without source path", func() (DataMigrationModel, error) {
+			return NewMirror(EndpointDetails{}, dst, RsyncOption{})
+		}, "invalid migration template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.fn(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package transx
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Topology classifies a migration by where its endpoints are relative to the machine running transx.
+type Topology int
+
+const (
+	LocalToLocal        Topology = iota // Both endpoints are on this machine
+	LocalToRemote                       // The source is local and rsync pushes to the remote destination
+	RemoteToLocal                       // rsync pulls from the remote source to the local destination
+	RemoteToRemoteRelay                 // Both endpoints are remote; data is relayed through a local staging directory
+	// RemoteToRemotePush is a transfer pushed directly from the remote source to the remote destination.
+	// rsync always relays between two remote endpoints; Topology returns it only for a backend that
+	// pushes instead (see BackendCapabilities.Topologies).
+	RemoteToRemotePush
+)
+
+// Topology returns the topology of the task, which determines how Transfer moves the data.
+func (task *DataMigrationModel) Topology() Topology {
+	switch {
+	case task.Source.isRemote() && task.Destination.isRemote():
+		if backend, ok := task.transferBackend(); ok {
+			topologies := backend.Capabilities().Topologies
+			if slices.Contains(topologies, RemoteToRemotePush) && !slices.Contains(topologies, RemoteToRemoteRelay) {
+				return RemoteToRemotePush
+			}
+		}
+		return RemoteToRemoteRelay
+	case task.Source.isRemote():
+		return RemoteToLocal
+	case task.Destination.isRemote():
+		return LocalToRemote
+	default:
+		return LocalToLocal
+	}
+}
+
+// String returns the topology in kebab case (e.g., "remote-to-remote-relay").
+func (t Topology) String() string {
+	switch t {
+	case LocalToLocal:
+		return "local-to-local"
+	case LocalToRemote:
+		return "local-to-remote"
+	case RemoteToLocal:
+		return "remote-to-local"
+	case RemoteToRemoteRelay:
+		return "remote-to-remote-relay"
+	case RemoteToRemotePush:
+		return "remote-to-remote-push"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the topology as its String form, so reports serialize it readably.
+func (t Topology) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a topology from its String form.
+func (t *Topology) UnmarshalText(text []byte) error {
+	for candidate := LocalToLocal; candidate <= RemoteToRemotePush; candidate++ {
+		if candidate.String() == string(text) {
+			*t = candidate
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown topology '%s'", text)
+}
@@ -1,11 +1,20 @@
 package transx
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // DataMigrationModel defines a single rsync data migration task.
@@ -13,6 +22,21 @@ type DataMigrationModel struct {
 	Source       EndpointDetails
 	Destination  EndpointDetails
 	RsyncOptions RsyncOption
+
+	// Backend names the TransferBackend moving the data (see RegisterBackend); empty uses rsync.
+	Backend string
+
+	// BackupEndpoint, if set, is where Source.BackupCmd runs instead of the source, e.g., a database host
+	// writing its dump to a share that the source reads from. Its DataPath is where the backup writes
+	// (shown in the plan and checked by Lint); the transfer still reads the Source paths. Only the
+	// connection and container fields are used, and it must differ from both Source and Destination.
+	BackupEndpoint   *EndpointDetails
+	PreflightOptions PreflightOption
+	WorkflowOptions  WorkflowOption
+
+	// Actor identifies who runs the task (e.g., an operator or a pipeline) in the records of
+	// WorkflowOption.AuditLogger; the local OS user is recorded if it is not set.
+	Actor string
 }
 
 // EndpointDetails defines the source/destination endpoint for rsync or the target for backup/restore operations.
@@ -22,31 +46,538 @@ type EndpointDetails struct {
 	HostIP   string // Hostname or IP address for SSH connection (e.g., "server.example.com" or "192.168.1.100")
 	SSHPort  int    // SSH port (0 or unspecified uses default 22)
 
-	// DataPath for both local and remote operations
+	// DataPath for both local and remote operations.
+	// A relative path is resolved against the SSH login (home) directory for remote endpoints
+	// and against the process working directory for local endpoints; set
+	// WorkflowOption.RequireAbsolutePaths to reject relative paths.
 	DataPath string // Data path (e.g., "/home/user/data" for remote or "/var/backups/data" for local)
 
+	// URL, if set on the source, is an http:// or https:// artifact (e.g., a nightly dump) that transx
+	// downloads into a local staging file and transfers to the destination as a file named after the
+	// last element of the URL path. With RsyncOption.StagingDir, an interrupted download is resumed
+	// (Range request) and a verified one is reused by the next run. The path, host, and command fields
+	// of a URL source must be empty; the artifact is verified against URLDigest unless AllowUnverifiedURL is set.
+	URL                string
+	URLDigest          string // Expected digest of the URL artifact, "<algorithm>:<hex>" (sha256, sha512, sha1, or md5)
+	AllowUnverifiedURL bool   // Transfer the URL artifact without verifying it
+
+	// AdditionalDataPaths lists further source paths on the same endpoint that are consolidated into
+	// the destination together with DataPath, as extra source arguments of a single rsync invocation
+	// (source only). rsync's trailing-slash rule applies to each path: "/srv/a/" merges the contents
+	// of a into the destination, while "/srv/a" creates the directory a in it.
+	AdditionalDataPaths []string
+
 	SSHPrivateKeyPath string // Path to the SSH private key file (used for remote connections with key authentication)
 	BackupCmd         string // Backup command string to be executed on this endpoint
 	RestoreCmd        string // Restore command string to be executed on this endpoint
+	PreTransferCmd    string // Command executed on the destination before the transfer (e.g., stop services, mkdir)
+	HealthCmd         string // Command checking the service on this endpoint before and after the workflow (see WorkflowOption.HealthCheck)
+
+	// ExpectedHostIdentity, if set, is checked by Preflight first, which fails with a
+	// *HostIdentityMismatchError if the host is not the expected one (see HostIdentity).
+	ExpectedHostIdentity HostIdentity
+
+	// For container endpoints, the data lives inside a container running on the host
+	// described above (local if HostIP is empty, otherwise reached via SSH).
+	// DataPath is then a path inside the container, and BackupCmd/RestoreCmd run inside the container.
+	ContainerName    string // Name or ID of the container (empty for non-container endpoints)
+	ContainerRuntime string // Container runtime CLI (e.g., "docker" or "podman"; empty uses "docker")
+	VolumeHostPath   string // Host path of the volume mounted at DataPath; if empty, data is staged via "<runtime> cp"
 }
 
 // RsyncOption defines options to be applied when executing rsync commands and SSH connection options.
 type RsyncOption struct {
-	Compress  bool     // -z, --compress: Compress file data during the transfer
-	Archive   bool     // -a, --archive: Archive mode; equals -rlptgoD (no -H,-A,-X)
-	Verbose   bool     // -v, --verbose: Increase verbosity
-	Delete    bool     // --delete: Delete extraneous files from dest dirs
-	Progress  bool     // --progress: Show progress during transfer
-	DryRun    bool     // -n, --dry-run: Perform a trial run with no changes made
-	RsyncPath string   // Path to the rsync executable (if empty, uses system PATH)
-	Exclude   []string // --exclude=PATTERN: List of patterns to exclude
-	Include   []string // --include=PATTERN: List of patterns to include
+	Compress     bool     // -z, --compress: Compress file data during the transfer
+	Archive      bool     // -a, --archive: Archive mode; equals -rlptgoD (no -H,-A,-X)
+	Verbose      bool     // -v, --verbose: Increase verbosity
+	Delete       bool     // --delete: Delete extraneous files from dest dirs
+	DeleteDelay  bool     // --delete-delay: Find deletions during the transfer, apply them at the end (requires Delete)
+	Progress     bool     // --progress: Show progress during transfer
+	DryRun       bool     // -n, --dry-run: Perform a trial run with no changes made
+	Update       bool     // -u, --update: Skip files that are newer on the receiver
+	WholeFile    bool     // -W, --whole-file: Copy files whole, without the delta-transfer algorithm
+	NoPerms      bool     // --no-perms: Do not preserve permissions (requires Archive)
+	NoOwner      bool     // --no-owner: Do not preserve the owner (requires Archive)
+	NoGroup      bool     // --no-group: Do not preserve the group (requires Archive)
+	NoTimes      bool     // --no-times: Do not preserve modification times (requires Archive)
+	Partial      bool     // --partial: Keep partially transferred files so an interrupted transfer can resume
+	CopyDirlinks bool     // -k, --copy-dirlinks: Send symlinks to directories (e.g., a symlinked DataPath) as the directories they point to
+	MungeLinks   bool     // --munge-links: Store symlinks in a safe, munged form in the relay staging directory (relay mode only)
+	ProtectArgs  bool     // -s, --protect-args: Keep remote paths from being word-split or globbed (automatic for such paths)
+	RsyncPath    string   // Path to the rsync executable (if empty, uses system PATH)
+	Exclude      []string // --exclude=PATTERN: List of patterns to exclude
+	Include      []string // --include=PATTERN: List of patterns to include
+
+	// FilesFromList, if set, transfers only these paths, relative to the source directory (--files-from),
+	// e.g., a list generated from an asset database. rsync reads it from a temporary file, so it may be
+	// arbitrarily long. As with --files-from, Archive does not recurse into listed directories: list the
+	// files themselves.
+	FilesFromList []string
+
+	// TempDir, if set, makes the receiving rsync write the temporary files of the destination into this
+	// directory (--temp-dir) instead of next to their targets, e.g., a scratch volume when the destination
+	// volume is nearly full. It is a path on the destination, relative to the destination directory if
+	// not absolute, and must exist. On a different filesystem than the destination, each file is copied
+	// into place instead of renamed, doubling its write I/O and leaving a window where it is incomplete.
+	// In relay mode, only the upload leg uses it. The free-space preflight also checks its filesystem.
+	TempDir string
+
+	// BandwidthLimitKBps, if positive, limits the transfer to this many KiB per second (--bwlimit), e.g.,
+	// to leave room for production traffic on a shared WAN link. In relay mode, DownloadBandwidthLimitKBps
+	// and UploadBandwidthLimitKBps override it for the leg from the source and to the destination, since
+	// the two legs often cross different networks (0 uses BandwidthLimitKBps). The download of a URL
+	// source is limited like the download leg.
+	BandwidthLimitKBps         int
+	DownloadBandwidthLimitKBps int
+	UploadBandwidthLimitKBps   int
+
+	// ExcludeCommonJunk, if true, excludes the DefaultJunkPatterns (e.g., .git, node_modules, .DS_Store).
+	// They are added after Exclude and Include, so an Include pattern can override them.
+	ExcludeCommonJunk bool
 	// ExtraArgs []string // List of other rsync arguments to pass directly
 
+	// StopAt and TimeLimit bound the transfer window: rsync stops gracefully at the given wall-clock
+	// time (--stop-at) or after the given duration (--time-limit, whole minutes), leaving a consistent
+	// partial state that a later run resumes (combine with Partial). They require rsync 3.2.3+ locally
+	// and are mutually exclusive.
+	StopAt    time.Time
+	TimeLimit time.Duration
+
+	// RemoveSourceFiles, if true, emits --remove-source-files so that files (non-directories) are
+	// removed from the source once they are duplicated on the receiver (a move-style migration).
+	// It is a dangerous operation and requires WorkflowOption.ForceRemoveSourceFiles.
+	// In relay mode, source files are only removed after the upload leg has been verified
+	// against the staging directory with a checksum dry-run, and only those still identical to
+	// their staged copies; files changed on the source after the download leg are kept.
+	RemoveSourceFiles bool
+
+	// CompressAuto, if true, enables -z when either endpoint is remote and leaves it off when both are local.
+	// The heuristic assumes remote endpoints are reached over a WAN where compression saves bandwidth,
+	// while local-to-local copies only waste CPU on it. Compress=true always enables compression.
+	CompressAuto bool
+
+	// KeepStaging, if true, keeps the local staging directory created in relay mode instead of removing it.
+	// Its path is reported in TransferResult.RelayStagingPath; the caller is responsible for removing it.
+	KeepStaging bool
+
+	// StagingDir, if set, is used as the local staging directory in relay mode instead of a temporary
+	// directory. It is created if missing and never removed by transx, so a later run (e.g., Commit)
+	// can reuse the already staged data.
+	// Once the download leg completes, a manifest is written into StagingDir (unless LocalRunAs is set);
+	// a rerun of the same task within StagingMaxAge skips the download leg and only uploads, so a relay
+	// interrupted between the legs resumes where it stopped. The manifest is removed after the upload.
+	StagingDir string
+
+	// NoStagingResume, if true, ignores the staging manifest and always runs the download leg.
+	NoStagingResume bool
+
+	// StagingMaxAge is the age above which a staging manifest is ignored as stale (0 uses 1 hour).
+	StagingMaxAge time.Duration
+
+	// A relay transfer locks StagingDir for its duration with a lock file next to it ("<StagingDir>.transx-lock"),
+	// so that concurrent runs sharing it fail with a *StagingLockedError instead of corrupting each other's
+	// staged data. The lock file is held with flock, so the lock of a run that died is released with it.
+	StagingLockMaxAge  time.Duration // Age above which a lock is taken over as stale, e.g., one left on another host (0 never)
+	ForceUnlockStaging bool          // Take over the lock even if its run looks alive
+
+	// RelayStreaming, if true, transfers a relay task as a tar stream piped from the source through this
+	// machine into tar on the destination, so the data never lands on the local disk and both ends move
+	// at once. Like the tar fallback, it copies everything and cannot compare or prune the destination,
+	// so Validate refuses the options tar cannot honor (e.g., Delete, Include, Partial), as well as
+	// those acting on rsync processes only: TempDir (tar writes in place), StallTimeout (tar produces
+	// no output to watch), Retry (a failed stream starts over on the next run), SampledVerify and
+	// DirectoryStats (tar logs no transferred files), and OnFile. OnProgress receives no snapshots. A
+	// dry run, or a task whose endpoint has no tar, is relayed through the staging directory instead.
+	RelayStreaming bool
+
+	// FallbackBackends lists the backends tried in order when rsync is missing on a remote endpoint
+	// (see IsRemoteRsyncMissing); other failures never trigger a fallback. Only "tar" (tar streamed
+	// over ssh) is available. Validate refuses options the fallback cannot honor, such as Delete or
+	// Include, instead of silently transferring with different semantics.
+	FallbackBackends []string
+
+	// Retry retries a failed rsync process of the transfer (see RetryPolicy).
+	Retry RetryPolicy
+
+	// RateLimit limits how often commands are launched against remote hosts (see RateLimitOption).
+	RateLimit RateLimitOption
+
+	// ChecksumAlgorithm selects the hash used by Verify and the sampled verification ("sha256", "sha1",
+	// "md5", or "xxh64"). The hashing command is detected per endpoint (e.g., sha256sum, "shasum -a 256",
+	// or "openssl dgst -sha256"), with a Go fallback for local endpoints. If empty, the sampled
+	// verification uses SHA-256 and Verify uses rsync's own checksums (-c, typically MD5).
+	ChecksumAlgorithm ChecksumAlgorithm
+
+	// MaxCapturedOutput, if positive, caps the output buffered in memory per command (rsync transfers,
+	// and backup, restore, and other shell commands) to this many bytes. The tail is kept, since it holds
+	// the error and rsync's statistics, and the truncation is noted at the start of the output.
+	// Streamed output (WorkflowOption.StreamCommandOutput) is not truncated. Transferred files listed
+	// in the dropped part are not considered by the sampled verification.
+	MaxCapturedOutput int64
+
+	// StallTimeout, if positive, kills an rsync transfer (with its process group, e.g., the ssh client)
+	// that produces no output for this long and fails it with a *StallError, which is retryable. It
+	// catches hangs that rsync's own --timeout misses, e.g., on a connection silently blackholed by a
+	// firewall. rsync then reports progress (--info=progress2), so a slow but active transfer is not
+	// mistaken for a hang; the window must still exceed pauses without progress, such as a long file
+	// list scan. It cannot be combined with MtimeSplit.
+	StallTimeout time.Duration
+
+	// MtimeSplit partitions the source by modification-time windows and transfers them in parallel.
+	MtimeSplit MtimeSplitOption
+
+	// BigFileParallelStreams, if 2 or more, transfers a source DataPath that is a single regular file
+	// without rsync: the file is split into this many byte ranges, streamed concurrently (tail/head over
+	// ssh) into part-files on the destination, then concatenated and always verified by checksum
+	// (ChecksumAlgorithm) before replacing the destination file. Owner, permissions, and times are not
+	// preserved, and the destination needs room for twice the file. A source that turns out not to be
+	// a regular file is transferred by rsync as usual, as is any source on a dry run.
+	BigFileParallelStreams int
+
+	// CreateDestDirMode, if set, is the permission mode (e.g., 0755) of the directories transx creates on
+	// the destination with mkdir (by the big-file and tar transfers and for DestinationSymlinkTarget),
+	// including missing parents, regardless of the umask of the destination. Directories that already
+	// exist are not changed, nor are those created by rsync itself. If 0, the umask of the destination
+	// applies (e.g., 0700 under a hardened umask of 077). It must grant the owner full access.
+	CreateDestDirMode os.FileMode
+
+	// SessionDirMode is the permission mode of the staging directories transx creates for a run: the
+	// local relay staging directory (a temporary one, or StagingDir if missing), the directory of a
+	// downloaded URL source, and the container staging directories created on the hosts with mktemp.
+	// It is applied after creation, so it holds whatever the umask is; existing directories are not
+	// changed. If 0, they are private (0700). It must grant the owner full access, e.g., 0750 for a
+	// group of operators inspecting kept staging data. Files holding data or state (filter and
+	// files-from lists, manifests, locks, state and history files) are always created 0600. With
+	// LocalRunAs, the filter and files-from lists stay 0600 but are owned by that user (chown, done by
+	// transx as root or else with "sudo -n chown"), in a directory others can only traverse (0711).
+	SessionDirMode os.FileMode
+
+	// BatchDir, if set, makes a direct transfer go through an rsync batch file kept in this local
+	// directory: rsync writes the changes into the batch (--only-write-batch) and then applies it
+	// (--read-batch). If the application fails, a rerun of the same task applies the kept batch without
+	// walking and comparing both trees again, and falls back to a normal transfer if the batch no longer
+	// applies. The batch holds the changed data as read when it was written, so the source must not be
+	// modified before the rerun; a batch is discarded if the modification time of the source DataPath
+	// changed. Not supported in relay mode, and skipped on a dry run.
+	BatchDir string
+
+	// ResolveSourceSymlink, if true, replaces a source DataPath that is a symlink (e.g., /var/lib/mysql
+	// -> /data/mysql) by its final target before the transfer, resolved locally or with "readlink -f"
+	// on a remote source, so that the data is copied rather than the link. A directory named without
+	// a trailing slash still lands under the name of the link. The resolved path is recorded in
+	// MigrationReport.ResolvedSourcePath.
+	ResolveSourceSymlink bool
+
+	// DestinationSymlinkTarget, if set, makes the transfer write the data to this real path on the
+	// destination and then recreate the destination DataPath as a symlink to it (replacing an existing
+	// symlink, but never a file or directory). Skipped on a dry run.
+	DestinationSymlinkTarget string
+
+	// OwnershipMap translates numeric UIDs/GIDs on the receiver via --usermap/--groupmap.
+	// Ownership is only preserved (and therefore remapped) with Archive or when running as root on the receiver.
+	OwnershipMap OwnershipMap
+
+	// CommandWrapper, if set, prefixes every rsync and ssh invocation (including both relay legs),
+	// e.g., ["cgexec", "-g", "blkio:migrations"] to place the migration I/O into a cgroup.
+	// Its first element must be an executable found in PATH (or an existing path).
+	CommandWrapper []string
+
+	// OnProgress, if set, receives the --info=progress2 snapshots of the transfer as rsync emits them
+	// (e.g., to drive a progress bar), tagged with the leg in relay mode. It runs on its own goroutine,
+	// and snapshots parsed while it is busy are coalesced into the newest one. Mtime-split transfers
+	// do not report progress.
+	OnProgress ProgressFunc `json:"-"`
+
+	// OnFile, if set, receives an event for each entry rsync creates, updates, or deletes (logged
+	// with --out-format), tagged with the leg in relay mode, e.g., to index the transferred files.
+	// It runs on its own goroutine, separately from OnProgress, and no event is coalesced: up to
+	// FileEventBuffer events (0 uses 65536) wait while it is busy, and if more pile up, the others are
+	// dropped and the transfer returns a *FileEventOverflowError once rsync finished. Mtime-split
+	// transfers do not report file events.
+	OnFile          FileFunc `json:"-"`
+	FileEventBuffer int
+
+	// OnDiskFull, if set, is called when the transfer runs out of space on the receiving side, after
+	// rsync was stopped and the free space left was measured, e.g., to free space. Returning true
+	// retries the transfer if RsyncOption.Retry has attempts left; a *DiskFullError is otherwise not retried.
+	OnDiskFull func(*DiskFullError) bool `json:"-"`
+
+	// CommandRunner, if set, runs the rsync, ssh, and local shell commands of the transfer, the
+	// workflow commands (e.g., BackupCmd and RestoreCmd), and the verification instead of os/exec,
+	// e.g., a fake recording the command lines and returning canned output in tests (see CommandRunner).
+	// Streamed output (progress, StreamCommandOutput) is delivered once a command finished, and
+	// BigFileParallelStreams, MtimeSplit, and the tar fallback, which pipe data between processes,
+	// still run their commands with os/exec.
+	CommandRunner CommandRunner `json:"-"`
+
+	// onProgress receives the --info=progress2 snapshots of the transfer (set by the workflow when
+	// a progress consumer such as the status socket is attached). Mtime-split transfers do not report progress.
+	onProgress func(ProgressEvent)
+
+	// onRateLimitWait receives a message when a command waits for RateLimit (set by the workflow when
+	// the status socket is attached).
+	onRateLimitWait func(message string)
+
+	// onSSHThrottled is called when sshd refuses a connection under its MaxStartups throttling (set by
+	// the workflow to count the refusals).
+	onSSHThrottled func()
+
+	// probes memoizes environment probes across the tasks of a batch (set by MigrateBatch).
+	probes *probeCache
+
+	// cleanups tracks the temporary resources created by the transfer (set by the workflow).
+	cleanups *cleanupRegistry
+
+	// recorder receives the rsync command lines of the transfer (set by the workflow when
+	// WorkflowOption.RecordFile is set).
+	recorder *commandRecorder
+
+	// audit records the executed commands (set when WorkflowOption.AuditLogger is set).
+	audit *auditTrail
+
+	// usage accounts the resource usage of the processes (set by the workflow per stage, and by the transfer).
+	usage *usageAccumulator
+
+	// stage is the workflow stage the commands run for, in the OperationError of a failed command
+	// (set by the workflow per stage, and by the transfer and the stage commands).
+	stage Stage
+
+	// filterFile is the merge file holding the Exclude, Include, and junk patterns when they are too
+	// many for the command line, and filesFromFile the file holding FilesFromList (set by the
+	// workflow, see spillFilterRules).
+	filterFile    string
+	filesFromFile string
+
+	// sourceResolved and destinationLink record that resolveSymlinks was applied, and the destination
+	// DataPath to link to DestinationSymlinkTarget after the transfer.
+	sourceResolved  bool
+	destinationLink string
+
+	// LocalRunAs, if set, runs the local rsync processes and local commands as this user via
+	// non-interactive sudo ("sudo -n -u <user> --"), so that staged and transferred local data is owned
+	// by and readable for that account. A relay staging directory is then also created as this user.
+	// The ssh client started by rsync runs as this user too, so SSHPrivateKeyPath must be readable by it.
+	// Composed with CommandWrapper, the order is: CommandWrapper, sudo, rsync
+	// (e.g., "nice -n 10 sudo -n -u svc -- rsync ..."), so priorities and cgroups apply to the whole tree.
+	// Preflight fails if "sudo -n -u <user> true" does not succeed.
+	LocalRunAs string
+
+	// RemoteShellCommand, if set, is passed to rsync as its remote shell (-e) instead of the ssh
+	// command transx builds, e.g., a transport binary that wraps authentication. Remote commands
+	// (backup, restore, checks) run through it the way rsync invokes it: "<command> [-l user] host
+	// <command line>", with RemoteShellCommand split on whitespace. The endpoints' SSHPort and
+	// SSHPrivateKeyPath and the DebugSSH and InsecureSkipHostKeyVerification options are not applied.
+	RemoteShellCommand string
+
+	// DebugSSH, if true, runs ssh with -vvv so that the handshake details (which key was offered,
+	// which authentication step failed) are captured in the error when a connection fails.
+	// For remote commands, ssh writes its log to a temporary file (ssh -E) instead of the command
+	// output, and the log is appended to the output only if the command fails.
+	DebugSSH bool
+
+	// SSHMultiplexing, if true, makes the ssh commands and rsync share one connection per host
+	// (ControlMaster=auto, kept open for 60 seconds after the last use), so that concurrent tasks open
+	// multiplexed channels instead of new TCP connections, which count against sshd's MaxStartups.
+	// The control sockets are created in /tmp. Not applied with RemoteShellCommand.
+	SSHMultiplexing bool
+
 	// InsecureSkipHostKeyVerification, if true, relaxes host key checking for SSH connections.
 	// Adds "-o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=/dev/null" options.
 	// Warning: This can be a security risk and should only be used in trusted environments.
 	InsecureSkipHostKeyVerification bool
+
+	// InteractiveSSH, if true, lets ssh prompt on the terminal, e.g., to accept an unknown host key or for
+	// a password. By default, ssh runs with "-o BatchMode=yes", so that such a prompt fails the command
+	// (unknown or changed host keys with a *HostKeyError) instead of waiting for an answer forever.
+	// Not applied with RemoteShellCommand.
+	InteractiveSSH bool
+}
+
+// OwnershipMap defines an explicit numeric ownership translation table for rsync.
+type OwnershipMap struct {
+	Users  []UIDMapping // Translated into --usermap=FROM:TO,...
+	Groups []GIDMapping // Translated into --groupmap=FROM:TO,...
+}
+
+// UIDMapping maps a numeric user ID on the source to a numeric user ID on the destination.
+type UIDMapping struct {
+	FromUID int
+	ToUID   int
+}
+
+// GIDMapping maps a numeric group ID on the source to a numeric group ID on the destination.
+type GIDMapping struct {
+	FromGID int
+	ToGID   int
+}
+
+// maxOwnershipID is the largest valid UID/GID (4294967295 is reserved as "no ID").
+const maxOwnershipID int64 = 4294967294
+
+// validate checks that all entries are valid IDs and that no source ID is mapped twice.
+func (m OwnershipMap) validate() error {
+	seenUIDs := make(map[int]bool)
+	for _, u := range m.Users {
+		if u.FromUID < 0 || int64(u.FromUID) > maxOwnershipID || u.ToUID < 0 || int64(u.ToUID) > maxOwnershipID {
+			return fmt.Errorf("invalid UID mapping %d:%d (IDs must be in range 0-%d)", u.FromUID, u.ToUID, maxOwnershipID)
+		}
+		if seenUIDs[u.FromUID] {
+			return fmt.Errorf("UID %d is mapped more than once", u.FromUID)
+		}
+		seenUIDs[u.FromUID] = true
+	}
+	seenGIDs := make(map[int]bool)
+	for _, g := range m.Groups {
+		if g.FromGID < 0 || int64(g.FromGID) > maxOwnershipID || g.ToGID < 0 || int64(g.ToGID) > maxOwnershipID {
+			return fmt.Errorf("invalid GID mapping %d:%d (IDs must be in range 0-%d)", g.FromGID, g.ToGID, maxOwnershipID)
+		}
+		if seenGIDs[g.FromGID] {
+			return fmt.Errorf("GID %d is mapped more than once", g.FromGID)
+		}
+		seenGIDs[g.FromGID] = true
+	}
+	return nil
+}
+
+// args returns the rsync --usermap/--groupmap arguments for the ownership map.
+func (m OwnershipMap) args() []string {
+	var args []string
+	if len(m.Users) > 0 {
+		pairs := make([]string, 0, len(m.Users))
+		for _, u := range m.Users {
+			pairs = append(pairs, fmt.Sprintf("%d:%d", u.FromUID, u.ToUID))
+		}
+		args = append(args, "--usermap="+strings.Join(pairs, ","))
+	}
+	if len(m.Groups) > 0 {
+		pairs := make([]string, 0, len(m.Groups))
+		for _, g := range m.Groups {
+			pairs = append(pairs, fmt.Sprintf("%d:%d", g.FromGID, g.ToGID))
+		}
+		args = append(args, "--groupmap="+strings.Join(pairs, ","))
+	}
+	return args
+}
+
+// WorkflowOption defines options controlling the MigrateData workflow itself.
+type WorkflowOption struct {
+	PrintSummary         bool // Print a human-readable migration summary to stdout when MigrateData finishes
+	SkipCommandPathLint  bool // Do not warn when BackupCmd/RestoreCmd paths disagree with the endpoint's DataPath
+	RequireAbsolutePaths bool // Make Validate reject DataPaths that are not absolute
+
+	// StatusSocket, if set, makes MigrateData serve the run's status over HTTP on a Unix domain
+	// socket at this path (created with 0600 permissions and removed when the run ends):
+	// GET /status returns the current StatusSnapshot, GET /events streams StatusEvents as NDJSON,
+	// and POST /cancel cancels the migration.
+	StatusSocket string
+
+	// StateFile, if set, makes MigrateData restartable: the stages completed so far (and, in relay mode,
+	// the staging directory) are recorded in this file, and a re-invocation with the same task skips
+	// the completed stages and resumes the transfer from the staged data. The file is only trusted if
+	// it was written for the same configuration, and it is removed once the migration succeeds.
+	// Preflight checks and the path audit always run again.
+	StateFile string
+
+	// AllowRestoreOnDryRun, if true, runs the destination RestoreCmd even when RsyncOptions.DryRun is
+	// set. Otherwise a dry run skips the restore (MigrateData) or refuses it (Restore), since restoring
+	// data that was never transferred would act on whatever the destination holds.
+	AllowRestoreOnDryRun bool
+
+	// BypassProbeCache, if true, makes this task of a MigrateBatch run repeat the environment probes
+	// (rsync version, LocalRunAs sudo check, host resolution) instead of reusing the batch's results.
+	BypassProbeCache bool
+
+	// RecordFile, if set, makes MigrateData write a troubleshooting bundle (see RecordBundle) to this
+	// path when it ends: the task, the detected environment, and every rsync command line built for
+	// the transfer, all redacted so the bundle can be shared. Replay rebuilds the command lines from it.
+	RecordFile string
+
+	// ReportHistoryDir, if set, makes MigrateData compare each run with the last successful run of the
+	// same task (keyed by DataMigrationModel.Hash) saved in this directory, recording the delta and its
+	// anomalies in MigrationReport.Delta, and save successful runs as the new baseline (see CompareReports).
+	ReportHistoryDir  string
+	AnomalyThresholds AnomalyThresholds // Thresholds of the anomaly flags of the delta
+
+	// Before a delete-enabled transfer, the source is listed and the transfer aborts with an
+	// *EmptySourceError if it is an empty directory. AbortOnEmptySource extends the check to
+	// transfers without --delete; AllowEmptySource disables it.
+	AbortOnEmptySource bool
+	AllowEmptySource   bool
+
+	// ConcurrentPreparation, if true, runs the source BackupCmd and the destination PreTransferCmd
+	// concurrently when they run on different hosts, joining before the transfer.
+	// A failure on either side cancels the other.
+	ConcurrentPreparation bool
+
+	// SourceReadOnly guarantees that transx never modifies the source endpoint.
+	// Validate rejects any setting that conflicts with the guarantee: a source BackupCmd
+	// (unless AllowSourceBackupCmd acknowledges it) and rsync options that write to the source.
+	SourceReadOnly       bool
+	AllowSourceBackupCmd bool // Acknowledge that BackupCmd is safe to run on a read-only source
+
+	// Force flags acknowledge dangerous operations; without them, Validate refuses the task.
+	ForceRemoveSourceFiles bool // Allow RsyncOption.RemoveSourceFiles to delete files from the source
+	ForceMultiSourceDelete bool // Allow RsyncOption.Delete with Source.AdditionalDataPaths (deletes files absent from all sources)
+
+	// Confirmer, if set, is asked by MigrateData and Transfer to confirm each dangerous operation whose
+	// Force flag is not set (see ConfirmationRequest); an approval acts as the flag. The decisions are
+	// recorded in MigrationReport.Confirmations.
+	Confirmer Confirmer `json:"-"`
+
+	// SecretsProvider, if set, resolves the secret references ("secret://<name>") in the endpoint
+	// commands when they run (see SecretsProvider). A command with references fails without it.
+	SecretsProvider SecretsProvider `json:"-"`
+
+	// AuditLogger, if set, receives an AuditRecord for each command executed for the task (see AuditRecord),
+	// attributed to DataMigrationModel.Actor. It is independent of the operational output on stdout.
+	AuditLogger AuditLogger `json:"-"`
+
+	// PathAudit audits the destination paths of the transfer before it runs.
+	PathAudit PathAuditOption
+
+	// RestorePreview, if true, cross-references the paths referenced by Destination.RestoreCmd with the
+	// dry-run listing of the transfer and the destination before the transfer runs, and warns about
+	// restore inputs that would not exist after it (see RestoreInput). It runs with RsyncOptions.DryRun
+	// too, so that the restore can be reviewed with the plan.
+	RestorePreview bool
+
+	// AutoTune probes the link between the endpoints before the transfer and tunes the transfer options
+	// from its profile (see AutoTuneOption).
+	AutoTune AutoTuneOption
+
+	// HealthCheck configures the endpoints' HealthCmd, run before the workflow and after it succeeds,
+	// with the outcomes recorded in MigrationReport.HealthChecks.
+	HealthCheck HealthCheckOption
+
+	// Phase timeouts bound the backup, pre-transfer, and restore commands; a command still running
+	// when its timeout expires is killed and the stage fails. Zero means no limit.
+	BackupTimeout      time.Duration
+	PreTransferTimeout time.Duration
+	RestoreTimeout     time.Duration
+
+	// StreamCommandOutput, if true, prints the output of backup, pre-transfer, and restore commands
+	// line by line as it is produced (prefixed with the stage), instead of only after the command exits.
+	StreamCommandOutput bool
+
+	// OutputTailLines is the number of trailing lines of the output of the backup, pre-transfer, and
+	// restore commands kept in StageReport.Output, for successful and failed stages alike (e.g., the
+	// rows affected or the replication coordinates printed by a dump). Secrets such as "password=..."
+	// are redacted, and at most 64 KiB are kept. 0 keeps nothing, so that sensitive command output is
+	// only retained when asked for.
+	OutputTailLines int
+
+	// SampledVerify, if a percentage or count is set, verifies a random sample of the transferred
+	// files by checksum after the transfer (see SampledVerifyOption).
+	SampledVerify SampledVerifyOption
+
+	// DirectoryStats, if Depth is set, breaks down the files sent by the transfer by directory
+	// (TransferResult.Directories), and PrintSummary shows the top directories.
+	DirectoryStats DirectoryStatsOption
+
+	// RedactionMode, if RedactionShareable, makes command errors (*OperationError) hide hosts,
+	// usernames, and data paths, so they can be pasted into public issue trackers.
+	// Empty or RedactionNone reports them verbatim.
+	RedactionMode RedactionMode
 }
 
 // isRemote determines if the EndpointDetails represent a remote endpoint.
@@ -57,20 +588,65 @@ func (e *EndpointDetails) isRemote() bool {
 
 // getRsyncPath constructs the path string suitable for rsync (e.g., "user@host:/path" or "/local/path").
 func (e *EndpointDetails) getRsyncPath() string {
+	return e.rsyncPathFor(e.DataPath)
+}
+
+// rsyncPathFor constructs the rsync path string of dataPath on this endpoint.
+// A relative path starting with a dash is prefixed with "./" (see dashSafePath).
+func (e *EndpointDetails) rsyncPathFor(dataPath string) string {
+	dataPath = dashSafePath(dataPath)
 	if e.isRemote() {
 		if strings.TrimSpace(e.Username) != "" {
-			return fmt.Sprintf("%s@%s:%s", e.Username, e.HostIP, e.DataPath)
+			return fmt.Sprintf("%s@%s:%s", e.Username, e.HostIP, dataPath)
 		}
-		return fmt.Sprintf("%s:%s", e.HostIP, e.DataPath) // Username might be optional if SSH config handles it
+		return fmt.Sprintf("%s:%s", e.HostIP, dataPath) // Username might be optional if SSH config handles it
+	}
+	return dataPath
+}
+
+// rsyncPathRoot returns the rsync path of the directory the names of a transfer of dataPath are
+// relative to (in --files-from and --out-format %n), and the prefix of those names: dataPath itself
+// if it has a trailing slash, or else its parent, with the name of dataPath as the prefix.
+func (e *EndpointDetails) rsyncPathRoot(dataPath string) (rsyncPath, prefix string) {
+	if strings.HasSuffix(dataPath, "/") {
+		return e.rsyncPathFor(dataPath), ""
 	}
-	return e.DataPath
+	parent := path.Dir(dataPath)
+	if !strings.HasSuffix(parent, "/") {
+		parent += "/"
+	}
+	return e.rsyncPathFor(parent), path.Base(dataPath) + "/"
+}
+
+// dataPaths returns DataPath followed by AdditionalDataPaths.
+func (e *EndpointDetails) dataPaths() []string {
+	return append([]string{e.DataPath}, e.AdditionalDataPaths...)
+}
+
+// rsyncSourcePaths returns the rsync path strings of all data paths of the endpoint, used as source arguments.
+func (e *EndpointDetails) rsyncSourcePaths() []string {
+	var paths []string
+	for _, p := range e.dataPaths() {
+		paths = append(paths, e.rsyncPathFor(p))
+	}
+	return paths
+}
+
+// displayPath returns the endpoint in a human-readable form (e.g., "user@host:/path", "/local/path", or the URL).
+func (e *EndpointDetails) displayPath() string {
+	if e.isURL() {
+		return e.URL
+	}
+	return e.getRsyncPath()
 }
 
 // IsRelayMode determines if both source and destination endpoints are remote.
 // This is used to identify relay migration scenarios where data needs to flow through the local machine
 // as an intermediary between two remote endpoints.
+//
+// Deprecated: Use Topology, which also distinguishes the direct topologies.
 func (task *DataMigrationModel) IsRelayMode() bool {
-	return task.Source.isRemote() && task.Destination.isRemote()
+	return task.Topology() == RemoteToRemoteRelay
 }
 
 // Validate checks if the fields of DataMigrationModel satisfy basic requirements for an rsync task.
@@ -78,12 +654,38 @@ func Validate(task DataMigrationModel) error {
 	sourceRsyncPath := task.Source.getRsyncPath()
 	destRsyncPath := task.Destination.getRsyncPath()
 
-	if strings.TrimSpace(sourceRsyncPath) == "" || strings.TrimSpace(task.Source.DataPath) == "" {
+	if task.Source.isURL() {
+		if err := task.validateURLSource(); err != nil {
+			return fmt.Errorf("invalid URL source: %w", err)
+		}
+	} else if strings.TrimSpace(sourceRsyncPath) == "" || strings.TrimSpace(task.Source.DataPath) == "" {
 		return fmt.Errorf("source path must be provided for rsync task")
 	}
 	if strings.TrimSpace(destRsyncPath) == "" || strings.TrimSpace(task.Destination.DataPath) == "" {
 		return fmt.Errorf("destination path must be provided for rsync task")
 	}
+	if task.Destination.isURL() {
+		return fmt.Errorf("URL is a source type; the destination must be a path")
+	}
+
+	if task.WorkflowOptions.RequireAbsolutePaths {
+		if !task.Source.isURL() && !strings.HasPrefix(task.Source.DataPath, "/") {
+			return fmt.Errorf("source path '%s' must be absolute (relative paths resolve against the SSH home or working directory)", task.Source.DataPath)
+		}
+		if !strings.HasPrefix(task.Destination.DataPath, "/") {
+			return fmt.Errorf("destination path '%s' must be absolute (relative paths resolve against the SSH home or working directory)", task.Destination.DataPath)
+		}
+	}
+
+	if err := task.validateBackupEndpoint(); err != nil {
+		return fmt.Errorf("invalid backup endpoint: %w", err)
+	}
+	if err := task.Source.validateContainer(); err != nil {
+		return fmt.Errorf("invalid source container: %w", err)
+	}
+	if err := task.Destination.validateContainer(); err != nil {
+		return fmt.Errorf("invalid destination container: %w", err)
+	}
 
 	// Validate SSH port for source if it's a remote endpoint
 	if task.Source.isRemote() {
@@ -103,161 +705,1358 @@ func Validate(task DataMigrationModel) error {
 			return fmt.Errorf("destination HostIP must be provided for remote rsync task")
 		}
 	}
+	opts := task.RsyncOptions
+	if len(opts.CommandWrapper) > 0 {
+		if _, err := exec.LookPath(opts.CommandWrapper[0]); err != nil {
+			return fmt.Errorf("command wrapper '%s' not found: %w", opts.CommandWrapper[0], err)
+		}
+	}
+	if task.WorkflowOptions.OutputTailLines < 0 {
+		return fmt.Errorf("OutputTailLines must not be negative (0 keeps no output)")
+	}
+	if strings.TrimSpace(task.WorkflowOptions.StateFile) != "" && opts.DryRun {
+		return fmt.Errorf("StateFile cannot be combined with DryRun (a dry run completes no stage)")
+	}
+	if opts.MungeLinks && task.Topology() != RemoteToRemoteRelay {
+		return fmt.Errorf("MungeLinks only applies to relay mode (it munges the symlinks of the local staging directory)")
+	}
+	if err := task.validateRelayStreaming(); err != nil {
+		return err
+	}
+	if opts.DeleteDelay && !opts.Delete {
+		return fmt.Errorf("DeleteDelay only applies to delete-enabled transfers; enable Delete or drop it")
+	}
+	if opts.RemoteShellCommand != "" {
+		shell := strings.Fields(opts.RemoteShellCommand)
+		if len(shell) == 0 {
+			return fmt.Errorf("RemoteShellCommand must not be blank")
+		}
+		if _, err := exec.LookPath(shell[0]); err != nil {
+			return fmt.Errorf("remote shell command '%s' not found: %w", shell[0], err)
+		}
+	}
+	if (opts.NoPerms || opts.NoOwner || opts.NoGroup || opts.NoTimes) && !opts.Archive {
+		return fmt.Errorf("NoPerms, NoOwner, NoGroup, and NoTimes only apply to archive mode; enable Archive or drop them")
+	}
+	if !opts.StopAt.IsZero() && opts.TimeLimit != 0 {
+		return fmt.Errorf("StopAt and TimeLimit are mutually exclusive")
+	}
+	if !opts.StopAt.IsZero() && !opts.StopAt.After(time.Now()) {
+		return fmt.Errorf("StopAt %s is not in the future", opts.StopAt.Format(time.RFC3339))
+	}
+	if opts.TimeLimit < 0 || (opts.TimeLimit > 0 && (opts.TimeLimit < time.Minute || opts.TimeLimit%time.Minute != 0)) {
+		return fmt.Errorf("TimeLimit %s must be a positive whole number of minutes", opts.TimeLimit)
+	}
+	if opts.RemoveSourceFiles {
+		if !task.WorkflowOptions.ForceRemoveSourceFiles {
+			return fmt.Errorf("RemoveSourceFiles deletes files from the source; set ForceRemoveSourceFiles to confirm")
+		}
+		if task.Source.isContainer() && task.Source.VolumeHostPath == "" {
+			return fmt.Errorf("RemoveSourceFiles requires VolumeHostPath for a container source (staged copies cannot remove the originals)")
+		}
+	}
+	if err := task.validateSourceReadOnly(); err != nil {
+		return fmt.Errorf("source read-only guarantee violated: %w", err)
+	}
+	if err := task.validateMtimeSplit(); err != nil {
+		return fmt.Errorf("invalid mtime split: %w", err)
+	}
+	if err := task.validateSymlinks(); err != nil {
+		return fmt.Errorf("invalid symlink options: %w", err)
+	}
+	if err := task.validateBigFile(); err != nil {
+		return fmt.Errorf("invalid big-file mode: %w", err)
+	}
+	if err := task.validateRsyncBatch(); err != nil {
+		return fmt.Errorf("invalid rsync batch: %w", err)
+	}
+	if err := task.validateSampledVerify(); err != nil {
+		return fmt.Errorf("invalid sampled verification: %w", err)
+	}
+	if err := task.WorkflowOptions.DirectoryStats.validate(); err != nil {
+		return err
+	}
+	if err := task.WorkflowOptions.HealthCheck.validate(); err != nil {
+		return err
+	}
+	if err := task.WorkflowOptions.AutoTune.validate(); err != nil {
+		return err
+	}
+	if err := task.Source.ExpectedHostIdentity.validate(); err != nil {
+		return fmt.Errorf("invalid source ExpectedHostIdentity: %w", err)
+	}
+	if err := task.Destination.ExpectedHostIdentity.validate(); err != nil {
+		return fmt.Errorf("invalid destination ExpectedHostIdentity: %w", err)
+	}
+	if err := task.validateFallbackBackends(); err != nil {
+		return fmt.Errorf("invalid fallback backends: %w", err)
+	}
+	if err := task.validateBackend(); err != nil {
+		return fmt.Errorf("invalid backend: %w", err)
+	}
+	if err := task.RsyncOptions.Retry.validate(); err != nil {
+		return fmt.Errorf("invalid retry policy: %w", err)
+	}
+	if err := task.RsyncOptions.ChecksumAlgorithm.validate(); err != nil {
+		return err
+	}
+	if task.RsyncOptions.MaxCapturedOutput < 0 {
+		return fmt.Errorf("MaxCapturedOutput must not be negative")
+	}
+	if mode := task.RsyncOptions.CreateDestDirMode; mode&^os.ModePerm != 0 || (mode != 0 && mode&0700 != 0700) {
+		return fmt.Errorf("CreateDestDirMode %#o must be a permission mode granting the owner full access (e.g., 0755)", uint32(mode))
+	}
+	if mode := task.RsyncOptions.SessionDirMode; mode&^os.ModePerm != 0 || (mode != 0 && mode&0700 != 0700) {
+		return fmt.Errorf("SessionDirMode %#o must be a permission mode granting the owner full access (e.g., 0750)", uint32(mode))
+	}
+	if task.RsyncOptions.StallTimeout < 0 {
+		return fmt.Errorf("StallTimeout must not be negative")
+	}
+	if task.RsyncOptions.FileEventBuffer < 0 {
+		return fmt.Errorf("FileEventBuffer must not be negative")
+	}
+	if task.RsyncOptions.StallTimeout > 0 && len(task.RsyncOptions.MtimeSplit.Boundaries) > 0 {
+		return fmt.Errorf("StallTimeout cannot be combined with MtimeSplit")
+	}
+	if task.RsyncOptions.StagingMaxAge < 0 {
+		return fmt.Errorf("StagingMaxAge must not be negative")
+	}
+	if task.RsyncOptions.TempDir != "" {
+		if strings.TrimSpace(task.RsyncOptions.TempDir) == "" {
+			return fmt.Errorf("TempDir must not be blank")
+		}
+		if task.Destination.isContainer() {
+			return fmt.Errorf("TempDir is not supported with a container destination")
+		}
+	}
+	if task.RsyncOptions.BandwidthLimitKBps < 0 || task.RsyncOptions.DownloadBandwidthLimitKBps < 0 || task.RsyncOptions.UploadBandwidthLimitKBps < 0 {
+		return fmt.Errorf("bandwidth limits must not be negative")
+	}
+	if task.RsyncOptions.StagingLockMaxAge < 0 {
+		return fmt.Errorf("StagingLockMaxAge must not be negative")
+	}
+	if err := task.RsyncOptions.RateLimit.validate(); err != nil {
+		return fmt.Errorf("invalid rate limit: %w", err)
+	}
+	if err := task.RsyncOptions.OwnershipMap.validate(); err != nil {
+		return fmt.Errorf("invalid ownership map: %w", err)
+	}
+	if err := task.validateFilesFrom(); err != nil {
+		return err
+	}
+	if err := task.validateMultiSource(); err != nil {
+		return fmt.Errorf("invalid multi-source transfer: %w", err)
+	}
+	switch task.WorkflowOptions.RedactionMode {
+	case "", RedactionNone, RedactionShareable:
+	default:
+		return fmt.Errorf("unknown redaction mode '%s' (use '%s' or '%s')", task.WorkflowOptions.RedactionMode, RedactionNone, RedactionShareable)
+	}
 	// The existence of SSHPrivateKey path etc. will be handled by the ssh command at runtime.
 	// The Validate function primarily checks for structural issues.
 	return nil
 }
 
+// validateMultiSource checks a transfer that consolidates several source paths (Source.AdditionalDataPaths).
+// Paths must be distinct and must not place two directories of the same name in the destination.
+// With --delete, any destination file missing from all sources is removed (and one unmounted source
+// makes its files disappear from the destination), so Delete requires WorkflowOption.ForceMultiSourceDelete.
+func (task *DataMigrationModel) validateMultiSource() error {
+	if len(task.Destination.AdditionalDataPaths) > 0 {
+		return fmt.Errorf("AdditionalDataPaths is only supported on the source")
+	}
+	if len(task.Source.AdditionalDataPaths) == 0 {
+		return nil
+	}
+	if task.Source.isContainer() || task.Destination.isContainer() {
+		return fmt.Errorf("multiple source paths are not supported with container endpoints")
+	}
+	if len(task.RsyncOptions.MtimeSplit.Boundaries) > 0 {
+		return fmt.Errorf("multiple source paths cannot be combined with MtimeSplit")
+	}
+	if task.RsyncOptions.Delete && !task.WorkflowOptions.ForceMultiSourceDelete {
+		return fmt.Errorf("Delete with multiple source paths removes destination files missing from every source; set ForceMultiSourceDelete to confirm")
+	}
+
+	seenPaths := map[string]bool{}
+	seenNames := map[string]string{}
+	for _, p := range task.Source.dataPaths() {
+		if strings.TrimSpace(p) == "" {
+			return fmt.Errorf("source paths must not be empty")
+		}
+		if task.WorkflowOptions.RequireAbsolutePaths && !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("source path '%s' must be absolute (relative paths resolve against the SSH home or working directory)", p)
+		}
+		cleaned := path.Clean(p)
+		if seenPaths[cleaned] {
+			return fmt.Errorf("source path '%s' is listed more than once", p)
+		}
+		seenPaths[cleaned] = true
+
+		// Without a trailing slash, rsync creates a directory named after the path in the destination
+		if !strings.HasSuffix(p, "/") {
+			name := path.Base(cleaned)
+			if other, ok := seenNames[name]; ok {
+				return fmt.Errorf("source paths '%s' and '%s' would both be copied to '%s' in the destination", other, p, name)
+			}
+			seenNames[name] = p
+		}
+	}
+	return nil
+}
+
 // Transfer runs the rsync command to transfer data as defined by the given DataMigrationModel.
 func Transfer(task DataMigrationModel) error {
-	if err := Validate(task); err != nil {
-		return fmt.Errorf("rsync task validation failed: %w", err)
+	return TransferContext(context.Background(), task)
+}
+
+// TransferContext is like Transfer but kills the rsync processes (in relay mode, both legs) when ctx
+// is canceled or its deadline expires; temporary resources such as the relay staging directory are
+// removed as on a failure. The error of an interrupted transfer matches ctx.Err() with errors.Is
+// and includes the failed command.
+func TransferContext(ctx context.Context, task DataMigrationModel) error {
+	_, err := TransferWithResultContext(ctx, task)
+	return err
+}
+
+// TransferWithResult is like Transfer and also returns the statistics of the transfer, parsed from
+// rsync's --stats output (always requested); in relay mode, those of each leg are in Download and
+// Upload. The result may be nil if the transfer failed.
+func TransferWithResult(task DataMigrationModel) (*TransferResult, error) {
+	return TransferWithResultContext(context.Background(), task)
+}
+
+// TransferWithResultContext is like TransferWithResult but cancelable like TransferContext.
+func TransferWithResultContext(ctx context.Context, task DataMigrationModel) (*TransferResult, error) {
+	task.attachAuditTrail()
+	if _, err := task.confirmDangerousOperations(ctx); err != nil {
+		return nil, err
 	}
+	return transfer(ctx, task)
+}
 
-	// Check if we're operating in relay mode (both source and destination are remote)
-	isRelayMode := task.IsRelayMode()
+// TransferWithProgress is like Transfer and delivers the progress of the transfer to onProgress as
+// rsync reports it (see RsyncOption.OnProgress, which onProgress is combined with). The output of
+// rsync, including its error messages, is still captured for the error on failure.
+func TransferWithProgress(task DataMigrationModel, onProgress func(ProgressEvent)) error {
+	if onProgress != nil {
+		next := task.RsyncOptions.OnProgress
+		task.RsyncOptions.OnProgress = func(event ProgressEvent) {
+			onProgress(event)
+			if next != nil {
+				next(event)
+			}
+		}
+	}
+	return Transfer(task)
+}
+
+// TransferWithStats is like Transfer and also returns the summary of the transfer statistics (see
+// TransferResult.Stats), e.g., to record per-migration metrics. The statistics are zero if the
+// transfer failed before rsync reported them.
+func TransferWithStats(task DataMigrationModel) (TransferStats, error) {
+	result, err := TransferWithResult(task)
+	return result.Stats(), err
+}
+
+// sourceWritingRsyncArgs returns the rsync arguments in args that modify the sending side.
+func sourceWritingRsyncArgs(args []string) []string {
+	var found []string
+	for _, arg := range args {
+		if arg == "--remove-source-files" || arg == "--remove-sent-files" {
+			found = append(found, arg)
+		}
+	}
+	return found
+}
+
+// validateSourceReadOnly checks that no setting of the task modifies the source when
+// WorkflowOptions.SourceReadOnly is set.
+func (task *DataMigrationModel) validateSourceReadOnly() error {
+	if !task.WorkflowOptions.SourceReadOnly {
+		return nil
+	}
+	if strings.TrimSpace(task.Source.BackupCmd) != "" && task.BackupEndpoint == nil && !task.WorkflowOptions.AllowSourceBackupCmd {
+		return fmt.Errorf("source BackupCmd runs on the source and may modify it; set AllowSourceBackupCmd to acknowledge it is read-only")
+	}
+	// Deletions (--delete) only affect the receiver, but options that remove files on the
+	// sender would modify the source, whether it is pulled from or pushed from this host.
+	_, args := buildRsyncArgs(*task)
+	if found := sourceWritingRsyncArgs(args); len(found) > 0 {
+		return fmt.Errorf("rsync option(s) %s modify the source", strings.Join(found, ", "))
+	}
+	return nil
+}
+
+// shouldCompress resolves whether rsync should compress data, applying CompressAuto when set.
+func (task *DataMigrationModel) shouldCompress() bool {
+	if task.RsyncOptions.Compress {
+		return true
+	}
+	if task.RsyncOptions.CompressAuto {
+		return task.Source.isRemote() || task.Destination.isRemote()
+	}
+	return false
+}
+
+// remotePathSpecialChars are the characters that a remote shell would split or glob in a path.
+const remotePathSpecialChars = " \t\n*?["
+
+// protectArgs reports whether rsync must run with --protect-args and why: it is requested by
+// ProtectArgs or needed because a remote path contains whitespace or glob metacharacters,
+// which the remote shell would otherwise word-split or expand.
+// File lists passed with --files-from are unaffected, as they are never parsed by a shell.
+func (task *DataMigrationModel) protectArgs() (bool, string) {
+	if task.RsyncOptions.ProtectArgs {
+		return true, "ProtectArgs is set"
+	}
+	if task.Source.isRemote() {
+		for _, p := range task.Source.dataPaths() {
+			if strings.ContainsAny(p, remotePathSpecialChars) {
+				return true, fmt.Sprintf("remote source path '%s' contains whitespace or glob characters", p)
+			}
+		}
+	}
+	if task.Destination.isRemote() && strings.ContainsAny(task.Destination.DataPath, remotePathSpecialChars) {
+		return true, fmt.Sprintf("remote destination path '%s' contains whitespace or glob characters", task.Destination.DataPath)
+	}
+	return false, ""
+}
+
+// wantsProgress reports whether the single-process transfers of the task stream progress
+// (--info=progress2): if a progress consumer is attached, or to keep a healthy transfer producing
+// output for the stall detection.
+func (task *DataMigrationModel) wantsProgress() bool {
+	return (task.RsyncOptions.progressFunc() != nil || task.RsyncOptions.StallTimeout > 0) && len(task.RsyncOptions.MtimeSplit.Boundaries) == 0
+}
+
+// buildRsyncArgs returns the rsync executable path and the option arguments (without the
+// source and destination paths) for the given task.
+func buildRsyncArgs(task DataMigrationModel) (string, []string) {
+	rsyncCmdPath, args := buildRsyncArgList(task)
+	return rsyncCmdPath, args.values()
+}
 
+// buildRsyncArgList is like buildRsyncArgs, but returns the arguments with their origins.
+func buildRsyncArgList(task DataMigrationModel) (string, rsyncArgList) {
 	rsyncCmdPath := task.RsyncOptions.RsyncPath
 	if rsyncCmdPath == "" {
 		rsyncCmdPath = "rsync" // Use system default rsync
 	}
 
-	var args []string
-	// Configure basic rsync options
-	if task.RsyncOptions.Archive {
-		args = append(args, "-a")
+	var args rsyncArgList
+	// Configure basic rsync options
+	if task.RsyncOptions.Archive {
+		args.option("RsyncOptions.Archive", "-a")
+	}
+	if task.RsyncOptions.Compress {
+		args.option("RsyncOptions.Compress", "-z")
+	} else if task.shouldCompress() {
+		args.auto("RsyncOptions.CompressAuto: a remote endpoint", "-z")
+	}
+	if task.RsyncOptions.Verbose {
+		args.option("RsyncOptions.Verbose", "-v")
+	}
+	if task.RsyncOptions.Delete {
+		args.option("RsyncOptions.Delete", "--delete")
+	}
+	if task.RsyncOptions.DeleteDelay {
+		args.option("RsyncOptions.DeleteDelay", "--delete-delay")
+	}
+	if task.RsyncOptions.Progress {
+		args.option("RsyncOptions.Progress", "--progress")
+	}
+	if task.RsyncOptions.DryRun {
+		args.option("RsyncOptions.DryRun", "-n") // or "--dry-run"
+	}
+	if task.RsyncOptions.RemoveSourceFiles {
+		args.option("RsyncOptions.RemoveSourceFiles", "--remove-source-files")
+	}
+	if task.RsyncOptions.Update {
+		args.option("RsyncOptions.Update", "-u")
+	}
+	if task.RsyncOptions.WholeFile {
+		args.option("RsyncOptions.WholeFile", "-W")
+	}
+	if task.RsyncOptions.Partial {
+		args.option("RsyncOptions.Partial", "--partial")
+	}
+	if arg := task.RsyncOptions.tempDirArg(); arg != "" {
+		args.option("RsyncOptions.TempDir", arg)
+	}
+	if arg := task.RsyncOptions.bwlimitArg(""); arg != "" {
+		args.option("RsyncOptions.BandwidthLimitKBps", arg)
+	}
+	if task.RsyncOptions.CopyDirlinks {
+		// Source side only: unlike --keep-dirlinks (-K), which keeps symlinked directories on the
+		// receiver instead of replacing them, -k changes what is sent
+		args.option("RsyncOptions.CopyDirlinks", "-k")
+	}
+	if task.RsyncOptions.MungeLinks {
+		// --munge-links only affects the local side: the download leg (local receiver) stores the
+		// symlinks of the staging directory munged ("/rsyncd-munged/" prefixed, so they cannot be
+		// followed out of the tree), and the upload leg (local sender) unmunges them again, so the
+		// destination receives the original targets
+		args.option("RsyncOptions.MungeLinks", "--munge-links")
+	}
+	if protect, reason := task.protectArgs(); protect {
+		if task.RsyncOptions.ProtectArgs {
+			args.option("RsyncOptions.ProtectArgs", "-s")
+		} else {
+			args.auto(reason, "-s")
+		}
+	}
+	if !task.RsyncOptions.StopAt.IsZero() {
+		args.option("RsyncOptions.StopAt", "--stop-at="+task.RsyncOptions.StopAt.Local().Format("2006-01-02T15:04"))
+	}
+	if task.RsyncOptions.TimeLimit > 0 {
+		args.option("RsyncOptions.TimeLimit", "--time-limit="+strconv.Itoa(int(task.RsyncOptions.TimeLimit/time.Minute)))
+	}
+
+	// Selectively drop attributes preserved by archive mode
+	if task.RsyncOptions.NoPerms {
+		args.option("RsyncOptions.NoPerms", "--no-perms")
+	}
+	if task.RsyncOptions.NoOwner {
+		args.option("RsyncOptions.NoOwner", "--no-owner")
+	}
+	if task.RsyncOptions.NoGroup {
+		args.option("RsyncOptions.NoGroup", "--no-group")
+	}
+	if task.RsyncOptions.NoTimes {
+		args.option("RsyncOptions.NoTimes", "--no-times")
+	}
+
+	// Configure the file list, and Exclude and Include options
+	if len(task.RsyncOptions.FilesFromList) > 0 {
+		file := task.RsyncOptions.filesFromFile
+		if file == "" {
+			file = filesFromPlaceholder
+		}
+		args.option("RsyncOptions.FilesFromList", "--files-from="+file)
+	}
+	filterFile := task.RsyncOptions.filterFile
+	if _, argBytes := task.RsyncOptions.filterRules(); filterFile == "" && argBytes > maxFilterArgBytes {
+		filterFile = filterFilePlaceholder // A preview shows the merge file the transfer will write
+	}
+	if filterFile != "" {
+		args.auto("RsyncOptions.Exclude/Include: too many patterns for the command line", "--filter=merge "+filterFile)
+	} else {
+		for _, ex := range task.RsyncOptions.Exclude {
+			if strings.TrimSpace(ex) != "" {
+				args.option("RsyncOptions.Exclude", "--exclude="+ex)
+			}
+		}
+		for _, inc := range task.RsyncOptions.Include {
+			if strings.TrimSpace(inc) != "" {
+				args.option("RsyncOptions.Include", "--include="+inc)
+			}
+		}
+		for _, junk := range task.RsyncOptions.junkExcludes() {
+			args.option("RsyncOptions.ExcludeCommonJunk", "--exclude="+junk)
+		}
+	}
+
+	// Configure ownership translation
+	args.option("RsyncOptions.OwnershipMap", task.RsyncOptions.OwnershipMap.args()...)
+
+	// Always request statistics so the transfer result can be reported
+	args.auto("transfer statistics (always requested)", "--stats")
+
+	// Log the transferred entries so the sampled verification can draw from them,
+	// the per-directory statistics can be computed, and OnFile can be called
+	if task.WorkflowOptions.SampledVerify.enabled() || task.WorkflowOptions.DirectoryStats.enabled() || task.RsyncOptions.OnFile != nil {
+		args.auto("transferred file log for WorkflowOptions.SampledVerify/DirectoryStats and RsyncOptions.OnFile", "--out-format="+dryRunEntryPrefix+"%i:%l:%n")
+	}
+
+	// // Configure extra rsync arguments
+	// if len(task.RsyncOptions.ExtraArgs) > 0 {
+	// 	args = append(args, task.RsyncOptions.ExtraArgs...)
+	// }
+
+	// Configure SSH options (-e)
+	// rsync uses only one remote shell command.
+	// If the source is remote, SSH settings for source connection are used.
+	// If the source is local and destination is remote, SSH settings for destination connection are used.
+	var sshOptString string
+	var activeRemoteEndpointForRsync EndpointDetails
+	operationInvolvesRemoteRsync := false
+
+	if task.Source.isRemote() {
+		activeRemoteEndpointForRsync = task.Source
+		operationInvolvesRemoteRsync = true
+	} else if task.Destination.isRemote() {
+		activeRemoteEndpointForRsync = task.Destination
+		operationInvolvesRemoteRsync = true
+	}
+
+	if operationInvolvesRemoteRsync && strings.TrimSpace(task.RsyncOptions.RemoteShellCommand) != "" {
+		sshOptString = task.RsyncOptions.RemoteShellCommand // Used as is instead of the constructed ssh command
+		args.option("RsyncOptions.RemoteShellCommand", "-e", sshOptString)
+	} else if operationInvolvesRemoteRsync {
+		// Username and HostIP are part of the rsync path, not the -e ssh command for rsync
+		sshCmdParts := sshBaseArgs(activeRemoteEndpointForRsync, task.RsyncOptions)
+		if len(sshCmdParts) > 1 { // Only override rsync's default remote shell if options are needed
+			sshOptString = strings.Join(sshCmdParts, " ")
+			args.auto("ssh settings of the remote endpoint", "-e", sshOptString)
+		}
+	}
+
+	return rsyncCmdPath, args
+}
+
+// rsyncLegArgs returns the arguments of one rsync process of a transfer: the option arguments,
+// the progress arguments, and the source paths and the destination path after "--".
+func rsyncLegArgs(args, progressArgs, sources []string, destination string) []string {
+	legArgs := make([]string, 0, len(args)+len(progressArgs)+len(sources)+2)
+	legArgs = append(legArgs, args...)
+	legArgs = append(legArgs, progressArgs...)
+	return append(legArgs, rsyncPathArgs(sources, destination)...)
+}
+
+// relayArgs derives the option arguments of a relay transfer from those of a direct one (see
+// buildRsyncArgs). shared are the arguments both legs agree on (e.g., for verifying the destination
+// against the staging directory); download and upload are those of each leg, which exclude the
+// staging manifest if useManifest is set.
+func relayArgs(task DataMigrationModel, args []string, useManifest bool) (shared, download, upload []string) {
+	// Source files must not be removed by the download leg, before the data reached the destination
+	shared = withoutArg(args, "--remove-source-files")
+	// The temp dir is on the destination, so only the upload leg uses it
+	tempDirArg := task.RsyncOptions.tempDirArg()
+	if tempDirArg != "" {
+		shared = withoutArg(shared, tempDirArg)
+	}
+	// Each leg has its own bandwidth limit
+	shared = withoutArg(shared, task.RsyncOptions.bwlimitArg(""))
+
+	legArgs := shared
+	if useManifest {
+		legArgs = append([]string{stagingManifestExclude}, shared...)
+	}
+	download = withArg(legArgs, task.RsyncOptions.bwlimitArg(RelayDownload))
+	upload = withArg(withArg(legArgs, tempDirArg), task.RsyncOptions.bwlimitArg(RelayUpload))
+	return shared, download, upload
+}
+
+// rsyncPathArgs returns the positional path arguments of rsync: the end-of-options marker "--",
+// so that no path is taken for an option, followed by the source paths and the destination path.
+func rsyncPathArgs(sources []string, destination string) []string {
+	pathArgs := append([]string{"--"}, sources...)
+	return append(pathArgs, destination)
+}
+
+// transfer runs the rsync transfer and returns the statistics parsed from rsync's --stats output.
+// In relay mode, the top-level statistics are those of the upload leg (what reached the destination),
+// and both legs are available in Download and Upload. A failed relay transfer still returns a result
+// carrying the RelayStagingPath.
+// If rsync is missing on a remote endpoint, the RsyncOption.FallbackBackends are tried in order.
+// With DataMigrationModel.Backend, the data is moved by that backend instead.
+func transfer(ctx context.Context, task DataMigrationModel) (*TransferResult, error) {
+	result, _, err := transferWithFallback(ctx, task)
+	return result, err
+}
+
+// transferWithFallback runs the transfer like transfer and also returns the attempt of each backend.
+func transferWithFallback(ctx context.Context, task DataMigrationModel) (*TransferResult, []TransferAttempt, error) {
+	if err := Validate(task); err != nil {
+		return nil, nil, fmt.Errorf("rsync task validation failed: %w", err)
+	}
+	if task.RsyncOptions.stage == "" {
+		task.RsyncOptions.stage = StageTransfer
+	}
+	if task.Source.isURL() {
+		fetched, _, release, err := fetchURLSource(ctx, task)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer release()
+		task = fetched
+	}
+	if _, err := task.resolveSymlinks(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	if task.RsyncOptions.usage == nil {
+		task.RsyncOptions.usage = &usageAccumulator{}
+	}
+	task, releaseFilters, err := spillFilterRules(task)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer releaseFilters()
+	var result *TransferResult
+	var attempts []TransferAttempt
+	if task.usesCustomBackend() {
+		result, err = runCustomBackend(ctx, task)
+		attempts = []TransferAttempt{newTransferAttempt(task.Backend, err)}
+	} else {
+		result, attempts, err = transferWithBackends(ctx, task)
+	}
+	if err == nil {
+		err = createDestinationSymlink(ctx, task)
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("transfer timed out: %w: %w", ctx.Err(), err)
+	} else if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		err = fmt.Errorf("transfer was canceled: %w: %w", ctx.Err(), err)
+	}
+	if result != nil {
+		result.Usage = task.RsyncOptions.usage.snapshot()
+	}
+	return result, attempts, err
+}
+
+// transferWithBackends runs the transfer of a validated task with rsync, falling back to the
+// RsyncOption.FallbackBackends if rsync is missing on a remote endpoint.
+func transferWithBackends(ctx context.Context, task DataMigrationModel) (*TransferResult, []TransferAttempt, error) {
+	// Guard against wiping the destination with an empty (e.g., unmounted) source
+	if task.shouldCheckEmptySource() {
+		if err := checkSourceNotEmpty(task); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// A single huge file is transferred by parallel byte ranges if requested
+	if task.RsyncOptions.BigFileParallelStreams > 1 && !task.RsyncOptions.DryRun {
+		result, handled, err := transferBigFile(ctx, task)
+		if handled {
+			return result, []TransferAttempt{newTransferAttempt(BackendBigFile, err)}, err
+		}
+		fmt.Println("Big-file transfer: the source is not a non-empty regular file; transferring it with rsync")
+	}
+
+	// A relay task is streamed through this machine without staging if requested
+	if task.RsyncOptions.RelayStreaming && task.Topology() == RemoteToRemoteRelay {
+		result, streamed, err := streamRelay(ctx, task)
+		if streamed {
+			return result, []TransferAttempt{newTransferAttempt(BackendTar, err)}, err
+		}
+	}
+
+	// Container endpoints are transferred through their host (volume path or staging dir)
+	var result *TransferResult
+	var err error
+	if task.Source.isContainer() || task.Destination.isContainer() {
+		result, err = transferWithContainers(ctx, task)
+	} else {
+		result, err = runRsyncTransfer(ctx, task)
+	}
+	attempts := []TransferAttempt{newTransferAttempt(BackendRsync, err)}
+	if err == nil || !IsRemoteRsyncMissing(err) || ctx.Err() != nil {
+		return result, attempts, err
+	}
+
+	for _, backend := range task.RsyncOptions.FallbackBackends {
+		fmt.Printf("rsync is not available on the remote endpoint; falling back to the %s backend...\n", backend)
+		result, err = runFallbackBackend(ctx, task, backend)
+		attempts = append(attempts, newTransferAttempt(backend, err))
+		if err == nil {
+			return result, attempts, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return result, attempts, err
+}
+
+// runRsyncTransfer executes the rsync transfer for an already validated task.
+func runRsyncTransfer(ctx context.Context, task DataMigrationModel) (*TransferResult, error) {
+	startTime := time.Now()
+
+	// Check if we're operating in relay mode (both source and destination are remote)
+	isRelayMode := task.Topology() == RemoteToRemoteRelay
+
+	rsyncCmdPath, args := buildRsyncArgs(task)
+	if protect, reason := task.protectArgs(); protect && task.RsyncOptions.Verbose {
+		fmt.Printf("Debug: using --protect-args (%s)\n", reason)
+	}
+	if junk := task.RsyncOptions.junkExcludes(); len(junk) > 0 {
+		fmt.Printf("Excluding common junk: %s\n", strings.Join(junk, ", "))
+	}
+	if task.RsyncOptions.Verbose {
+		fmt.Println("Effective rsync options:")
+		printEffectiveRsyncArgs(os.Stdout, effectiveRsyncArgs(task), "  ")
+	}
+
+	if !task.RsyncOptions.StopAt.IsZero() || task.RsyncOptions.TimeLimit > 0 {
+		if err := requireRsyncVersion(task.RsyncOptions, rsyncCmdPath, 3, 2, 3, "StopAt/TimeLimit"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Stream progress of the single-process transfers if wanted
+	var progressArgs []string
+	if task.wantsProgress() {
+		if err := requireRsyncVersion(task.RsyncOptions, rsyncCmdPath, 3, 1, 0, "Progress reporting (--info=progress2)"); err != nil {
+			return nil, err
+		}
+		progressArgs = []string{"--info=progress2"}
+	}
+	task.RsyncOptions.recorder.progress(len(progressArgs) > 0)
+
+	// Add source and destination paths
+	sourceRsyncPaths := task.Source.rsyncSourcePaths()
+	sourceRsyncPath := strings.Join(sourceRsyncPaths, "', '") // For messages
+	destinationRsyncPath := task.Destination.getRsyncPath()
+
+	// Check if we need to use relay mode (both source and destination are remote)
+	if isRelayMode {
+		// For relay mode, we need to:
+		// 1. Create a temporary directory on the local machine
+		// 2. First download from source to the temp dir
+		// 3. Then upload from the temp dir to the destination
+
+		tempDir, owned, err := relayStagingDir(task.RsyncOptions)
+		keepStaging := false // Set if staging holds the only copy of files removed from the source
+		if err != nil {
+			return nil, err
+		}
+		if !owned {
+			// A staging directory shared between runs is used by one relay transfer at a time
+			unlock, err := lockStagingDir(task.RsyncOptions, tempDir)
+			if err != nil {
+				return nil, err
+			}
+			defer task.RsyncOptions.cleanups.track("relay staging lock "+stagingLockPath(tempDir), unlock)()
+		}
+		if owned && task.RsyncOptions.KeepStaging {
+			fmt.Printf("Relay staging directory will be kept: %s\n", tempDir)
+		} else if owned {
+			// Clean up temp dir when done, unless it holds the only copy of removed source files
+			defer task.RsyncOptions.cleanups.track("relay staging directory "+tempDir, func() error {
+				if keepStaging {
+					fmt.Printf("Relay staging directory kept, since it holds data missing on the destination: %s\n", tempDir)
+					return nil
+				}
+				return removeRelayStagingDir(task.RsyncOptions, tempDir)
+			})()
+		}
+		// The staging path is returned even on failure so callers can inspect kept staging data
+		stagingResult := &TransferResult{RelayStagingPath: tempDir}
+		task.RsyncOptions.recorder.staging(tempDir)
+
+		// A persistent staging directory records the completed download leg in a manifest,
+		// so that a rerun after an interruption can skip straight to the upload leg
+		useManifest := stagingManifestEnabled(task, owned)
+		var downloadLegArgs, uploadLegArgs []string
+		args, downloadLegArgs, uploadLegArgs = relayArgs(task, args, useManifest)
+		removeSourceFiles := task.RsyncOptions.RemoveSourceFiles
+
+		// Step 1: Download from source to temp dir
+		var downloadResult *TransferResult
+		var manifest *stagingManifest
+		if useManifest {
+			manifest = loadStagingManifest(task, tempDir)
+		}
+		if manifest != nil {
+			fmt.Printf("Relay transfer mode: Resuming with the data staged at %s; skipping the download leg\n",
+				manifest.CompletedAt.Format(time.RFC3339))
+			downloadResult = &TransferResult{TotalFileCount: manifest.FileCount, TotalFileSize: manifest.TotalBytes}
+		} else {
+			if useManifest {
+				if err := removeStagingManifest(tempDir); err != nil {
+					return stagingResult, fmt.Errorf("failed to remove outdated staging manifest: %w", err)
+				}
+			}
+			downloadArgs := rsyncLegArgs(downloadLegArgs, progressArgs, sourceRsyncPaths, tempDir+"/")
+			task.RsyncOptions.recorder.command(rsyncCmdPath, downloadArgs)
+
+			fmt.Printf("Relay transfer mode: Downloading from source to local temp dir...\n")
+			var downloadOutput []byte
+			downloadStart := time.Now()
+			err = task.RsyncOptions.retry(ctx, "Relay download", func() error {
+				if err := throttle(ctx, task.RsyncOptions, task.Source); err != nil {
+					return err
+				}
+				downloadCmd := newLocalCommand(ctx, task.RsyncOptions, rsyncCmdPath, downloadArgs...)
+				start := time.Now()
+				var err error
+				downloadOutput, err = runRsyncCommand(ctx, downloadCmd, RelayDownload, task.RsyncOptions)
+				task.RsyncOptions.usage.record(downloadCmd, start)
+				err = task.RsyncOptions.audit.record(downloadCmd.String(), err, task.Source)
+				task.handleDiskFull(err, EndpointDetails{DataPath: tempDir})
+				if err != nil {
+					return &RelayError{Leg: RelayDownload, StagingPath: tempDir,
+						Err: newOperationError(task, StageRelayDownload, fmt.Sprintf("rsync execution failed from '%s' to temp dir", sourceRsyncPath),
+							append([]string{rsyncCmdPath}, downloadArgs...), downloadOutput, err)}
+				}
+				return nil
+			})
+			if err != nil {
+				return stagingResult, err
+			}
+			downloadResult = parseRsyncStats(string(downloadOutput))
+			downloadResult.Duration = time.Since(downloadStart)
+
+			if useManifest {
+				if err := writeStagingManifest(task, tempDir, downloadResult); err != nil {
+					fmt.Printf("Warning: failed to write staging manifest (an interrupted upload will download again): %v\n", err)
+				}
+			}
+		}
+
+		// Step 2: Upload from temp dir to destination
+		uploadArgs := rsyncLegArgs(uploadLegArgs, progressArgs, []string{tempDir + "/"}, destinationRsyncPath)
+		task.RsyncOptions.recorder.command(rsyncCmdPath, uploadArgs)
+
+		fmt.Printf("Relay transfer mode: Uploading from local temp dir to destination...\n")
+		var uploadOutput []byte
+		uploadStart := time.Now()
+		err = task.RsyncOptions.retry(ctx, "Relay upload", func() error {
+			if err := throttle(ctx, task.RsyncOptions, task.Destination); err != nil {
+				return err
+			}
+			uploadCmd := newLocalCommand(ctx, task.RsyncOptions, rsyncCmdPath, uploadArgs...)
+			start := time.Now()
+			var err error
+			uploadOutput, err = runRsyncCommand(ctx, uploadCmd, RelayUpload, task.RsyncOptions)
+			task.RsyncOptions.usage.record(uploadCmd, start)
+			err = task.RsyncOptions.audit.record(uploadCmd.String(), err, task.Destination)
+			task.handleDiskFull(err, task.Destination)
+			if err != nil {
+				return &RelayError{Leg: RelayUpload, StagingPath: tempDir,
+					Err: newOperationError(task, StageRelayUpload, fmt.Sprintf("rsync execution failed from temp dir to '%s'", destinationRsyncPath),
+						append([]string{rsyncCmdPath}, uploadArgs...), uploadOutput, err)}
+			}
+			return nil
+		})
+		if err != nil {
+			return stagingResult, err
+		}
+
+		uploadDuration := time.Since(uploadStart)
+		if useManifest {
+			// The staged data reached the destination; a later run must download again
+			if err := removeStagingManifest(tempDir); err != nil {
+				fmt.Printf("Warning: failed to remove staging manifest: %v\n", err)
+			}
+		}
+
+		fmt.Printf("Relay transfer completed successfully!\n")
+		uploadResult := parseRsyncStats(string(uploadOutput))
+		uploadResult.Duration = uploadDuration
+		if manifest != nil {
+			fmt.Printf("Relay download leg (source read): skipped (resumed from staged data)\n")
+		} else {
+			fmt.Printf("Relay download leg (source read): %s\n", downloadResult.throughputSummary())
+		}
+		fmt.Printf("Relay upload leg (destination write): %s\n", uploadResult.throughputSummary())
+		printTuningHints("Relay download leg", downloadResult, task.RsyncOptions)
+		printTuningHints("Relay upload leg", uploadResult, task.RsyncOptions)
+
+		result := *uploadResult
+		result.Duration = time.Since(startTime)
+		result.Download = downloadResult
+		result.Upload = uploadResult
+		result.RelayStagingPath = tempDir
+		result.files = transferredFiles(string(uploadOutput))
+		result.Directories = collectDirectoryStats(task.WorkflowOptions.DirectoryStats, string(uploadOutput))
+
+		// Step 3: Remove source files only after the destination has been verified
+		if removeSourceFiles && !task.RsyncOptions.DryRun {
+			removed, stagedOnly, err := removeRelaySourceFiles(ctx, task, rsyncCmdPath, args, uploadArgs, tempDir, destinationRsyncPath)
+			result.SourceFilesRemoved = removed
+			if stagedOnly {
+				keepStaging = true
+			}
+			if err != nil {
+				return &result, err
+			}
+		}
+		return &result, nil
+	}
+
+	// Split the transfer into parallel mtime windows if requested
+	if len(task.RsyncOptions.MtimeSplit.Boundaries) > 0 {
+		result, err := transferByMtimeWindows(ctx, task, rsyncCmdPath, args)
+		if err != nil {
+			return nil, err
+		}
+		result.Duration = time.Since(startTime)
+		if task.RsyncOptions.RemoveSourceFiles && !task.RsyncOptions.DryRun {
+			result.SourceFilesRemoved = result.nonDirectoryCount()
+		}
+		return result, nil
+	}
+
+	// Go through an rsync batch file if requested, which a rerun applies without comparing the trees
+	var output []byte
+	handled := false
+	if task.RsyncOptions.BatchDir != "" && !task.RsyncOptions.DryRun {
+		var err error
+		output, handled, err = transferWithRsyncBatch(ctx, task, rsyncCmdPath, args, progressArgs, sourceRsyncPaths, destinationRsyncPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Standard direct transfer (not relay mode)
+	if !handled {
+		args = rsyncLegArgs(args, progressArgs, sourceRsyncPaths, destinationRsyncPath)
+		task.RsyncOptions.recorder.command(rsyncCmdPath, args)
+		var err error
+		output, err = runRsyncAttempts(ctx, task, "Transfer", rsyncCmdPath, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result := parseRsyncStats(string(output))
+	result.Duration = time.Since(startTime)
+	result.files = transferredFiles(string(output))
+	result.Directories = collectDirectoryStats(task.WorkflowOptions.DirectoryStats, string(output))
+	if task.RsyncOptions.RemoveSourceFiles && !task.RsyncOptions.DryRun {
+		result.SourceFilesRemoved = result.nonDirectoryCount()
+	}
+	printTuningHints("Transfer", result, task.RsyncOptions)
+	return result, nil
+}
+
+// runRsyncAttempts runs a direct rsync process with the arguments (again on each retry of
+// RsyncOption.Retry) and returns its combined stdout and stderr.
+func runRsyncAttempts(ctx context.Context, task DataMigrationModel, operation, rsyncCmdPath string, args []string) ([]byte, error) {
+	var output []byte
+	err := task.RsyncOptions.retry(ctx, operation, func() error {
+		if err := throttle(ctx, task.RsyncOptions, task.Source, task.Destination); err != nil {
+			return err
+		}
+		cmd := newLocalCommand(ctx, task.RsyncOptions, rsyncCmdPath, args...)
+		// fmt.Println("Executing command:", cmd.String()) // For debugging
+
+		start := time.Now()
+		var err error
+		output, err = runRsyncCommand(ctx, cmd, "", task.RsyncOptions) // Get combined stdout and stderr
+		task.RsyncOptions.usage.record(cmd, start)
+		err = task.RsyncOptions.audit.record(cmd.String(), err, task.Source, task.Destination)
+		task.handleDiskFull(err, task.Destination)
+		if err != nil {
+			// Improve error message by including the command and output for easier debugging
+			return newOperationError(task, StageTransfer, fmt.Sprintf("rsync execution failed for task from '%s' to '%s'",
+				strings.Join(task.Source.rsyncSourcePaths(), "', '"), task.Destination.getRsyncPath()),
+				append([]string{rsyncCmdPath}, args...), output, err)
+		}
+		return nil
+	})
+	return output, err
+}
+
+// relayStagingDir returns the local staging directory for a relay transfer. If StagingDir is set,
+// it is created if missing and is owned by the caller; otherwise a temporary directory is created
+// and owned (i.e., to be removed) by transx. With LocalRunAs, the directory is created as that user.
+// The directory gets RsyncOption.SessionDirMode if transx creates it.
+func relayStagingDir(opts RsyncOption) (dir string, owned bool, err error) {
+	mode := fmt.Sprintf("%04o", uint32(opts.sessionDirMode()))
+	if strings.TrimSpace(opts.StagingDir) != "" {
+		if strings.TrimSpace(opts.LocalRunAs) != "" {
+			// -m applies to the directory itself only, which is left alone if it exists
+			err = runAsLocalUser(opts, "mkdir", "-p", "-m", mode, opts.StagingDir)
+		} else {
+			err = makeSessionDir(opts, opts.StagingDir)
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("failed to create relay staging directory '%s': %w", opts.StagingDir, err)
+		}
+		return opts.StagingDir, false, nil
+	}
+	if strings.TrimSpace(opts.LocalRunAs) != "" {
+		output, err := localUserOutput(opts, "mktemp", "-d", filepath.Join(os.TempDir(), "transx-relay-XXXXXX"))
+		if err != nil {
+			return "", false, fmt.Errorf("failed to create temporary directory for relay transfer as '%s': %w", opts.LocalRunAs, err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n") // sudo may print a warning first
+		dir = strings.TrimSpace(lines[len(lines)-1])
+		if err := runAsLocalUser(opts, "chmod", mode, dir); err != nil {
+			removeRelayStagingDir(opts, dir)
+			return "", false, fmt.Errorf("failed to set the mode of relay staging directory %s: %w", dir, err)
+		}
+		return dir, true, nil
+	}
+	dir, err = makeSessionTempDir(opts, "transx-relay-*")
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create temporary directory for relay transfer: %w", err)
+	}
+	return dir, true, nil
+}
+
+// sessionDirMode returns the mode of the staging directories transx creates (see SessionDirMode).
+func (o RsyncOption) sessionDirMode() os.FileMode {
+	if o.SessionDirMode != 0 {
+		return o.SessionDirMode
+	}
+	return 0700
+}
+
+// makeSessionDir creates the local directory and its missing parents, and sets SessionDirMode on
+// the directory if it was missing. The parents are private (0700 masked by the umask).
+func makeSessionDir(opts RsyncOption, dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return os.Chmod(dir, opts.sessionDirMode())
+}
+
+// makeSessionTempDir creates a new local temporary directory named after pattern (see os.MkdirTemp)
+// with SessionDirMode.
+func makeSessionTempDir(opts RsyncOption, pattern string) (string, error) {
+	dir, err := os.MkdirTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(dir, opts.sessionDirMode()); err != nil {
+		os.Remove(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// removeRelayStagingDir removes a staging directory created by relayStagingDir (as LocalRunAs, if set).
+func removeRelayStagingDir(opts RsyncOption, dir string) error {
+	var err error
+	if strings.TrimSpace(opts.LocalRunAs) != "" {
+		err = runAsLocalUser(opts, "rm", "-rf", "--", dir)
+	} else {
+		err = os.RemoveAll(dir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove relay staging directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+// runAsLocalUser runs a local command as RsyncOption.LocalRunAs, including its output in the error.
+func runAsLocalUser(opts RsyncOption, name string, args ...string) error {
+	_, err := localUserOutput(opts, name, args...)
+	return err
+}
+
+// localUserOutput runs a local command as RsyncOption.LocalRunAs with the runner of the options and
+// returns its combined output, which the error also includes.
+func localUserOutput(opts RsyncOption, name string, args ...string) ([]byte, error) {
+	name, args = runAsArgs(opts, name, args)
+	output, err := opts.runner().Run(context.Background(), name, args...)
+	if err != nil {
+		return output, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return output, nil
+}
+
+// withoutArg returns a copy of args with every occurrence of arg removed.
+func withoutArg(args []string, arg string) []string {
+	filtered := make([]string, 0, len(args))
+	for _, a := range args {
+		if a != arg {
+			filtered = append(filtered, a)
+		}
+	}
+	return filtered
+}
+
+// withArg returns a copy of args with arg appended, or args itself if arg is empty.
+func withArg(args []string, arg string) []string {
+	if arg == "" {
+		return args
+	}
+	return append(append([]string{}, args...), arg)
+}
+
+// bwlimitArg returns the --bwlimit argument of the relay leg (or of a direct transfer if leg is
+// empty), or "" if it is not limited.
+func (o RsyncOption) bwlimitArg(leg RelayLeg) string {
+	limit := o.BandwidthLimitKBps
+	switch {
+	case leg == RelayDownload && o.DownloadBandwidthLimitKBps > 0:
+		limit = o.DownloadBandwidthLimitKBps
+	case leg == RelayUpload && o.UploadBandwidthLimitKBps > 0:
+		limit = o.UploadBandwidthLimitKBps
+	}
+	if limit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("--bwlimit=%d", limit)
+}
+
+// tempDirArg returns the --temp-dir argument of RsyncOption.TempDir, or "" if it is not set.
+func (o RsyncOption) tempDirArg() string {
+	if o.TempDir == "" {
+		return ""
+	}
+	return "--temp-dir=" + o.TempDir
+}
+
+// removeRelaySourceFiles removes from the source only the files proven to be on the destination.
+// rsync cannot compare the two remote endpoints directly, so the proof goes through the relay staging
+// directory: a checksum dry-run must find no file differing between staging and the destination, and
+// a checksum dry-run from the source to staging lists the files still identical to their staged
+// copies. Files created or modified on the source after the download leg are not in the list and
+// stay on the source. The listed files are then removed by rsync with --remove-source-files from the
+// source into staging, passed with --files-from. A listed file modified in the meantime is copied
+// into staging before its removal, so in that case uploadArgs (the upload leg) runs again and the
+// destination is verified again; if that fails, stagedOnly reports that staging holds the only copy
+// of such files and must be kept. It returns the number of source files removed.
+func removeRelaySourceFiles(ctx context.Context, task DataMigrationModel, rsyncCmdPath string, args, uploadArgs []string, stagingDir, destinationRsyncPath string) (removed int64, stagedOnly bool, err error) {
+	opts := task.RsyncOptions
+	fmt.Printf("Relay transfer mode: Verifying destination before removing source files...\n")
+	if err := verifyRelayDestination(ctx, task, rsyncCmdPath, args, stagingDir, destinationRsyncPath); err != nil {
+		return 0, false, fmt.Errorf("%w; source files were not removed", err)
+	}
+
+	restaged := false
+	for _, dataPath := range task.Source.dataPaths() {
+		sourceRsyncPath := task.Source.rsyncPathFor(dataPath)
+		// The names rsync logs and reads in --files-from are relative to the root of the transfer
+		root, _ := task.Source.rsyncPathRoot(dataPath)
+		if len(opts.FilesFromList) > 0 {
+			root = sourceRsyncPath // With --files-from, they are relative to the source directory itself
+		}
+
+		identical, err := identicalRelayFiles(ctx, task, rsyncCmdPath, args, sourceRsyncPath, stagingDir)
+		if err != nil {
+			return removed, false, fmt.Errorf("relay verification failed; source files were not removed: %w", err)
+		}
+		if len(identical) == 0 {
+			continue
+		}
+		listPath, err := writeListFile(opts, "transx-remove-source-*", identical)
+		if err != nil {
+			return removed, false, fmt.Errorf("failed to write the list of source files to remove: %w", err)
+		}
+		release := opts.cleanups.track("files-from file "+listPath, removeListFile(listPath))
+
+		cleanupArgs := append(append([]string{}, args...), "--remove-source-files", "-c", "--files-from="+listPath)
+		cleanupArgs = append(cleanupArgs, rsyncPathArgs([]string{root}, stagingDir+"/")...)
+		fmt.Printf("Relay transfer mode: Removing %d verified file(s) from source '%s'...\n", len(identical), sourceRsyncPath)
+		if err := throttle(ctx, opts, task.Source); err != nil {
+			release()
+			return removed, false, err
+		}
+		cleanupCmd := newLocalCommand(ctx, opts, rsyncCmdPath, cleanupArgs...)
+		start := time.Now()
+		cleanupOutput, err := commandOutput(ctx, opts, cleanupCmd)
+		opts.usage.record(cleanupCmd, start)
+		err = opts.audit.record(cleanupCmd.String(), err, task.Source)
+		release()
+		if err != nil {
+			err = fmt.Errorf("relay source cleanup failed for '%s'\nCommand: %s %s\nError: %w\nOutput:\n%s",
+				sourceRsyncPath, rsyncCmdPath, strings.Join(cleanupArgs, " "), err, string(cleanupOutput))
+			// Files sent into staging before the failure may already be gone from the source
+			if differs, uploadErr := reuploadRelayStaging(ctx, task, rsyncCmdPath, args, uploadArgs, stagingDir, destinationRsyncPath); differs {
+				return removed, true, fmt.Errorf("%w\nThe staging directory '%s' may hold the only copy of some files: %v", err, stagingDir, uploadErr)
+			}
+			return removed, false, err
+		}
+		stats := parseRsyncStats(string(cleanupOutput))
+		// A file sent into staging changed after its verification and is now gone from the source
+		restaged = restaged || stats.FilesTransferred > 0
+		removed += stats.nonDirectoryCount()
+	}
+
+	if restaged {
+		fmt.Printf("Relay transfer mode: Source files changed during the cleanup; uploading them again...\n")
+		if _, err := reuploadRelayStaging(ctx, task, rsyncCmdPath, args, uploadArgs, stagingDir, destinationRsyncPath); err != nil {
+			return removed, true, fmt.Errorf("files changed on the source during the relay cleanup were removed from it but did not reach the destination; the staging directory '%s' holds them: %w",
+				stagingDir, err)
+		}
+	}
+	return removed, false, nil
+}
+
+// verifyRelayDestination checks with a checksum dry-run that no file differs between the relay
+// staging directory and the destination.
+func verifyRelayDestination(ctx context.Context, task DataMigrationModel, rsyncCmdPath string, args []string, stagingDir, destinationRsyncPath string) error {
+	if err := throttle(ctx, task.RsyncOptions, task.Destination); err != nil {
+		return err
 	}
-	if task.RsyncOptions.Compress {
-		args = append(args, "-z")
+	differing, err := checksumDiffCount(ctx, task.RsyncOptions, rsyncCmdPath, args, []string{stagingDir + "/"}, destinationRsyncPath)
+	if err != nil {
+		return fmt.Errorf("relay verification failed: %w", err)
 	}
-	if task.RsyncOptions.Verbose {
-		args = append(args, "-v")
+	if differing > 0 {
+		return fmt.Errorf("relay verification found %d file(s) differing between staging and '%s'", differing, destinationRsyncPath)
 	}
-	if task.RsyncOptions.Delete {
-		args = append(args, "--delete")
+	return nil
+}
+
+// reuploadRelayStaging runs the upload leg of a relay transfer again and verifies the destination.
+// It reports whether staging is known to differ from the destination, i.e., whether the upload or
+// its verification failed (for a caller deciding whether staging holds data the destination lacks).
+func reuploadRelayStaging(ctx context.Context, task DataMigrationModel, rsyncCmdPath string, args, uploadArgs []string, stagingDir, destinationRsyncPath string) (bool, error) {
+	opts := task.RsyncOptions
+	if err := throttle(ctx, opts, task.Destination); err != nil {
+		return true, err
 	}
-	if task.RsyncOptions.Progress {
-		args = append(args, "--progress")
+	uploadCmd := newLocalCommand(ctx, opts, rsyncCmdPath, uploadArgs...)
+	start := time.Now()
+	output, err := commandOutput(ctx, opts, uploadCmd)
+	opts.usage.record(uploadCmd, start)
+	if err = opts.audit.record(uploadCmd.String(), err, task.Destination); err != nil {
+		return true, newOperationError(task, StageRelayUpload, fmt.Sprintf("rsync execution failed from temp dir to '%s'", destinationRsyncPath),
+			append([]string{rsyncCmdPath}, uploadArgs...), output, err)
 	}
-	if task.RsyncOptions.DryRun {
-		args = append(args, "-n") // or "--dry-run"
+	if err := verifyRelayDestination(ctx, task, rsyncCmdPath, args, stagingDir, destinationRsyncPath); err != nil {
+		return true, err
 	}
+	return false, nil
+}
 
-	// Configure Exclude and Include options
-	for _, ex := range task.RsyncOptions.Exclude {
-		if strings.TrimSpace(ex) != "" {
-			args = append(args, "--exclude="+ex)
-		}
-	}
-	for _, inc := range task.RsyncOptions.Include {
-		if strings.TrimSpace(inc) != "" {
-			args = append(args, "--include="+inc)
-		}
+// identicalRelayFiles lists the regular files of the source path whose content and attributes are
+// identical to their copies in the relay staging directory, using a checksum dry-run that also logs
+// unchanged files (--info=name2). The names are relative to the root of the transfer. Names rsync
+// escapes in its output (containing a backslash or a non-printable character) cannot be passed back
+// to it and are left out, so those files stay on the source.
+func identicalRelayFiles(ctx context.Context, task DataMigrationModel, rsyncCmdPath string, args []string, sourceRsyncPath, stagingDir string) ([]string, error) {
+	opts := task.RsyncOptions
+	listArgs := append(append([]string{}, args...), "-n", "-c", "--info=name2", "--out-format="+dryRunEntryPrefix+"%i:%l:%n")
+	listArgs = append(listArgs, rsyncPathArgs([]string{sourceRsyncPath}, stagingDir+"/")...)
+	if err := throttle(ctx, opts, task.Source); err != nil {
+		return nil, err
 	}
-
-	// // Configure extra rsync arguments
-	// if len(task.RsyncOptions.ExtraArgs) > 0 {
-	// 	args = append(args, task.RsyncOptions.ExtraArgs...)
-	// }
-
-	// Configure SSH options (-e)
-	// rsync uses only one remote shell command.
-	// If the source is remote, SSH settings for source connection are used.
-	// If the source is local and destination is remote, SSH settings for destination connection are used.
-	var sshOptString string
-	var activeRemoteEndpointForRsync EndpointDetails
-	operationInvolvesRemoteRsync := false
-
-	if task.Source.isRemote() {
-		activeRemoteEndpointForRsync = task.Source
-		operationInvolvesRemoteRsync = true
-	} else if task.Destination.isRemote() {
-		activeRemoteEndpointForRsync = task.Destination
-		operationInvolvesRemoteRsync = true
+	cmd := newLocalCommand(ctx, opts, rsyncCmdPath, listArgs...)
+	start := time.Now()
+	output, err := commandOutput(ctx, opts, cmd)
+	opts.usage.record(cmd, start)
+	if err != nil {
+		return nil, fmt.Errorf("rsync checksum comparison failed from '%s' to '%s'\nCommand: %s %s\nError: %w\nOutput:\n%s",
+			sourceRsyncPath, stagingDir, rsyncCmdPath, strings.Join(listArgs, " "), err, string(output))
 	}
 
-	if operationInvolvesRemoteRsync && activeRemoteEndpointForRsync.SSHPrivateKeyPath != "" {
-		var sshCmdParts []string
-		sshCmdParts = append(sshCmdParts, "ssh")
-		if strings.TrimSpace(activeRemoteEndpointForRsync.SSHPrivateKeyPath) != "" {
-			sshCmdParts = append(sshCmdParts, "-i", activeRemoteEndpointForRsync.SSHPrivateKeyPath)
-		}
-		if activeRemoteEndpointForRsync.SSHPort != 0 { // If 0, use default port (22)
-			sshCmdParts = append(sshCmdParts, "-p", strconv.Itoa(activeRemoteEndpointForRsync.SSHPort))
+	var identical []string
+	skipped := 0
+	for _, line := range strings.Split(string(output), "\n") {
+		entry, ok := parseDryRunEntry(line)
+		if !ok || entry.Itemize != ".f" { // Unchanged items are logged with blanks after the type
+			continue
 		}
-		if task.RsyncOptions.InsecureSkipHostKeyVerification {
-			sshCmdParts = append(sshCmdParts, "-o", "StrictHostKeyChecking=accept-new")
-			sshCmdParts = append(sshCmdParts, "-o", "UserKnownHostsFile=/dev/null")
+		if strings.Contains(entry.Name, "\\") {
+			skipped++
+			continue
 		}
-		// Username and HostIP are part of the rsync path, not the -e ssh command for rsync
-		sshOptString = strings.Join(sshCmdParts, " ")
+		identical = append(identical, entry.Name)
+	}
+	if skipped > 0 {
+		fmt.Printf("Relay transfer mode: Keeping %d source file(s) whose names rsync escapes in its output\n", skipped)
 	}
+	return identical, nil
+}
 
-	if sshOptString != "" {
-		args = append(args, "-e", sshOptString)
+// sshBaseArgs returns the ssh command and its connection options for the endpoint
+// (e.g., ["ssh", "-i", key, "-p", port]), without the destination and remote command.
+func sshBaseArgs(endpoint EndpointDetails, sshConfig RsyncOption) []string {
+	sshCmdParts := []string{"ssh"} // SSH command
+	if strings.TrimSpace(endpoint.SSHPrivateKeyPath) != "" {
+		sshCmdParts = append(sshCmdParts, "-i", endpoint.SSHPrivateKeyPath) // Private key
+	}
+	if endpoint.SSHPort != 0 { // SSH port (if 0, use default port 22)
+		sshCmdParts = append(sshCmdParts, "-p", strconv.Itoa(endpoint.SSHPort))
 	}
+	if sshConfig.InsecureSkipHostKeyVerification { // Skip host key verification option
+		sshCmdParts = append(sshCmdParts, "-o", "StrictHostKeyChecking=accept-new")
+		sshCmdParts = append(sshCmdParts, "-o", "UserKnownHostsFile=/dev/null")
+	}
+	if !sshConfig.InteractiveSSH { // Fail instead of prompting on a terminal transx does not have
+		sshCmdParts = append(sshCmdParts, "-o", "BatchMode=yes")
+	}
+	if sshConfig.DebugSSH { // Verbose handshake output for diagnosing connection failures
+		sshCmdParts = append(sshCmdParts, "-vvv")
+	}
+	sshCmdParts = append(sshCmdParts, sshMultiplexingArgs(sshConfig)...)
+	return sshCmdParts
+}
 
-	// Add source and destination paths
-	sourceRsyncPath := task.Source.getRsyncPath()
-	destinationRsyncPath := task.Destination.getRsyncPath()
+// customRemoteShellArgs returns the argv invoking RsyncOption.RemoteShellCommand for the endpoint
+// the way rsync invokes its remote shell: "<command> [-l user] host".
+func customRemoteShellArgs(endpoint EndpointDetails, opts RsyncOption) []string {
+	args := strings.Fields(opts.RemoteShellCommand)
+	if user := strings.TrimSpace(endpoint.Username); user != "" {
+		args = append(args, "-l", user)
+	}
+	return append(args, endpoint.HostIP)
+}
 
-	// Check if we need to use relay mode (both source and destination are remote)
-	if isRelayMode {
-		// For relay mode, we need to:
-		// 1. Create a temporary directory on the local machine
-		// 2. First download from source to the temp dir
-		// 3. Then upload from the temp dir to the destination
+// newSSHDebugLog creates the temporary file ssh writes its log to with RsyncOption.DebugSSH (ssh -E),
+// so that the verbose lines, which ssh prints without a common prefix, stay out of the command output.
+func newSSHDebugLog() (string, error) {
+	f, err := os.CreateTemp("", "transx-ssh-*.log")
+	if err != nil {
+		return "", fmt.Errorf("failed to create the ssh debug log: %w", err)
+	}
+	f.Close()
+	return f.Name(), nil
+}
 
-		tempDir, err := os.MkdirTemp("", "transx-relay-*")
-		if err != nil {
-			return fmt.Errorf("failed to create temporary directory for relay transfer: %w", err)
-		}
-		defer os.RemoveAll(tempDir) // Clean up temp dir when done
+// attachSSHDebugLog removes the ssh debug log and, if the command failed, appends the log to its
+// output, where the handshake details and ssh's own error messages belong.
+func attachSSHDebugLog(output []byte, err error, logPath string) ([]byte, error) {
+	debugLog, _ := os.ReadFile(logPath)
+	os.Remove(logPath)
+	if err == nil || len(debugLog) == 0 {
+		return output, err
+	}
+	if len(output) > 0 && !bytes.HasSuffix(output, []byte("\n")) {
+		output = append(output, '\n')
+	}
+	output = append(output, debugLog...)
+	return output, hostKeyFailure(output, err)
+}
 
-		// Step 1: Download from source to temp dir
-		downloadArgs := make([]string, len(args))
-		copy(downloadArgs, args)
-		downloadArgs = append(downloadArgs, sourceRsyncPath, tempDir+"/")
+// newCommand creates the command for an rsync or ssh invocation, prefixed with
+// RsyncOption.CommandWrapper if set (e.g., "cgexec -g blkio:migrations rsync ...").
+func newCommand(ctx context.Context, opts RsyncOption, name string, args ...string) *exec.Cmd {
+	if len(opts.CommandWrapper) > 0 {
+		wrapped := append([]string{}, opts.CommandWrapper[1:]...)
+		wrapped = append(wrapped, name)
+		args = append(wrapped, args...)
+		name = opts.CommandWrapper[0]
+	}
+	return exec.CommandContext(ctx, name, args...)
+}
 
-		fmt.Printf("Relay transfer mode: Downloading from source to local temp dir...\n")
-		downloadCmd := exec.Command(rsyncCmdPath, downloadArgs...)
-		downloadOutput, err := downloadCmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("relay download failed from '%s' to temp dir\nCommand: %s %s\nError: %w\nOutput:\n%s",
-				sourceRsyncPath, rsyncCmdPath, strings.Join(downloadArgs, " "), err, string(downloadOutput))
-		}
+// runAsArgs prefixes the command with "sudo -n -u <user> --" if RsyncOption.LocalRunAs is set.
+func runAsArgs(opts RsyncOption, name string, args []string) (string, []string) {
+	user := strings.TrimSpace(opts.LocalRunAs)
+	if user == "" {
+		return name, args
+	}
+	return "sudo", append([]string{"-n", "-u", user, "--", name}, args...)
+}
 
-		// Step 2: Upload from temp dir to destination
-		uploadArgs := make([]string, len(args))
-		copy(uploadArgs, args)
-		uploadArgs = append(uploadArgs, tempDir+"/", destinationRsyncPath)
+// newLocalCommand creates the command for a local rsync invocation: like newCommand, but run as
+// RsyncOption.LocalRunAs if set (CommandWrapper, then sudo, then rsync).
+func newLocalCommand(ctx context.Context, opts RsyncOption, name string, args ...string) *exec.Cmd {
+	name, args = runAsArgs(opts, name, args)
+	return newCommand(ctx, opts, name, args...)
+}
 
-		fmt.Printf("Relay transfer mode: Uploading from local temp dir to destination...\n")
-		uploadCmd := exec.Command(rsyncCmdPath, uploadArgs...)
-		uploadOutput, err := uploadCmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("relay upload failed from temp dir to '%s'\nCommand: %s %s\nError: %w\nOutput:\n%s",
-				destinationRsyncPath, rsyncCmdPath, strings.Join(uploadArgs, " "), err, string(uploadOutput))
-		}
+// shellQuote quotes s for safe use as a single word in a POSIX shell command.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
 
-		fmt.Printf("Relay transfer completed successfully!\n")
-		return nil
+// dashSafePath returns the path prefixed with "./" if it starts with a dash (e.g., "-old-backups"),
+// so that no command takes it for an option. Other paths are returned unchanged.
+func dashSafePath(p string) string {
+	if strings.HasPrefix(p, "-") {
+		return "./" + p
 	}
+	return p
+}
 
-	// Standard direct transfer (not relay mode)
-	args = append(args, sourceRsyncPath, destinationRsyncPath)
-
-	// Create and execute the rsync command
-	cmd := exec.Command(rsyncCmdPath, args...)
-	// fmt.Println("Executing command:", cmd.String()) // For debugging
-
-	output, err := cmd.CombinedOutput() // Get combined stdout and stderr
-	if err != nil {
-		// Improve error message by including the command and output for easier debugging
-		return fmt.Errorf("rsync execution failed for task from '%s' to '%s'\nCommand: %s %s\nError: %w\nOutput:\n%s",
-			sourceRsyncPath, destinationRsyncPath, rsyncCmdPath, strings.Join(args, " "), err, string(output))
+// mkdirCommand returns the shell command creating the directory and its missing parents with the
+// mode (see RsyncOption.CreateDestDirMode), or with the umask of the shell if mode is 0.
+func mkdirCommand(dir string, mode os.FileMode) string {
+	if mode == 0 {
+		return "mkdir -p " + shellQuotePath(dir)
 	}
-	return nil
+	// mkdir -p creates every directory with 0777 masked by the umask, so the umask sets the mode
+	return fmt.Sprintf("(umask %04o && mkdir -p %s)", uint32(^mode&os.ModePerm), shellQuotePath(dir))
+}
+
+// shellQuotePath quotes a path argument of a shell command like shellQuote, after dashSafePath.
+// Shell commands rely on it rather than "--", which some tools (e.g., openssl) do not accept.
+func shellQuotePath(p string) string {
+	return shellQuote(dashSafePath(p))
 }
 
 // executeCommand executes the given command locally or remotely (via SSH).
@@ -265,61 +2064,232 @@ func Transfer(task DataMigrationModel) error {
 // Otherwise, it executes locally.
 // sshConfig provides SSH options (InsecureSkipHostKeyVerification) for remote execution.
 func executeCommand(commandToExecute string, endpoint EndpointDetails, sshConfig RsyncOption) ([]byte, error) {
+	return executeCommandContext(context.Background(), commandToExecute, endpoint, sshConfig)
+}
+
+// executeCommandContext is like executeCommand but kills the command (local shell or ssh client)
+// when ctx is canceled.
+func executeCommandContext(ctx context.Context, commandToExecute string, endpoint EndpointDetails, sshConfig RsyncOption) ([]byte, error) {
+	return executeCommandStream(ctx, commandToExecute, endpoint, sshConfig, nil)
+}
+
+// executeCommandStream is like executeCommandContext and additionally copies the output to stream
+// as it is produced, if stream is not nil. The returned output is complete in either case.
+func executeCommandStream(ctx context.Context, commandToExecute string, endpoint EndpointDetails, sshConfig RsyncOption, stream io.Writer) ([]byte, error) {
 	if strings.TrimSpace(commandToExecute) == "" {
 		return nil, fmt.Errorf("command to execute cannot be empty")
 	}
 
+	// Commands for container endpoints run inside the container on its host
+	if endpoint.isContainer() {
+		commandToExecute = endpoint.wrapContainerCommand(commandToExecute)
+		endpoint = endpoint.hostEndpoint()
+	}
+
 	if endpoint.isRemote() { // Check if it's a remote endpoint
 		if strings.TrimSpace(endpoint.HostIP) == "" {
 			return nil, fmt.Errorf("HostIP must be provided for remote command execution on endpoint")
 		}
 
+		if err := throttle(ctx, sshConfig, endpoint); err != nil {
+			return nil, err
+		}
+
 		userHost := endpoint.HostIP
 		if strings.TrimSpace(endpoint.Username) != "" {
 			userHost = fmt.Sprintf("%s@%s", endpoint.Username, endpoint.HostIP)
 		}
 
+		customShell := strings.TrimSpace(sshConfig.RemoteShellCommand) != ""
 		var sshCmdParts []string
-		sshCmdParts = append(sshCmdParts, "ssh") // SSH command
-		if strings.TrimSpace(endpoint.SSHPrivateKeyPath) != "" {
-			sshCmdParts = append(sshCmdParts, "-i", endpoint.SSHPrivateKeyPath) // Private key
-		}
-		if endpoint.SSHPort != 0 { // SSH port (if not 0)
-			sshCmdParts = append(sshCmdParts, "-p", strconv.Itoa(endpoint.SSHPort))
-		}
-		if sshConfig.InsecureSkipHostKeyVerification { // Skip host key verification option
-			sshCmdParts = append(sshCmdParts, "-o", "StrictHostKeyChecking=accept-new")
-			sshCmdParts = append(sshCmdParts, "-o", "UserKnownHostsFile=/dev/null")
-		}
+		if customShell {
+			sshCmdParts = append(customRemoteShellArgs(endpoint, sshConfig), commandToExecute)
+		} else {
+			sshCmdParts = sshBaseArgs(endpoint, sshConfig)
 
-		// Add timeout for SSH connection
-		sshCmdParts = append(sshCmdParts, "-o", "ConnectTimeout=30")
+			// Add timeout for SSH connection
+			sshCmdParts = append(sshCmdParts, "-o", "ConnectTimeout=30")
 
-		// For remote commands with sudo, we need the -t option to allocate a pseudo-tty
-		if strings.Contains(commandToExecute, "sudo") {
-			sshCmdParts = append(sshCmdParts, "-t")
+			// For remote commands with sudo, we need the -t option to allocate a pseudo-tty
+			if strings.Contains(commandToExecute, "sudo") {
+				sshCmdParts = append(sshCmdParts, "-t")
+			}
 		}
+		debugSSH := sshConfig.DebugSSH && !customShell
 
-		sshCmdParts = append(sshCmdParts, userHost, commandToExecute) // user@host "command_to_execute"
-
-		cmd := exec.Command(sshCmdParts[0], sshCmdParts[1:]...)
-		fmt.Printf("Executing remote command on %s...\n", userHost) // For user feedback
-		return cmd.CombinedOutput()
+		// A connection refused by sshd's MaxStartups throttling is retried, since the command never ran
+		for attempt := 1; ; attempt++ {
+			cmdParts := append([]string{}, sshCmdParts...)
+			var debugLog string
+			if debugSSH {
+				var err error
+				if debugLog, err = newSSHDebugLog(); err != nil {
+					return nil, err
+				}
+				cmdParts = append(cmdParts, "-E", debugLog)
+			}
+			if !customShell {
+				cmdParts = append(cmdParts, userHost, commandToExecute) // user@host "command_to_execute"
+			}
+			cmd := newCommand(ctx, sshConfig, cmdParts[0], cmdParts[1:]...)
+			start := time.Now()
+			if customShell {
+				fmt.Printf("Executing remote command on %s via the custom remote shell...\n", userHost)
+			} else {
+				fmt.Printf("Executing remote command on %s...\n", userHost) // For user feedback
+			}
+			output, err := combinedOutput(ctx, sshConfig, cmd, stream)
+			sshConfig.usage.record(cmd, start)
+			if debugSSH {
+				output, err = attachSSHDebugLog(output, err, debugLog) // Keep the handshake details only for failures
+			}
+			if err != nil && sshThrottled(string(output)) && ctx.Err() == nil {
+				sshConfig.reportSSHThrottle(endpoint.HostIP)
+				if attempt < sshThrottleAttempts && waitSSHThrottle(ctx, attempt) {
+					continue
+				}
+			}
+			err = sshConfig.audit.record(commandToExecute, err, endpoint)
+			return output, commandError(sshConfig, commandToExecute, endpoint, output, err)
+		}
 	} else {
 		// Local execution
 		// Use "sh -c" to handle complex shell commands
-		cmd := exec.Command("sh", "-c", commandToExecute)
+		name, args := runAsArgs(sshConfig, "sh", []string{"-c", commandToExecute})
+		cmd := exec.CommandContext(ctx, name, args...)
+		setProcessGroup(cmd) // A canceled context kills the processes started by the shell too
 		fmt.Println("Executing local command...")
-		return cmd.CombinedOutput()
+		start := time.Now()
+		output, err := combinedOutput(ctx, sshConfig, cmd, stream)
+		sshConfig.usage.record(cmd, start)
+		err = sshConfig.audit.record(commandToExecute, err)
+		return output, commandError(sshConfig, commandToExecute, endpoint, output, err)
+	}
+}
+
+// commandWaitDelay bounds how long a canceled command may keep its output open, e.g., when
+// "sh -c" is killed but a child process it started still holds the pipe.
+const commandWaitDelay = 10 * time.Second
+
+// combinedOutput runs cmd and returns its combined stdout and stderr, also copying it to stream if not nil.
+// At most RsyncOption.MaxCapturedOutput bytes of output are kept; stream receives all of it. With
+// RsyncOption.CommandRunner, the command runs through it, and stream receives the output once it finished.
+func combinedOutput(ctx context.Context, opts RsyncOption, cmd *exec.Cmd, stream io.Writer) ([]byte, error) {
+	output := &tailBuffer{limit: opts.MaxCapturedOutput}
+	var w io.Writer = output
+	if stream != nil {
+		w = io.MultiWriter(output, stream)
+	}
+	if opts.CommandRunner != nil {
+		raw, err := runWithRunner(ctx, opts, cmd)
+		w.Write(raw)
+		return output.Bytes(), hostKeyFailure(raw, err)
+	}
+	cmd.WaitDelay = commandWaitDelay
+	cmd.Stdout = w
+	cmd.Stderr = w // The same writer, so os/exec serializes the writes
+	err := cmd.Run()
+	return output.Bytes(), hostKeyFailure(output.Bytes(), err)
+}
+
+// prefixWriter writes each complete line to w with a prefix, buffering partial lines.
+type prefixWriter struct {
+	w       io.Writer
+	prefix  string
+	secrets []string // Secret values redacted from the lines
+	pending []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.pending = append(p.pending, b...)
+	for {
+		i := bytes.IndexByte(p.pending, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := fmt.Fprintf(p.w, "%s%s\n", p.prefix, hideSecrets(strings.TrimRight(string(p.pending[:i]), "\r"), p.secrets)); err != nil {
+			return len(b), err
+		}
+		p.pending = p.pending[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes a trailing partial line, if any.
+func (p *prefixWriter) Flush() {
+	if len(p.pending) > 0 {
+		fmt.Fprintf(p.w, "%s%s\n", p.prefix, hideSecrets(string(p.pending), p.secrets))
+		p.pending = nil
+	}
+}
+
+// runStageCommand executes a backup, pre-transfer, restore, or health command on the endpoint with the stage's
+// timeout (0 means no limit), streaming its output to stdout if WorkflowOptions.StreamCommandOutput is set.
+// A command killed by the timeout returns an error saying so. Secret references in the command are
+// resolved with WorkflowOptions.SecretsProvider, and their values are redacted from the output.
+func runStageCommand(ctx context.Context, dmm DataMigrationModel, stage Stage, command string, endpoint EndpointDetails, timeout time.Duration) ([]byte, error) {
+	command, secrets, err := resolveSecretRefs(ctx, dmm.WorkflowOptions.SecretsProvider, command)
+	if err != nil {
+		return nil, fmt.Errorf("%s command: %w", stage, err)
+	}
+	opts := dmm.RsyncOptions
+	opts.audit = opts.audit.withSecrets(secrets)
+	opts.stage = stage
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var stream *prefixWriter
+	if dmm.WorkflowOptions.StreamCommandOutput {
+		stream = &prefixWriter{w: os.Stdout, prefix: fmt.Sprintf("[%s] ", stage), secrets: secrets}
+		defer stream.Flush()
+	}
+
+	var output []byte
+	if stream != nil {
+		output, err = executeCommandStream(ctx, command, endpoint, opts, stream)
+	} else {
+		output, err = executeCommandContext(ctx, command, endpoint, opts)
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%s command timed out after %s: %w", stage, timeout, err)
+	} else if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		err = fmt.Errorf("%s command was canceled: %w: %w", stage, ctx.Err(), err)
 	}
+	if len(secrets) > 0 {
+		output = []byte(hideSecrets(string(output), secrets))
+	}
+	return output, err
 }
 
-// Backup executes the BackupCmd defined in the source EndpointDetails of the DataMigrationModel.
+// Backup executes the BackupCmd defined in the source EndpointDetails of the DataMigrationModel,
+// on the BackupEndpoint if one is set.
 func Backup(dmm DataMigrationModel) error {
-	// Use source endpoint for backup operations
-	source := dmm.Source
-	if strings.TrimSpace(source.BackupCmd) == "" {
-		return fmt.Errorf("backup command is not defined for source")
+	_, err := backup(context.Background(), dmm)
+	return err
+}
+
+// BackupContext is like Backup but kills the backup command when ctx is canceled, independently of
+// any transfer running concurrently. It returns the output of the command, which is partial if the
+// command failed or was canceled; the error then matches context.Canceled with errors.Is.
+func BackupContext(ctx context.Context, dmm DataMigrationModel) ([]byte, error) {
+	return backup(ctx, dmm)
+}
+
+// backup executes the source BackupCmd and returns its output.
+func backup(ctx context.Context, dmm DataMigrationModel) ([]byte, error) {
+	dmm.attachAuditTrail()
+	if strings.TrimSpace(dmm.Source.BackupCmd) == "" {
+		return nil, fmt.Errorf("backup command is not defined for source")
+	}
+	// Use the backup endpoint (the source unless BackupEndpoint is set) for backup operations
+	source := dmm.backupEndpoint()
+	source.BackupCmd = dmm.Source.BackupCmd
+	if dmm.BackupEndpoint != nil {
+		fmt.Printf("Running the backup on the backup endpoint %s; the transfer reads %s\n", source.commandLocation(), dmm.Source.displayPath())
 	}
 
 	// Determine the source path for display
@@ -334,13 +2304,17 @@ func Backup(dmm DataMigrationModel) error {
 		fmt.Println("Executing backup command locally...")
 	}
 
-	fmt.Printf("Backup command: %s\n", source.BackupCmd)
-	output, err := executeCommand(source.BackupCmd, source, dmm.RsyncOptions)
+	fmt.Printf("Backup command: %s\n", redactSecrets(source.BackupCmd))
+	output, err := runStageCommand(ctx, dmm, StageBackup, source.BackupCmd, source, dmm.WorkflowOptions.BackupTimeout)
 	if err != nil {
-		return fmt.Errorf("backup command execution failed for source '%s': %w\nOutput:\n%s", sourcePath, err, string(output))
+		return output, newOperationError(dmm, StageBackup, fmt.Sprintf("backup command execution failed for source '%s'", sourcePath),
+			[]string{source.BackupCmd}, output, err)
 	}
 
-	// Show output summary
+	// Show output summary (unless it was already streamed)
+	if dmm.WorkflowOptions.StreamCommandOutput {
+		return output, nil
+	}
 	outputStr := string(output)
 	if len(outputStr) > 200 {
 		// Truncate very long output for display
@@ -348,15 +2322,32 @@ func Backup(dmm DataMigrationModel) error {
 	} else if len(outputStr) > 0 {
 		fmt.Printf("Backup command output: %s\n", outputStr)
 	}
-	return nil
+	return output, nil
 }
 
 // Restore executes the RestoreCmd defined in the destination EndpointDetails of the DataMigrationModel.
 func Restore(dmm DataMigrationModel) error {
+	_, err := restore(context.Background(), dmm)
+	return err
+}
+
+// RestoreContext is like Restore but kills the restore command when ctx is canceled, leaving the
+// transferred data at the destination in place. It returns the output of the command, which is
+// partial if the command failed or was canceled; the error then matches context.Canceled with errors.Is.
+func RestoreContext(ctx context.Context, dmm DataMigrationModel) ([]byte, error) {
+	return restore(ctx, dmm)
+}
+
+// restore executes the destination RestoreCmd and returns its output.
+func restore(ctx context.Context, dmm DataMigrationModel) ([]byte, error) {
+	dmm.attachAuditTrail()
 	// Use destination endpoint for restore operations
 	destination := dmm.Destination
 	if strings.TrimSpace(destination.RestoreCmd) == "" {
-		return fmt.Errorf("restore command is not defined for destination")
+		return nil, fmt.Errorf("restore command is not defined for destination")
+	}
+	if dmm.restoreRefusedOnDryRun() {
+		return nil, fmt.Errorf("restore refused: RsyncOptions.DryRun is set (set WorkflowOptions.AllowRestoreOnDryRun to run it)")
 	}
 
 	// Determine the destination path for display
@@ -371,13 +2362,17 @@ func Restore(dmm DataMigrationModel) error {
 		fmt.Println("Executing restore command locally...")
 	}
 
-	fmt.Printf("Restore command: %s\n", destination.RestoreCmd)
-	output, err := executeCommand(destination.RestoreCmd, destination, dmm.RsyncOptions)
+	fmt.Printf("Restore command: %s\n", redactSecrets(destination.RestoreCmd))
+	output, err := runStageCommand(ctx, dmm, StageRestore, destination.RestoreCmd, destination, dmm.WorkflowOptions.RestoreTimeout)
 	if err != nil {
-		return fmt.Errorf("restore command execution failed for destination '%s': %w\nOutput:\n%s", destinationDataPath, err, string(output))
+		return output, newOperationError(dmm, StageRestore, fmt.Sprintf("restore command execution failed for destination '%s'", destinationDataPath),
+			[]string{destination.RestoreCmd}, output, err)
 	}
 
-	// Show output summary
+	// Show output summary (unless it was already streamed)
+	if dmm.WorkflowOptions.StreamCommandOutput {
+		return output, nil
+	}
 	outputStr := string(output)
 	if len(outputStr) > 200 {
 		// Truncate very long output for display
@@ -385,39 +2380,461 @@ func Restore(dmm DataMigrationModel) error {
 	} else if len(outputStr) > 0 {
 		fmt.Printf("Restore command output: %s\n", outputStr)
 	}
-	return nil
+	return output, nil
+}
+
+// prepareDestination executes the destination PreTransferCmd (e.g., stopping services,
+// clearing old data, creating directories) and returns its output.
+func prepareDestination(ctx context.Context, dmm DataMigrationModel) ([]byte, error) {
+	destination := dmm.Destination
+	if strings.TrimSpace(destination.PreTransferCmd) == "" {
+		return nil, fmt.Errorf("pre-transfer command is not defined for destination")
+	}
+
+	fmt.Printf("Pre-transfer command: %s\n", redactSecrets(destination.PreTransferCmd))
+	output, err := runStageCommand(ctx, dmm, StagePrepare, destination.PreTransferCmd, destination, dmm.WorkflowOptions.PreTransferTimeout)
+	if err != nil {
+		return output, newOperationError(dmm, StagePrepare, fmt.Sprintf("pre-transfer command execution failed for destination '%s'", destination.displayPath()),
+			[]string{destination.PreTransferCmd}, output, err)
+	}
+	return output, nil
 }
 
 // MigrateData manages the complete data migration workflow:
-// 1. If Source.BackupCmd is available, perform Backup
-// 2. Always perform Transfer
-// 3. If Destination.RestoreCmd is available, perform Restore
+//  0. If any preflight check is enabled, perform Preflight
+//  1. If Source.BackupCmd is available, perform Backup
+//     (and run Destination.PreTransferCmd, concurrently if ConcurrentPreparation is set)
+//  2. Always perform Transfer
+//  3. If Destination.RestoreCmd is available, perform Restore
+//
 // This provides a simple one-call approach to handle the entire data migration pipeline.
 func MigrateData(dmm DataMigrationModel) error {
-	// Step 1: Check and perform backup if BackupCmd is defined
-	if strings.TrimSpace(dmm.Source.BackupCmd) != "" {
-		fmt.Println("Step 1: Backing up data...")
-		if err := Backup(dmm); err != nil {
-			return fmt.Errorf("backup operation failed: %w", err)
+	return MigrateDataContext(context.Background(), dmm)
+}
+
+// MigrateDataContext is like MigrateData but aborts the migration when ctx is canceled (e.g., on
+// SIGTERM): the running command (backup, transfer, restore, etc.) is killed and the next step is not
+// started. The error then matches ctx.Err() with errors.Is.
+func MigrateDataContext(ctx context.Context, dmm DataMigrationModel) error {
+	_, err := MigrateDataWithReportContext(ctx, dmm)
+	return err
+}
+
+// MigrateDataWithReport runs the same workflow as MigrateData and returns a structured report of the run.
+// The report is returned even when the migration fails, recording the stages completed so far.
+// If WorkflowOptions.PrintSummary is set, a human-readable summary is printed at the end.
+// If WorkflowOptions.StatusSocket is set, the status of the run is served on that socket while it runs.
+// If WorkflowOptions.StateFile is set, stages completed by a previous run of the same task are skipped.
+func MigrateDataWithReport(dmm DataMigrationModel) (*MigrationReport, error) {
+	return MigrateDataWithReportContext(context.Background(), dmm)
+}
+
+// MigrateDataWithReportContext is like MigrateDataWithReport but aborts the migration when ctx is
+// canceled, like MigrateDataContext. The report records the stages completed before.
+func MigrateDataWithReportContext(ctx context.Context, dmm DataMigrationModel) (*MigrationReport, error) {
+	report := newMigrationReport(dmm)
+	if dmm.WorkflowOptions.BypassProbeCache {
+		dmm.RsyncOptions.probes = nil
+	}
+	dmm.attachAuditTrail()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if socket := strings.TrimSpace(dmm.WorkflowOptions.StatusSocket); socket != "" {
+		report.monitor = newStatusMonitor(report.StartTime, cancel)
+		server, err := startStatusServer(socket, report.monitor)
+		if err != nil {
+			err = fmt.Errorf("failed to start status server: %w", err)
+			report.finish(err)
+			return report, err
+		}
+		defer server.close()
+		fmt.Printf("Serving migration status on %s\n", socket)
+
+		onProgress := dmm.RsyncOptions.onProgress
+		dmm.RsyncOptions.onProgress = func(p ProgressEvent) {
+			if onProgress != nil {
+				onProgress(p)
+			}
+			report.monitor.progress(p)
+		}
+		dmm.RsyncOptions.onRateLimitWait = report.monitor.rateLimited
+	}
+
+	decisions, err := dmm.confirmDangerousOperations(ctx)
+	report.Confirmations = decisions
+	if err != nil {
+		report.finish(err)
+		return report, err
+	}
+
+	var state *migrationState
+	if stateFile := strings.TrimSpace(dmm.WorkflowOptions.StateFile); stateFile != "" {
+		var err error
+		state, err = loadMigrationState(stateFile, dmm)
+		if err == nil {
+			err = state.prepareStaging(&dmm)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to prepare restartable migration: %w", err)
+			report.finish(err)
+			return report, err
+		}
+		if len(state.Completed) > 0 {
+			fmt.Printf("Resuming migration from state file %s (completed stages: %s)\n", stateFile, joinStages(state.Completed))
+		}
+	}
+
+	var recorder *commandRecorder
+	if recordFile := strings.TrimSpace(dmm.WorkflowOptions.RecordFile); recordFile != "" {
+		recorder = &commandRecorder{}
+		dmm.RsyncOptions.recorder = recorder
+		defer func() {
+			if err := recorder.write(recordFile, dmm); err != nil {
+				fmt.Printf("Warning: failed to write record bundle: %v\n", err)
+			}
+		}()
+	}
+
+	// Temporary resources left behind by a failure, cancellation, or panic are cleaned up at the end
+	cleanups := &cleanupRegistry{}
+	dmm.RsyncOptions.cleanups = cleanups
+	defer cleanups.run()
+
+	// Every rsync stage (dry run, transfer, verification) shares the filter file
+	dmm, releaseFilters, err := spillFilterRules(dmm)
+	if err != nil {
+		report.finish(err)
+		return report, err
+	}
+	defer releaseFilters()
+
+	// Connections refused by sshd's MaxStartups throttling are counted for tuning the hosts or the concurrency
+	var throttledConnections atomic.Int64
+	dmm.RsyncOptions.onSSHThrottled = func() { throttledConnections.Add(1) }
+
+	err = migrateData(ctx, dmm, report, state)
+	report.addCleanups(cleanups.run())
+	if report.SSHThrottled = throttledConnections.Load(); report.SSHThrottled > 0 {
+		report.addWarnings(fmt.Sprintf("sshd refused %d connection(s) under MaxStartups throttling; lower the concurrency, enable RsyncOptions.SSHMultiplexing, or raise MaxStartups", report.SSHThrottled))
+	}
+	if err == nil && state != nil {
+		state.finish(dmm.RsyncOptions)
+	}
+	report.finish(err)
+	if historyDir := strings.TrimSpace(dmm.WorkflowOptions.ReportHistoryDir); historyDir != "" {
+		compareWithHistory(historyDir, dmm, report)
+	}
+
+	if dmm.WorkflowOptions.PrintSummary {
+		fmt.Println()
+		PrintSummary(os.Stdout, *report)
+	}
+	return report, err
+}
+
+// migrateData executes the workflow steps and records each stage in the report.
+// The workflow stops before the next step once ctx is canceled; running commands are killed.
+// Stages completed according to state (which may be nil) are skipped, and newly completed stages are recorded in it.
+func migrateData(ctx context.Context, dmm DataMigrationModel, report *MigrationReport, state *migrationState) error {
+	// Dry-run listings are shared by all consumers within this run
+	dryRuns := newDryRunCache(dmm.RsyncOptions.Verbose)
+
+	if dmm.RsyncOptions.DryRun {
+		fmt.Printf("*** %s ***\n", dryRunBanner)
+		report.addWarnings(dryRunBanner)
+	}
+
+	// Report heuristic configuration warnings; they never stop the migration
+	for _, warning := range Lint(dmm) {
+		fmt.Printf("Warning: %s\n", warning)
+		report.addWarnings(warning)
+	}
+
+	// Download a URL source first, so that every stage works on the staged artifact
+	if dmm.Source.isURL() && !skipCompleted(state, StageTransfer) {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("migration canceled before fetching the source: %w", err)
+		}
+		release := func() {}
+		err := report.runStage(StageFetch, func() error {
+			fetched, result, releaseFetched, err := fetchURLSource(ctx, report.stageTask(dmm, StageFetch))
+			if err != nil {
+				return err
+			}
+			release = releaseFetched
+			report.Fetch = result
+			dmm.Source = fetched.Source
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("fetching the source failed: %w", err)
+		}
+		defer release()
+	}
+
+	// Resolve the symlinked data paths, so that every stage works on the real paths
+	resolved, err := dmm.resolveSymlinks(ctx)
+	if err != nil {
+		return err
+	}
+	report.ResolvedSourcePath = resolved
+
+	// Step 0: Run preflight checks if any are enabled (or required by the options)
+	if dmm.needsPreflight() {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("migration canceled before the preflight checks: %w", err)
+		}
+		fmt.Println("Step 0: Running preflight checks...")
+		err := report.runStage(StagePreflight, func() error {
+			preflightReport, err := Preflight(report.stageTask(dmm, StagePreflight))
+			report.Preflight = preflightReport
+			if preflightReport != nil {
+				report.addWarnings(preflightReport.Warnings...)
+			}
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("preflight check failed: %w", err)
+		}
+		fmt.Println("Preflight checks passed!")
+	}
+
+	// Check that the services are healthy before touching anything
+	if dmm.hasHealthCmd() {
+		fmt.Println("Checking endpoint health...")
+		if err := runHealthChecks(ctx, dmm, report, HealthBefore); err != nil {
+			return fmt.Errorf("health check failed: %w", err)
+		}
+	}
+
+	hasBackup := strings.TrimSpace(dmm.Source.BackupCmd) != "" && !skipCompleted(state, StageBackup)
+	hasPreTransfer := strings.TrimSpace(dmm.Destination.PreTransferCmd) != "" && !skipCompleted(state, StagePrepare)
+	if err := ctx.Err(); err != nil && (hasBackup || hasPreTransfer) {
+		return fmt.Errorf("migration canceled before the backup: %w", err)
+	}
+	if hasBackup && hasPreTransfer && dmm.WorkflowOptions.ConcurrentPreparation && !sameHost(dmm.backupEndpoint(), dmm.Destination) {
+		// Step 1: Back up the source and prepare the destination at the same time
+		fmt.Println("Step 1: Backing up data and preparing destination concurrently...")
+		if err := runConcurrentPreparation(ctx, dmm, report); err != nil {
+			return err
+		}
+		if err := state.markCompleted(StageBackup); err != nil {
+			return err
+		}
+		if err := state.markCompleted(StagePrepare); err != nil {
+			return err
+		}
+		fmt.Println("Backup and destination preparation completed successfully!")
+		dryRuns.invalidate() // The backup may have changed the source data
+	} else {
+		// Step 1: Check and perform backup if BackupCmd is defined
+		if hasBackup {
+			fmt.Println("Step 1: Backing up data...")
+			err := report.runCommandStage(StageBackup, func() ([]byte, error) { return backup(ctx, report.stageTask(dmm, StageBackup)) })
+			if err != nil {
+				return fmt.Errorf("backup operation failed: %w", err)
+			}
+			if err := state.markCompleted(StageBackup); err != nil {
+				return err
+			}
+			fmt.Println("Backup completed successfully!")
+			dryRuns.invalidate() // The backup may have changed the source data
+		}
+
+		// Prepare the destination if PreTransferCmd is defined
+		if hasPreTransfer {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("migration canceled before destination preparation: %w", err)
+			}
+			fmt.Println("Preparing destination...")
+			err := report.runCommandStage(StagePrepare, func() ([]byte, error) { return prepareDestination(ctx, report.stageTask(dmm, StagePrepare)) })
+			if err != nil {
+				return fmt.Errorf("destination preparation failed: %w", err)
+			}
+			if err := state.markCompleted(StagePrepare); err != nil {
+				return err
+			}
+			fmt.Println("Destination preparation completed successfully!")
+		}
+	}
+
+	// Audit the destination paths using the dry-run file listing if enabled
+	if dmm.WorkflowOptions.PathAudit.Enabled {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("migration canceled before the path audit: %w", err)
+		}
+		fmt.Println("Auditing destination paths...")
+		err := report.runStage(StagePathAudit, func() error {
+			warnings, err := runPathAudit(report.stageTask(dmm, StagePathAudit), dryRuns)
+			for _, warning := range warnings {
+				fmt.Printf("Warning: %s\n", warning)
+			}
+			report.addWarnings(warnings...)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("path audit failed: %w", err)
+		}
+	}
+
+	// Preview what the restore will operate on using the dry-run file listing if enabled
+	if dmm.WorkflowOptions.RestorePreview && strings.TrimSpace(dmm.Destination.RestoreCmd) != "" && !skipCompleted(state, StageRestore) {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("migration canceled before the restore preview: %w", err)
+		}
+		fmt.Println("Previewing the restore inputs...")
+		err := report.runStage(StageRestorePreview, func() error {
+			inputs, warnings, err := runRestorePreview(ctx, report.stageTask(dmm, StageRestorePreview), dryRuns)
+			report.RestorePreview = inputs
+			for _, input := range inputs {
+				fmt.Printf("  %s\n", input)
+			}
+			for _, warning := range warnings {
+				fmt.Printf("Warning: %s\n", warning)
+			}
+			report.addWarnings(warnings...)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("restore preview failed: %w", err)
 		}
-		fmt.Println("Backup completed successfully!")
 	}
 
 	// Step 2: Always perform the data transfer (core functionality)
-	fmt.Println("Step 2: Transferring data to destination...")
-	if err := Transfer(dmm); err != nil {
-		return fmt.Errorf("data transfer failed: %w", err)
+	if !skipCompleted(state, StageTransfer) {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("migration canceled before the transfer: %w", err)
+		}
+		if dmm.WorkflowOptions.AutoTune.Enabled {
+			err := report.runStage(StageLinkProbe, func() error {
+				result, err := runAutoTune(ctx, report.stageTask(dmm, StageLinkProbe), &dmm.RsyncOptions)
+				report.AutoTune = result
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("auto-tune failed: %w", err)
+			}
+		}
+		fmt.Println("Step 2: Transferring data to destination...")
+		report.EffectiveOptions = effectiveRsyncArgs(dmm)
+		err := report.runStage(StageTransfer, func() error {
+			result, attempts, err := transferWithFallback(ctx, report.stageTask(dmm, StageTransfer))
+			report.Transfer = result
+			report.TransferAttempts = attempts
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("data transfer failed: %w", err)
+		}
+		if err := state.markCompleted(StageTransfer); err != nil {
+			return err
+		}
+		fmt.Println("Data transfer completed successfully!")
+
+		// Verify a random sample of the transferred files if requested
+		if dmm.WorkflowOptions.SampledVerify.enabled() {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("migration canceled before the sampled verification: %w", err)
+			}
+			fmt.Println("Verifying a sample of the transferred files...")
+			err := report.runStage(StageSampledVerify, func() error {
+				result, err := sampledVerify(ctx, report.stageTask(dmm, StageSampledVerify), report.Transfer.files)
+				report.SampledVerify = result
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("sampled verification failed: %w", err)
+			}
+		}
 	}
-	fmt.Println("Data transfer completed successfully!")
 
 	// Step 3: Check and perform restore if RestoreCmd is defined
-	if strings.TrimSpace(dmm.Destination.RestoreCmd) != "" {
+	if strings.TrimSpace(dmm.Destination.RestoreCmd) != "" && dmm.restoreRefusedOnDryRun() {
+		warning := "restore skipped: RsyncOptions.DryRun is set (set WorkflowOptions.AllowRestoreOnDryRun to run it)"
+		fmt.Printf("Warning: %s\n", warning)
+		report.addWarnings(warning)
+	} else if strings.TrimSpace(dmm.Destination.RestoreCmd) != "" && !skipCompleted(state, StageRestore) {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("migration canceled before the restore: %w", err)
+		}
 		fmt.Println("Step 3: Restoring data...")
-		if err := Restore(dmm); err != nil {
+		err := report.runCommandStage(StageRestore, func() ([]byte, error) { return restore(ctx, report.stageTask(dmm, StageRestore)) })
+		if err != nil {
 			return fmt.Errorf("restore operation failed: %w", err)
 		}
+		if err := state.markCompleted(StageRestore); err != nil {
+			return err
+		}
 		fmt.Println("Restore completed successfully!")
 	}
 
+	// Check that the services came up after the migration
+	if dmm.hasHealthCmd() {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("migration canceled before the health check: %w", err)
+		}
+		fmt.Println("Checking endpoint health after the migration...")
+		if err := runHealthChecks(ctx, dmm, report, HealthAfter); err != nil {
+			return fmt.Errorf("health check after the migration failed: %w", err)
+		}
+	}
+
 	return nil
 }
+
+// dryRunBanner marks the output and report of a migration whose transfer is an rsync dry run.
+const dryRunBanner = "DRY RUN — no data will be modified by the transfer"
+
+// restoreRefusedOnDryRun reports whether the restore must not run because the transfer is a dry run.
+func (task *DataMigrationModel) restoreRefusedOnDryRun() bool {
+	return task.RsyncOptions.DryRun && !task.WorkflowOptions.AllowRestoreOnDryRun
+}
+
+// sameHost reports whether two endpoints run their commands on the same host.
+func sameHost(a, b EndpointDetails) bool {
+	return strings.TrimSpace(a.HostIP) == strings.TrimSpace(b.HostIP) && a.SSHPort == b.SSHPort
+}
+
+// runConcurrentPreparation runs the source backup and the destination pre-transfer command
+// concurrently, records both stages, and returns an error naming both outcomes if either fails.
+// A failure on one side cancels the other.
+func runConcurrentPreparation(ctx context.Context, dmm DataMigrationModel, report *MigrationReport) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg                        sync.WaitGroup
+		backupStage, prepareStage StageReport
+		backupErr, prepareErr     error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		backupStage, backupErr = report.timeCommandStage(StageBackup, func() ([]byte, error) { return backup(ctx, report.stageTask(dmm, StageBackup)) })
+		if backupErr != nil {
+			cancel()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		prepareStage, prepareErr = report.timeCommandStage(StagePrepare, func() ([]byte, error) { return prepareDestination(ctx, report.stageTask(dmm, StagePrepare)) })
+		if prepareErr != nil {
+			cancel()
+		}
+	}()
+	wg.Wait()
+	report.Stages = append(report.Stages, backupStage, prepareStage)
+
+	if backupErr == nil && prepareErr == nil {
+		return nil
+	}
+	outcome := func(err error) string {
+		if err == nil {
+			return "succeeded"
+		}
+		return "failed"
+	}
+	return fmt.Errorf("concurrent preparation failed (backup %s, destination preparation %s): %w",
+		outcome(backupErr), outcome(prepareErr), errors.Join(backupErr, prepareErr))
+}
@@ -0,0 +1,162 @@
+package transx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// PreparedMigration is the handle returned by Prepare and consumed by Commit.
+// It carries the task and the report of the preparation phase.
+type PreparedMigration struct {
+	Task   DataMigrationModel
+	Report *MigrationReport // Report of the preparation phase
+
+	ownedStagingDir string // Relay staging directory created by Prepare and removed by Commit
+	committed       bool
+}
+
+// Prepare runs the first phase of a two-phase (prepare/commit) migration while the source
+// application is still live: backup (if Source.BackupCmd is defined), a full transfer, and a
+// checksum verification of the destination. The restore command is not run.
+// In relay mode, the staging directory is kept (unless StagingDir is already set) so that
+// Commit only needs to transfer the final delta.
+// The task is validated as Commit will transfer it (with Delete) before anything runs, so that a
+// task Commit would refuse fails here rather than after the source application was quiesced.
+func Prepare(task DataMigrationModel) (*PreparedMigration, error) {
+	if task.RsyncOptions.RelayStreaming {
+		// The stream leaves the staging directory empty, so Verify would compare nothing, and the
+		// Delete of Commit is one of the options the stream cannot honor
+		return nil, fmt.Errorf("RelayStreaming cannot be combined with Prepare/Commit; disable RelayStreaming to relay through a staging directory")
+	}
+	if err := validateCommitTask(task); err != nil {
+		return nil, err
+	}
+	task.attachAuditTrail()
+	prepared := &PreparedMigration{Task: task}
+	if task.Topology() == RemoteToRemoteRelay && strings.TrimSpace(task.RsyncOptions.StagingDir) == "" {
+		dir, err := makeSessionTempDir(task.RsyncOptions, "transx-relay-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create relay staging directory for prepare phase: %w", err)
+		}
+		prepared.ownedStagingDir = dir
+		prepared.Task.RsyncOptions.StagingDir = dir
+	}
+
+	report := newMigrationReport(prepared.Task)
+	err := prepare(prepared.Task, report)
+	report.finish(err)
+	prepared.Report = report
+	if err != nil {
+		prepared.cleanup()
+		return nil, err
+	}
+	return prepared, nil
+}
+
+// validateCommitTask validates the task with Delete, as Commit transfers it. The dangerous operations
+// WorkflowOptions.Confirmer is asked about in Commit are taken as approved.
+func validateCommitTask(task DataMigrationModel) error {
+	task.RsyncOptions.Delete = true
+	if task.WorkflowOptions.Confirmer != nil {
+		for _, p := range task.pendingConfirmations() {
+			*p.force = true
+		}
+	}
+	if err := Validate(task); err != nil {
+		return fmt.Errorf("rsync task validation failed (Commit transfers with Delete): %w", err)
+	}
+	return nil
+}
+
+// prepare executes the steps of the preparation phase and records each stage in the report.
+func prepare(task DataMigrationModel, report *MigrationReport) error {
+	if strings.TrimSpace(task.Source.BackupCmd) != "" {
+		fmt.Println("Prepare: Backing up data...")
+		if err := report.runStage(StageBackup, func() error { return Backup(report.stageTask(task, StageBackup)) }); err != nil {
+			return fmt.Errorf("backup operation failed: %w", err)
+		}
+	}
+
+	fmt.Println("Prepare: Transferring data to destination...")
+	report.EffectiveOptions = effectiveRsyncArgs(task)
+	err := report.runStage(StageTransfer, func() error {
+		result, attempts, err := transferWithFallback(context.Background(), report.stageTask(task, StageTransfer))
+		report.Transfer = result
+		report.TransferAttempts = attempts
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("data transfer failed: %w", err)
+	}
+
+	fmt.Println("Prepare: Verifying destination...")
+	report.VerifyAlgorithm = task.RsyncOptions.ChecksumAlgorithm
+	if err := report.runStage(StageVerify, func() error { return Verify(report.stageTask(task, StageVerify)) }); err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	fmt.Println("Prepare phase completed successfully!")
+	return nil
+}
+
+// Commit runs the second phase of a two-phase migration, after the source application has been
+// quiesced: a final delta transfer with --delete (so the destination exactly mirrors the source),
+// followed by the restore/promote command (Destination.RestoreCmd) if defined.
+// The dangerous operations of the final transfer are confirmed with WorkflowOptions.Confirmer first.
+// A staging directory created by Prepare is removed once Commit returns.
+func Commit(prepared *PreparedMigration) (*MigrationReport, error) {
+	if prepared == nil {
+		return nil, fmt.Errorf("prepared migration must not be nil")
+	}
+	if prepared.committed {
+		return nil, fmt.Errorf("prepared migration has already been committed")
+	}
+	prepared.committed = true
+	defer prepared.cleanup()
+
+	task := prepared.Task
+	task.RsyncOptions.Delete = true
+
+	report := newMigrationReport(task)
+	decisions, err := task.confirmDangerousOperations(context.Background())
+	report.Confirmations = decisions
+	if err == nil {
+		err = commit(task, report)
+	}
+	report.finish(err)
+	return report, err
+}
+
+// commit executes the steps of the commit phase and records each stage in the report.
+func commit(task DataMigrationModel, report *MigrationReport) error {
+	fmt.Println("Commit: Transferring final delta to destination...")
+	report.EffectiveOptions = effectiveRsyncArgs(task)
+	err := report.runStage(StageTransfer, func() error {
+		result, attempts, err := transferWithFallback(context.Background(), report.stageTask(task, StageTransfer))
+		report.Transfer = result
+		report.TransferAttempts = attempts
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("final data transfer failed: %w", err)
+	}
+
+	if strings.TrimSpace(task.Destination.RestoreCmd) != "" {
+		fmt.Println("Commit: Restoring/promoting data...")
+		if err := report.runStage(StageRestore, func() error { return Restore(report.stageTask(task, StageRestore)) }); err != nil {
+			return fmt.Errorf("restore operation failed: %w", err)
+		}
+	}
+	fmt.Println("Commit phase completed successfully!")
+	return nil
+}
+
+// cleanup removes the staging directory owned by the prepared migration, if any.
+func (p *PreparedMigration) cleanup() {
+	if p.ownedStagingDir != "" {
+		if err := removeRelayStagingDir(p.Task.RsyncOptions, p.ownedStagingDir); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+		p.ownedStagingDir = ""
+	}
+}
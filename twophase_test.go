@@ -0,0 +1,93 @@
+package transx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A task Commit would refuse fails in Prepare, before the backup command runs.
+func TestPrepareValidatesBeforeBackup(t *testing.T) {
+	root := t.TempDir()
+	marker := filepath.Join(root, "backup-ran")
+	task := DataMigrationModel{
+		Source: EndpointDetails{
+			DataPath:            filepath.Join(root, "src") + "/",
+			AdditionalDataPaths: []string{filepath.Join(root, "logs") + "/"},
+			BackupCmd:           "touch " + shellQuote(marker),
+		},
+		Destination:  EndpointDetails{DataPath: filepath.Join(root, "dst") + "/"},
+		RsyncOptions: RsyncOption{CommandRunner: &fixtureRunner{t: t}},
+	}
+
+	_, err := Prepare(task)
+	if err == nil || !strings.Contains(err.Error(), "ForceMultiSourceDelete") {
+		t.Errorf("Prepare() error = %v, want the Delete of Commit refused", err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("backup command ran for an invalid task (%v)", err)
+	}
+}
+
+// Commit asks the Confirmer about the dangerous operations of its Delete transfer, and transfers
+// nothing if one is declined.
+func TestCommitConfirmsDelete(t *testing.T) {
+	root := t.TempDir()
+	src, logs, dst := filepath.Join(root, "src")+"/", filepath.Join(root, "logs")+"/", filepath.Join(root, "dst")+"/"
+	writeFixture(t, src, map[string]string{"data.txt": "data\n"})
+	writeFixture(t, logs, map[string]string{"app.log": "log\n"})
+	runner := &fixtureRunner{t: t}
+	var asked []string
+	task := DataMigrationModel{
+		Source:       EndpointDetails{DataPath: src, AdditionalDataPaths: []string{logs}},
+		Destination:  EndpointDetails{DataPath: dst},
+		RsyncOptions: RsyncOption{CommandRunner: runner},
+		WorkflowOptions: WorkflowOption{Confirmer: ConfirmerFunc(func(ctx context.Context, req ConfirmationRequest) (bool, error) {
+			asked = append(asked, req.Code)
+			return false, nil
+		})},
+	}
+
+	prepared, err := Prepare(task)
+	if err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+	transfers := len(runner.rsyncs)
+	report, err := Commit(prepared)
+	if err == nil || !strings.Contains(err.Error(), ConfirmMultiSourceDelete) {
+		t.Errorf("Commit() error = %v, want the declined %s", err, ConfirmMultiSourceDelete)
+	}
+	if len(asked) != 1 || asked[0] != ConfirmMultiSourceDelete {
+		t.Errorf("Confirmer asked about %q, want %q", asked, ConfirmMultiSourceDelete)
+	}
+	if len(report.Confirmations) != 1 || report.Confirmations[0].Approved {
+		t.Errorf("report.Confirmations = %+v, want the declined confirmation", report.Confirmations)
+	}
+	if len(runner.rsyncs) != transfers {
+		t.Errorf("Commit ran rsync %d time(s) after the confirmation was declined", len(runner.rsyncs)-transfers)
+	}
+}
+
+// RelayStreaming is refused by Prepare, since Verify would compare an empty staging directory and
+// Commit could never run the stream with Delete.
+func TestPrepareCommitRefusesRelayStreaming(t *testing.T) {
+	runner := &fakeRunner{}
+	task := DataMigrationModel{
+		Source:       EndpointDetails{Username: "user", HostIP: "10.0.0.1", DataPath: "/data/", BackupCmd: "true"},
+		Destination:  EndpointDetails{Username: "user", HostIP: "10.0.0.2", DataPath: "/data/"},
+		RsyncOptions: RsyncOption{RelayStreaming: true, CommandRunner: runner},
+	}
+
+	prepared, err := Prepare(task)
+	if err == nil || !strings.Contains(err.Error(), "RelayStreaming") {
+		t.Fatalf("Prepare() error = %v, want RelayStreaming refused", err)
+	}
+	if _, err := Commit(prepared); err == nil {
+		t.Error("Commit() succeeded without a prepared migration")
+	}
+	if cmds := runner.commands(); len(cmds) != 0 {
+		t.Errorf("commands run = %q, want none", cmds)
+	}
+}
@@ -0,0 +1,357 @@
+package transx
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// urlDigestAlgorithms are the hash functions accepted in EndpointDetails.URLDigest.
+var urlDigestAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"sha1":   sha1.New,
+	"md5":    md5.New,
+}
+
+// FetchResult records the download of a URL source (see EndpointDetails.URL).
+type FetchResult struct {
+	URL         string
+	StagedPath  string        // Local staging file the transfer read
+	Bytes       int64         // Size of the artifact
+	ResumedFrom int64         // Bytes kept from an interrupted download (0 if it started over)
+	Reused      bool          // Whether a verified artifact staged by an earlier run was transferred without downloading
+	Verified    bool          // Whether the artifact matched URLDigest
+	Duration    time.Duration // Time spent downloading and verifying
+}
+
+// isURL reports whether the endpoint is a URL source.
+func (e *EndpointDetails) isURL() bool {
+	return strings.TrimSpace(e.URL) != ""
+}
+
+// validateURLSource checks a URL source: an http or https URL whose artifact is verified against
+// URLDigest unless AllowUnverifiedURL is set. The endpoint fields naming a path or running commands
+// do not apply to it.
+func (task *DataMigrationModel) validateURLSource() error {
+	e := task.Source
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return fmt.Errorf("invalid URL '%s': %w", e.URL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("URL '%s' must use http or https", e.URL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("URL '%s' has no host", e.URL)
+	}
+	if urlArtifactName(u) == "" {
+		return fmt.Errorf("URL '%s' does not name a file (its path must not end with a slash)", e.URL)
+	}
+	if strings.TrimSpace(e.BackupCmd) != "" {
+		return fmt.Errorf("BackupCmd cannot run on a URL source")
+	}
+	var set []string
+	for _, f := range []struct {
+		name  string
+		isSet bool
+	}{
+		{"HostIP", e.isRemote()}, {"DataPath", strings.TrimSpace(e.DataPath) != ""}, {"AdditionalDataPaths", len(e.AdditionalDataPaths) > 0},
+		{"ContainerName", e.isContainer()}, {"PreTransferCmd", strings.TrimSpace(e.PreTransferCmd) != ""},
+	} {
+		if f.isSet {
+			set = append(set, f.name)
+		}
+	}
+	if len(set) > 0 {
+		return fmt.Errorf("a URL source does not take %s", strings.Join(set, ", "))
+	}
+	if strings.TrimSpace(e.URLDigest) == "" {
+		if !e.AllowUnverifiedURL {
+			return fmt.Errorf("URLDigest is required to verify the downloaded artifact (or set AllowUnverifiedURL to transfer it unverified)")
+		}
+		return nil
+	}
+	_, _, err = parseURLDigest(e.URLDigest)
+	return err
+}
+
+// parseURLDigest splits a digest of the form "<algorithm>:<hex>" and checks its length.
+func parseURLDigest(digest string) (newHash func() hash.Hash, sum []byte, err error) {
+	algorithm, value, ok := strings.Cut(strings.TrimSpace(digest), ":")
+	if !ok {
+		return nil, nil, fmt.Errorf("URLDigest '%s' must have the form <algorithm>:<hex> (e.g., sha256:...)", digest)
+	}
+	newHash, ok = urlDigestAlgorithms[strings.ToLower(algorithm)]
+	if !ok {
+		return nil, nil, fmt.Errorf("URLDigest algorithm '%s' is not supported (use sha256, sha512, sha1, or md5)", algorithm)
+	}
+	sum, err = hex.DecodeString(value)
+	if err != nil || len(sum) != newHash().Size() {
+		return nil, nil, fmt.Errorf("URLDigest '%s' is not a valid %s digest", digest, algorithm)
+	}
+	return newHash, sum, nil
+}
+
+// urlArtifactName returns the file name of the artifact, the last element of the URL path.
+func urlArtifactName(u *url.URL) string {
+	if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		return ""
+	}
+	return path.Base(u.Path)
+}
+
+// fetchURLSource downloads the artifact of a URL source into a local staging file and returns the
+// task with the staged file as its source, the fetch record, and a function removing the staging
+// directory if transx created it (a StagingDir is kept, so that the next run can resume or reuse the
+// download). The download is limited to DownloadBandwidthLimitKBps (or BandwidthLimitKBps).
+func fetchURLSource(ctx context.Context, task DataMigrationModel) (DataMigrationModel, *FetchResult, func(), error) {
+	start := time.Now()
+	opts := task.RsyncOptions
+	u, err := url.Parse(task.Source.URL)
+	if err != nil {
+		return task, nil, nil, err
+	}
+	dir, owned, err := urlStagingDir(opts)
+	if err != nil {
+		return task, nil, nil, err
+	}
+	release := func() {}
+	if owned {
+		release = opts.cleanups.track("URL source staging directory "+dir, func() error { return os.RemoveAll(dir) })
+	}
+	fail := func(err error) (DataMigrationModel, *FetchResult, func(), error) {
+		release()
+		return task, nil, nil, err
+	}
+
+	staged := filepath.Join(dir, urlArtifactName(u))
+	result := &FetchResult{URL: task.Source.URL, StagedPath: staged}
+	verify := strings.TrimSpace(task.Source.URLDigest) != ""
+	if verify && !owned {
+		if info, err := os.Stat(staged); err == nil && verifyURLDigest(staged, task.Source.URLDigest) == nil {
+			fmt.Printf("URL source: reusing the verified artifact staged at %s\n", staged)
+			result.Bytes, result.Reused, result.Verified = info.Size(), true, true
+		}
+	}
+	if !result.Reused {
+		fmt.Printf("URL source: downloading %s to %s...\n", task.Source.URL, staged)
+		if result.Bytes, result.ResumedFrom, err = downloadURL(ctx, task.Source.URL, staged+".part", opts.urlBandwidthLimit()); err != nil {
+			return fail(fmt.Errorf("failed to download '%s': %w", task.Source.URL, err))
+		}
+		if err := os.Rename(staged+".part", staged); err != nil {
+			return fail(fmt.Errorf("failed to stage the downloaded artifact: %w", err))
+		}
+		os.Remove(staged + ".part" + urlValidatorSuffix)
+		if verify {
+			if err := verifyURLDigest(staged, task.Source.URLDigest); err != nil {
+				os.Remove(staged)
+				return fail(err)
+			}
+			result.Verified = true
+		} else {
+			fmt.Printf("Warning: the artifact of %s is not verified (AllowUnverifiedURL is set)\n", task.Source.URL)
+		}
+	}
+	// The local rsync runs as LocalRunAs, which cannot read the files of the current user otherwise
+	if strings.TrimSpace(opts.LocalRunAs) != "" {
+		if err := errors.Join(os.Chmod(dir, 0755), os.Chmod(staged, 0644)); err != nil {
+			return fail(fmt.Errorf("failed to make the staged artifact readable for '%s': %w", opts.LocalRunAs, err))
+		}
+	}
+	result.Duration = time.Since(start)
+	fmt.Printf("URL source: %d bytes staged in %s\n", result.Bytes, result.Duration.Round(time.Millisecond))
+
+	task.Source = EndpointDetails{DataPath: staged}
+	return task, result, release, nil
+}
+
+// urlStagingDir returns the local directory of a downloaded URL artifact: StagingDir, created if
+// missing and owned by the caller, or a temporary directory owned (i.e., to be removed) by transx,
+// with SessionDirMode if created.
+func urlStagingDir(opts RsyncOption) (dir string, owned bool, err error) {
+	if strings.TrimSpace(opts.StagingDir) != "" {
+		if err := makeSessionDir(opts, opts.StagingDir); err != nil {
+			return "", false, fmt.Errorf("failed to create staging directory '%s': %w", opts.StagingDir, err)
+		}
+		return opts.StagingDir, false, nil
+	}
+	dir, err = makeSessionTempDir(opts, "transx-url-*")
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create temporary directory for the URL source: %w", err)
+	}
+	return dir, true, nil
+}
+
+// urlBandwidthLimit returns the limit of a URL download in KiB per second (0 if unlimited).
+func (o RsyncOption) urlBandwidthLimit() int {
+	if o.DownloadBandwidthLimitKBps > 0 {
+		return o.DownloadBandwidthLimitKBps
+	}
+	return o.BandwidthLimitKBps
+}
+
+// urlValidatorSuffix is appended to the path of a partial download to name the file holding the
+// validator (ETag or Last-Modified) of the artifact it is a part of.
+const urlValidatorSuffix = ".validator"
+
+// downloadURL downloads rawURL into partPath, resuming the bytes already there with a Range request
+// if the server supports it, and returns the size of the artifact and the bytes resumed from. The
+// validator of the response that started the download is kept next to partPath, and a resume sends
+// it in If-Range, so that an artifact changed on the server since is downloaded again rather than
+// spliced from two versions. Partial data without a validator is never resumed.
+func downloadURL(ctx context.Context, rawURL, partPath string, limitKBps int) (size, resumedFrom int64, err error) {
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	offset := info.Size()
+	validatorPath := partPath + urlValidatorSuffix
+	validator := ""
+	if offset > 0 {
+		if data, err := os.ReadFile(validatorPath); err == nil {
+			validator = strings.TrimSpace(string(data))
+		}
+		if validator == "" {
+			fmt.Println("URL source: the partial download cannot be matched to the artifact on the server; starting over")
+			offset = 0
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0 && strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)):
+		fmt.Printf("URL source: resuming the download after %d bytes\n", offset)
+		resumedFrom = offset
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 && resp.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", offset):
+		return offset, offset, nil // The interrupted download had received everything
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			fmt.Println("URL source: the artifact changed on the server since the interrupted download; starting over")
+		}
+		if err := file.Truncate(0); err != nil {
+			return 0, 0, err
+		}
+		if err := writeURLValidator(validatorPath, resp.Header); err != nil {
+			return 0, 0, err
+		}
+	default:
+		return 0, 0, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	if _, err := file.Seek(resumedFrom, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+
+	var body io.Reader = resp.Body
+	if limitKBps > 0 {
+		body = &throttledReader{ctx: ctx, r: resp.Body, bytesPerSecond: float64(limitKBps) * 1024, start: time.Now()}
+	}
+	n, err := io.Copy(file, body)
+	if err != nil {
+		return 0, 0, fmt.Errorf("download interrupted after %d bytes (a rerun with StagingDir resumes it): %w", resumedFrom+n, err)
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return 0, 0, fmt.Errorf("download ended after %d of %d bytes", n, resp.ContentLength)
+	}
+	return resumedFrom + n, resumedFrom, file.Close()
+}
+
+// writeURLValidator records the validator of the response starting a download at path: its strong
+// ETag, or else its Last-Modified date (a weak ETag cannot be used in If-Range). Without either, any
+// previous validator is removed, so that the download is not resumed.
+func writeURLValidator(path string, header http.Header) error {
+	validator := header.Get("ETag")
+	if strings.HasPrefix(validator, "W/") {
+		validator = ""
+	}
+	if validator == "" {
+		validator = header.Get("Last-Modified")
+	}
+	if validator == "" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(path, []byte(validator+"\n"), 0600)
+}
+
+// verifyURLDigest checks the staged artifact against the expected digest.
+func verifyURLDigest(file, digest string) error {
+	newHash, expected, err := parseURLDigest(digest)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("failed to read the staged artifact: %w", err)
+	}
+	if actual := h.Sum(nil); !strings.EqualFold(hex.EncodeToString(actual), hex.EncodeToString(expected)) {
+		return fmt.Errorf("the downloaded artifact does not match URLDigest %s (got %s); it was removed", digest, hex.EncodeToString(actual))
+	}
+	return nil
+}
+
+// throttledReader limits reads from r to bytesPerSecond on average since start.
+type throttledReader struct {
+	ctx            context.Context
+	r              io.Reader
+	bytesPerSecond float64
+	start          time.Time
+	n              int64
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	// Reads of at most a tenth of a second of data keep the rate smooth
+	if chunk := max(int(t.bytesPerSecond/10), 1); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.r.Read(p)
+	t.n += int64(n)
+	due := t.start.Add(time.Duration(float64(t.n) / t.bytesPerSecond * float64(time.Second)))
+	if wait := time.Until(due); wait > 0 {
+		select {
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,69 @@
+package transx
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A resumed download must never splice two versions of the artifact together.
+func TestDownloadURLResume(t *testing.T) {
+	oldContent := bytes.Repeat([]byte("old-"), 1000)
+	newContent := bytes.Repeat([]byte("new-"), 1000)
+	modified := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		etag        string // Of the artifact served
+		served      []byte
+		partial     []byte // Left by an interrupted download
+		validator   string // Recorded with the partial download ("" for none)
+		wantResumed int64
+	}{
+		{name: "unchanged artifact", etag: `"v1"`, served: oldContent, partial: oldContent[:1000], validator: `"v1"`, wantResumed: 1000},
+		{name: "changed artifact", etag: `"v2"`, served: newContent, partial: oldContent[:1000], validator: `"v1"`},
+		{name: "partial download without validator", etag: `"v1"`, served: oldContent, partial: oldContent[:1000]},
+		{name: "unchanged by Last-Modified", served: oldContent, partial: oldContent[:1000],
+			validator: modified.Format(http.TimeFormat), wantResumed: 1000},
+		{name: "complete partial download", etag: `"v1"`, served: oldContent, partial: oldContent, validator: `"v1"`, wantResumed: int64(len(oldContent))},
+		{name: "fresh download", etag: `"v1"`, served: oldContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.etag != "" {
+					w.Header().Set("ETag", tt.etag)
+				}
+				http.ServeContent(w, r, "dump.sql", modified, bytes.NewReader(tt.served))
+			}))
+			defer server.Close()
+			partPath := filepath.Join(t.TempDir(), "dump.sql.part")
+			if tt.partial != nil {
+				os.WriteFile(partPath, tt.partial, 0600)
+			}
+			if tt.validator != "" {
+				os.WriteFile(partPath+urlValidatorSuffix, []byte(tt.validator+"\n"), 0600)
+			}
+
+			size, resumedFrom, err := downloadURL(context.Background(), server.URL+"/dump.sql", partPath, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := os.ReadFile(partPath)
+			if !bytes.Equal(got, tt.served) || size != int64(len(tt.served)) {
+				t.Errorf("downloaded %d bytes (size %d) that differ from the served artifact", len(got), size)
+			}
+			if resumedFrom != tt.wantResumed {
+				t.Errorf("resumed from %d, want %d", resumedFrom, tt.wantResumed)
+			}
+			if validator, _ := os.ReadFile(partPath + urlValidatorSuffix); tt.etag != "" && string(validator) != tt.etag+"\n" {
+				t.Errorf("recorded validator %q, want %q", validator, tt.etag)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package transx
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ProcessUsage is the resource usage of the external processes run by transx (rsync, ssh, tar, and
+// local shells). For a remote command it is that of the local ssh client: the wall-clock time covers
+// the remote command, but its CPU time on the remote host is not measured.
+type ProcessUsage struct {
+	Processes int           // Processes that ran
+	Wall      time.Duration // Sum of the wall-clock durations of the processes (concurrent processes overlap)
+	User      time.Duration // User CPU time of the processes and their waited-for children
+	System    time.Duration // System CPU time of the processes and their waited-for children
+	MaxRSS    int64         // Largest peak resident set size of a process in bytes
+
+	// RusageUnavailable is set if the platform does not report the resource usage of processes,
+	// in which case MaxRSS (and possibly the CPU times) are zero.
+	RusageUnavailable bool
+}
+
+// usageAccumulator sums up the usage of the processes of a stage or transfer. It is nil-safe and
+// safe for concurrent use.
+type usageAccumulator struct {
+	mu    sync.Mutex
+	usage ProcessUsage
+}
+
+// record adds the usage of cmd, which finished and was started at start. A command that did not
+// start is ignored.
+func (a *usageAccumulator) record(cmd *exec.Cmd, start time.Time) {
+	if a == nil || cmd.ProcessState == nil {
+		return
+	}
+	wall := time.Since(start)
+	rss, ok := maxRSS(cmd.ProcessState)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.usage.Processes++
+	a.usage.Wall += wall
+	a.usage.User += cmd.ProcessState.UserTime()
+	a.usage.System += cmd.ProcessState.SystemTime()
+	a.usage.MaxRSS = max(a.usage.MaxRSS, rss)
+	a.usage.RusageUnavailable = a.usage.RusageUnavailable || !ok
+}
+
+// snapshot returns the usage so far, or nil if no process ran.
+func (a *usageAccumulator) snapshot() *ProcessUsage {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.usage.Processes == 0 {
+		return nil
+	}
+	usage := a.usage
+	return &usage
+}
+
+// stageUsage holds the process usage of each stage of a migration.
+type stageUsage struct {
+	mu     sync.Mutex
+	stages map[Stage]*usageAccumulator
+}
+
+// accumulator returns the accumulator of the stage, creating it if needed.
+func (s *stageUsage) accumulator(stage Stage) *usageAccumulator {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stages == nil {
+		s.stages = make(map[Stage]*usageAccumulator)
+	}
+	if s.stages[stage] == nil {
+		s.stages[stage] = &usageAccumulator{}
+	}
+	return s.stages[stage]
+}
+
+// stageTask returns a copy of the task whose processes are accounted to the stage of the report.
+func (r *MigrationReport) stageTask(dmm DataMigrationModel, stage Stage) DataMigrationModel {
+	dmm.RsyncOptions.usage = r.usage.accumulator(stage)
+	dmm.RsyncOptions.stage = stage
+	return dmm
+}
+
+// summary returns the CPU times and peak memory of the usage, e.g., "cpu 1.2s user, 300ms sys, 45.0 MiB max RSS".
+func (u *ProcessUsage) summary() string {
+	summary := fmt.Sprintf("cpu %s user, %s sys", u.User.Round(time.Millisecond), u.System.Round(time.Millisecond))
+	if u.RusageUnavailable {
+		return summary + " (rusage unavailable)"
+	}
+	return summary + fmt.Sprintf(", %.1f MiB max RSS", float64(u.MaxRSS)/(1<<20))
+}
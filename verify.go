@@ -0,0 +1,77 @@
+package transx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Verify checks that the destination holds the same data as the source by running an rsync
+// checksum dry-run (-n -c) with the task's options and failing if any file would be transferred.
+// In relay mode, the destination is compared against the local staging directory, so
+// RsyncOptions.StagingDir must be set to the directory used by the preceding transfer.
+// If RsyncOptions.ChecksumAlgorithm is set, every file is instead compared by checksums of that
+// algorithm computed on both sides (see verifyByChecksums), rather than by rsync's own checksums.
+func Verify(task DataMigrationModel) error {
+	task.attachAuditTrail()
+	if err := Validate(task); err != nil {
+		return fmt.Errorf("rsync task validation failed: %w", err)
+	}
+	if _, err := task.resolveSymlinks(context.Background()); err != nil {
+		return err
+	}
+	task, releaseFilters, err := spillFilterRules(task)
+	if err != nil {
+		return err
+	}
+	defer releaseFilters()
+
+	rsyncCmdPath, args := buildRsyncArgs(task)
+	args = withoutArg(args, "--remove-source-files") // A verification must never modify the source
+
+	sourceRsyncPaths := task.Source.rsyncSourcePaths()
+	if task.Topology() == RemoteToRemoteRelay {
+		if strings.TrimSpace(task.RsyncOptions.StagingDir) == "" {
+			return fmt.Errorf("verification in relay mode requires StagingDir to compare the destination against")
+		}
+		sourceRsyncPaths = []string{strings.TrimSuffix(task.RsyncOptions.StagingDir, "/") + "/"}
+	}
+	destinationRsyncPath := task.Destination.getRsyncPath()
+
+	endpoints := []EndpointDetails{task.Source, task.Destination}
+	if task.Topology() == RemoteToRemoteRelay {
+		endpoints = endpoints[1:] // Compared against the local staging directory
+	}
+	if err := throttle(context.Background(), task.RsyncOptions, endpoints...); err != nil {
+		return err
+	}
+	if task.RsyncOptions.ChecksumAlgorithm != "" {
+		return verifyByChecksums(context.Background(), task, rsyncCmdPath, args, sourceRsyncPaths, destinationRsyncPath)
+	}
+	differing, err := checksumDiffCount(context.Background(), task.RsyncOptions, rsyncCmdPath, args, sourceRsyncPaths, destinationRsyncPath)
+	if err != nil {
+		return err
+	}
+	if differing > 0 {
+		return fmt.Errorf("verification found %d file(s) differing between '%s' and '%s'",
+			differing, strings.Join(sourceRsyncPaths, "', '"), destinationRsyncPath)
+	}
+	return nil
+}
+
+// checksumDiffCount runs an rsync checksum dry-run from the sources to the destination and returns the number
+// of regular files whose content differs (i.e., that rsync would transfer).
+func checksumDiffCount(ctx context.Context, opts RsyncOption, rsyncCmdPath string, args []string, sourceRsyncPaths []string, destinationRsyncPath string) (int64, error) {
+	verifyArgs := append(append([]string{}, args...), "-n", "-c")
+	verifyArgs = append(verifyArgs, rsyncPathArgs(sourceRsyncPaths, destinationRsyncPath)...)
+	cmd := newLocalCommand(ctx, opts, rsyncCmdPath, verifyArgs...)
+	start := time.Now()
+	output, err := commandOutput(ctx, opts, cmd)
+	opts.usage.record(cmd, start)
+	if err != nil {
+		return 0, fmt.Errorf("rsync checksum comparison failed from '%s' to '%s'\nCommand: %s %s\nError: %w\nOutput:\n%s",
+			strings.Join(sourceRsyncPaths, "', '"), destinationRsyncPath, rsyncCmdPath, strings.Join(verifyArgs, " "), err, string(output))
+	}
+	return parseRsyncStats(string(output)).FilesTransferred, nil
+}
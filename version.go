@@ -0,0 +1,77 @@
+package transx
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// rsyncVersion is a parsed rsync version number.
+type rsyncVersion struct {
+	Major, Minor, Patch int
+}
+
+// String returns the version in "major.minor.patch" form.
+func (v rsyncVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// atLeast reports whether v is the same as or newer than major.minor.patch.
+func (v rsyncVersion) atLeast(major, minor, patch int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+	return v.Patch >= patch
+}
+
+// detectRsyncVersion runs "rsync --version" and parses the version from its first line,
+// e.g., "rsync  version 3.2.7  protocol version 31". It runs with the CommandRunner of opts if set.
+func detectRsyncVersion(opts RsyncOption, rsyncCmdPath string) (rsyncVersion, error) {
+	output, err := commandOutput(context.Background(), opts, exec.Command(rsyncCmdPath, "--version"))
+	if err != nil {
+		return rsyncVersion{}, fmt.Errorf("failed to run '%s --version': %w\nOutput:\n%s", rsyncCmdPath, err, string(output))
+	}
+	return parseRsyncVersion(string(output))
+}
+
+// parseRsyncVersion parses the output of "rsync --version".
+func parseRsyncVersion(output string) (rsyncVersion, error) {
+	fields := strings.Fields(output)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] != "version" {
+			continue
+		}
+		var v rsyncVersion
+		parts := strings.SplitN(strings.TrimLeft(fields[i+1], "v"), ".", 3)
+		nums := []*int{&v.Major, &v.Minor, &v.Patch}
+		for j, part := range parts {
+			// Drop suffixes such as "3.2.7dev"
+			digits := strings.TrimRightFunc(part, func(r rune) bool { return r < '0' || r > '9' })
+			n, err := strconv.Atoi(digits)
+			if err != nil {
+				return rsyncVersion{}, fmt.Errorf("unexpected rsync version '%s'", fields[i+1])
+			}
+			*nums[j] = n
+		}
+		return v, nil
+	}
+	return rsyncVersion{}, fmt.Errorf("rsync version not found in output: %q", output)
+}
+
+// requireRsyncVersion fails if the local rsync is older than major.minor.patch, naming the feature that needs it.
+// The detected version is memoized in the probes of opts.
+func requireRsyncVersion(opts RsyncOption, rsyncCmdPath string, major, minor, patch int, feature string) error {
+	v, err := cachedProbe(opts.probes, "rsync-version|"+rsyncCmdPath, func() (rsyncVersion, error) { return detectRsyncVersion(opts, rsyncCmdPath) })
+	if err != nil {
+		return err
+	}
+	if !v.atLeast(major, minor, patch) {
+		return fmt.Errorf("%s requires rsync %d.%d.%d or later (found %s)", feature, major, minor, patch, v)
+	}
+	return nil
+}